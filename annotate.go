@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// cssPathJS defines cssPath(el), a selector that uniquely matches el: its id
+// when that is unique, otherwise an nth-of-type chain up to such an ancestor
+const cssPathJS = `const cssPath = el => {
+	const parts = [];
+	for (; el && el.nodeType === 1 && el !== document.documentElement; el = el.parentElement) {
+		if (el.id && document.querySelectorAll('#' + CSS.escape(el.id)).length === 1) {
+			parts.unshift('#' + CSS.escape(el.id));
+			break;
+		}
+		const tag = el.tagName.toLowerCase();
+		const same = el.parentElement ? Array.from(el.parentElement.children).filter(c => c.tagName === el.tagName) : [];
+		parts.unshift(same.length > 1 ? tag + ':nth-of-type(' + (same.indexOf(el) + 1) + ')' : tag);
+	}
+	return parts.join(' > ');
+};`
+
+// interactiveJS defines interactiveElements, which lists the visible
+// interactive elements in document order, skipping ones nested in another
+// (a span in a button). Outside fullPage, only those in the viewport count.
+const interactiveJS = cssPathJS + `
+const interactiveElements = fullPage => {
+	const text = s => (s || '').replace(/\s+/g, ' ').trim();
+	const roleOf = el => {
+		if (el.getAttribute('role')) return el.getAttribute('role');
+		const tag = el.tagName.toLowerCase();
+		if (tag === 'a') return 'link';
+		if (tag === 'select') return 'combobox';
+		if (tag === 'textarea') return 'textbox';
+		if (tag === 'input') {
+			const t = (el.type || 'text').toLowerCase();
+			if (['button', 'submit', 'reset', 'image'].includes(t)) return 'button';
+			if (['checkbox', 'radio', 'range'].includes(t)) return t === 'range' ? 'slider' : t;
+			return 'textbox';
+		}
+		if (tag === 'summary') return 'button';
+		if (el.isContentEditable) return 'textbox';
+		return tag;
+	};
+	const nameOf = el => text(el.getAttribute('aria-label')) ||
+		(el.labels && el.labels.length ? text(el.labels[0].textContent) : '') ||
+		text(el.innerText).slice(0, 80) || text(el.alt || el.title || el.placeholder || el.value);
+	const valueOf = el => {
+		if (el.type === 'password') return el.value ? '••••' : '';
+		if (['checkbox', 'radio', 'submit', 'button', 'reset', 'image'].includes(el.type)) return '';
+		if (el.tagName === 'SELECT') return [...el.selectedOptions].map(o => text(o.textContent)).join(', ');
+		if ('value' in el && typeof el.value === 'string' && el.tagName !== 'BUTTON' && el.tagName !== 'LI') return el.value;
+		return el.getAttribute('aria-valuetext') || el.getAttribute('aria-valuenow') || '';
+	};
+	const statesOf = el => {
+		const aria = name => el.getAttribute('aria-' + name);
+		const states = [];
+		if (el.checked || aria('checked') === 'true' || aria('pressed') === 'true') states.push('checked');
+		if (el.disabled || aria('disabled') === 'true') states.push('disabled');
+		if (aria('expanded') === 'true' || (el.tagName === 'SUMMARY' && el.parentElement.open)) states.push('expanded');
+		if (aria('expanded') === 'false' || (el.tagName === 'SUMMARY' && !el.parentElement.open)) states.push('collapsed');
+		if (aria('selected') === 'true' || el.selected) states.push('selected');
+		if (el.required || aria('required') === 'true') states.push('required');
+		if (el.readOnly || aria('readonly') === 'true') states.push('readonly');
+		if (el === document.activeElement) states.push('focused');
+		return states;
+	};
+
+	const selector = 'a[href], button, input:not([type=hidden]), select, textarea, summary, [contenteditable=""], [contenteditable=true], ' +
+		'[role=button], [role=link], [role=checkbox], [role=radio], [role=tab], [role=menuitem], [role=option], [role=switch], [role=combobox], [onclick], [tabindex]:not([tabindex="-1"])';
+	const found = [];
+	for (const el of document.querySelectorAll(selector)) {
+		const r = el.getBoundingClientRect();
+		if (r.width < 1 || r.height < 1) continue;
+		const st = getComputedStyle(el);
+		if (st.visibility === 'hidden' || st.display === 'none') continue;
+		if (!fullPage && (r.bottom < 0 || r.right < 0 || r.top > innerHeight || r.left > innerWidth)) continue;
+		if (found.some(f => f.el.contains(el))) continue;
+		found.push({el, selector: cssPath(el), role: roleOf(el), name: nameOf(el), tag: el.tagName.toLowerCase(),
+			value: valueOf(el), states: statesOf(el),
+			box: {x: Math.round(r.left + scrollX), y: Math.round(r.top + scrollY), width: Math.round(r.width), height: Math.round(r.height)}});
+	}
+	return found;
+};`
+
+// annotateJS numbers the visible, enabled interactive elements, draws a
+// labelled box over each one and returns what the numbers refer to
+const annotateJS = `(fullPage) => {
+	` + interactiveJS + `
+	document.getElementById('__bb_marks')?.remove();
+	const layer = document.createElement('div');
+	layer.id = '__bb_marks';
+	layer.style.cssText = 'position:absolute;left:0;top:0;width:0;height:0;z-index:2147483647;pointer-events:none';
+
+	const marks = [];
+	for (const found of interactiveElements(fullPage)) {
+		if (found.el.disabled) continue;
+		const id = marks.length + 1;
+		const {x, y, width, height} = found.box;
+		const hue = (id * 47) % 360;
+		const box = document.createElement('div');
+		box.style.cssText = 'position:absolute;box-sizing:border-box;border:2px solid hsl(' + hue + ',90%,40%);' +
+			'left:' + x + 'px;top:' + y + 'px;width:' + width + 'px;height:' + height + 'px';
+		const label = document.createElement('div');
+		label.textContent = id;
+		label.style.cssText = 'position:absolute;left:-2px;top:-2px;transform:translateY(-100%);padding:0 3px;' +
+			'font:bold 11px/14px monospace;color:#fff;background:hsl(' + hue + ',90%,40%)';
+		if (y < 14) label.style.transform = 'none';
+		box.appendChild(label);
+		layer.appendChild(box);
+		marks.push({id, selector: found.selector, role: found.role, name: found.name, tag: found.tag, box: found.box});
+	}
+	document.body.appendChild(layer);
+	return marks;
+}`
+
+const removeMarksJS = `() => document.getElementById('__bb_marks')?.remove()`
+
+// mark is one numbered element in an annotated screenshot
+type mark struct {
+	ID       int    `json:"id"`
+	Selector string `json:"selector"`
+	Role     string `json:"role"`
+	Name     string `json:"name"`
+	Tag      string `json:"tag"`
+	Box      struct {
+		X      int `json:"x"`
+		Y      int `json:"y"`
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"box"`
+}
+
+// addMarks draws the set-of-marks overlay and returns the marked elements.
+// The caller must remove the overlay with removeMarks after capturing.
+func addMarks(page *rod.Page, fullPage bool) []mark {
+	res, err := page.Eval(annotateJS, fullPage)
+	if err != nil {
+		fatal("failed to annotate page: %v", err)
+	}
+	var marks []mark
+	if err := json.Unmarshal([]byte(res.Value.JSON("", "")), &marks); err != nil {
+		fatal("failed to annotate page: %v", err)
+	}
+	return marks
+}
+
+func removeMarks(page *rod.Page) {
+	_, _ = page.Eval(removeMarksJS)
+}
+
+// writeMarks saves the marks as a JSON sidecar next to the screenshot
+func writeMarks(file string, marks []mark) string {
+	sidecar := strings.TrimSuffix(file, filepath.Ext(file)) + ".json"
+	if marks == nil {
+		marks = []mark{}
+	}
+	data, _ := json.MarshalIndent(marks, "", "  ")
+	if err := os.WriteFile(sidecar, data, 0644); err != nil {
+		fatal("failed to write %s: %v", sidecar, err)
+	}
+	recordArtifact("marks", sidecar)
+	return sidecar
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Artifact is a file bb wrote during the current session. The manifest lives
+// in State, so it is discarded by `bb stop` together with the session.
+type Artifact struct {
+	ID      int      `json:"id"`
+	Kind    string   `json:"kind"`
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Command []string `json:"command"`
+	URL     string   `json:"url,omitempty"`
+	Time    string   `json:"time"`
+}
+
+// recordArtifact adds file to the session manifest and returns its id (0 if
+// there is no session). Like captureFailure it is best-effort.
+func recordArtifact(kind, file string) int {
+	s, err := loadState()
+	if err != nil {
+		return 0
+	}
+	a := Artifact{
+		ID:      len(s.Artifacts) + 1,
+		Kind:    kind,
+		Path:    file,
+		Command: invocation,
+		Time:    time.Now().Format(time.RFC3339),
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		a.Path = abs
+	}
+	if info, err := os.Stat(file); err == nil {
+		a.Size = info.Size()
+	}
+	if currentPage != nil {
+		if info, err := currentPage.Info(); err == nil {
+			a.URL = info.URL
+		}
+	}
+	s.Artifacts = append(s.Artifacts, a)
+	if err := saveState(s); err != nil {
+		return 0
+	}
+	return a.ID
+}
+
+func cmdArtifacts(args []string, flags globalFlags) {
+	sub := "list"
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	s, err := loadState()
+	if err != nil {
+		s = &State{}
+	}
+
+	switch sub {
+	case "list":
+		if flags.jsonOutput {
+			items := s.Artifacts
+			if items == nil {
+				items = []Artifact{}
+			}
+			out, _ := json.MarshalIndent(items, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if len(s.Artifacts) == 0 {
+			fmt.Println("No artifacts in this session")
+			return
+		}
+		for _, a := range s.Artifacts {
+			fmt.Printf("%3d  %-16s %s  %s\n", a.ID, a.Kind, a.Time, a.Path)
+		}
+	case "get":
+		if len(args) != 2 {
+			fatalUsage("usage: bb artifacts get <id>")
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+		if err != nil {
+			fatalUsage("invalid artifact id: %s", args[1])
+		}
+		for _, a := range s.Artifacts {
+			if a.ID != id {
+				continue
+			}
+			if flags.jsonOutput {
+				out, _ := json.MarshalIndent(a, "", "  ")
+				fmt.Println(string(out))
+			} else {
+				fmt.Println(a.Path)
+			}
+			return
+		}
+		fail(exitNotFound, "", "no artifact with id %d (see bb artifacts list)", id)
+	default:
+		fatalUsage("unknown artifacts subcommand: %s (expected list or get)", sub)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// assertProbeJS reads the value an assertion checks; null when the element
+// is missing
+const assertProbeJS = `(kind, sel, name) => {
+	if (kind === 'count') return String(document.querySelectorAll(sel).length);
+	const el = document.querySelector(sel);
+	if (!el) return kind === 'visible' ? 'false' : null;
+	switch (kind) {
+	case 'text': return el.innerText;
+	case 'value': return typeof el.value === 'string' ? el.value : null;
+	case 'attr': return el.getAttribute(name);
+	case 'visible': {
+		const r = el.getBoundingClientRect(), st = getComputedStyle(el);
+		return String(r.width > 0 && r.height > 0 && st.visibility !== 'hidden' && st.display !== 'none');
+	}
+	}
+	return null;
+}`
+
+// assertion is one check of bb assert
+type assertion struct {
+	kind     string // text, value, attr, count, visible, url, title
+	selector string
+	attr     string
+	expected string
+	mode     string // equals, contains or regex
+	not      bool
+}
+
+type assertResult struct {
+	Passed   bool    `json:"passed"`
+	Check    string  `json:"check"`
+	Expected string  `json:"expected"`
+	Actual   *string `json:"actual"` // null when the element is missing
+}
+
+func (a assertion) String() string {
+	parts := []string{a.kind}
+	if a.selector != "" {
+		parts = append(parts, strconv.Quote(a.selector))
+	}
+	if a.attr != "" {
+		parts = append(parts, a.attr)
+	}
+	if a.not {
+		parts = append(parts, "not")
+	}
+	if a.mode != "equals" {
+		parts = append(parts, a.mode)
+	}
+	return strings.Join(parts, " ")
+}
+
+// countOp splits "n", ">=n", "<n", ... into the operator and n
+func countOp(expected string) (string, int, error) {
+	op := "="
+	for _, o := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(expected, o) {
+			op, expected = o, strings.TrimPrefix(expected, o)
+			break
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(expected))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid count %q (expected N, >=N, <=N, >N or <N)", expected)
+	}
+	return op, n, nil
+}
+
+// matches checks actual against the expectation. A missing element fails
+// either way.
+func (a assertion) matches(actual *string) bool {
+	if actual == nil {
+		return false
+	}
+	ok := false
+	switch {
+	case a.kind == "count":
+		op, want, _ := countOp(a.expected)
+		got, _ := strconv.Atoi(*actual)
+		switch op {
+		case ">=":
+			ok = got >= want
+		case "<=":
+			ok = got <= want
+		case ">":
+			ok = got > want
+		case "<":
+			ok = got < want
+		default:
+			ok = got == want
+		}
+	case a.mode == "contains":
+		ok = strings.Contains(*actual, a.expected)
+	case a.mode == "regex":
+		ok = regexp.MustCompile(a.expected).MatchString(*actual)
+	default:
+		ok = *actual == a.expected
+	}
+	return ok != a.not
+}
+
+// diffLine points at the first character where actual departs from expected,
+// aligned under the quoted actual value
+func diffLine(expected, actual string) string {
+	e, a := []rune(expected), []rune(actual)
+	i := 0
+	for i < len(e) && i < len(a) && e[i] == a[i] {
+		i++
+	}
+	if i == len(e) && i == len(a) {
+		return ""
+	}
+	col := utf8.RuneCountInString(strconv.Quote(string(a[:i]))) - 1
+	return strings.Repeat(" ", 12+col) + fmt.Sprintf("^ differs at character %d", i+1)
+}
+
+func cmdAssert(args []string, flags globalFlags) {
+	usage := `usage: bb assert text|value <selector> <expected> | attr <selector> <name> <expected> |
+       count <selector> <N|>=N|<=N> | visible <selector> | url|title <expected>
+       [--contains|--regex] [--not] [--wait seconds]`
+	a := assertion{mode: "equals"}
+	wait := 5.0
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--contains":
+			a.mode = "contains"
+		case "--regex":
+			a.mode = "regex"
+		case "--not":
+			a.not = true
+		case "--wait":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --wait")
+			}
+			v, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || v < 0 {
+				fatalUsage("invalid --wait: %s", args[i])
+			}
+			wait = v
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) == 0 {
+		fatalUsage("%s", usage)
+	}
+	a.kind, positional = positional[0], positional[1:]
+	// Mode flags take no value, so "url --contains X" works as it reads
+	want := map[string]int{"text": 2, "value": 2, "attr": 3, "count": 2, "visible": 1, "url": 1, "title": 1}
+	n, ok := want[a.kind]
+	if !ok || len(positional) != n {
+		fatalUsage("%s", usage)
+	}
+	switch a.kind {
+	case "url", "title":
+		a.expected = positional[0]
+	case "visible":
+		a.selector, a.expected = positional[0], "true"
+	case "attr":
+		a.selector, a.attr, a.expected = positional[0], positional[1], positional[2]
+	default:
+		a.selector, a.expected = positional[0], positional[1]
+	}
+	if a.kind == "count" {
+		if _, _, err := countOp(a.expected); err != nil {
+			fatalUsage("%v", err)
+		}
+	}
+	if a.mode == "regex" {
+		if _, err := regexp.Compile(a.expected); err != nil {
+			fatalUsage("invalid regex: %v", err)
+		}
+	}
+
+	_, _, page := withPage()
+	probe := func() *string {
+		if a.kind == "url" || a.kind == "title" {
+			info, err := page.Info()
+			if err != nil {
+				fatal("failed to get page info: %v", err)
+			}
+			v := info.URL
+			if a.kind == "title" {
+				v = info.Title
+			}
+			return &v
+		}
+		res, err := page.Eval(assertProbeJS, a.kind, a.selector, a.attr)
+		if err != nil {
+			fatal("query failed: %v", err)
+		}
+		if res.Value.Nil() {
+			return nil
+		}
+		v := res.Value.Str()
+		if a.kind == "text" {
+			v = strings.Join(strings.Fields(v), " ")
+		}
+		return &v
+	}
+
+	// Pages update asynchronously, so the check is retried until it passes
+	// or the wait runs out
+	deadline := time.Now().Add(time.Duration(wait * float64(time.Second)))
+	actual := probe()
+	for !a.matches(actual) && time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		actual = probe()
+	}
+	r := assertResult{Passed: a.matches(actual), Check: a.String(), Expected: a.expected, Actual: actual}
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(r, "", "  ")
+		fmt.Println(string(out))
+	} else if r.Passed {
+		fmt.Printf("ok   %s\n", r.Check)
+	} else {
+		fmt.Fprintf(os.Stderr, "FAIL %s\n", r.Check)
+		expected := strconv.Quote(a.expected)
+		if a.not {
+			expected = "not " + expected
+		}
+		fmt.Fprintf(os.Stderr, "  expected: %s\n", expected)
+		if actual == nil {
+			fmt.Fprintf(os.Stderr, "  actual:   (no element matches %s)\n", a.selector)
+		} else {
+			fmt.Fprintf(os.Stderr, "  actual:   %s\n", strconv.Quote(*actual))
+			if a.mode == "equals" && !a.not && a.kind != "count" {
+				if d := diffLine(a.expected, *actual); d != "" {
+					fmt.Fprintln(os.Stderr, d)
+				}
+			}
+		}
+	}
+	if !r.Passed {
+		exit(exitFalse)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// AudioCapture marks a running bb audio capture
+type AudioCapture struct {
+	Started time.Time `json:"started"`
+}
+
+// audioCaptureJS taps what the document plays: Web Audio graphs connected to
+// a destination, and <audio>/<video> elements through captureStream. Headless
+// Chrome has no voices, so speechSynthesis is replaced by a stub that logs
+// each utterance and fires its start and end events. Samples are kept as
+// 16-bit stereo per tapped context. Re-running it keeps the recording.
+const audioCaptureJS = `() => {
+	if (window.__bbAudio) return;
+	const t0 = performance.now();
+	const realConnect = AudioNode.prototype.connect;
+	const tracks = [], taps = new Map(), contexts = [];
+	const tapFor = ctx => {
+		if (taps.has(ctx)) return taps.get(ctx);
+		const node = ctx.createScriptProcessor(4096, 2, 2);
+		const track = {rate: ctx.sampleRate, start: null, chunks: []};
+		node.onaudioprocess = e => {
+			const b = e.inputBuffer, l = b.getChannelData(0), r = b.numberOfChannels > 1 ? b.getChannelData(1) : l;
+			if (track.start === null) track.start = performance.now() - t0 - 1000 * b.length / ctx.sampleRate;
+			const pcm = new Int16Array(b.length * 2);
+			for (let i = 0; i < b.length; i++) {
+				pcm[2 * i] = Math.max(-1, Math.min(1, l[i])) * 32767;
+				pcm[2 * i + 1] = Math.max(-1, Math.min(1, r[i])) * 32767;
+			}
+			track.chunks.push(pcm);
+		};
+		realConnect.call(node, ctx.destination);
+		tracks.push(track);
+		taps.set(ctx, node);
+		contexts.push(ctx);
+		return node;
+	};
+	AudioNode.prototype.connect = function(dest, ...rest) {
+		const out = realConnect.call(this, dest, ...rest);
+		if (dest instanceof AudioDestinationNode && !(this.context instanceof OfflineAudioContext) && this !== taps.get(this.context)) {
+			realConnect.call(this, tapFor(this.context));
+		}
+		return out;
+	};
+
+	let mediaCtx = null;
+	const tapped = new WeakSet();
+	const tapMedia = el => {
+		if (!(el instanceof HTMLMediaElement) || tapped.has(el) || !el.captureStream) return;
+		tapped.add(el);
+		try {
+			mediaCtx = mediaCtx || new AudioContext();
+			mediaCtx.resume();
+			const stream = el.captureStream();
+			const connect = () => {
+				if (stream.getAudioTracks().length) realConnect.call(mediaCtx.createMediaStreamSource(stream), tapFor(mediaCtx));
+				else stream.addEventListener('addtrack', connect, {once: true});
+			};
+			connect();
+		} catch (e) {}
+	};
+	const onPlay = e => tapMedia(e.target);
+	document.addEventListener('play', onPlay, true);
+	document.querySelectorAll('audio, video').forEach(el => { if (!el.paused) tapMedia(el); });
+
+	const utterances = [];
+	const synth = window.speechSynthesis;
+	const realSpeak = synth && synth.speak, realCancel = synth && synth.cancel;
+	if (synth) {
+		const fire = (u, type) => {
+			let ev;
+			try { ev = new SpeechSynthesisEvent(type, {utterance: u, charIndex: 0}); } catch (e) { ev = new Event(type); }
+			u.dispatchEvent(ev);
+		};
+		synth.speak = u => {
+			utterances.push({text: u.text, lang: u.lang || document.documentElement.lang || '', rate: u.rate, at: Math.round(performance.now() - t0) / 1000});
+			const ms = Math.max(300, u.text.split(/\s+/).length * 350 / (u.rate || 1));
+			setTimeout(() => { fire(u, 'start'); setTimeout(() => fire(u, 'end'), ms); }, 0);
+		};
+		synth.cancel = () => {};
+	}
+
+	const base64 = pcm => {
+		const bytes = new Uint8Array(pcm.buffer);
+		let s = '';
+		for (let i = 0; i < bytes.length; i += 0x8000) s += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000));
+		return btoa(s);
+	};
+	window.__bbAudio = {
+		resume: () => contexts.forEach(c => c.resume()),
+		dump: () => ({
+			utterances,
+			tracks: tracks.filter(t => t.chunks.length).map(t => {
+				const pcm = new Int16Array(t.chunks.reduce((n, c) => n + c.length, 0));
+				let off = 0;
+				for (const c of t.chunks) { pcm.set(c, off); off += c.length; }
+				return {rate: t.rate, start_ms: t.start, data: base64(pcm)};
+			}),
+		}),
+		stop: () => {
+			AudioNode.prototype.connect = realConnect;
+			document.removeEventListener('play', onPlay, true);
+			taps.forEach(node => { node.onaudioprocess = null; node.disconnect(); });
+			if (mediaCtx) mediaCtx.close();
+			if (synth) { synth.speak = realSpeak; synth.cancel = realCancel; }
+			delete window.__bbAudio;
+		},
+	};
+}`
+
+// applyAudioCapture installs the recorder in the current document and in
+// documents loaded while this invocation is attached
+func applyAudioCapture(page *rod.Page) {
+	_, _ = page.EvalOnNewDocument(fmt.Sprintf(`(%s)()`, audioCaptureJS))
+	_, _ = page.Eval(audioCaptureJS)
+}
+
+// audioTrack is the audio one tapped context played, as 16-bit stereo
+type audioTrack struct {
+	Rate    float64 `json:"rate"`
+	StartMS float64 `json:"start_ms"`
+	Data    string  `json:"data"`
+}
+
+type utterance struct {
+	Text  string  `json:"text"`
+	Lang  string  `json:"lang,omitempty"`
+	Rate  float64 `json:"rate"`
+	AtSec float64 `json:"at"`
+}
+
+type audioResult struct {
+	File       string      `json:"file"`
+	Duration   float64     `json:"duration"`
+	PeakDBFS   *float64    `json:"peak_dbfs"` // null when silent
+	RMSDBFS    *float64    `json:"rms_dbfs"`
+	Silent     bool        `json:"silent"`
+	Utterances []utterance `json:"utterances"`
+}
+
+// mixAudio places each track at its start time and mixes them at the highest
+// sample rate, resampling the others linearly
+func mixAudio(tracks []audioTrack) ([]int16, int) {
+	rate := 0.0
+	for _, t := range tracks {
+		rate = math.Max(rate, t.Rate)
+	}
+	if rate == 0 {
+		return nil, 48000
+	}
+	var mix []float64
+	for _, t := range tracks {
+		raw, err := base64.StdEncoding.DecodeString(t.Data)
+		if err != nil {
+			continue
+		}
+		frames := len(raw) / 4
+		sample := func(frame, ch int) float64 {
+			return float64(int16(binary.LittleEndian.Uint16(raw[4*frame+2*ch:])))
+		}
+		offset := int(math.Max(0, t.StartMS) * rate / 1000)
+		n := int(float64(frames) * rate / t.Rate)
+		if need := 2 * (offset + n); need > len(mix) {
+			mix = append(mix, make([]float64, need-len(mix))...)
+		}
+		for i := 0; i < n; i++ {
+			pos := float64(i) * t.Rate / rate
+			f := int(pos)
+			frac := pos - float64(f)
+			for ch := 0; ch < 2; ch++ {
+				v := sample(f, ch)
+				if f+1 < frames {
+					v += (sample(f+1, ch) - v) * frac
+				}
+				mix[2*(offset+i)+ch] += v
+			}
+		}
+	}
+	out := make([]int16, len(mix))
+	for i, v := range mix {
+		out[i] = int16(math.Max(-32768, math.Min(32767, v)))
+	}
+	return out, int(rate)
+}
+
+// writeWAV writes interleaved 16-bit stereo samples as a PCM WAV file
+func writeWAV(file string, samples []int16, rate int) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size := uint32(2 * len(samples))
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + size, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), uint16(1), uint16(2), uint32(rate), uint32(rate * 4), uint16(4), uint16(16),
+		[4]byte{'d', 'a', 't', 'a'}, size,
+	}
+	for _, v := range header {
+		if err := binary.Write(f, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(f, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// audioLevels returns the peak and RMS level in dBFS, nil when silent
+func audioLevels(samples []int16) (peak, rms *float64) {
+	maxAbs, sum := 0.0, 0.0
+	for _, s := range samples {
+		v := math.Abs(float64(s))
+		maxAbs = math.Max(maxAbs, v)
+		sum += v * v
+	}
+	// Below one step of 16-bit audio there is nothing to hear
+	if maxAbs < 2 {
+		return nil, nil
+	}
+	p := math.Round(200*math.Log10(maxAbs/32767)) / 10
+	r := math.Round(200*math.Log10(math.Sqrt(sum/float64(len(samples)))/32767)) / 10
+	return &p, &r
+}
+
+func cmdAudio(args []string, flags globalFlags) {
+	usage := "usage: bb audio capture start | stop [file.wav] | status"
+	if len(args) < 2 || args[0] != "capture" {
+		fatalUsage("%s", usage)
+	}
+	switch args[1] {
+	case "start":
+		if len(args) != 2 {
+			fatalUsage("%s", usage)
+		}
+		s, _, page := withPage()
+		if s.Audio == nil {
+			s.Audio = &AudioCapture{Started: time.Now()}
+			if err := saveState(s); err != nil {
+				fatal("failed to save state: %v", err)
+			}
+		}
+		applyAudioCapture(page)
+		// Contexts the page created before bb resumed them may be suspended
+		// by the autoplay policy
+		_, _ = page.Evaluate(rod.Eval(`() => window.__bbAudio && window.__bbAudio.resume()`).ByUser())
+		fmt.Println("Capturing audio; bb audio capture stop <file.wav> saves it")
+	case "stop":
+		if len(args) > 3 {
+			fatalUsage("%s", usage)
+		}
+		file := ""
+		if len(args) == 3 {
+			file = args[2]
+		}
+		s, _, page := withPage()
+		if s.Audio == nil {
+			fatal("no audio capture running (bb audio capture start)")
+		}
+		s.Audio = nil
+		if err := saveState(s); err != nil {
+			fatal("failed to save state: %v", err)
+		}
+		res, err := page.Eval(`() => {
+			if (!window.__bbAudio) return null;
+			const d = window.__bbAudio.dump();
+			window.__bbAudio.stop();
+			return d;
+		}`)
+		if err != nil {
+			fatal("failed to read the captured audio: %v", err)
+		}
+		if res.Value.Nil() {
+			fatal("the capture was lost when the page navigated; start it again on this page")
+		}
+		var dump struct {
+			Tracks     []audioTrack `json:"tracks"`
+			Utterances []utterance  `json:"utterances"`
+		}
+		if err := res.Value.Unmarshal(&dump); err != nil {
+			fatal("failed to read the captured audio: %v", err)
+		}
+
+		samples, rate := mixAudio(dump.Tracks)
+		if file == "" {
+			file = nextAvailableFile(filepath.Join(outputDir(), "audio"), ".wav")
+		}
+		if err := writeWAV(file, samples, rate); err != nil {
+			fatal("failed to write %s: %v", file, err)
+		}
+		recordArtifact("audio", file)
+		r := audioResult{File: file, Duration: math.Round(float64(len(samples))/2/float64(rate)*100) / 100, Utterances: []utterance{}}
+		r.PeakDBFS, r.RMSDBFS = audioLevels(samples)
+		r.Silent = r.PeakDBFS == nil
+		r.Utterances = append(r.Utterances, dump.Utterances...)
+
+		if flags.jsonOutput {
+			out, _ := json.MarshalIndent(r, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		level := "silent"
+		if !r.Silent {
+			level = fmt.Sprintf("peak %.1f dBFS, rms %.1f dBFS", *r.PeakDBFS, *r.RMSDBFS)
+		}
+		fmt.Printf("Saved %.2fs of audio to %s (%s)\n", r.Duration, file, level)
+		for _, u := range r.Utterances {
+			fmt.Printf("  speech at %.1fs: %q\n", u.AtSec, u.Text)
+		}
+	case "status":
+		s, err := loadState()
+		if err != nil || s.Audio == nil {
+			fmt.Println("No audio capture running")
+			return
+		}
+		fmt.Printf("Capturing audio since %s (%s)\n", s.Audio.Started.Format(time.RFC3339), time.Since(s.Audio.Started).Round(time.Second))
+	default:
+		fatalUsage("%s", usage)
+	}
+}
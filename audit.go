@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// auditCategories in report order
+var auditCategories = []string{"seo", "a11y", "perf", "best-practices"}
+
+// auditDOMJS runs the checks that only need the document. Each returns the
+// offending elements or resources; an empty list passes.
+const auditDOMJS = `() => {
+	` + cssPathJS + `
+	const meta = name => document.querySelector('meta[name="' + name + '" i]');
+	const visible = el => {
+		const r = el.getBoundingClientRect();
+		return r.width > 0 && r.height > 0 && getComputedStyle(el).visibility !== 'hidden';
+	};
+	const named = el => (el.getAttribute('aria-label') || el.getAttribute('title') || el.innerText || el.value || '').trim() !== '' ||
+		!!el.getAttribute('aria-labelledby') || !!el.querySelector('img[alt]:not([alt=""]), svg title');
+	const out = {};
+
+	out['document-title'] = document.title.trim() ? [] : ['<title> is missing or empty'];
+	const desc = meta('description');
+	out['meta-description'] = desc && desc.content.trim() ? [] : ['<meta name="description"> is missing or empty'];
+	const vp = meta('viewport');
+	out['viewport'] = vp && /width\s*=\s*device-width/i.test(vp.content) ? [] : ['no <meta name="viewport" content="width=device-width, ...">'];
+	const robots = meta('robots');
+	out['crawlable'] = robots && /noindex/i.test(robots.content) ? ['<meta name="robots"> contains noindex'] : [];
+
+	out['image-alt'] = [...document.querySelectorAll('img:not([alt])')].filter(visible).map(cssPath);
+	out['html-lang'] = document.documentElement.lang ? [] : ['<html> has no lang attribute'];
+	out['label'] = [...document.querySelectorAll('input:not([type=hidden]):not([type=submit]):not([type=button]):not([type=image]), select, textarea')]
+		.filter(el => visible(el) && !(el.labels && el.labels.length) && !el.getAttribute('aria-label') && !el.getAttribute('aria-labelledby') && !el.getAttribute('title'))
+		.map(cssPath);
+	out['button-name'] = [...document.querySelectorAll('button, [role=button], a[href]')].filter(el => visible(el) && !named(el)).map(cssPath);
+
+	// Large images: over 200 KB, or shipped at more than twice the displayed size
+	const bytes = {};
+	for (const e of performance.getEntriesByType('resource')) bytes[e.name] = e.encodedBodySize || e.transferSize || 0;
+	out['large-images'] = [...document.images].filter(img => img.complete && img.naturalWidth > 0 && visible(img)).flatMap(img => {
+		const size = bytes[img.currentSrc] || 0;
+		const r = img.getBoundingClientRect();
+		const dpr = window.devicePixelRatio || 1;
+		const oversized = img.naturalWidth * img.naturalHeight > 4 * (r.width * dpr) * (r.height * dpr) && img.naturalWidth > 200;
+		if (size <= 200 * 1024 && !oversized) return [];
+		const why = [];
+		if (size > 200 * 1024) why.push(Math.round(size / 1024) + ' KB');
+		if (oversized) why.push(img.naturalWidth + 'x' + img.naturalHeight + ' shown at ' + Math.round(r.width) + 'x' + Math.round(r.height));
+		return [img.currentSrc + ' (' + why.join(', ') + ')'];
+	});
+	const nodes = document.getElementsByTagName('*').length;
+	out['dom-size'] = nodes > 1500 ? [nodes + ' elements (more than 1500)'] : [];
+
+	const mixed = new Set();
+	if (location.protocol === 'https:') {
+		for (const e of performance.getEntriesByType('resource')) if (e.name.startsWith('http:')) mixed.add(e.name);
+		for (const el of document.querySelectorAll('img[src], script[src], iframe[src], link[rel=stylesheet][href], audio[src], video[src], source[src]')) {
+			const u = el.src || el.href;
+			if (u && u.startsWith('http:')) mixed.add(u);
+		}
+	}
+	out['mixed-content'] = [...mixed];
+	return out;
+}`
+
+// auditCheck describes one check of the audit
+type auditCheck struct {
+	ID       string
+	Category string
+	Title    string
+	Weight   int
+}
+
+var auditChecks = []auditCheck{
+	{"document-title", "seo", "Document has a <title>", 3},
+	{"meta-description", "seo", "Document has a meta description", 2},
+	{"viewport", "seo", "Page sets a mobile viewport", 2},
+	{"crawlable", "seo", "Page isn't blocked from indexing", 3},
+	{"image-alt", "a11y", "Images have alt text", 3},
+	{"html-lang", "a11y", "<html> has a lang attribute", 2},
+	{"label", "a11y", "Form fields have labels", 3},
+	{"button-name", "a11y", "Buttons and links have an accessible name", 3},
+	{"lcp", "perf", "Largest Contentful Paint under 2.5 s", 3},
+	{"cls", "perf", "Cumulative Layout Shift under 0.1", 2},
+	{"large-images", "perf", "Images are appropriately sized", 2},
+	{"dom-size", "perf", "DOM has at most 1500 elements", 1},
+	{"mixed-content", "best-practices", "No insecure (http:) resources on an https page", 3},
+	{"console-errors", "best-practices", "No errors logged to the console", 2},
+}
+
+type auditResult struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Passed  bool     `json:"passed"`
+	Weight  int      `json:"weight"`
+	Details []string `json:"details,omitempty"`
+}
+
+type auditCategory struct {
+	Score  int           `json:"score"` // 0-100, weighted share of passed checks
+	Audits []auditResult `json:"audits"`
+}
+
+type auditReport struct {
+	URL        string                    `json:"url"`
+	Score      int                       `json:"score"` // mean of the category scores
+	Categories map[string]*auditCategory `json:"categories"`
+}
+
+func cmdAudit(args []string, flags globalFlags) {
+	usage := "usage: bb audit [--categories seo,a11y,perf,best-practices] [--min-score N]"
+	categories := auditCategories
+	minScore := -1
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--categories":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --categories")
+			}
+			categories = nil
+			for _, c := range strings.Split(args[i], ",") {
+				if !slices.Contains(auditCategories, c) {
+					fatalUsage("unknown category %q (expected seo, a11y, perf or best-practices)", c)
+				}
+				if !slices.Contains(categories, c) {
+					categories = append(categories, c)
+				}
+			}
+		case "--min-score":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --min-score")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 || n > 100 {
+				fatalUsage("invalid --min-score: %s", args[i])
+			}
+			minScore = n
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+
+	_, _, page := withPage()
+	res, err := page.Eval(auditDOMJS)
+	if err != nil {
+		fatal("failed to audit the page: %v", err)
+	}
+	findings := map[string][]string{}
+	if err := res.Value.Unmarshal(&findings); err != nil {
+		fatal("failed to read the audit: %v", err)
+	}
+	if slices.Contains(categories, "perf") {
+		vitals, err := page.Eval(perfVitalsJS)
+		if err != nil {
+			fatal("failed to read web vitals: %v", err)
+		}
+		if lcp := vitals.Value.Get("lcp"); !lcp.Nil() && lcp.Num() > 2500 {
+			findings["lcp"] = []string{fmt.Sprintf("%.0f ms", lcp.Num())}
+		}
+		if cls := vitals.Value.Get("cls").Num(); cls > 0.1 {
+			findings["cls"] = []string{fmt.Sprintf("%.3f", cls)}
+		}
+	}
+	if slices.Contains(categories, "best-practices") {
+		for _, m := range consoleMessages(page, 0) {
+			if m.Type == "error" {
+				findings["console-errors"] = append(findings["console-errors"], m.Text)
+			}
+		}
+	}
+
+	r := auditReport{URL: page.MustInfo().URL, Categories: map[string]*auditCategory{}}
+	for _, c := range categories {
+		cat := &auditCategory{Audits: []auditResult{}}
+		passed, total := 0, 0
+		for _, check := range auditChecks {
+			if check.Category != c {
+				continue
+			}
+			details := findings[check.ID]
+			a := auditResult{ID: check.ID, Title: check.Title, Passed: len(details) == 0, Weight: check.Weight, Details: details}
+			cat.Audits = append(cat.Audits, a)
+			total += check.Weight
+			if a.Passed {
+				passed += check.Weight
+			}
+		}
+		cat.Score = int(math.Round(100 * float64(passed) / float64(total)))
+		r.Categories[c] = cat
+		r.Score += cat.Score
+	}
+	r.Score = int(math.Round(float64(r.Score) / float64(len(categories))))
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(r, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("Audit of %s: %d/100\n", r.URL, r.Score)
+		for _, c := range categories {
+			cat := r.Categories[c]
+			fmt.Printf("\n%s: %d/100\n", c, cat.Score)
+			for _, a := range cat.Audits {
+				mark := "pass"
+				if !a.Passed {
+					mark = "FAIL"
+				}
+				fmt.Printf("  %s  %-17s %s\n", mark, a.ID, a.Title)
+				for i, d := range a.Details {
+					if i == 5 {
+						fmt.Printf("          ... %d more\n", len(a.Details)-5)
+						break
+					}
+					fmt.Printf("          %s\n", d)
+				}
+			}
+		}
+	}
+
+	// Any category under the bar fails the run, so the audit can gate CI
+	failed := false
+	for _, c := range categories {
+		if minScore >= 0 && r.Categories[c].Score < minScore {
+			fmt.Fprintf(os.Stderr, "%s scored %d, below --min-score %d\n", c, r.Categories[c].Score, minScore)
+			failed = true
+		}
+	}
+	if failed {
+		exit(exitFalse)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// axeURL is the axe-core build bb ax-audit downloads on first use
+const axeURL = "https://cdn.jsdelivr.net/npm/axe-core@4.10.2/axe.min.js"
+
+// axeSHA256 is the digest the download has to have before bb runs it in a
+// page: `curl -s $axeURL | sha256sum`, updated together with axeURL
+var axeSHA256 = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// axeImpacts in order of severity
+var axeImpacts = []string{"critical", "serious", "moderate", "minor"}
+
+// axeCachePath is where the downloaded axe-core is kept
+func axeCachePath() string {
+	return filepath.Join(stateDir(), "axe.min.js")
+}
+
+// axeSource returns the axe-core script: from src (a file or URL) if given,
+// otherwise the cached copy, downloading it the first time
+func axeSource(src string) string {
+	if src != "" {
+		data, err := readSource(src)
+		if err != nil {
+			fatal("failed to read axe-core: %v", err)
+		}
+		return string(data)
+	}
+	if data, err := os.ReadFile(axeCachePath()); err == nil && checkAxe(data) == nil {
+		return string(data)
+	}
+	data, err := readSource(axeURL)
+	if err != nil {
+		fatal("failed to download axe-core (use --axe <file> offline): %v", err)
+	}
+	if err := checkAxe(data); err != nil {
+		fatal("refusing the axe-core download from %s: %v (use --axe <file> with a build you trust)", axeURL, err)
+	}
+	if err := os.MkdirAll(stateDir(), 0755); err == nil {
+		_ = os.WriteFile(axeCachePath(), data, 0644)
+	}
+	return string(data)
+}
+
+// checkAxe verifies a download of axeURL against axeSHA256
+func checkAxe(data []byte) error {
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != axeSHA256 {
+		return fmt.Errorf("SHA-256 %s, expected %s", got, axeSHA256)
+	}
+	return nil
+}
+
+// axeRunJS runs axe on the document, or on context, for the given tags
+const axeRunJS = `async (context, tags) => {
+	const options = {resultTypes: ['violations']};
+	if (tags.length) options.runOnly = {type: 'tag', values: tags};
+	const r = await axe.run(context || document, options);
+	return r.violations.map(v => ({
+		id: v.id,
+		impact: v.impact || 'minor',
+		help: v.help,
+		help_url: v.helpUrl,
+		nodes: v.nodes.map(n => ({target: n.target.map(String).join(' '), summary: n.failureSummary || ''})),
+	}));
+}`
+
+type axeNode struct {
+	Target  string `json:"target"` // selector; frames and shadow roots are joined by spaces
+	Summary string `json:"summary"`
+}
+
+type axeViolation struct {
+	ID      string    `json:"id"`
+	Impact  string    `json:"impact"`
+	Help    string    `json:"help"`
+	HelpURL string    `json:"help_url"`
+	Nodes   []axeNode `json:"nodes"`
+}
+
+type axeReport struct {
+	URL        string         `json:"url"`
+	Counts     map[string]int `json:"counts"` // violations by impact
+	Violations []axeViolation `json:"violations"`
+}
+
+func cmdAxAudit(args []string, flags globalFlags) {
+	usage := "usage: bb ax-audit [--selector sel] [--tags wcag2a,wcag2aa] [--axe file|url]"
+	context, axe := "", ""
+	tags := []string{}
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			fatalUsage("%s", usage)
+		}
+		switch args[i] {
+		case "--selector":
+			context = args[i+1]
+		case "--tags":
+			tags = strings.Split(args[i+1], ",")
+		case "--axe":
+			axe = args[i+1]
+		default:
+			fatalUsage("%s", usage)
+		}
+		i++
+	}
+
+	_, _, page := withPage()
+	if loaded, err := page.Eval(`() => typeof axe !== 'undefined'`); err != nil || !loaded.Value.Bool() {
+		// Evaluated as a script, so it defines window.axe like a <script> tag would
+		res, err := proto.RuntimeEvaluate{Expression: axeSource(axe)}.Call(page)
+		if err == nil && res.ExceptionDetails != nil {
+			err = fmt.Errorf("%s", res.ExceptionDetails.Text)
+			if ex := res.ExceptionDetails.Exception; ex != nil && ex.Description != "" {
+				err = fmt.Errorf("%s", ex.Description)
+			}
+		}
+		if err != nil {
+			fatal("failed to inject axe-core: %v", err)
+		}
+	}
+	res, err := page.Eval(axeRunJS, context, tags)
+	if err != nil {
+		fatal("axe failed: %v", err)
+	}
+	r := axeReport{URL: page.MustInfo().URL, Counts: map[string]int{}}
+	if err := res.Value.Unmarshal(&r.Violations); err != nil {
+		fatal("failed to read the axe results: %v", err)
+	}
+	if r.Violations == nil {
+		r.Violations = []axeViolation{}
+	}
+	for _, v := range r.Violations {
+		r.Counts[v.Impact]++
+	}
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(r, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	if len(r.Violations) == 0 {
+		fmt.Printf("No accessibility violations found on %s\n", r.URL)
+		return
+	}
+	var counts []string
+	for _, impact := range axeImpacts {
+		if n := r.Counts[impact]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, impact))
+		}
+	}
+	fmt.Printf("%d violations (%s) on %s\n", len(r.Violations), strings.Join(counts, ", "), r.URL)
+	for _, impact := range axeImpacts {
+		if r.Counts[impact] == 0 {
+			continue
+		}
+		fmt.Printf("\n%s\n", strings.ToUpper(impact))
+		for _, v := range r.Violations {
+			if v.Impact != impact {
+				continue
+			}
+			fmt.Printf("  %s: %s (%d elements)\n", v.ID, v.Help, len(v.Nodes))
+			for i, n := range v.Nodes {
+				if i == 5 {
+					fmt.Printf("    ... %d more\n", len(v.Nodes)-5)
+					break
+				}
+				fmt.Printf("    %s\n", n.Target)
+			}
+			fmt.Printf("    %s\n", v.HelpURL)
+		}
+	}
+}
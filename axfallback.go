@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/ysmood/gson"
+)
+
+// domAXTreeJS derives an approximate accessibility tree from the DOM: roles
+// from ARIA attributes and tag names, names from labels, alt text and
+// content. Nodes without a role of their own (div, span) are ignored like
+// Chrome's generic nodes, so their children show under the parent. The
+// nodes are kept in globalThis.__bbAXNodes for resolving them afterwards.
+const domAXTreeJS = `function(maxDepth) {
+	const root = this && this.nodeType === 1 ? this : document.documentElement;
+	const skip = new Set(['SCRIPT', 'STYLE', 'TEMPLATE', 'NOSCRIPT', 'HEAD', 'META', 'LINK']);
+	const text = el => (el.innerText ?? el.textContent ?? '').replace(/\s+/g, ' ').trim();
+	const fromContent = new Set(['button', 'link', 'heading', 'cell', 'columnheader', 'rowheader', 'option',
+		'tab', 'menuitem', 'menuitemcheckbox', 'menuitemradio', 'treeitem', 'checkbox', 'radio', 'switch', 'tooltip']);
+	const sectioning = 'article, aside, main, nav, section';
+	const implicitRole = el => {
+		const tag = el.localName, type = (el.getAttribute('type') || 'text').toLowerCase();
+		switch (tag) {
+		case 'a': case 'area': return el.hasAttribute('href') ? 'link' : '';
+		case 'button': case 'summary': return 'button';
+		case 'input':
+			if (['button', 'submit', 'reset', 'image'].includes(type)) return 'button';
+			if (type === 'hidden') return 'none';
+			return {checkbox: 'checkbox', radio: 'radio', range: 'slider', number: 'spinbutton', search: 'searchbox'}[type]
+				|| (el.hasAttribute('list') ? 'combobox' : 'textbox');
+		case 'textarea': return 'textbox';
+		case 'select': return el.multiple || el.size > 1 ? 'listbox' : 'combobox';
+		case 'option': return 'option';
+		case 'h1': case 'h2': case 'h3': case 'h4': case 'h5': case 'h6': return 'heading';
+		case 'img': return el.getAttribute('alt') === '' ? 'none' : 'image';
+		case 'nav': return 'navigation';
+		case 'main': return 'main';
+		case 'header': return el.closest(sectioning) ? '' : 'banner';
+		case 'footer': return el.closest(sectioning) ? '' : 'contentinfo';
+		case 'aside': return 'complementary';
+		case 'form': return 'form';
+		case 'section': return el.hasAttribute('aria-label') || el.hasAttribute('aria-labelledby') ? 'region' : '';
+		case 'article': return 'article';
+		case 'ul': case 'ol': case 'menu': return 'list';
+		case 'li': return 'listitem';
+		case 'dl': return 'list';
+		case 'table': return 'table';
+		case 'thead': case 'tbody': case 'tfoot': return 'rowgroup';
+		case 'tr': return 'row';
+		case 'td': return 'cell';
+		case 'th': return el.scope === 'row' ? 'rowheader' : 'columnheader';
+		case 'dialog': return 'dialog';
+		case 'p': return 'paragraph';
+		case 'fieldset': case 'details': case 'optgroup': return 'group';
+		case 'progress': return 'progressbar';
+		case 'meter': return 'meter';
+		case 'hr': return 'separator';
+		case 'figure': return 'figure';
+		case 'blockquote': return 'blockquote';
+		case 'iframe': return 'Iframe';
+		}
+		return el.isContentEditable && !el.parentElement?.isContentEditable ? 'textbox' : '';
+	};
+	const name = (el, role) => {
+		const by = el.getAttribute('aria-labelledby');
+		if (by) {
+			const parts = by.split(/\s+/).map(id => document.getElementById(id)).filter(Boolean).map(text);
+			if (parts.length) return parts.join(' ');
+		}
+		const label = el.getAttribute('aria-label');
+		if (label && label.trim()) return label.trim();
+		if (el.labels && el.labels.length) return Array.from(el.labels, text).join(' ');
+		if (el.localName === 'input' && ['button', 'submit', 'reset'].includes(el.type)) {
+			return el.value || (el.type === 'submit' ? 'Submit' : el.type === 'reset' ? 'Reset' : '');
+		}
+		if (el.localName === 'img' || (el.localName === 'input' && el.type === 'image') || el.localName === 'area') {
+			if (el.getAttribute('alt')) return el.getAttribute('alt');
+		}
+		if (el.localName === 'fieldset') {
+			const legend = el.querySelector(':scope > legend');
+			if (legend) return text(legend);
+		}
+		if (el.localName === 'table' && el.caption) return text(el.caption);
+		if (fromContent.has(role)) {
+			const t = text(el);
+			if (t) return t;
+		}
+		return el.getAttribute('title') || el.getAttribute('placeholder') || '';
+	};
+	const hidden = el => {
+		if (el.hidden || el.getAttribute('aria-hidden') === 'true') return true;
+		const style = getComputedStyle(el);
+		return style.display === 'none' || style.visibility === 'hidden';
+	};
+
+	const nodes = [], elements = [];
+	const add = (node, domNode, parent) => {
+		node.id = String(nodes.length + 1);
+		node.parent = parent ? parent.id : '';
+		node.children = [];
+		if (parent) parent.children.push(node.id);
+		nodes.push(node);
+		elements.push(domNode);
+		return node;
+	};
+	const walk = (el, parent, depth) => {
+		if (skip.has(el.tagName) || hidden(el)) return;
+		let role = (el.getAttribute('role') || '').trim().split(/\s+/)[0] || implicitRole(el);
+		if (role === 'presentation') role = 'none';
+		const node = add({role: role || 'generic', ignored: !role || role === 'none', props: {}}, el, parent);
+		if (!node.ignored) {
+			node.name = name(el, role);
+			const p = node.props;
+			if (el.tabIndex >= 0 && !el.disabled) p.focusable = true;
+			if (document.activeElement === el) p.focused = true;
+			if (el.disabled || el.getAttribute('aria-disabled') === 'true') p.disabled = true;
+			if (el.required || el.getAttribute('aria-required') === 'true') p.required = true;
+			if (el.readOnly || el.getAttribute('aria-readonly') === 'true') p.readonly = true;
+			if ('checked' in el && (el.type === 'checkbox' || el.type === 'radio')) p.checked = el.checked;
+			else if (el.hasAttribute('aria-checked')) p.checked = el.getAttribute('aria-checked') === 'true';
+			if (el.hasAttribute('aria-expanded')) p.expanded = el.getAttribute('aria-expanded') === 'true';
+			else if (el.localName === 'details') p.expanded = el.open;
+			if (el.localName === 'option') p.selected = el.selected;
+			else if (el.hasAttribute('aria-selected')) p.selected = el.getAttribute('aria-selected') === 'true';
+			if (el.localName === 'textarea') p.multiline = true;
+			if (el.getAttribute('aria-modal') === 'true' || (el.localName === 'dialog' && el.matches(':modal'))) p.modal = true;
+			const level = el.getAttribute('aria-level') || (/^h[1-6]$/.test(el.localName) ? el.localName[1] : '');
+			if (level) p.level = Number(level);
+			if (['textbox', 'searchbox', 'combobox', 'spinbutton', 'slider'].includes(role) && 'value' in el) node.value = String(el.value);
+		}
+		if (maxDepth >= 0 && depth >= maxDepth) return;
+		const next = node.ignored ? depth : depth + 1;
+		for (const child of el.childNodes) {
+			if (child.nodeType === Node.TEXT_NODE) {
+				const t = child.textContent.replace(/\s+/g, ' ').trim();
+				if (t) add({role: 'StaticText', name: t, props: {}}, child, node);
+			} else if (child.nodeType === Node.ELEMENT_NODE) {
+				walk(child, node, next);
+			}
+		}
+		if (el.shadowRoot) for (const child of el.shadowRoot.children) walk(child, node, next);
+	};
+	if (root === document.documentElement) {
+		const top = add({role: 'RootWebArea', name: document.title, props: {focusable: true}}, document, null);
+		walk(root, top, 1);
+	} else {
+		walk(root, null, 0);
+	}
+	globalThis.__bbAXNodes = elements;
+	return nodes;
+}`
+
+// domAXNode is a node of domAXTreeJS's result
+type domAXNode struct {
+	ID       string                 `json:"id"`
+	Parent   string                 `json:"parent"`
+	Children []string               `json:"children"`
+	Role     string                 `json:"role"`
+	Name     string                 `json:"name"`
+	Value    *string                `json:"value"`
+	Ignored  bool                   `json:"ignored"`
+	Props    map[string]interface{} `json:"props"`
+}
+
+// axFallbackNoted makes the fallback note print once per invocation
+var axFallbackNoted bool
+
+// isMethodNotFound reports whether the browser doesn't implement the CDP
+// method that was called
+func isMethodNotFound(err error) bool {
+	var cdpErr *cdp.Error
+	return errors.As(err, &cdpErr) && (cdpErr.Code == -32601 ||
+		strings.HasPrefix(cdpErr.Message, "'Accessibility.") && strings.HasSuffix(cdpErr.Message, "' wasn't found"))
+}
+
+// axDomain runs an Accessibility domain call and reports whether the caller
+// should fall back to the DOM-derived tree: when the browser has no such
+// domain to ask, or BB_AX_DOM is set. Other errors are returned.
+func axDomain(call func() error) (bool, error) {
+	if os.Getenv("BB_AX_DOM") == "" {
+		if err := call(); err == nil || !isMethodNotFound(err) {
+			return false, err
+		}
+	}
+	if !axFallbackNoted {
+		axFallbackNoted = true
+		fmt.Fprintln(os.Stderr, "note: accessibility tree unavailable; using one derived from the DOM (roles and names are approximate)")
+	}
+	return true, nil
+}
+
+// axString makes an AX value of the given type
+func axString(t proto.AccessibilityAXValueType, s string) *proto.AccessibilityAXValue {
+	return &proto.AccessibilityAXValue{Type: t, Value: gson.New(s)}
+}
+
+// domAXTree returns the DOM-derived tree under el (the whole document when
+// el is nil), depth levels deep when depth is set
+func domAXTree(page *rod.Page, el *rod.Element, depth *int) ([]*proto.AccessibilityAXNode, error) {
+	maxDepth := -1
+	if depth != nil {
+		maxDepth = *depth
+	}
+	opts := rod.Eval(domAXTreeJS, maxDepth)
+	if el != nil {
+		opts = opts.This(el.Object)
+	}
+	res, err := page.Evaluate(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the accessibility tree: %w", err)
+	}
+	var raw []domAXNode
+	if err := res.Value.Unmarshal(&raw); err != nil {
+		return nil, fmt.Errorf("failed to read the accessibility tree: %w", err)
+	}
+	nodes := make([]*proto.AccessibilityAXNode, 0, len(raw))
+	for _, r := range raw {
+		n := &proto.AccessibilityAXNode{
+			NodeID:   proto.AccessibilityAXNodeID(r.ID),
+			ParentID: proto.AccessibilityAXNodeID(r.Parent),
+			Ignored:  r.Ignored,
+			Role:     axString(proto.AccessibilityAXValueTypeRole, r.Role),
+		}
+		for _, c := range r.Children {
+			n.ChildIDs = append(n.ChildIDs, proto.AccessibilityAXNodeID(c))
+		}
+		if !r.Ignored {
+			n.Name = axString(proto.AccessibilityAXValueTypeComputedString, r.Name)
+		}
+		if r.Value != nil {
+			n.Value = axString(proto.AccessibilityAXValueTypeString, *r.Value)
+		}
+		// Properties in the order formatProperties prints them
+		for _, key := range []string{"focusable", "focused", "disabled", "required", "readonly", "checked", "expanded", "selected", "multiline", "modal", "level"} {
+			v, ok := r.Props[key]
+			if !ok {
+				continue
+			}
+			value := &proto.AccessibilityAXValue{Type: proto.AccessibilityAXValueTypeBoolean, Value: gson.New(v)}
+			if key == "level" {
+				value.Type = proto.AccessibilityAXValueTypeInteger
+			}
+			n.Properties = append(n.Properties, &proto.AccessibilityAXProperty{Name: proto.AccessibilityAXPropertyName(key), Value: value})
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// resolveDOMAXNodes fills in the backendNodeId of nodes from the last
+// domAXTree call, for output that points at elements
+func resolveDOMAXNodes(page *rod.Page, nodes []*proto.AccessibilityAXNode) {
+	for _, n := range nodes {
+		i, err := strconv.Atoi(string(n.NodeID))
+		if err != nil {
+			continue
+		}
+		obj, err := page.Evaluate(rod.Eval(`i => globalThis.__bbAXNodes?.[i]`, i-1).ByObject())
+		if err != nil || obj.ObjectID == "" {
+			continue
+		}
+		if desc, err := (proto.DOMDescribeNode{ObjectID: obj.ObjectID}).Call(page); err == nil {
+			n.BackendDOMNodeID = desc.Node.BackendNodeID
+		}
+	}
+}
+
+// fullAXTree is the page's accessibility tree, from Chrome or else derived
+// from the DOM
+func fullAXTree(page *rod.Page, depth *int) ([]*proto.AccessibilityAXNode, error) {
+	var result *proto.AccessibilityGetFullAXTreeResult
+	fallback, err := axDomain(func() (err error) {
+		result, err = proto.AccessibilityGetFullAXTree{Depth: depth}.Call(page)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fallback {
+		return domAXTree(page, nil, depth)
+	}
+	return result.Nodes, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// volatileAttr matches attributes that change between page loads without
+// the content changing: CSP nonces, framework bookkeeping and hydration ids
+var volatileAttr = regexp.MustCompile(`^(nonce|integrity|data-reactid|data-reactroot|data-react-.*|data-v-[0-9a-f]+|_ngcontent-.*|_nghost-.*|ng-version|data-emotion|data-styled|data-n-head|data-hid|data-server-rendered|jsaction|jscontroller|jsmodel|jsname)$`)
+
+// volatileClass matches generated class names from CSS-in-JS and scoped style
+// tooling (emotion, styled-components, styled-jsx, svelte)
+var volatileClass = regexp.MustCompile(`^(css-[0-9a-z]+(-.*)?|sc-[A-Za-z]+|jsx-\d+|svelte-[0-9a-z]+)$`)
+
+// keepWhitespace lists elements whose text is printed verbatim
+var keepWhitespace = map[string]bool{"pre": true, "textarea": true, "script": true, "style": true}
+
+// canonicalHTML reformats HTML for line-based diffing: one element per line,
+// attributes sorted, volatile attributes and generated class names removed,
+// whitespace collapsed and comments dropped
+func canonicalHTML(src string, fragment bool) (string, error) {
+	var nodes []*html.Node
+	if fragment {
+		var err error
+		nodes, err = html.ParseFragment(strings.NewReader(src), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+		if err != nil {
+			return "", err
+		}
+	} else {
+		doc, err := html.Parse(strings.NewReader(src))
+		if err != nil {
+			return "", err
+		}
+		for c := doc.FirstChild; c != nil; c = c.NextSibling {
+			nodes = append(nodes, c)
+		}
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		writeCanonical(&b, n, 0)
+	}
+	return b.String(), nil
+}
+
+func canonicalAttrs(n *html.Node) string {
+	var attrs []string
+	for _, a := range n.Attr {
+		key := a.Key
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + key
+		}
+		if volatileAttr.MatchString(key) {
+			continue
+		}
+		val := a.Val
+		if key == "class" {
+			var classes []string
+			for _, c := range strings.Fields(val) {
+				if !volatileClass.MatchString(c) {
+					classes = append(classes, c)
+				}
+			}
+			if len(classes) == 0 {
+				continue
+			}
+			sort.Strings(classes)
+			val = strings.Join(classes, " ")
+		}
+		attrs = append(attrs, key+`="`+html.EscapeString(val)+`"`)
+	}
+	sort.Strings(attrs)
+	if len(attrs) == 0 {
+		return ""
+	}
+	return " " + strings.Join(attrs, " ")
+}
+
+func writeCanonical(b *strings.Builder, n *html.Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch n.Type {
+	case html.DoctypeNode:
+		b.WriteString("<!DOCTYPE " + n.Data + ">\n")
+	case html.TextNode:
+		if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+			b.WriteString(indent + html.EscapeString(text) + "\n")
+		}
+	case html.ElementNode:
+		open := "<" + n.Data + canonicalAttrs(n) + ">"
+		if isVoidElement(n.Data) {
+			b.WriteString(indent + open + "\n")
+			return
+		}
+		closeTag := "</" + n.Data + ">"
+		if keepWhitespace[n.Data] {
+			var inner strings.Builder
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					inner.WriteString(c.Data)
+				} else {
+					_ = html.Render(&inner, c)
+				}
+			}
+			b.WriteString(indent + open + inner.String() + closeTag + "\n")
+			return
+		}
+		// An element holding only text stays on one line
+		if c := n.FirstChild; c == nil || (c.Type == html.TextNode && c.NextSibling == nil) {
+			text := ""
+			if c != nil {
+				text = html.EscapeString(strings.Join(strings.Fields(c.Data), " "))
+			}
+			b.WriteString(indent + open + text + closeTag + "\n")
+			return
+		}
+		b.WriteString(indent + open + "\n")
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeCanonical(b, c, depth+1)
+		}
+		b.WriteString(indent + closeTag + "\n")
+	}
+}
+
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
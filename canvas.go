@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/ysmood/gson"
+)
+
+// canvasDataJS exports the canvas backing store. Cross-origin content taints
+// the canvas, in which case toDataURL throws and null is returned.
+const canvasDataJS = `function() {
+	if (this.tagName !== 'CANVAS') throw new Error('element is not a <canvas>');
+	try {
+		return this.toDataURL('image/png');
+	} catch (e) {
+		return null;
+	}
+}`
+
+// canvasPixelsJS samples pixels in canvas coordinates. The canvas is copied
+// onto a 2D canvas first so WebGL canvases can be read too.
+const canvasPixelsJS = `function(points) {
+	if (this.tagName !== 'CANVAS') throw new Error('element is not a <canvas>');
+	const copy = document.createElement('canvas');
+	copy.width = this.width;
+	copy.height = this.height;
+	const ctx = copy.getContext('2d');
+	ctx.drawImage(this, 0, 0);
+	return points.map(([x, y]) => {
+		if (x < 0 || y < 0 || x >= this.width || y >= this.height) return {x, y, error: 'out of bounds'};
+		try {
+			const [r, g, b, a] = ctx.getImageData(x, y, 1, 1).data;
+			return {x, y, r, g, b, a};
+		} catch (e) {
+			return {x, y, error: 'canvas is tainted by cross-origin content'};
+		}
+	});
+}`
+
+// parsePoint parses "x,y" into integer canvas coordinates
+func parsePoint(v string) ([2]int, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return [2]int{}, fmt.Errorf("expected x,y, got %q", v)
+	}
+	var p [2]int
+	for i, s := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return [2]int{}, fmt.Errorf("expected x,y, got %q", v)
+		}
+		p[i] = n
+	}
+	return p, nil
+}
+
+func cmdCanvas(args []string, flags globalFlags) {
+	out := ""
+	var points [][2]int
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--out":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --out")
+			}
+			out = args[i]
+		case "--pixels":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --pixels")
+			}
+			for _, p := range strings.Split(args[i], ";") {
+				pt, err := parsePoint(p)
+				if err != nil {
+					fatalUsage("invalid --pixels: %v", err)
+				}
+				points = append(points, pt)
+			}
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("usage: bb canvas <selector> [--out file.png] [--pixels x,y[;x,y...]]")
+	}
+
+	_, _, page := withPage()
+	el, err := page.Element(positional[0])
+	if err != nil {
+		fatalNotFound(positional[0], err)
+	}
+
+	var pixels gson.JSON
+	if len(points) > 0 {
+		res, err := el.Eval(canvasPixelsJS, points)
+		if err != nil {
+			fatal("failed to read pixels: %v", err)
+		}
+		pixels = res.Value
+		if out == "" {
+			if flags.jsonOutput {
+				fmt.Println(pixels.JSON("", "  "))
+				return
+			}
+			printPixels(pixels)
+			return
+		}
+	}
+
+	if out == "" {
+		out = nextAvailableFile(filepath.Join(outputDir(), "canvas"), ".png")
+	}
+	size := saveCanvas(el, out)
+	if flags.jsonOutput {
+		result := map[string]interface{}{"file": out, "bytes": size}
+		if len(points) > 0 {
+			result["pixels"] = pixels
+		}
+		res, _ := json.Marshal(result)
+		fmt.Println(string(res))
+		return
+	}
+	if len(points) > 0 {
+		printPixels(pixels)
+	}
+	fmt.Printf("Saved %s (%d bytes)\n", out, size)
+}
+
+func printPixels(pixels gson.JSON) {
+	for _, p := range pixels.Arr() {
+		if p.Has("error") {
+			fmt.Printf("%d,%d error: %s\n", p.Get("x").Int(), p.Get("y").Int(), p.Get("error").Str())
+			continue
+		}
+		fmt.Printf("%d,%d rgba(%d, %d, %d, %d)\n", p.Get("x").Int(), p.Get("y").Int(),
+			p.Get("r").Int(), p.Get("g").Int(), p.Get("b").Int(), p.Get("a").Int())
+	}
+}
+
+// saveCanvas writes the canvas el as a PNG to out and returns its size
+func saveCanvas(el *rod.Element, out string) int {
+	res, err := el.Eval(canvasDataJS)
+	if err != nil {
+		fatal("canvas capture failed: %v", err)
+	}
+	var data []byte
+	if !res.Value.Nil() {
+		data, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(res.Value.Str(), "data:image/png;base64,"))
+		if err != nil {
+			fatal("canvas capture failed: %v", err)
+		}
+	} else {
+		// A tainted canvas can't be exported, but it can still be seen
+		fmt.Fprintln(os.Stderr, "warning: canvas is tainted by cross-origin content, using an element screenshot")
+		data, err = el.Screenshot(proto.PageCaptureScreenshotFormatPng, 0)
+		if err != nil {
+			fatal("screenshot failed: %v", err)
+		}
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		fatal("failed to write %s: %v", out, err)
+	}
+	recordArtifact("canvas", out)
+	return len(data)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/go-rod/stealth"
+)
+
+// linkCard is what a social network shows for a shared link
+type linkCard struct {
+	URL         string   `json:"url"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Image       string   `json:"image,omitempty"`
+	ImageWidth  int      `json:"image_width,omitempty"` // natural size, 0 if it didn't load
+	ImageHeight int      `json:"image_height,omitempty"`
+	Site        string   `json:"site"`
+	Style       string   `json:"style"` // large or summary (small image beside the text)
+	File        string   `json:"file"`
+	Warnings    []string `json:"warnings"`
+}
+
+// cardHTML is the preview template: a large card has the image on top, a
+// summary card a square thumbnail beside the text
+const cardHTML = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><style>
+body { margin: 0; padding: 16px; background: #fff; font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+.card { width: 560px; border: 1px solid #cfd9de; border-radius: 16px; overflow: hidden; color: #0f1419; display: flex; flex-direction: column; }
+.card.summary { flex-direction: row; }
+.image { display: block; width: 560px; height: 293px; object-fit: cover; background: #e1e8ed; }
+.summary .image { width: 130px; height: 130px; flex: none; border-right: 1px solid #cfd9de; }
+.text { padding: 12px 14px; display: flex; flex-direction: column; justify-content: center; gap: 3px; min-width: 0; }
+.site { color: #536471; font-size: 14px; }
+.title { font-size: 16px; font-weight: 600; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.desc { color: #536471; font-size: 14px; line-height: 19px; max-height: 38px; overflow: hidden; display: -webkit-box; -webkit-line-clamp: 2; -webkit-box-orient: vertical; }
+</style></head><body>
+<div class="card %s">%s<div class="text">
+<div class="site">%s</div><div class="title">%s</div><div class="desc">%s</div>
+</div></div>
+</body></html>`
+
+// cardImageJS loads the card image to learn whether it works and its size
+const cardImageJS = `(src) => new Promise(resolve => {
+	const img = new Image();
+	img.onload = () => resolve({width: img.naturalWidth, height: img.naturalHeight});
+	img.onerror = () => resolve({width: 0, height: 0});
+	setTimeout(() => resolve({width: 0, height: 0}), 10000);
+	img.src = src;
+})`
+
+// firstMeta returns the first non-empty metadata value; repeated tags count by
+// their first occurrence
+func firstMeta(values ...interface{}) string {
+	for _, v := range values {
+		if list, ok := v.([]interface{}); ok && len(list) > 0 {
+			v = list[0]
+		}
+		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+func cmdCard(args []string, flags globalFlags) {
+	usage := "usage: bb card <url> [file.png] [--style large|summary]"
+	var imgOpts imageOptions
+	style := ""
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		if next, ok := parseImageFlag(args, i, &imgOpts); ok {
+			i = next
+			continue
+		}
+		switch args[i] {
+		case "--style":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for --style")
+			}
+			style = args[i+1]
+			if style != "large" && style != "summary" {
+				fatalUsage("invalid --style: %s (expected large or summary)", style)
+			}
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				fatalUsage("%s", usage)
+			}
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		fatalUsage("%s", usage)
+	}
+	target := positional[0]
+	if !strings.Contains(target, "://") {
+		target = "https://" + target
+	}
+	file := "card" + imgOpts.ext()
+	if len(positional) > 1 {
+		file = positional[1]
+		imgOpts.inferFormat(file)
+	} else if dir := outputDir(); dir != "" {
+		file = nextAvailableFile(filepath.Join(dir, "card"), imgOpts.ext())
+	}
+
+	// The link is loaded and the card drawn in a tab of their own, so the
+	// active page is left alone
+	_, browser := ensureBrowser()
+	page := stealth.MustPage(browser)
+	defer page.Close()
+	activatePage(page)
+	page = page.Timeout(defaultTimeout)
+	prepareNavigation(page, target, false)
+	if err := page.Navigate(target); err != nil {
+		fatal("failed to open %s: %v", target, err)
+	}
+	if err := page.WaitLoad(); err != nil {
+		fatal("failed to load %s: %v", target, err)
+	}
+	res, err := page.Eval(metaJS)
+	if err != nil {
+		fatal("failed to read metadata: %v", err)
+	}
+	var meta struct {
+		URL         string                 `json:"url"`
+		Canonical   string                 `json:"canonical"`
+		Title       string                 `json:"title"`
+		Description string                 `json:"description"`
+		OpenGraph   map[string]interface{} `json:"openGraph"`
+		Twitter     map[string]interface{} `json:"twitter"`
+	}
+	if err := res.Value.Unmarshal(&meta); err != nil {
+		fatal("failed to read metadata: %v", err)
+	}
+
+	og, tw := meta.OpenGraph, meta.Twitter
+	card := linkCard{
+		URL:         meta.URL,
+		Title:       firstMeta(og["title"], tw["title"], meta.Title),
+		Description: firstMeta(og["description"], tw["description"], meta.Description),
+		Image:       firstMeta(og["image"], og["image:url"], og["image:secure_url"], tw["image"], tw["image:src"]),
+		Site:        firstMeta(og["site_name"]),
+		Style:       style,
+		File:        file,
+		Warnings:    []string{},
+	}
+	warn := func(format string, args ...interface{}) {
+		card.Warnings = append(card.Warnings, fmt.Sprintf(format, args...))
+	}
+	if card.Site == "" {
+		if u, err := url.Parse(firstMeta(og["url"], meta.Canonical, meta.URL)); err == nil {
+			card.Site = strings.TrimPrefix(u.Hostname(), "www.")
+		}
+	}
+	if card.Image != "" {
+		if u, err := url.Parse(meta.URL); err == nil {
+			if ref, err := u.Parse(card.Image); err == nil {
+				card.Image = ref.String()
+			}
+		}
+	}
+	if card.Style == "" {
+		card.Style = "large"
+		if firstMeta(tw["card"]) == "summary" {
+			card.Style = "summary"
+		}
+	}
+
+	switch {
+	case og["title"] != nil:
+	case tw["title"] != nil:
+		warn("no og:title; using twitter:title")
+	default:
+		warn("no og:title; using the page title")
+	}
+	if card.Description == "" {
+		warn("no og:description or meta description")
+	} else if len([]rune(card.Description)) > 200 {
+		warn("description is %d characters; it will be cut off", len([]rune(card.Description)))
+	}
+	if len([]rune(card.Title)) > 70 {
+		warn("title is %d characters; it will be cut off", len([]rune(card.Title)))
+	}
+
+	// Draw the card from what was found, the way a network's crawler would
+	// see it: metadata only, none of the page's own styles
+	prepareNavigation(page, "about:blank", false)
+	if err := page.Navigate("about:blank"); err != nil {
+		fatal("failed to open a blank page: %v", err)
+	}
+	image := ""
+	if card.Image == "" {
+		warn("no og:image or twitter:image; networks show a text-only card or none")
+	} else {
+		size, err := page.Eval(cardImageJS, card.Image)
+		if err != nil {
+			fatal("failed to load %s: %v", card.Image, err)
+		}
+		card.ImageWidth, card.ImageHeight = size.Value.Get("width").Int(), size.Value.Get("height").Int()
+		switch {
+		case card.ImageWidth == 0:
+			warn("image %s failed to load", card.Image)
+		case card.Style == "large" && (card.ImageWidth < 600 || card.ImageHeight < 314):
+			warn("image is %dx%d; large cards want at least 1200x630", card.ImageWidth, card.ImageHeight)
+		}
+		image = `<div class="image"></div>`
+		if card.ImageWidth > 0 {
+			image = fmt.Sprintf(`<img class="image" src="%s">`, html.EscapeString(card.Image))
+		}
+	}
+	doc := fmt.Sprintf(cardHTML, card.Style, image, html.EscapeString(card.Site), html.EscapeString(card.Title), html.EscapeString(card.Description))
+	if err := page.SetDocumentContent(doc); err != nil {
+		fatal("failed to render the card: %v", err)
+	}
+	if _, err := page.Eval(`() => Promise.all(Array.from(document.images, i => i.decode().catch(() => {})))`); err != nil {
+		fatal("failed to render the card: %v", err)
+	}
+	el, err := page.Element(".card")
+	if err != nil {
+		fatal("failed to render the card: %v", err)
+	}
+	data, err := el.Screenshot(proto.PageCaptureScreenshotFormatPng, 0)
+	if err != nil {
+		fatal("screenshot failed: %v", err)
+	}
+	if data, err = processImage(data, imgOpts); err != nil {
+		fatal("failed to process screenshot: %v", err)
+	}
+	if file == "-" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		fatal("failed to write screenshot: %v", err)
+	}
+	recordArtifact("card", file)
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(card, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Printf("Site:        %s\nTitle:       %s\nDescription: %s\n", card.Site, card.Title, card.Description)
+	if card.Image != "" {
+		fmt.Printf("Image:       %s", card.Image)
+		if card.ImageWidth > 0 {
+			fmt.Printf(" (%dx%d)", card.ImageWidth, card.ImageHeight)
+		}
+		fmt.Println()
+	}
+	for _, w := range card.Warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	fmt.Printf("Saved %s (%s card, %d bytes)\n", file, card.Style, len(data))
+}
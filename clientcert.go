@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// ClientCert is a TLS client certificate bb presents for some origins (all
+// https origins when Origins is empty)
+type ClientCert struct {
+	Cert    string   `json:"cert"`
+	Key     string   `json:"key"`
+	Origins []string `json:"origins,omitempty"` // host patterns, e.g. intranet.corp or *.corp.example
+}
+
+// clientCertSetter returns a setter for "<cert.pem> <key.pem> [--origin o]...".
+// Each call adds a certificate, replacing one for the same origins; "" clears
+// them all.
+func clientCertSetter(assign func(c *Config, v []ClientCert)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		if len(args) == 1 && args[0] == "" {
+			assign(c, nil)
+			return nil
+		}
+		var files, origins []string
+		for i := 0; i < len(args); i++ {
+			if args[i] == "--origin" {
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing value for --origin")
+				}
+				for _, o := range strings.Split(args[i], ",") {
+					host, err := originHost(o)
+					if err != nil {
+						return err
+					}
+					origins = append(origins, host)
+				}
+				continue
+			}
+			files = append(files, args[i])
+		}
+		if len(files) != 2 {
+			return fmt.Errorf("expected <cert.pem> <key.pem> [--origin https://host]")
+		}
+		for i, f := range files {
+			p, err := expandPath(f)
+			if err != nil {
+				return err
+			}
+			files[i] = p
+		}
+		if _, err := tls.LoadX509KeyPair(files[0], files[1]); err != nil {
+			return fmt.Errorf("invalid certificate or key: %w", err)
+		}
+		certs := []ClientCert{}
+		for _, cc := range c.ClientCerts {
+			if strings.Join(cc.Origins, ",") != strings.Join(origins, ",") {
+				certs = append(certs, cc)
+			}
+		}
+		assign(c, append(certs, ClientCert{Cert: files[0], Key: files[1], Origins: origins}))
+		return nil
+	}
+}
+
+// originHost reduces an origin (https://host:port) to the host pattern
+func originHost(o string) (string, error) {
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(o), "https://"), "http://")
+	host = strings.TrimSuffix(host, "/")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return "", fmt.Errorf("invalid origin %q (expected https://host or *.domain)", o)
+	}
+	return host, nil
+}
+
+func formatClientCerts(certs []ClientCert) string {
+	var parts []string
+	for _, cc := range certs {
+		p := quoteArgs([]string{cc.Cert, cc.Key})
+		if len(cc.Origins) > 0 {
+			p += " --origin " + strings.Join(cc.Origins, ",")
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// clientCertFor returns the certificate configured for host
+func clientCertFor(certs []ClientCert, host string) *ClientCert {
+	var fallback *ClientCert
+	for i, cc := range certs {
+		if len(cc.Origins) == 0 && fallback == nil {
+			fallback = &certs[i]
+		}
+		for _, o := range cc.Origins {
+			if ok, _ := path.Match(o, host); ok || o == host {
+				return &certs[i]
+			}
+		}
+	}
+	return fallback
+}
+
+// certProxyPAC routes the origins with a certificate through the proxy and
+// everything else directly
+func certProxyPAC(certs []ClientCert, port int) string {
+	var conds []string
+	for _, cc := range certs {
+		if len(cc.Origins) == 0 {
+			conds = []string{"true"}
+			break
+		}
+		for _, o := range cc.Origins {
+			conds = append(conds, fmt.Sprintf("shExpMatch(host, %q)", o))
+		}
+	}
+	return fmt.Sprintf(`function FindProxyForURL(url, host) {
+  if (url.substring(0, 6) == "https:" && (%s)) return "PROXY 127.0.0.1:%d";
+  return "DIRECT";
+}`, strings.Join(conds, " || "), port)
+}
+
+func certProxyLogPath() string {
+	return filepath.Join(stateDir(), "cert-proxy.log")
+}
+
+// certProxyAuthPath holds the password the running proxy asks for, readable
+// only by the user; bb hands it to Chrome when the proxy challenges it
+func certProxyAuthPath() string {
+	return filepath.Join(stateDir(), "cert-proxy.auth")
+}
+
+// certProxyRealm is the realm of the proxy's challenge, so bb answers it and
+// no other proxy's
+const certProxyRealm = "bb client certificate proxy"
+
+// certProxyPatterns returns the requests Chrome sends through the running
+// client certificate proxy and the password it asks for
+func certProxyPatterns() ([]*proto.FetchRequestPattern, string) {
+	certs := loadConfig().ClientCerts
+	secret, err := os.ReadFile(certProxyAuthPath())
+	if err != nil || len(certs) == 0 {
+		return nil, ""
+	}
+	var patterns []*proto.FetchRequestPattern
+	add := func(p string) {
+		patterns = append(patterns, &proto.FetchRequestPattern{URLPattern: p, RequestStage: proto.FetchRequestStageRequest})
+	}
+	for _, cc := range certs {
+		if len(cc.Origins) == 0 {
+			patterns = nil
+			add("https://*")
+			break
+		}
+		for _, o := range cc.Origins {
+			add("https://" + o + "/*")
+			add("https://" + o + ":*")
+		}
+	}
+	return patterns, strings.TrimSpace(string(secret))
+}
+
+// startCertProxy starts the client certificate proxy for a browser about to
+// launch and points Chrome at it. Chrome can't be handed a certificate on the
+// command line, so the proxy terminates TLS for the configured origins with
+// a key Chrome is told to trust, and connects upstream with the certificate.
+// The returned function hands the proxy Chrome's PID; it exits with Chrome.
+func startCertProxy(l *launcher.Launcher) (*launcher.Launcher, func(pid int)) {
+	bin, err := os.Executable()
+	if err != nil {
+		fatal("failed to find the bb binary: %v", err)
+	}
+	logFile, err := os.Create(certProxyLogPath())
+	if err != nil {
+		fatal("failed to create %s: %v", certProxyLogPath(), err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(bin, "__cert-proxy")
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		fatal("failed to start the client certificate proxy: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fatal("failed to start the client certificate proxy: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		fatal("failed to start the client certificate proxy: %v", err)
+	}
+	var ready struct {
+		Port int    `json:"port"`
+		SPKI string `json:"spki"`
+		PAC  string `json:"pac"`
+	}
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	if err := json.Unmarshal([]byte(line), &ready); err != nil {
+		_ = cmd.Process.Kill()
+		msg, _ := os.ReadFile(certProxyLogPath())
+		fatal("failed to start the client certificate proxy: %s", strings.TrimPrefix(strings.TrimSpace(string(msg)), "error: "))
+	}
+	_ = cmd.Process.Release()
+
+	l = l.Set("proxy-pac-url", "data:application/x-ns-proxy-autoconfig;base64,"+base64.StdEncoding.EncodeToString([]byte(ready.PAC))).
+		Set("ignore-certificate-errors-spki-list", ready.SPKI)
+	return l, func(pid int) {
+		fmt.Fprintln(stdin, pid)
+		stdin.Close()
+	}
+}
+
+// cmdCertProxy runs the detached client certificate proxy
+func cmdCertProxy() {
+	certs := loadConfig().ClientCerts
+	if len(certs) == 0 {
+		fatal("no client certificates configured")
+	}
+	pairs := map[string]tls.Certificate{}
+	for _, cc := range certs {
+		pair, err := tls.LoadX509KeyPair(cc.Cert, cc.Key)
+		if err != nil {
+			fatal("failed to load %s: %v", cc.Cert, err)
+		}
+		pairs[cc.Cert] = pair
+	}
+
+	// One key signs a certificate per host; Chrome trusts it by its SPKI hash
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		fatal("%v", err)
+	}
+	spki, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sum := sha256.Sum256(spki)
+	var mu sync.Mutex
+	leaves := map[string]*tls.Certificate{}
+	leafFor := func(host string) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if c, ok := leaves[host]; ok {
+			return c, nil
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: host},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = []net.IP{ip}
+		} else {
+			tmpl.DNSNames = []string{host}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			return nil, err
+		}
+		leaves[host] = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+		return leaves[host], nil
+	}
+
+	// Any local process can connect to the port; only Chrome gets the
+	// password, which is new for every launch
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		fatal("%v", err)
+	}
+	password := hex.EncodeToString(secret)
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("bb:"+password))
+	_ = os.MkdirAll(stateDir(), 0755)
+	if err := os.WriteFile(certProxyAuthPath(), []byte(password+"\n"), 0600); err != nil {
+		fatal("failed to write %s: %v", certProxyAuthPath(), err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fatal("%v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ready, _ := json.Marshal(map[string]any{"port": port, "spki": base64.StdEncoding.EncodeToString(sum[:]), "pac": certProxyPAC(certs, port)})
+	fmt.Println(string(ready))
+
+	// Exit with the browser, or right away if it never launched
+	go func() {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if pid, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+			for syscall.Kill(pid, 0) == nil {
+				time.Sleep(2 * time.Second)
+			}
+		}
+		_ = os.Remove(certProxyAuthPath())
+		os.Exit(0)
+	}()
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodConnect {
+				http.Error(w, "bb's client certificate proxy only tunnels https", http.StatusMethodNotAllowed)
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Proxy-Authorization")), []byte(wantAuth)) != 1 {
+				w.Header().Set("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q", certProxyRealm))
+				http.Error(w, "bb's client certificate proxy needs the password of this launch", http.StatusProxyAuthRequired)
+				return
+			}
+			host, port, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host, port = r.Host, "443"
+			}
+			cc := clientCertFor(certs, host)
+			hj, ok := w.(http.Hijacker)
+			if !ok {
+				http.Error(w, "hijacking unsupported", http.StatusInternalServerError)
+				return
+			}
+			conn, buf, err := hj.Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			fmt.Fprint(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+			var client net.Conn = &bufferedConn{conn, buf.Reader}
+			if cc == nil {
+				upstream, err := net.Dial("tcp", net.JoinHostPort(host, port))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %s: %v\n", r.Host, err)
+					return
+				}
+				pipe(client, upstream)
+				return
+			}
+			// HTTP/1.1 on both sides, so the streams can be piped as they are
+			leaf, err := leafFor(host)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s: %v\n", host, err)
+				return
+			}
+			down := tls.Server(client, &tls.Config{Certificates: []tls.Certificate{*leaf}, NextProtos: []string{"http/1.1"}})
+			if err := down.Handshake(); err != nil {
+				return
+			}
+			up, err := tls.Dial("tcp", net.JoinHostPort(host, port), &tls.Config{
+				ServerName:   host,
+				Certificates: []tls.Certificate{pairs[cc.Cert]},
+				NextProtos:   []string{"http/1.1"},
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s: %v\n", r.Host, err)
+				return
+			}
+			pipe(down, up)
+		}),
+	}
+	_ = srv.Serve(ln)
+}
+
+// bufferedConn reads what the HTTP server buffered before the connection was
+// hijacked
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// pipe copies between a and b until either side closes
+func pipe(a, b net.Conn) {
+	defer b.Close()
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(a, b); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(b, a); done <- struct{}{} }()
+	<-done
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// ClockOverride pins the page clock to a fixed instant. With Tick set, time
+// keeps running from that instant at normal speed.
+type ClockOverride struct {
+	Time  time.Time `json:"time"`
+	Tick  bool      `json:"tick,omitempty"`
+	SetAt time.Time `json:"set_at"`
+}
+
+// clockJS replaces Date and performance.now. Re-running it only updates the
+// mocked instant, so it is safe to apply on every invocation.
+const clockJS = `(base, tick, setAt) => {
+	const RealDate = window.__bbRealDate || Date;
+	const realPerfNow = window.__bbRealPerfNow || performance.now.bind(performance);
+	window.__bbRealDate = RealDate;
+	window.__bbRealPerfNow = realPerfNow;
+
+	const now = () => tick ? base + (RealDate.now() - setAt) : base;
+	function MockDate(...args) {
+		if (!new.target) return new RealDate(now()).toString();
+		return args.length ? new RealDate(...args) : new RealDate(now());
+	}
+	MockDate.prototype = RealDate.prototype;
+	MockDate.now = now;
+	MockDate.parse = RealDate.parse;
+	MockDate.UTC = RealDate.UTC;
+	window.Date = MockDate;
+
+	const frozen = realPerfNow();
+	performance.now = tick ? realPerfNow : () => frozen;
+}`
+
+const clockRestoreJS = `() => {
+	if (window.__bbRealDate) window.Date = window.__bbRealDate;
+	if (window.__bbRealPerfNow) performance.now = window.__bbRealPerfNow;
+}`
+
+// applyClock installs the clock override in the current document and in
+// documents loaded while this invocation is attached
+func applyClock(page *rod.Page, c *ClockOverride) {
+	base := c.Time.UnixMilli()
+	setAt := c.SetAt.UnixMilli()
+	_, _ = page.EvalOnNewDocument(fmt.Sprintf(`(%s)(%d, %t, %d)`, clockJS, base, c.Tick, setAt))
+	_, _ = page.Eval(clockJS, base, c.Tick, setAt)
+}
+
+// parseClockTime accepts RFC 3339 timestamps or plain dates (midnight UTC)
+func parseClockTime(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected RFC 3339, e.g. 2024-01-01T00:00:00Z)", v)
+}
+
+func cmdClock(args []string) {
+	if len(args) < 1 {
+		fatalUsage("usage: bb clock set <time> [--tick] | bb clock clear | bb clock status")
+	}
+
+	switch args[0] {
+	case "set":
+		tick := false
+		var positional []string
+		for _, a := range args[1:] {
+			if a == "--tick" {
+				tick = true
+			} else {
+				positional = append(positional, a)
+			}
+		}
+		if len(positional) != 1 {
+			fatalUsage("usage: bb clock set <time> [--tick]")
+		}
+		t, err := parseClockTime(positional[0])
+		if err != nil {
+			fatalUsage("%v", err)
+		}
+		s, _, page := withPage()
+		s.Clock = &ClockOverride{Time: t, Tick: tick, SetAt: time.Now()}
+		if err := saveState(s); err != nil {
+			fatal("failed to save state: %v", err)
+		}
+		applyClock(page, s.Clock)
+		mode := "frozen"
+		if tick {
+			mode = "ticking"
+		}
+		fmt.Printf("Clock set to %s (%s)\n", t.Format(time.RFC3339), mode)
+	case "clear":
+		s, _, page := withPage()
+		s.Clock = nil
+		if err := saveState(s); err != nil {
+			fatal("failed to save state: %v", err)
+		}
+		_, _ = page.Eval(clockRestoreJS)
+		fmt.Println("Clock restored")
+	case "status":
+		s, err := loadState()
+		if err != nil || s.Clock == nil {
+			fmt.Println("Clock not overridden")
+			return
+		}
+		now := s.Clock.Time
+		if s.Clock.Tick {
+			now = now.Add(time.Since(s.Clock.SetAt))
+			fmt.Printf("Clock ticking, now %s\n", now.Format(time.RFC3339))
+		} else {
+			fmt.Printf("Clock frozen at %s\n", now.Format(time.RFC3339))
+		}
+	default:
+		fatalUsage("unknown clock subcommand: %s", args[0])
+	}
+}
@@ -0,0 +1,781 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Config holds persistent user preferences, stored in ~/.bb/config.json.
+// Unlike State it survives `bb stop`. Launch options take effect the next
+// time Chrome starts.
+type Config struct {
+	Headless   string `json:"headless,omitempty"`
+	GPU        string `json:"gpu,omitempty"`
+	Fonts      string `json:"fonts,omitempty"`
+	FontFamily string `json:"font_family,omitempty"`
+	OutputDir  string `json:"output_dir,omitempty"`
+
+	DisableAnimations bool     `json:"disable_animations,omitempty"`
+	BypassCSP         bool     `json:"bypass_csp,omitempty"`
+	NoJSDomains       []string `json:"nojs_domains,omitempty"`
+
+	Timeout      float64 `json:"timeout,omitempty"` // seconds
+	Viewport     string  `json:"viewport,omitempty"`
+	UserAgent    string  `json:"user_agent,omitempty"`
+	DownloadDir  string  `json:"download_dir,omitempty"`
+	OutputFormat string  `json:"output_format,omitempty"`
+	ExtractLimit int     `json:"extract_limit,omitempty"` // KB
+	ChromeBin    string  `json:"chrome_bin,omitempty"`
+
+	ChromeArgs []string `json:"chrome_args,omitempty"`
+	LoadPolicy []string `json:"load_policy,omitempty"` // blocked resource classes
+
+	ClientCerts []ClientCert `json:"client_certs,omitempty"`
+
+	SSOAllowlist         []string `json:"sso_allowlist,omitempty"`          // --auth-server-allowlist
+	SSODelegateAllowlist []string `json:"sso_delegate_allowlist,omitempty"` // --auth-negotiate-delegate-allowlist
+
+	Throttle    *Throttle   `json:"throttle,omitempty"`     // set by bb throttle
+	CPUThrottle float64     `json:"cpu_throttle,omitempty"` // set by bb perf --cpu
+	UserStyles  []UserStyle `json:"user_styles,omitempty"`  // set by bb css
+
+	SlowPhases map[string]float64 `json:"slow_phases,omitempty"` // seconds before a phase is reported slow
+}
+
+func configPath() string {
+	return filepath.Join(stateDir(), "config.json")
+}
+
+// loadConfig returns the saved config, or an empty one if none exists
+func loadConfig() *Config {
+	var c Config
+	data, err := os.ReadFile(configPath())
+	if err != nil {
+		return &c
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		fatal("corrupt config file %s: %v", configPath(), err)
+	}
+	return &c
+}
+
+func saveConfig(c *Config) error {
+	if err := os.MkdirAll(stateDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configPath(), data, 0644)
+}
+
+// configOption describes one key accepted by `bb config`
+type configOption struct {
+	name  string
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, args []string) error
+}
+
+// oneOf returns a setter that accepts a single value from the allowed list
+// (or "" to reset to the default) and stores it via assign
+func oneOf(allowed []string, assign func(c *Config, v string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		v := strings.Join(args, " ")
+		if v == "" {
+			assign(c, "")
+			return nil
+		}
+		for _, a := range allowed {
+			if v == a {
+				assign(c, v)
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid value %q (expected %s)", v, strings.Join(allowed, ", "))
+	}
+}
+
+// expandPath resolves ~ and relative paths so stored paths work from any cwd
+func expandPath(p string) (string, error) {
+	if rest, ok := strings.CutPrefix(p, "~"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		p = filepath.Join(home, rest)
+	}
+	return filepath.Abs(p)
+}
+
+// dirSetter returns a setter that stores an existing directory as an absolute path
+func dirSetter(assign func(c *Config, v string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		v := strings.Join(args, " ")
+		if v == "" {
+			assign(c, "")
+			return nil
+		}
+		dir, err := expandPath(v)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		assign(c, dir)
+		return nil
+	}
+}
+
+// mkdirSetter is like dirSetter but creates the directory if needed
+func mkdirSetter(assign func(c *Config, v string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		v := strings.Join(args, " ")
+		if v == "" {
+			assign(c, "")
+			return nil
+		}
+		dir, err := expandPath(v)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		assign(c, dir)
+		return nil
+	}
+}
+
+// boolSetter returns a setter that parses true/false ("" resets to false)
+func boolSetter(assign func(c *Config, v bool)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		v := strings.Join(args, " ")
+		if v == "" {
+			assign(c, false)
+			return nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid value %q (expected true or false)", v)
+		}
+		assign(c, b)
+		return nil
+	}
+}
+
+// stringSetter returns a setter that stores its arguments verbatim
+func stringSetter(assign func(c *Config, v string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		assign(c, strings.Join(args, " "))
+		return nil
+	}
+}
+
+// numberSetter returns a setter that parses a positive number ("" resets to
+// the default); integer rejects fractions
+func numberSetter(integer bool, assign func(c *Config, v float64)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		v := strings.Join(args, " ")
+		if v == "" {
+			assign(c, 0)
+			return nil
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n <= 0 || (integer && n != float64(int(n))) {
+			kind := "number"
+			if integer {
+				kind = "whole number"
+			}
+			return fmt.Errorf("invalid value %q (expected a positive %s)", v, kind)
+		}
+		assign(c, n)
+		return nil
+	}
+}
+
+// formatNumber renders a numeric setting, with 0 meaning unset
+func formatNumber(n float64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// viewportSetter returns a setter that accepts WIDTHxHEIGHT
+func viewportSetter(assign func(c *Config, v string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		v := strings.Join(args, " ")
+		if v == "" {
+			assign(c, "")
+			return nil
+		}
+		if _, _, err := parseViewport(v); err != nil {
+			return err
+		}
+		assign(c, v)
+		return nil
+	}
+}
+
+// parseViewport parses WIDTHxHEIGHT, e.g. 1280x800
+func parseViewport(v string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.ToLower(v), "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid viewport %q (expected WIDTHxHEIGHT, e.g. 1280x800)", v)
+	}
+	return width, height, nil
+}
+
+// binarySetter returns a setter that stores an executable as an absolute
+// path, looking bare names up in PATH
+func binarySetter(assign func(c *Config, v string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		v := strings.Join(args, " ")
+		if v == "" {
+			assign(c, "")
+			return nil
+		}
+		if !strings.ContainsRune(v, filepath.Separator) && !strings.HasPrefix(v, "~") {
+			bin, err := exec.LookPath(v)
+			if err != nil {
+				return fmt.Errorf("%s not found in PATH", v)
+			}
+			v = bin
+		}
+		bin, err := expandPath(v)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(bin); err != nil || info.IsDir() {
+			return fmt.Errorf("%s is not an executable", bin)
+		}
+		assign(c, bin)
+		return nil
+	}
+}
+
+// chromeArgsSetter returns a setter for Chrome command line flags, split like
+// a shell would ("" clears them)
+func chromeArgsSetter(assign func(c *Config, v []string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		var all []string
+		for _, a := range args {
+			split, err := splitCommandLine(a)
+			if err != nil {
+				return err
+			}
+			all = append(all, split...)
+		}
+		for _, a := range all {
+			if !strings.HasPrefix(a, "--") {
+				return fmt.Errorf("invalid Chrome flag %q (expected --name or --name=value)", a)
+			}
+		}
+		assign(c, all)
+		return nil
+	}
+}
+
+// quoteArgs joins args for display, quoting those with spaces
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = a
+		if strings.ContainsAny(a, " \t\"'") {
+			quoted[i] = strconv.Quote(a)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// domainsSetter returns a setter for a list of host names, separated by
+// spaces or commas ("" clears the list)
+func domainsSetter(assign func(c *Config, v []string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		var domains []string
+		for _, f := range strings.FieldsFunc(strings.Join(args, " "), func(r rune) bool { return r == ',' || r == ' ' }) {
+			d := strings.ToLower(strings.Trim(f, "."))
+			if strings.Contains(d, "/") {
+				return fmt.Errorf("invalid domain %q (expected a host name like example.com)", f)
+			}
+			domains = append(domains, d)
+		}
+		assign(c, domains)
+		return nil
+	}
+}
+
+var configOptions = []configOption{
+	{
+		name:  "headless",
+		usage: "Headless mode: new, old, or false for a visible window (default: Chrome's default)",
+		get:   func(c *Config) string { return c.Headless },
+		set:   oneOf([]string{"new", "old", "false"}, func(c *Config, v string) { c.Headless = v }),
+	},
+	{
+		name:  "gpu",
+		usage: "GPU mode: off, on, or swiftshader for software WebGL (default: off)",
+		get:   func(c *Config) string { return c.GPU },
+		set:   oneOf([]string{"off", "on", "swiftshader"}, func(c *Config, v string) { c.GPU = v }),
+	},
+	{
+		name:  "fonts",
+		usage: "Extra font directory (e.g. Noto, Noto Color Emoji) made visible to Chrome",
+		get:   func(c *Config) string { return c.Fonts },
+		set:   dirSetter(func(c *Config, v string) { c.Fonts = v }),
+	},
+	{
+		name:  "font-family",
+		usage: "Default font family for pages that don't specify one",
+		get:   func(c *Config) string { return c.FontFamily },
+		set:   stringSetter(func(c *Config, v string) { c.FontFamily = v }),
+	},
+	{
+		name:  "output-dir",
+		usage: "Directory for auto-named screenshots and PDFs, in date-stamped subfolders (default: cwd)",
+		get:   func(c *Config) string { return c.OutputDir },
+		set:   mkdirSetter(func(c *Config, v string) { c.OutputDir = v }),
+	},
+	{
+		name:  "disable-animations",
+		usage: "Disable CSS animations, transitions and smooth scrolling on every page",
+		get:   func(c *Config) string { return strconv.FormatBool(c.DisableAnimations) },
+		set:   boolSetter(func(c *Config, v bool) { c.DisableAnimations = v }),
+	},
+	{
+		name:  "bypass-csp",
+		usage: "Ignore the pages' Content Security Policy, so injected scripts and styles run on strict sites",
+		get:   func(c *Config) string { return strconv.FormatBool(c.BypassCSP) },
+		set:   boolSetter(func(c *Config, v bool) { c.BypassCSP = v }),
+	},
+	{
+		name:  "nojs-domains",
+		usage: "Domains (and their subdomains) whose pages bb loads with JavaScript disabled",
+		get:   func(c *Config) string { return strings.Join(c.NoJSDomains, ",") },
+		set:   domainsSetter(func(c *Config, v []string) { c.NoJSDomains = v }),
+	},
+	{
+		name:  "timeout",
+		usage: "Default timeout in seconds (default: 30; BB_TIMEOUT and --timeout override it)",
+		get:   func(c *Config) string { return formatNumber(c.Timeout) },
+		set:   numberSetter(false, func(c *Config, v float64) { c.Timeout = v }),
+	},
+	{
+		name:  "slow-phases",
+		usage: "Seconds before a phase is reported slow, e.g. navigate=20,wait=15 (default: connect=5,extract=5,navigate=10,wait=10)",
+		get:   func(c *Config) string { return formatSlowPhases(c.SlowPhases) },
+		set:   slowPhasesSetter(func(c *Config, v map[string]float64) { c.SlowPhases = v }),
+	},
+	{
+		name:  "viewport",
+		usage: "Window size as WIDTHxHEIGHT, e.g. 1280x800 (default: Chrome's default)",
+		get:   func(c *Config) string { return c.Viewport },
+		set:   viewportSetter(func(c *Config, v string) { c.Viewport = v }),
+	},
+	{
+		name:  "user-agent",
+		usage: "User agent string Chrome sends (default: Chrome's own)",
+		get:   func(c *Config) string { return c.UserAgent },
+		set:   stringSetter(func(c *Config, v string) { c.UserAgent = v }),
+	},
+	{
+		name:  "download-dir",
+		usage: "Directory for files the page downloads (default: Chrome's default)",
+		get:   func(c *Config) string { return c.DownloadDir },
+		set:   mkdirSetter(func(c *Config, v string) { c.DownloadDir = v }),
+	},
+	{
+		name:  "output-format",
+		usage: "text, or json to imply --json on every command (--no-json overrides it)",
+		get:   func(c *Config) string { return c.OutputFormat },
+		set:   oneOf([]string{"text", "json"}, func(c *Config, v string) { c.OutputFormat = v }),
+	},
+	{
+		name:  "extract-limit",
+		usage: "Maximum readable content open and extract print, in KB (default: 50)",
+		get:   func(c *Config) string { return formatNumber(float64(c.ExtractLimit)) },
+		set:   numberSetter(true, func(c *Config, v float64) { c.ExtractLimit = int(v) }),
+	},
+	{
+		name:  "chrome-bin",
+		usage: "Chrome or Chromium binary to launch (BB_CHROME_BIN overrides it)",
+		get:   func(c *Config) string { return c.ChromeBin },
+		set:   binarySetter(func(c *Config, v string) { c.ChromeBin = v }),
+	},
+	{
+		name:  "chrome-args",
+		usage: "Extra Chrome flags, e.g. \"--lang=de --load-extension=/path\" (apply after bb restart)",
+		get:   func(c *Config) string { return quoteArgs(c.ChromeArgs) },
+		set:   chromeArgsSetter(func(c *Config, v []string) { c.ChromeArgs = v }),
+	},
+	{
+		name:  "load-policy",
+		usage: "--block images,fonts,media,stylesheets,scripts: resource types pages don't load",
+		get: func(c *Config) string {
+			if len(c.LoadPolicy) == 0 {
+				return ""
+			}
+			return "--block " + strings.Join(c.LoadPolicy, ",")
+		},
+		set: loadPolicySetter(func(c *Config, v []string) { c.LoadPolicy = v }),
+	},
+	{
+		name:  "sso-allowlist",
+		usage: "Hosts Chrome may sign in to with Kerberos/NTLM, e.g. *.corp.example.com (apply after bb restart)",
+		get:   func(c *Config) string { return strings.Join(c.SSOAllowlist, ",") },
+		set:   domainsSetter(func(c *Config, v []string) { c.SSOAllowlist = v }),
+	},
+	{
+		name:  "sso-delegate-allowlist",
+		usage: "Hosts Chrome may delegate Kerberos credentials to (apply after bb restart)",
+		get:   func(c *Config) string { return strings.Join(c.SSODelegateAllowlist, ",") },
+		set:   domainsSetter(func(c *Config, v []string) { c.SSODelegateAllowlist = v }),
+	},
+	{
+		name:  "client-cert",
+		usage: "<cert.pem> <key.pem> [--origin https://host]: TLS client certificate to present (apply after bb restart)",
+		get:   func(c *Config) string { return formatClientCerts(c.ClientCerts) },
+		set:   clientCertSetter(func(c *Config, v []ClientCert) { c.ClientCerts = v }),
+	},
+}
+
+func findConfigOption(name string) *configOption {
+	for i := range configOptions {
+		if configOptions[i].name == name {
+			return &configOptions[i]
+		}
+	}
+	return nil
+}
+
+// outputDir returns today's subfolder of the configured output-dir, creating
+// it if needed, or "" to write auto-named files to the working directory
+func outputDir() string {
+	c := loadConfig()
+	if c.OutputDir == "" {
+		return ""
+	}
+	dir := filepath.Join(c.OutputDir, time.Now().Format("2006-01-02"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatal("failed to create output dir: %v", err)
+	}
+	return dir
+}
+
+// applyLaunchConfig adjusts Chrome launch flags according to the config
+func applyLaunchConfig(l *launcher.Launcher, c *Config) *launcher.Launcher {
+	switch c.Headless {
+	case "new":
+		l = l.HeadlessNew(true)
+	case "old":
+		l = l.Set("headless", "old")
+	case "false":
+		l = l.Headless(false)
+	}
+
+	switch c.GPU {
+	case "on":
+		l = l.Delete("disable-gpu").
+			Set("enable-gpu").
+			Set("ignore-gpu-blocklist")
+	case "swiftshader":
+		// Software rendering keeps WebGL working on machines without a GPU
+		l = l.Delete("disable-gpu").
+			Set("use-angle", "swiftshader").
+			Set("enable-unsafe-swiftshader").
+			Set("ignore-gpu-blocklist")
+	}
+
+	if c.Viewport != "" {
+		if w, h, err := parseViewport(c.Viewport); err == nil {
+			l = l.Set("window-size", fmt.Sprintf("%d,%d", w, h))
+		}
+	}
+	if c.UserAgent != "" {
+		l = l.Set("user-agent", c.UserAgent)
+	}
+	if c.ChromeBin != "" && os.Getenv("BB_CHROME_BIN") == "" {
+		l = l.Bin(c.ChromeBin)
+	}
+
+	// Integrated auth is only attempted for allowlisted hosts; others get
+	// a login prompt headless Chrome can't answer
+	if len(c.SSOAllowlist) > 0 {
+		l = l.Set("auth-server-allowlist", strings.Join(c.SSOAllowlist, ","))
+	}
+	if len(c.SSODelegateAllowlist) > 0 {
+		l = l.Set("auth-negotiate-delegate-allowlist", strings.Join(c.SSODelegateAllowlist, ","))
+	}
+
+	l = applyChromeArgs(l, c.ChromeArgs)
+
+	if c.Fonts != "" {
+		if file, err := writeFontConfig(c.Fonts); err == nil {
+			l = l.Env(append(os.Environ(), "FONTCONFIG_FILE="+file)...)
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: ignoring fonts dir: %v\n", err)
+		}
+	}
+	return l
+}
+
+// applyChromeArgs adds --name[=value] flags to the launch, replacing bb's own
+// setting of the same flag
+func applyChromeArgs(l *launcher.Launcher, args []string) *launcher.Launcher {
+	for _, a := range args {
+		name, value, ok := strings.Cut(strings.TrimPrefix(a, "--"), "=")
+		if ok {
+			l = l.Set(flags.Flag(name), value)
+		} else {
+			l = l.Set(flags.Flag(name))
+		}
+	}
+	return l
+}
+
+// writeFontConfig writes a fontconfig file that extends the system config
+// with dir, so minimal containers can render non-Latin text and emoji
+func writeFontConfig(dir string) (string, error) {
+	if err := os.MkdirAll(stateDir(), 0755); err != nil {
+		return "", err
+	}
+	conf := fmt.Sprintf(`<?xml version="1.0"?>
+<!DOCTYPE fontconfig SYSTEM "fonts.dtd">
+<fontconfig>
+  <include ignore_missing="yes">/etc/fonts/fonts.conf</include>
+  <dir>%s</dir>
+  <cachedir>%s</cachedir>
+</fontconfig>
+`, xmlText(dir), xmlText(filepath.Join(stateDir(), "font-cache")))
+	file := filepath.Join(stateDir(), "fonts.conf")
+	return file, os.WriteFile(file, []byte(conf), 0644)
+}
+
+// xmlText escapes a path for an XML element, so a directory named "R&D"
+// doesn't break the file
+func xmlText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// applyPageConfig applies per-page settings from the config. CDP overrides
+// are tied to the client session, so this runs on every invocation.
+func applyPageConfig(page *rod.Page) {
+	c := loadConfig()
+	if c.BypassCSP {
+		// Takes effect from the next document the page loads
+		_ = proto.PageSetBypassCSP{Enabled: true}.Call(page)
+	}
+	if c.FontFamily != "" {
+		_ = proto.PageSetFontFamilies{FontFamilies: &proto.PageFontFamilies{
+			Standard:  c.FontFamily,
+			SansSerif: c.FontFamily,
+		}}.Call(page)
+	}
+	if c.DisableAnimations {
+		// Reduced motion also makes well-behaved sites skip JS animations
+		_ = proto.EmulationSetEmulatedMedia{Features: []*proto.EmulationMediaFeature{
+			{Name: "prefers-reduced-motion", Value: "reduce"},
+		}}.Call(page)
+		injectStyle(page, "__bb_no_animations", noAnimationsCSS)
+	}
+	if c.DownloadDir != "" {
+		// Headless Chrome only saves downloads where it is told to
+		watchDownloads(page.Browser(), c.DownloadDir)
+		_ = proto.BrowserSetDownloadBehavior{
+			Behavior:      proto.BrowserSetDownloadBehaviorBehaviorAllow,
+			DownloadPath:  c.DownloadDir,
+			EventsEnabled: true,
+		}.Call(page.Browser())
+	}
+	if c.Throttle != nil {
+		_ = applyThrottle(page, c.Throttle)
+	}
+	if c.CPUThrottle > 1 {
+		_ = proto.EmulationSetCPUThrottlingRate{Rate: c.CPUThrottle}.Call(page)
+	}
+	for i, st := range c.UserStyles {
+		injectStyle(page, fmt.Sprintf("%s%d", userStyleID, i), st.CSS)
+	}
+}
+
+// downloadsWatched is set once this invocation listens for downloads
+var downloadsWatched bool
+
+// watchDownloads records the downloads that complete while this invocation
+// is attached as artifacts
+func watchDownloads(browser *rod.Browser, dir string) {
+	if downloadsWatched {
+		return
+	}
+	downloadsWatched = true
+	names := map[string]string{}
+	go browser.EachEvent(
+		func(e *proto.BrowserDownloadWillBegin) {
+			names[e.GUID] = e.SuggestedFilename
+		},
+		func(e *proto.BrowserDownloadProgress) {
+			name, ok := names[e.GUID]
+			if !ok || e.State == proto.BrowserDownloadProgressStateInProgress {
+				return
+			}
+			delete(names, e.GUID)
+			if e.State == proto.BrowserDownloadProgressStateCompleted {
+				recordArtifact("download", filepath.Join(dir, name))
+			}
+		},
+	)()
+}
+
+// extractLimit is the maximum size of printed readable content in bytes
+func extractLimit() int {
+	if kb := loadConfig().ExtractLimit; kb > 0 {
+		return kb * 1024
+	}
+	return 50 * 1024
+}
+
+// scriptsDisabledFor reports whether u is on one of the nojs-domains
+func scriptsDisabledFor(c *Config, u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, d := range c.NoJSDomains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareNavigation turns script execution off before page loads u if noJS
+// is set or u is on a nojs domain, and back on otherwise (a crawl reuses
+// its page). Like the other overrides it lasts while this invocation is
+// attached, which covers the load.
+func prepareNavigation(page *rod.Page, u string, noJS bool) {
+	disabled := noJS || scriptsDisabledFor(loadConfig(), u)
+	if err := (proto.EmulationSetScriptExecutionDisabled{Value: disabled}).Call(page); err != nil {
+		fatal("failed to set JavaScript execution: %v", err)
+	}
+}
+
+const noAnimationsCSS = `*, *::before, *::after {
+	animation-duration: 0s !important;
+	animation-delay: 0s !important;
+	animation-iteration-count: 1 !important;
+	transition-duration: 0s !important;
+	transition-delay: 0s !important;
+	scroll-behavior: auto !important;
+}`
+
+// injectStyle adds a <style> element with the given id to the current
+// document and to every document loaded while this invocation is attached
+func injectStyle(page *rod.Page, id, css string) {
+	js := fmt.Sprintf(`(() => {
+		const add = () => {
+			if (document.getElementById(%[1]q)) return;
+			const s = document.createElement('style');
+			s.id = %[1]q;
+			s.textContent = %[2]q;
+			(document.head || document.documentElement).appendChild(s);
+		};
+		if (document.documentElement) return add();
+		new MutationObserver((_, obs) => {
+			if (document.documentElement) { obs.disconnect(); add(); }
+		}).observe(document, {childList: true});
+	})()`, id, css)
+	_, _ = page.EvalOnNewDocument(js)
+	_, _ = page.Eval(`() => ` + js)
+}
+
+func cmdConfig(args []string, flags globalFlags) {
+	usage := "usage: bb config [list] | bb config get <key> | bb config set <key> <value>"
+	c := loadConfig()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			if len(args) != 1 {
+				fatalUsage("%s", usage)
+			}
+			args = nil
+		case "get":
+			if len(args) != 2 {
+				fatalUsage("%s", usage)
+			}
+			args = args[1:]
+		case "set":
+			if len(args) < 3 {
+				fatalUsage("%s", usage)
+			}
+			args = args[1:]
+		}
+	}
+
+	if len(args) == 0 {
+		if flags.jsonOutput {
+			values := map[string]string{}
+			for _, opt := range configOptions {
+				values[opt.name] = opt.get(c)
+			}
+			out, _ := json.MarshalIndent(values, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		width := 0
+		for _, opt := range configOptions {
+			width = max(width, len(opt.name))
+		}
+		for _, opt := range configOptions {
+			v := opt.get(c)
+			if v == "" {
+				v = "(default)"
+			}
+			fmt.Printf("%-*s %-12s %s\n", width, opt.name, v, opt.usage)
+		}
+		return
+	}
+
+	opt := findConfigOption(args[0])
+	if opt == nil {
+		var names []string
+		for _, o := range configOptions {
+			names = append(names, o.name)
+		}
+		fatalUsage("unknown config key %q (available: %s)", args[0], strings.Join(names, ", "))
+	}
+
+	if len(args) == 1 {
+		fmt.Println(opt.get(c))
+		return
+	}
+
+	if err := opt.set(c, args[1:]); err != nil {
+		fatalUsage("%s: %v", opt.name, err)
+	}
+	if err := saveConfig(c); err != nil {
+		fatal("failed to save config: %v", err)
+	}
+	fmt.Printf("%s = %s\n", opt.name, opt.get(c))
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+//go:embed consent-rules.json
+var builtinConsentRules []byte
+
+// consentRule clicks the accept button of one consent manager
+type consentRule struct {
+	Name   string `json:"name"`
+	Accept string `json:"accept"`           // selector of the accept button
+	Shadow string `json:"shadow,omitempty"` // host element whose shadow root holds it
+}
+
+// consentRules is the rule set: known consent managers first, then buttons
+// whose label is one of the phrases
+type consentRules struct {
+	Rules   []consentRule `json:"rules"`
+	Phrases []string      `json:"phrases"`
+}
+
+// autoConsent is set by --auto-consent
+var autoConsent bool
+
+// consentRulesPath is where bb consent update installs a newer rule set
+func consentRulesPath() string {
+	return filepath.Join(stateDir(), "consent-rules.json")
+}
+
+// parseConsentRules validates a rule set
+func parseConsentRules(data []byte) (*consentRules, error) {
+	var r consentRules
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid consent rules: %v", err)
+	}
+	for i, rule := range r.Rules {
+		if rule.Name == "" || rule.Accept == "" {
+			return nil, fmt.Errorf("invalid consent rules: rule %d needs a name and an accept selector", i+1)
+		}
+	}
+	if len(r.Rules) == 0 && len(r.Phrases) == 0 {
+		return nil, fmt.Errorf("invalid consent rules: no rules or phrases")
+	}
+	return &r, nil
+}
+
+// loadConsentRules returns the installed rule set, or the built-in one
+func loadConsentRules() *consentRules {
+	if data, err := os.ReadFile(consentRulesPath()); err == nil {
+		r, err := parseConsentRules(data)
+		if err != nil {
+			fatal("%s: %v", consentRulesPath(), err)
+		}
+		return r
+	}
+	r, err := parseConsentRules(builtinConsentRules)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// consentDismissJS clicks the first visible accept button a rule names, or
+// failing that a button labelled with one of the phrases that sits in
+// something banner-like: a dialog, a fixed or sticky box, an element named
+// after cookies or consent, or a frame showing such text.
+const consentDismissJS = `(cfg) => {
+	const visible = el => {
+		const r = el.getBoundingClientRect();
+		const s = getComputedStyle(el);
+		return r.width > 0 && r.height > 0 && s.visibility !== 'hidden' && s.display !== 'none' && s.opacity !== '0';
+	};
+	const label = el => (el.innerText || el.value || '').trim().replace(/\s+/g, ' ').slice(0, 60);
+	for (const rule of cfg.rules) {
+		let root = document;
+		if (rule.shadow) {
+			const host = document.querySelector(rule.shadow);
+			root = host && host.shadowRoot;
+			if (!root) continue;
+		}
+		let els = [];
+		try {
+			els = root.querySelectorAll(rule.accept);
+		} catch (e) {
+			continue;
+		}
+		for (const el of els) {
+			if (!visible(el)) continue;
+			el.click();
+			return {rule: rule.name, label: label(el)};
+		}
+	}
+
+	const norm = s => (s || '').replace(/\s+/g, ' ').trim().toLowerCase().replace(/[.!]+$/, '');
+	const phrases = new Set(cfg.phrases.map(norm));
+	const topic = /cookie|consent|privacy|gdpr|rgpd|dsgvo|datenschutz|tracking|confidentialit|privacidad|privacit/i;
+	const framed = window !== window.top && topic.test((document.body && document.body.innerText || '').slice(0, 5000));
+	const bannerLike = el => {
+		for (let a = el, i = 0; a && i < 10; a = a.parentElement, i++) {
+			const pos = getComputedStyle(a).position;
+			if (a.getAttribute('role') === 'dialog' || a.getAttribute('aria-modal') === 'true' || pos === 'fixed' || pos === 'sticky') return true;
+			if (topic.test((a.id || '') + ' ' + (a.getAttribute('class') || ''))) return true;
+			if (i >= 2 && i <= 5 && topic.test((a.innerText || '').slice(0, 2000))) return true;
+		}
+		return false;
+	};
+	for (const el of document.querySelectorAll('button, a, [role=button], input[type=button], input[type=submit]')) {
+		const text = norm(el.innerText || el.value || el.getAttribute('aria-label'));
+		if (!phrases.has(text) || !visible(el)) continue;
+		if (!framed && !bannerLike(el)) continue;
+		el.click();
+		return {rule: 'heuristic', label: label(el)};
+	}
+	return null;
+}`
+
+// consentResult says what dismissConsent clicked
+type consentResult struct {
+	Dismissed bool   `json:"dismissed"`
+	Rule      string `json:"rule,omitempty"`
+	Label     string `json:"label,omitempty"`
+	Frame     string `json:"frame,omitempty"` // URL of the iframe the banner was in
+}
+
+// dismissConsent looks for a consent banner in the page and its frames until
+// one is clicked or wait has passed. Consent managers often load after the
+// page, so a single look would miss them.
+func dismissConsent(page *rod.Page, wait time.Duration) consentResult {
+	rules := loadConsentRules()
+	deadline := time.Now().Add(wait)
+	for {
+		if r, _ := clickConsent(page, rules, ""); r.Dismissed {
+			return r
+		}
+		if iframes, err := page.Elements("iframe"); err == nil {
+			for _, el := range iframes {
+				var r consentResult
+				_ = inFrame(page, el, func(frame *rod.Page, src string) (err error) {
+					r, err = clickConsent(frame, rules, src)
+					return err
+				})
+				if r.Dismissed {
+					return r
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return consentResult{}
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// clickConsent runs consentDismissJS in one document
+func clickConsent(page *rod.Page, rules *consentRules, frame string) (consentResult, error) {
+	res, err := page.Eval(consentDismissJS, rules)
+	if err != nil || res.Value.Nil() {
+		return consentResult{}, err
+	}
+	r := consentResult{Dismissed: true, Rule: res.Value.Get("rule").Str(), Label: res.Value.Get("label").Str(), Frame: frame}
+	// Give the banner a moment to close and the page to react to the choice
+	time.Sleep(300 * time.Millisecond)
+	return r, nil
+}
+
+// reportAutoConsent dismisses a banner after a navigation when --auto-consent
+// is set; it goes to stderr, which keeps stdout the command's own output
+func reportAutoConsent(page *rod.Page) {
+	if !autoConsent {
+		return
+	}
+	if r := dismissConsent(page, 2*time.Second); r.Dismissed {
+		fmt.Fprintf(os.Stderr, "[dismissed %s consent banner]\n", r.Rule)
+	}
+}
+
+func cmdConsent(args []string, flags globalFlags) {
+	usage := "usage: bb consent dismiss [--wait seconds] | bb consent rules | bb consent update <file|url> | bb consent update --reset"
+	if len(args) == 0 {
+		fatalUsage("%s", usage)
+	}
+	switch args[0] {
+	case "dismiss":
+		wait := 2 * time.Second
+		for i := 1; i < len(args); i++ {
+			if args[i] != "--wait" || i+1 >= len(args) {
+				fatalUsage("%s", usage)
+			}
+			i++
+			d, err := time.ParseDuration(args[i] + "s")
+			if err != nil || d < 0 {
+				fatalUsage("invalid --wait: %s", args[i])
+			}
+			wait = d
+		}
+		_, _, page := withPage()
+		r := dismissConsent(page, wait)
+		if flags.jsonOutput {
+			out, _ := json.MarshalIndent(r, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if !r.Dismissed {
+			fmt.Println("No consent banner found")
+			return
+		}
+		where := ""
+		if r.Frame != "" {
+			where = " in frame " + r.Frame
+		}
+		fmt.Printf("Dismissed %s consent banner (clicked %q)%s\n", r.Rule, r.Label, where)
+	case "rules":
+		rules := loadConsentRules()
+		if flags.jsonOutput {
+			out, _ := json.MarshalIndent(rules, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		source := "built-in"
+		if _, err := os.Stat(consentRulesPath()); err == nil {
+			source = consentRulesPath()
+		}
+		fmt.Printf("%d rules, %d phrases (%s)\n", len(rules.Rules), len(rules.Phrases), source)
+		for _, r := range rules.Rules {
+			fmt.Printf("  %-24s %s\n", r.Name, r.Accept)
+		}
+	case "update":
+		if len(args) != 2 {
+			fatalUsage("%s", usage)
+		}
+		if args[1] == "--reset" {
+			if err := os.Remove(consentRulesPath()); err != nil && !os.IsNotExist(err) {
+				fatal("failed to remove %s: %v", consentRulesPath(), err)
+			}
+			fmt.Println("Using the built-in consent rules")
+			return
+		}
+		data, err := readSource(args[1])
+		if err != nil {
+			fatal("%v", err)
+		}
+		rules, err := parseConsentRules(data)
+		if err != nil {
+			fatal("%s: %v", args[1], err)
+		}
+		if err := os.MkdirAll(stateDir(), 0755); err != nil {
+			fatal("failed to create %s: %v", stateDir(), err)
+		}
+		if err := os.WriteFile(consentRulesPath(), data, 0644); err != nil {
+			fatal("failed to write %s: %v", consentRulesPath(), err)
+		}
+		fmt.Printf("Installed %d rules, %d phrases to %s\n", len(rules.Rules), len(rules.Phrases), consentRulesPath())
+	default:
+		fatalUsage("%s", usage)
+	}
+}
+
+// readSource reads a file or an http(s) URL
+func readSource(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src)
+	}
+	client := &http.Client{Timeout: defaultTimeout}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", src, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/ysmood/gson"
+)
+
+// consoleSerializerJS defines ser(value, level), which turns a logged value
+// into plain JSON. Objects deeper than depth are summarized the way DevTools
+// collapses them ("Array(3)", "Object"); cycles, DOM nodes and functions get
+// a short description instead of failing JSON.stringify.
+const consoleSerializerJS = `
+	const seen = new Set();
+	const summary = v => {
+		if (Array.isArray(v)) return 'Array(' + v.length + ')';
+		if (v instanceof Map || v instanceof Set) return v.constructor.name + '(' + v.size + ')';
+		return (v.constructor && v.constructor.name) || 'Object';
+	};
+	const ser = (v, level) => {
+		switch (typeof v) {
+		case 'undefined': return 'undefined';
+		case 'bigint': return v + 'n';
+		case 'symbol': return v.toString();
+		case 'function': return '[Function: ' + (v.name || 'anonymous') + ']';
+		case 'number': return isFinite(v) ? v : String(v);
+		case 'string': case 'boolean': return v;
+		}
+		if (v === null) return null;
+		if (v instanceof Node) {
+			if (v.nodeType !== 1) return v.nodeName;
+			return '<' + v.localName + (v.id ? '#' + v.id : '') + '>';
+		}
+		if (v instanceof Date) return isNaN(v) ? 'Invalid Date' : v.toISOString();
+		if (v instanceof RegExp) return String(v);
+		if (v instanceof Error) return v.stack || String(v);
+		if (seen.has(v)) return '[Circular]';
+		if (level >= depth) return summary(v);
+		seen.add(v);
+		let out;
+		if (Array.isArray(v) || ArrayBuffer.isView(v) || v instanceof Set) {
+			out = Array.from(v, x => ser(x, level + 1));
+		} else if (v instanceof Map) {
+			out = {};
+			for (const [k, x] of v) out[String(k)] = ser(x, level + 1);
+		} else {
+			out = {};
+			for (const k of Object.keys(v)) {
+				try {
+					out[k] = ser(v[k], level + 1);
+				} catch (e) {
+					out[k] = '[Thrown: ' + e.message + ']';
+				}
+			}
+		}
+		seen.delete(v);
+		return out;
+	};`
+
+// consoleValueJS serializes the object it is called on
+const consoleValueJS = `function(depth) {` + consoleSerializerJS + `
+	return JSON.stringify(ser(this, 0));
+}`
+
+// consoleTableJS rebuilds the rows and columns console.table displays for
+// the object it is called on, optionally restricted to the given columns
+const consoleTableJS = `function(depth, columns) {` + consoleSerializerJS + `
+	const cols = Array.isArray(columns) ? columns.map(String) : [];
+	const rows = [];
+	const isArray = Array.isArray(this);
+	for (const [i, row] of Object.entries(this)) {
+		const r = {'(index)': isArray ? Number(i) : i};
+		if (row !== null && typeof row === 'object') {
+			for (const k of Object.keys(row)) {
+				if (Array.isArray(columns) && !cols.includes(k)) continue;
+				if (!cols.includes(k)) cols.push(k);
+				r[k] = ser(row[k], 1);
+			}
+		} else {
+			if (!cols.includes('Value')) cols.push('Value');
+			r.Value = ser(row, 1);
+		}
+		rows.push(r);
+	}
+	return JSON.stringify({columns: ['(index)', ...cols], rows});
+}`
+
+// consoleTable is a console.table call as DevTools shows it; rows are
+// objects keyed by column
+type consoleTable struct {
+	Columns []string          `json:"columns"`
+	Rows    []json.RawMessage `json:"rows"`
+}
+
+// consoleMessage is one console API call with its arguments as JSON
+type consoleMessage struct {
+	Type  string            `json:"type"`
+	Text  string            `json:"text"`
+	Args  []json.RawMessage `json:"args"`
+	Table *consoleTable     `json:"table,omitempty"`
+}
+
+// consoleMessages returns the page's console messages, oldest first. Objects
+// are expanded expand levels deep; 0 keeps the CDP previews. Chrome replays
+// buffered console messages when the Runtime domain is enabled, so this also
+// sees output logged before bb attached.
+func consoleMessages(page *rod.Page, expand int) []consoleMessage {
+	p, cancel := page.WithCancel()
+	defer cancel()
+
+	var mu sync.Mutex
+	var calls []proto.RuntimeConsoleAPICalled
+	events := p.Event()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range events {
+			e := proto.RuntimeConsoleAPICalled{}
+			if !msg.Load(&e) {
+				continue
+			}
+			mu.Lock()
+			calls = append(calls, e)
+			mu.Unlock()
+		}
+	}()
+
+	if err := (proto.RuntimeEnable{}).Call(p); err != nil {
+		return nil
+	}
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	<-done
+
+	// The arguments' object ids stay valid after the replay, so they can be
+	// resolved past the shallow previews
+	var messages []consoleMessage
+	for _, e := range calls {
+		m := consoleMessage{Type: string(e.Type), Args: []json.RawMessage{}}
+		var parts []string
+		for _, arg := range e.Args {
+			value := consoleValue(page, arg, expand)
+			m.Args = append(m.Args, value)
+			if arg.Type == proto.RuntimeRemoteObjectTypeObject && expand > 0 && arg.Subtype != proto.RuntimeRemoteObjectSubtypeNode {
+				parts = append(parts, string(value))
+			} else {
+				parts = append(parts, remoteObjectString(arg))
+			}
+		}
+		m.Text = strings.Join(parts, " ")
+		if e.Type == proto.RuntimeConsoleAPICalledTypeTable && len(e.Args) > 0 && e.Args[0].ObjectID != "" {
+			var columns *proto.RuntimeRemoteObject
+			if len(e.Args) > 1 {
+				columns = e.Args[1]
+			}
+			m.Table = consoleTableOf(page, e.Args[0], columns, expand)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// consoleValue returns arg as JSON, expanding objects expand levels deep
+func consoleValue(page *rod.Page, arg *proto.RuntimeRemoteObject, expand int) json.RawMessage {
+	if arg.ObjectID != "" && expand > 0 {
+		res, err := proto.RuntimeCallFunctionOn{
+			FunctionDeclaration: consoleValueJS,
+			ObjectID:            arg.ObjectID,
+			Arguments:           []*proto.RuntimeCallArgument{{Value: gson.New(expand)}},
+			ReturnByValue:       true,
+		}.Call(page)
+		if err == nil && res.ExceptionDetails == nil && json.Valid([]byte(res.Result.Value.Str())) {
+			return json.RawMessage(res.Result.Value.Str())
+		}
+	}
+	switch {
+	case arg.Type == proto.RuntimeRemoteObjectTypeUndefined:
+		return json.RawMessage(`"undefined"`)
+	case arg.UnserializableValue != "" || arg.ObjectID != "":
+		s, _ := json.Marshal(remoteObjectString(arg))
+		return s
+	}
+	return json.RawMessage(arg.Value.JSON("", ""))
+}
+
+// consoleTableOf reconstructs the table a console.table call displayed
+func consoleTableOf(page *rod.Page, data, columns *proto.RuntimeRemoteObject, expand int) *consoleTable {
+	cols := &proto.RuntimeCallArgument{} // undefined
+	if columns != nil && columns.ObjectID != "" {
+		cols.ObjectID = columns.ObjectID
+	}
+	res, err := proto.RuntimeCallFunctionOn{
+		FunctionDeclaration: consoleTableJS,
+		ObjectID:            data.ObjectID,
+		Arguments: []*proto.RuntimeCallArgument{
+			{Value: gson.New(max(expand, 1))},
+			cols,
+		},
+		ReturnByValue: true,
+	}.Call(page)
+	if err != nil || res.ExceptionDetails != nil {
+		return nil
+	}
+	var t consoleTable
+	if json.Unmarshal([]byte(res.Result.Value.Str()), &t) != nil {
+		return nil
+	}
+	return &t
+}
+
+// printConsoleTable renders t as an aligned text table
+func printConsoleTable(t *consoleTable) {
+	cells := [][]string{t.Columns}
+	for _, raw := range t.Rows {
+		var row map[string]json.RawMessage
+		_ = json.Unmarshal(raw, &row)
+		line := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			v, ok := row[c]
+			if !ok {
+				continue
+			}
+			var s string
+			if json.Unmarshal(v, &s) != nil {
+				s = string(v)
+			}
+			line[i] = s
+		}
+		cells = append(cells, line)
+	}
+	widths := make([]int, len(t.Columns))
+	for _, line := range cells {
+		for i, s := range line {
+			widths[i] = max(widths[i], len(s))
+		}
+	}
+	for _, line := range cells {
+		var b strings.Builder
+		for i, s := range line {
+			if i > 0 {
+				b.WriteString("  ")
+			}
+			b.WriteString(s + strings.Repeat(" ", widths[i]-len(s)))
+		}
+		fmt.Println("  " + strings.TrimRight(b.String(), " "))
+	}
+}
+
+func cmdConsole(args []string, flags globalFlags) {
+	expand, tail := 1, 0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--expand", "--tail":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for %s", flag)
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				fatalUsage("invalid %s: %s", flag, args[i])
+			}
+			if flag == "--expand" {
+				expand = n
+			} else {
+				tail = n
+			}
+		default:
+			fatalUsage("usage: bb console [--expand N] [--tail N]")
+		}
+	}
+
+	_, _, page := withPage()
+	messages := consoleMessages(page, expand)
+	if tail > 0 && len(messages) > tail {
+		messages = messages[len(messages)-tail:]
+	}
+
+	if flags.jsonOutput {
+		if messages == nil {
+			messages = []consoleMessage{}
+		}
+		out, _ := json.MarshalIndent(messages, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	for _, m := range messages {
+		if m.Table != nil {
+			fmt.Printf("[%s]\n", m.Type)
+			printConsoleTable(m.Table)
+			continue
+		}
+		fmt.Printf("[%s] %s\n", m.Type, m.Text)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/stealth"
+)
+
+// pageLinksJS returns the page's http(s) links, absolute and without fragments
+const pageLinksJS = `() => {
+	const seen = new Set();
+	for (const a of document.querySelectorAll('a[href]')) {
+		try {
+			const u = new URL(a.getAttribute('href'), document.baseURI);
+			if (u.protocol !== 'http:' && u.protocol !== 'https:') continue;
+			u.hash = '';
+			seen.add(u.href);
+		} catch (e) {}
+	}
+	return Array.from(seen);
+}`
+
+// robotsRules holds the Allow/Disallow rules for "User-agent: *"
+type robotsRules struct {
+	allow, disallow []string
+}
+
+// allowed applies the longest matching rule; Allow wins ties
+func (r *robotsRules) allowed(path string) bool {
+	best, ok := -1, true
+	for _, p := range r.disallow {
+		if strings.HasPrefix(path, p) && len(p) > best {
+			best, ok = len(p), false
+		}
+	}
+	for _, p := range r.allow {
+		if strings.HasPrefix(path, p) && len(p) >= best {
+			best, ok = len(p), true
+		}
+	}
+	return ok
+}
+
+// fetchRobots reads the wildcard group of origin's robots.txt. A missing or
+// unreadable file allows everything.
+func fetchRobots(origin string) *robotsRules {
+	rules := &robotsRules{}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(origin + "/robots.txt")
+	if err != nil {
+		return rules
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rules
+	}
+	applies := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			applies = value == "*"
+		case "disallow":
+			if applies && value != "" {
+				rules.disallow = append(rules.disallow, value)
+			}
+		case "allow":
+			if applies && value != "" {
+				rules.allow = append(rules.allow, value)
+			}
+		}
+	}
+	return rules
+}
+
+// crawlEntry is one page in the index written by crawl and fetch-all
+type crawlEntry struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Depth int    `json:"depth"`
+	File  string `json:"file,omitempty"`
+	Wall  string `json:"wall,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+var slugUnsafe = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// crawlFileName names the output file for the n-th crawled URL
+func crawlFileName(n int, u string) string {
+	slug := u
+	if parsed, err := url.Parse(u); err == nil {
+		slug = parsed.Host + parsed.Path
+	}
+	slug = strings.Trim(slugUnsafe.ReplaceAllString(slug, "-"), "-")
+	if len(slug) > 80 {
+		slug = slug[:80]
+	}
+	return fmt.Sprintf("%03d-%s", n, slug)
+}
+
+func cmdCrawl(args []string, flags globalFlags) {
+	usage := "usage: bb crawl <url> [--depth N] [--max-pages N] [--same-origin] [--robots] [--format md|json] [--out dir]"
+	depth, maxPages := 1, 30
+	sameOrigin, robots := false, false
+	format, out := "md", ""
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--depth", "--max-pages":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for %s", flag)
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 || (flag == "--max-pages" && n < 1) {
+				fatalUsage("invalid %s: %s", flag, args[i])
+			}
+			if flag == "--depth" {
+				depth = n
+			} else {
+				maxPages = n
+			}
+		case "--same-origin":
+			sameOrigin = true
+		case "--robots":
+			robots = true
+		case "--format":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --format")
+			}
+			if args[i] != "md" && args[i] != "json" {
+				fatalUsage("invalid --format: %s (expected md or json)", args[i])
+			}
+			format = args[i]
+		case "--out":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --out")
+			}
+			out = args[i]
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("%s", usage)
+	}
+	start := positional[0]
+	if !strings.Contains(start, "://") {
+		start = "https://" + start
+	}
+	startURL, err := url.Parse(start)
+	if err != nil || startURL.Host == "" {
+		fatalUsage("invalid url: %s", start)
+	}
+	startURL.Fragment = ""
+	origin := startURL.Scheme + "://" + startURL.Host
+	if out == "" {
+		out = nextAvailableFile(filepath.Join(outputDir(), "crawl-"+slugUnsafe.ReplaceAllString(startURL.Host, "-")), "")
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		fatal("failed to create %s: %v", out, err)
+	}
+	rules := &robotsRules{}
+	if robots {
+		rules = fetchRobots(origin)
+	}
+
+	// Crawl in a tab of its own so the active page is left alone
+	_, browser := ensureBrowser()
+	base := stealth.MustPage(browser)
+	activatePage(base)
+	defer base.Close()
+
+	type queued struct {
+		url   string
+		depth int
+	}
+	queue := []queued{{startURL.String(), 0}}
+	seen := map[string]bool{startURL.String(): true}
+	var index []crawlEntry
+	for len(queue) > 0 && len(index) < maxPages {
+		item := queue[0]
+		queue = queue[1:]
+		entry := crawlEntry{URL: item.url, Depth: item.depth}
+		if !flags.jsonOutput {
+			fmt.Printf("[%d/%d] %s\n", len(index)+1, maxPages, item.url)
+		}
+
+		page := base.Timeout(defaultTimeout)
+		links, err := crawlPage(page, &entry, out, len(index)+1, format)
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		index = append(index, entry)
+
+		if item.depth >= depth {
+			continue
+		}
+		for _, link := range links {
+			u, err := url.Parse(link)
+			if err != nil || seen[link] {
+				continue
+			}
+			if sameOrigin && u.Scheme+"://"+u.Host != origin {
+				continue
+			}
+			if robots && u.Scheme+"://"+u.Host == origin && !rules.allowed(u.EscapedPath()) {
+				continue
+			}
+			seen[link] = true
+			queue = append(queue, queued{link, item.depth + 1})
+		}
+	}
+
+	indexFile := filepath.Join(out, "index.json")
+	data, _ := json.MarshalIndent(index, "", "  ")
+	if err := os.WriteFile(indexFile, data, 0644); err != nil {
+		fatal("failed to write %s: %v", indexFile, err)
+	}
+	recordArtifact("crawl", indexFile)
+	if flags.jsonOutput {
+		fmt.Println(string(data))
+		return
+	}
+	failed := 0
+	for _, e := range index {
+		if e.Error != "" {
+			failed++
+		}
+	}
+	fmt.Printf("Crawled %d pages (%d failed) into %s\n", len(index), failed, out)
+}
+
+// crawlPage loads one page, writes its readable content to out and returns
+// its links
+func crawlPage(page *rod.Page, entry *crawlEntry, out string, n int, format string) ([]string, error) {
+	prepareNavigation(page, entry.URL, false)
+	if err := page.Navigate(entry.URL); err != nil {
+		return nil, err
+	}
+	if err := page.WaitLoad(); err != nil {
+		return nil, err
+	}
+	info, err := page.Info()
+	if err != nil {
+		return nil, err
+	}
+	title, content, _ := readableContent(page, info.URL, info.Title, extractOptions{})
+	entry.Title = title
+	entry.Wall = detectWall(page, content)
+
+	var links []string
+	if res, err := page.Eval(pageLinksJS); err == nil {
+		for _, l := range res.Value.Arr() {
+			links = append(links, l.Str())
+		}
+	}
+
+	file := filepath.Join(out, crawlFileName(n, entry.URL)+"."+format)
+	var data []byte
+	if format == "json" {
+		data, _ = json.MarshalIndent(map[string]interface{}{
+			"url":     info.URL,
+			"title":   title,
+			"depth":   entry.Depth,
+			"content": content,
+			"links":   links,
+		}, "", "  ")
+	} else {
+		data = []byte(fmt.Sprintf("# %s\n\nSource: %s\n\n%s\n", title, info.URL, strings.TrimSpace(content)))
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		fatal("failed to write %s: %v", file, err)
+	}
+	entry.File = filepath.Base(file)
+	return links, nil
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// sealedMagic starts every file bb encrypts. Such files hold a PBKDF2 salt,
+// an AES-GCM nonce and the ciphertext.
+const sealedMagic = "bb-sealed-v1\n"
+
+const (
+	saltSize      = 16
+	kdfIterations = 200000
+	passphraseEnv = "BB_PASSPHRASE"
+)
+
+var errNoPassphrase = errors.New("file is encrypted; set BB_PASSPHRASE")
+
+// derivedKeys caches keys per salt: derivation is slow on purpose, and a
+// command reads and writes the state several times
+var derivedKeys = map[string][]byte{}
+
+// lastSalt is reused when sealing, so a command derives the key only once
+var lastSalt []byte
+
+func sealingKey(salt []byte) ([]byte, error) {
+	pass := os.Getenv(passphraseEnv)
+	if pass == "" {
+		return nil, errNoPassphrase
+	}
+	if key, ok := derivedKeys[string(salt)]; ok {
+		return key, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, pass, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	derivedKeys[string(salt)] = key
+	return key, nil
+}
+
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(sealedMagic))
+}
+
+// sealData encrypts data with a key derived from BB_PASSPHRASE
+func sealData(data []byte) ([]byte, error) {
+	salt := lastSalt
+	if salt == nil {
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	key, err := sealingKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	lastSalt = salt
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(sealedMagic), salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, []byte(sealedMagic)), nil
+}
+
+// openData decrypts data written by sealData; other data is returned as is
+func openData(data []byte) ([]byte, error) {
+	if !isSealed(data) {
+		return data, nil
+	}
+	rest := data[len(sealedMagic):]
+	if len(rest) < saltSize {
+		return nil, errors.New("truncated encrypted file")
+	}
+	salt := rest[:saltSize]
+	key, err := sealingKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[saltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("truncated encrypted file")
+	}
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], []byte(sealedMagic))
+	if err != nil {
+		return nil, errors.New("wrong BB_PASSPHRASE or damaged file")
+	}
+	lastSalt = salt
+	return plain, nil
+}
+
+// writeSecretFile writes session data (state, cookies, the journal),
+// encrypted when BB_PASSPHRASE is set
+func writeSecretFile(path string, data []byte) error {
+	if os.Getenv(passphraseEnv) == "" {
+		return os.WriteFile(path, data, 0644)
+	}
+	sealed, err := sealData(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, sealed, 0600)
+}
+
+// readSecretFile reads a file written by writeSecretFile
+func readSecretFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return openData(data)
+}
+
+// sealLine encrypts one line of an append-only log when BB_PASSPHRASE is
+// set. The line stays base64 text, so the log can still be read line by line.
+func sealLine(line []byte) ([]byte, error) {
+	if os.Getenv(passphraseEnv) == "" {
+		return line, nil
+	}
+	sealed, err := sealData(line)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// openLine reads a line written by sealLine
+func openLine(line []byte) ([]byte, error) {
+	if len(line) == 0 || line[0] == '{' {
+		return line, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return nil, err
+	}
+	return openData(sealed)
+}
+
+// lockedProfilePath is the encrypted archive of the Chrome profile
+func lockedProfilePath() string {
+	return filepath.Join(stateDir(), "chrome-data.locked")
+}
+
+// profileLocked reports whether bb lock has archived the profile
+func profileLocked() bool {
+	_, err := os.Stat(lockedProfilePath())
+	return err == nil
+}
+
+func cmdLock() {
+	if os.Getenv(passphraseEnv) == "" {
+		fatal("bb lock needs BB_PASSPHRASE")
+	}
+	if profileLocked() {
+		fatal("the profile is already locked")
+	}
+	dataDir := filepath.Join(stateDir(), "chrome-data")
+	if _, err := os.Stat(dataDir); err != nil {
+		fatal("no profile to lock at %s", dataDir)
+	}
+
+	// Chrome must be gone before its profile is archived
+	if s, err := loadState(); err == nil {
+		browser := rod.New().ControlURL(s.DebugURL)
+		if err := browser.Connect(); err == nil {
+			_ = browser.Close()
+		}
+		waitForExit(s.ChromePID, 10*time.Second)
+		removeState()
+		fmt.Println("Browser stopped")
+	}
+
+	var buf bytes.Buffer
+	if err := archiveDir(&buf, dataDir); err != nil {
+		fatal("failed to archive %s: %v", dataDir, err)
+	}
+	sealed, err := sealData(buf.Bytes())
+	if err != nil {
+		fatal("failed to encrypt the profile: %v", err)
+	}
+	if err := os.WriteFile(lockedProfilePath(), sealed, 0600); err != nil {
+		fatal("failed to write %s: %v", lockedProfilePath(), err)
+	}
+	if err := os.RemoveAll(dataDir); err != nil {
+		fatal("failed to remove %s: %v", dataDir, err)
+	}
+	fmt.Printf("Locked profile (%d KB encrypted)\n", len(sealed)/1024)
+}
+
+func cmdUnlock() {
+	data, err := os.ReadFile(lockedProfilePath())
+	if err != nil {
+		fatal("the profile isn't locked")
+	}
+	plain, err := openData(data)
+	if err != nil {
+		fatal("failed to decrypt the profile: %v", err)
+	}
+	dataDir := filepath.Join(stateDir(), "chrome-data")
+	if err := os.RemoveAll(dataDir); err != nil {
+		fatal("failed to clear %s: %v", dataDir, err)
+	}
+	if err := extractArchive(bytes.NewReader(plain), dataDir); err != nil {
+		fatal("failed to restore %s: %v", dataDir, err)
+	}
+	if err := os.Remove(lockedProfilePath()); err != nil {
+		fatal("failed to remove %s: %v", lockedProfilePath(), err)
+	}
+	fmt.Println("Unlocked profile")
+}
+
+// waitForExit polls until the process is gone or the timeout passes
+func waitForExit(pid int, timeout time.Duration) {
+	if pid <= 0 {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	_ = syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// archiveDir writes dir as a gzipped tar. Sockets and other special files
+// (Chrome's Singleton* links among them) are skipped.
+func archiveDir(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if rel == "." || !(d.IsDir() || d.Type().IsRegular()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// extractArchive unpacks an archiveDir archive into dir
+func extractArchive(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("unsafe path in archive: %s", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fs.FileMode(hdr.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// UserStyle is a stylesheet bb css adds to every page
+type UserStyle struct {
+	Source string `json:"source"` // the file it was read from, or "inline"
+	CSS    string `json:"css"`
+}
+
+// userStyleID prefixes the ids of the injected <style> elements
+const userStyleID = "__bb_user_css_"
+
+func cmdCSS(args []string) {
+	usage := "usage: bb css add <file.css|css> | bb css list | bb css clear"
+	if len(args) == 0 {
+		fatalUsage("%s", usage)
+	}
+	c := loadConfig()
+	switch args[0] {
+	case "add":
+		if len(args) != 2 || strings.TrimSpace(args[1]) == "" {
+			fatalUsage("%s", usage)
+		}
+		st := UserStyle{Source: "inline", CSS: args[1]}
+		if info, err := os.Stat(args[1]); err == nil && !info.IsDir() {
+			data, err := os.ReadFile(args[1])
+			if err != nil {
+				fatal("failed to read %s: %v", args[1], err)
+			}
+			st = UserStyle{Source: args[1], CSS: string(data)}
+		} else if !strings.Contains(args[1], "{") {
+			fatal("no such file, and not CSS: %s", args[1])
+		}
+		c.UserStyles = append(c.UserStyles, st)
+		if err := saveConfig(c); err != nil {
+			fatal("failed to save config: %v", err)
+		}
+		// Loading the page applies the config, the new stylesheet included
+		withPage()
+		fmt.Printf("Added stylesheet %d (%s); it applies to every page until bb css clear\n", len(c.UserStyles), st.Source)
+	case "list":
+		if len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		if len(c.UserStyles) == 0 {
+			fmt.Println("No user stylesheets")
+			return
+		}
+		for i, st := range c.UserStyles {
+			fmt.Printf("[%d] %s (%d bytes)\n", i+1, st.Source, len(st.CSS))
+		}
+	case "clear":
+		if len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		c.UserStyles = nil
+		if err := saveConfig(c); err != nil {
+			fatal("failed to save config: %v", err)
+		}
+		_, _, page := withPage()
+		_, _ = page.Eval(`(prefix) => document.querySelectorAll('style[id^="' + prefix + '"]').forEach(s => s.remove())`, userStyleID)
+		fmt.Println("Removed the user stylesheets")
+	default:
+		fatalUsage("%s", usage)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// declutterJS finds what gets in the way of reading or capturing a page and,
+// unless dryRun, clears it:
+//   - overlays: fixed elements covering much of the viewport or stacked
+//     high above it (modals, backdrops, paywall and newsletter prompts)
+//   - sticky bars: fixed or sticky headers and footers, which are unstuck
+//     rather than removed so their content stays in the page
+//   - scroll locks on <html> and <body>, and blur filters over content
+//
+// Elements holding most of the page's text are never removed, so a fixed
+// app shell doesn't take the content with it.
+const declutterJS = `(dryRun) => {
+	` + cssPathJS + `
+	const vw = window.innerWidth, vh = window.innerHeight;
+	const bodyText = (document.body && document.body.innerText || '').length;
+	const found = [];
+	const seen = new Set();
+	const inside = el => {
+		for (let a = el.parentElement; a; a = a.parentElement) if (seen.has(a)) return true;
+		return false;
+	};
+	for (const el of document.querySelectorAll('body *')) {
+		const s = getComputedStyle(el);
+		if (s.display === 'none' || s.visibility === 'hidden' || inside(el)) continue;
+		if (s.filter.includes('blur') || s.backdropFilter.includes('blur')) {
+			found.push({el, action: 'unblurred', reason: 'blur filter'});
+		}
+		if (s.position !== 'fixed' && s.position !== 'sticky') continue;
+		const r = el.getBoundingClientRect();
+		const w = Math.max(0, Math.min(r.right, vw) - Math.max(r.left, 0));
+		const h = Math.max(0, Math.min(r.bottom, vh) - Math.max(r.top, 0));
+		const coverage = (w * h) / (vw * vh);
+		if (w === 0 || h === 0) continue;
+		const z = parseInt(s.zIndex, 10) || 0;
+		const text = (el.innerText || '').length;
+		if (bodyText > 500 && text > bodyText * 0.5) continue;
+		let item = null;
+		if (s.position === 'fixed' && (coverage >= 0.3 || (z >= 1000 && coverage >= 0.05))) {
+			item = {action: 'removed', reason: text < 20 ? 'backdrop' : 'overlay'};
+		} else if (w >= vw * 0.6 && h <= vh * 0.3 && (r.top <= 1 || r.bottom >= vh - 1)) {
+			item = {action: 'unstuck', reason: r.top <= 1 ? 'sticky header' : 'sticky footer'};
+		} else if (s.position === 'fixed' && coverage >= 0.01) {
+			item = {action: 'removed', reason: 'floating box'};
+		}
+		if (!item) continue;
+		item.el = el;
+		item.coverage = Math.round(coverage * 100);
+		found.push(item);
+		seen.add(el);
+	}
+	for (const el of [document.documentElement, document.body]) {
+		if (!el) continue;
+		const s = getComputedStyle(el);
+		if (s.overflow === 'hidden' || s.overflowY === 'hidden' || (el === document.body && s.position === 'fixed')) {
+			found.push({el, action: 'unlocked', reason: 'scroll lock'});
+		}
+	}
+
+	const out = found.map(f => ({
+		action: f.action,
+		reason: f.reason,
+		selector: f.el === document.documentElement ? 'html' : f.el === document.body ? 'body' : cssPath(f.el),
+		coverage: f.coverage || 0,
+		text: (f.el === document.body || f.el === document.documentElement) ? '' : (f.el.innerText || '').replace(/\s+/g, ' ').trim().slice(0, 60),
+	}));
+	if (dryRun) return out;
+
+	for (const f of found) {
+		switch (f.action) {
+		case 'removed':
+			f.el.remove();
+			break;
+		case 'unstuck':
+			f.el.style.setProperty('position', 'static', 'important');
+			break;
+		case 'unblurred':
+			f.el.style.setProperty('filter', 'none', 'important');
+			f.el.style.setProperty('backdrop-filter', 'none', 'important');
+			break;
+		case 'unlocked':
+			f.el.style.setProperty('overflow', 'visible', 'important');
+			if (f.el === document.body && getComputedStyle(f.el).position === 'fixed') {
+				f.el.style.setProperty('position', 'static', 'important');
+			}
+			break;
+		}
+	}
+	return out;
+}`
+
+// declutterItem is one thing declutter cleared (or would clear)
+type declutterItem struct {
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+	Selector string `json:"selector"`
+	Coverage int    `json:"coverage"` // percent of the viewport
+	Text     string `json:"text,omitempty"`
+}
+
+func cmdDeclutter(args []string, flags globalFlags) {
+	dryRun := false
+	for _, a := range args {
+		if a != "--dry-run" {
+			fatalUsage("usage: bb declutter [--dry-run]")
+		}
+		dryRun = true
+	}
+	_, _, page := withPage()
+	res, err := page.Eval(declutterJS, dryRun)
+	if err != nil {
+		fatal("failed to declutter: %v", err)
+	}
+	var items []declutterItem
+	if err := res.Value.Unmarshal(&items); err != nil {
+		fatal("failed to read the result: %v", err)
+	}
+
+	if flags.jsonOutput {
+		if items == nil {
+			items = []declutterItem{}
+		}
+		out, _ := json.MarshalIndent(items, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	if len(items) == 0 {
+		fmt.Println("Nothing to declutter")
+		return
+	}
+	for _, it := range items {
+		action := it.Action
+		if dryRun {
+			action = "would be " + action
+		}
+		line := fmt.Sprintf("%-18s %-14s %s", action, it.Reason, it.Selector)
+		if it.Coverage > 0 {
+			line += fmt.Sprintf(" (%d%% of viewport)", it.Coverage)
+		}
+		if it.Text != "" {
+			line += fmt.Sprintf(" %q", it.Text)
+		}
+		fmt.Println(line)
+	}
+}
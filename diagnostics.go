@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// currentPage is the page the running command operates on. It is recorded by
+// withPage/open/newpage so failure diagnostics can inspect it.
+var currentPage *rod.Page
+
+// invocation is the command line being executed, used to label diagnostics
+var invocation []string
+
+// failureCapture configures what gets recorded when a command fails
+var failureCapture struct {
+	screenshotDir string // screenshot + console tail
+	dumpDir       string // full DOM HTML + accessibility tree
+}
+
+// defaultErrorDir is where failure artifacts go when no directory is given
+func defaultErrorDir() string {
+	return filepath.Join(stateDir(), "errors")
+}
+
+// failureReport is the sidecar written next to the failure artifacts
+type failureReport struct {
+	Time       string   `json:"time"`
+	Command    []string `json:"command"`
+	Error      string   `json:"error"`
+	URL        string   `json:"url,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Screenshot string   `json:"screenshot,omitempty"`
+	HTML       string   `json:"html,omitempty"`
+	AXTree     string   `json:"ax_tree,omitempty"`
+	Console    []string `json:"console,omitempty"`
+}
+
+// failureBase returns the path prefix (without extension) for artifacts in dir
+func failureBase(dir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := "bb"
+	if len(invocation) > 0 {
+		name = invocation[0]
+	}
+	return filepath.Join(dir, now.Format("20060102-150405")+"-"+name), nil
+}
+
+// writeArtifact writes data to base+ext (or the next free variant), records
+// it in the session manifest and returns the path
+func writeArtifact(kind, base, ext string, data []byte) string {
+	file := nextAvailableFile(base, ext)
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "[failed to write %s: %v]\n", file, err)
+		return ""
+	}
+	recordArtifact(kind, file)
+	return file
+}
+
+// captureFailure records the page state after a failed command. It never
+// fails itself: diagnostics are best-effort and must not mask the original error.
+func captureFailure(msg string) {
+	if currentPage == nil || (failureCapture.screenshotDir == "" && failureCapture.dumpDir == "") {
+		return
+	}
+
+	// The command's own timeout may have expired, so use a fresh short one
+	page := currentPage.Timeout(5 * time.Second)
+	now := time.Now()
+	report := failureReport{
+		Time:    now.Format(time.RFC3339),
+		Command: invocation,
+		Error:   msg,
+	}
+	if info, err := page.Info(); err == nil {
+		report.URL = info.URL
+		report.Title = info.Title
+	}
+	report.Console = consoleTail(page, 20)
+
+	reportBase := ""
+	if dir := failureCapture.screenshotDir; dir != "" {
+		base, err := failureBase(dir, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[failed to create %s: %v]\n", dir, err)
+			return
+		}
+		reportBase = base
+		if data, err := page.Screenshot(false, nil); err == nil {
+			report.Screenshot = writeArtifact("error-screenshot", base, ".png", data)
+		}
+	}
+	if dir := failureCapture.dumpDir; dir != "" {
+		base, err := failureBase(dir, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[failed to create %s: %v]\n", dir, err)
+			return
+		}
+		if reportBase == "" {
+			reportBase = base
+		}
+		if html, err := page.HTML(); err == nil {
+			report.HTML = writeArtifact("error-html", base, ".html", []byte(html))
+		}
+		if nodes, err := fullAXTree(page, nil); err == nil {
+			report.AXTree = writeArtifact("error-ax-tree", base, ".ax.txt", []byte(formatAXTree(nodes)))
+		}
+	}
+
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if file := writeArtifact("error-report", reportBase, ".json", data); file != "" {
+		fmt.Fprintf(os.Stderr, "[error report saved to %s]\n", file)
+	}
+}
+
+// consoleTail returns the last n console messages of the page, objects
+// expanded one level
+func consoleTail(page *rod.Page, n int) []string {
+	var lines []string
+	for _, m := range consoleMessages(page, 1) {
+		lines = append(lines, fmt.Sprintf("[%s] %s", m.Type, m.Text))
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// remoteObjectString renders a console argument roughly the way DevTools does
+func remoteObjectString(obj *proto.RuntimeRemoteObject) string {
+	if obj == nil {
+		return ""
+	}
+	switch obj.Type {
+	case proto.RuntimeRemoteObjectTypeString:
+		return obj.Value.Str()
+	case proto.RuntimeRemoteObjectTypeUndefined:
+		return "undefined"
+	}
+	if obj.UnserializableValue != "" {
+		return string(obj.UnserializableValue)
+	}
+	if obj.Description != "" {
+		return obj.Description
+	}
+	return obj.Value.JSON("", "")
+}
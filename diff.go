@@ -0,0 +1,351 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// contentSnapshot is the page content stored by bb diff snapshot
+type contentSnapshot struct {
+	URL      string `json:"url"`
+	Selector string `json:"selector,omitempty"`
+	HTML     bool   `json:"html,omitempty"` // canonical DOM instead of text
+	Time     string `json:"time"`
+	Hash     string `json:"hash"`
+	Content  string `json:"content"`
+}
+
+type contentDiff struct {
+	Name    string `json:"name,omitempty"`
+	URL     string `json:"url"`
+	Since   string `json:"since"`
+	Changed bool   `json:"changed"`
+	Before  string `json:"hash_before"`
+	After   string `json:"hash_after"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// snapshotFile is where the snapshot called name is stored. Unnamed
+// snapshots are keyed by URL and selector, so a later show on the same
+// page finds them.
+func snapshotFile(name, u, selector string) string {
+	if name == "" {
+		sum := sha256.Sum256([]byte(u + "\x00" + selector))
+		name = hex.EncodeToString(sum[:6])
+	}
+	return filepath.Join(stateDir(), "snapshots", slugUnsafe.ReplaceAllString(name, "-")+".json")
+}
+
+func hashContent(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// lineOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type lineOp struct {
+	kind byte
+	line string
+}
+
+// maxDiffTrace bounds the memory diffLines spends on the search; beyond it
+// the changed part is reported as replaced wholesale
+const maxDiffTrace = 1 << 24
+
+// diffLines returns a shortest edit script from a to b (Myers' algorithm)
+func diffLines(a, b []string) []lineOp {
+	var head, tail []lineOp
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		head = append(head, lineOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		tail = append([]lineOp{{' ', a[len(a)-1]}}, tail...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	return append(append(head, myers(a, b)...), tail...)
+}
+
+func myers(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if (d+1)*len(v) > maxDiffTrace {
+			var ops []lineOp
+			for _, l := range a {
+				ops = append(ops, lineOp{'-', l})
+			}
+			for _, l := range b {
+				ops = append(ops, lineOp{'+', l})
+			}
+			return ops
+		}
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, d, offset)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the saved frontiers back from the end to build the script
+func backtrack(trace [][]int, a, b []string, d, offset int) []lineOp {
+	var ops []lineOp
+	x, y := len(a), len(b)
+	for ; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			ops = append(ops, lineOp{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, lineOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, lineOp{'-', a[x]})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff formats the changes from a to b as a unified diff with
+// context lines around each hunk; it is empty when they are equal
+func unifiedDiff(a, b, fromName, toName string, context int) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// A hunk runs from the first change until more than 2*context
+		// unchanged lines separate it from the next one
+		from := max(0, start-context)
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*context {
+				break
+			}
+		}
+		to := min(len(ops), end+context)
+		aLine, bLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for _, op := range ops[from:to] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line + "\n")
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// hunkRange formats a "start,count" hunk range; an empty range starts at
+// the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// pageContent is the text (or canonical HTML) of the page or of the
+// element matching selector
+func pageContent(page *rod.Page, selector string, asHTML bool) string {
+	var content string
+	var err error
+	if selector != "" {
+		el, err := page.Element(selector)
+		if err != nil {
+			fatalNotFound(selector, err)
+		}
+		if asHTML {
+			content, err = el.HTML()
+		} else {
+			content, err = el.Text()
+		}
+		if err != nil {
+			fatal("failed to read %s: %v", selector, err)
+		}
+	} else if asHTML {
+		content = page.MustEval(`() => document.documentElement.outerHTML`).Str()
+	} else {
+		content = page.MustEval(`() => document.body?.innerText ?? ""`).Str()
+	}
+	if asHTML {
+		if content, err = canonicalHTML(content, selector != ""); err != nil {
+			fatal("failed to parse HTML: %v", err)
+		}
+	}
+	return content
+}
+
+func cmdDiff(args []string, flags globalFlags) {
+	usage := "usage: bb diff snapshot [selector] [--html] [--name name] | bb diff show [selector] [--name name] [--update]"
+	if len(args) == 0 || (args[0] != "snapshot" && args[0] != "show") {
+		fatalUsage("%s", usage)
+	}
+	name, selector := "", ""
+	asHTML, update := false, false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--name":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for --name")
+			}
+			name = args[i+1]
+			i++
+		case "--html":
+			asHTML = true
+		case "--update":
+			update = true
+		default:
+			if strings.HasPrefix(args[i], "--") || selector != "" {
+				fatalUsage("%s", usage)
+			}
+			selector = args[i]
+		}
+	}
+
+	if (args[0] == "snapshot" && update) || (args[0] == "show" && asHTML) {
+		fatalUsage("%s", usage)
+	}
+
+	_, _, page := withPage()
+	info, err := page.Info()
+	if err != nil {
+		fatal("failed to get page info: %v", err)
+	}
+	if args[0] == "snapshot" {
+		content := pageContent(page, selector, asHTML)
+		snap := contentSnapshot{URL: info.URL, Selector: selector, HTML: asHTML, Time: time.Now().Format(time.RFC3339), Hash: hashContent(content), Content: content}
+		writeSnapshot(snapshotFile(name, info.URL, selector), snap)
+		fmt.Printf("Snapshot of %s saved (%d lines, %s)\n", info.URL, len(splitLines(content)), snap.Hash[:12])
+		return
+	}
+
+	// A named snapshot remembers what it covered; an unnamed one is found by
+	// the current URL and the selector
+	file := snapshotFile(name, info.URL, selector)
+	data, err := readSecretFile(file)
+	if os.IsNotExist(err) {
+		fatal("no snapshot to compare with; run bb diff snapshot first")
+	} else if err != nil {
+		fatal("failed to read %s: %v", file, err)
+	}
+	var snap contentSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		fatal("invalid snapshot %s: %v", file, err)
+	}
+	if name != "" && selector == "" {
+		selector = snap.Selector
+	}
+	content := pageContent(page, selector, snap.HTML)
+	result := contentDiff{
+		Name:   name,
+		URL:    info.URL,
+		Since:  snap.Time,
+		Before: snap.Hash,
+		After:  hashContent(content),
+	}
+	result.Changed = result.Before != result.After
+	if result.Changed {
+		result.Diff = unifiedDiff(snap.Content, content, "snapshot "+snap.Time, "now", 3)
+	}
+	if update && result.Changed {
+		snap.URL, snap.Selector, snap.Time, snap.Hash, snap.Content = info.URL, selector, time.Now().Format(time.RFC3339), result.After, content
+		writeSnapshot(file, snap)
+	}
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+	} else if result.Changed {
+		fmt.Print(result.Diff)
+	} else {
+		fmt.Printf("No changes since %s\n", snap.Time)
+	}
+	if result.Changed {
+		exit(exitFalse)
+	}
+}
+
+func writeSnapshot(file string, snap contentSnapshot) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		fatal("failed to create %s: %v", filepath.Dir(file), err)
+	}
+	data, _ := json.MarshalIndent(snap, "", "  ")
+	if err := writeSecretFile(file, data); err != nil {
+		fatal("failed to write %s: %v", file, err)
+	}
+}
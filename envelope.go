@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// started is when this invocation began, for the envelope's timing
+var started = time.Now()
+
+// envelope wraps the text output of a command run with --json, and with
+// --envelope the JSON output too, so every command's result can be parsed
+// the same way
+type envelope struct {
+	OK         bool            `json:"ok"`
+	Command    string          `json:"command"`
+	ExitCode   int             `json:"exit_code,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+	Result     json.RawMessage `json:"result,omitempty"` // the command's own JSON
+	Output     string          `json:"output,omitempty"`
+	Data       string          `json:"data,omitempty"` // base64, when the output is binary
+
+	Timings  []phaseTiming `json:"timings,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"` // slow phases
+}
+
+// wrapJSON puts JSON output in the envelope as well (--envelope or
+// BB_ENVELOPE=1); without it, commands with JSON of their own print it as
+// they always have
+var wrapJSON bool
+
+// capture holds stdout while a command's output is being collected
+var capture struct {
+	command string
+	stdout  *os.File
+	w       *os.File
+	buf     bytes.Buffer
+	done    chan struct{}
+}
+
+// startEnvelope collects what the command prints, to be wrapped when it
+// ends
+func startEnvelope(command string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	capture.command, capture.stdout, capture.w = command, os.Stdout, w
+	capture.done = make(chan struct{})
+	os.Stdout = w
+	go func() {
+		_, _ = io.Copy(&capture.buf, r)
+		close(capture.done)
+	}()
+}
+
+// stopCapture restores stdout and returns what was printed
+func stopCapture() []byte {
+	if capture.w == nil {
+		return nil
+	}
+	capture.w.Close()
+	<-capture.done
+	os.Stdout, capture.w = capture.stdout, nil
+	return capture.buf.Bytes()
+}
+
+// finishEnvelope prints the collected output wrapped in the envelope: text
+// as output, JSON unchanged or, with wrapJSON, as result
+func finishEnvelope(code int, timings []phaseTiming, warnings []string) {
+	if capture.w == nil {
+		return
+	}
+	out := stopCapture()
+	e := envelope{OK: code == 0, Command: capture.command, ExitCode: code, DurationMS: time.Since(started).Milliseconds(), Timings: timings, Warnings: warnings}
+	if trimmed := bytes.TrimSpace(out); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		if !wrapJSON {
+			_, _ = os.Stdout.Write(out)
+			return
+		}
+		e.Result = trimmed
+	} else if utf8.Valid(out) {
+		e.Output = strings.TrimRight(string(out), "\n")
+	} else {
+		e.Data = base64.StdEncoding.EncodeToString(out)
+	}
+	data, _ := json.MarshalIndent(e, "", "  ")
+	fmt.Println(string(data))
+}
+
+// exit ends the invocation, printing the envelope and the timings first and
+// recording it in the journal
+func exit(code int) {
+	timings := phaseTimings()
+	warnings := slowPhaseWarnings(timings)
+	reportTimings(timings, warnings)
+	finishEnvelope(code, timings, warnings)
+	recordJournal(code)
+	os.Exit(code)
+}
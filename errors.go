@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/cdp"
+)
+
+// Exit codes
+const (
+	exitFailed      = 1
+	exitUsage       = 2
+	exitNotFound    = 3
+	exitTimeout     = 4
+	exitUnreachable = 5 // the browser couldn't be started or reached
+	exitFalse       = 6 // a check command (exists, visible, assert...) answered no
+)
+
+var errorCodes = map[int]string{
+	exitFailed:      "failed",
+	exitUsage:       "usage",
+	exitNotFound:    "not_found",
+	exitTimeout:     "timeout",
+	exitUnreachable: "browser_unreachable",
+	exitFalse:       "false",
+}
+
+// jsonErrors reports failures as a JSON object on stderr (with --json)
+var jsonErrors bool
+
+type cliError struct {
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+	Message  string `json:"message"`
+	Selector string `json:"selector,omitempty"`
+}
+
+// errorEnvelope is the --json form of an error, printed on stderr
+type errorEnvelope struct {
+	OK         bool     `json:"ok"`
+	Command    string   `json:"command,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+	Error      cliError `json:"error"`
+}
+
+// errorCode tells timeouts from other failures by the error they wrap
+func errorCode(msg string) int {
+	if strings.Contains(msg, context.DeadlineExceeded.Error()) || strings.Contains(msg, "timed out") {
+		return exitTimeout
+	}
+	return exitFailed
+}
+
+// mustFailure returns the error a rod Must* helper panicked with: a timeout
+// or an error from the browser. Anything else is a bug, for the caller to
+// panic with again.
+func mustFailure(r interface{}) (error, bool) {
+	err, ok := r.(error)
+	var cdpErr *cdp.Error
+	if !ok || !(errors.Is(err, context.DeadlineExceeded) || errors.As(err, &cdpErr)) {
+		return nil, false
+	}
+	return err, true
+}
+
+func fatal(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fail(errorCode(msg), "", "%s", msg)
+}
+
+// fatalUsage reports a command line bb can't run: a missing or invalid
+// argument, an unknown command or flag
+func fatalUsage(format string, args ...interface{}) {
+	fail(exitUsage, "", format, args...)
+}
+
+// fail reports an error with an explicit exit code and the selector it
+// concerns, if any
+func fail(code int, selector string, format string, args ...interface{}) {
+	if jsonErrors {
+		// Whatever the command printed before failing is dropped
+		stopCapture()
+	}
+	reportError(code, selector, fmt.Sprintf(format, args...))
+	exit(code)
+}
+
+// failWithOutput reports an error like fail but keeps what the command
+// printed, for a result that is worth having although the command failed
+// (with --json it stays in the envelope, which has ok false)
+func failWithOutput(code int, format string, args ...interface{}) {
+	reportError(code, "", fmt.Sprintf(format, args...))
+	exit(code)
+}
+
+// reportError prints an error on stderr and keeps it for the journal
+func reportError(code int, selector, msg string) {
+	if jsonErrors {
+		command := ""
+		if len(invocation) > 0 {
+			command = invocation[0]
+		}
+		out, _ := json.Marshal(errorEnvelope{
+			Command:    command,
+			DurationMS: time.Since(started).Milliseconds(),
+			Error:      cliError{Code: errorCodes[code], ExitCode: code, Message: msg, Selector: selector},
+		})
+		fmt.Fprintln(os.Stderr, string(out))
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+	}
+	captureFailure(msg)
+	failMsg = msg
+}
+
+// fatalNotFound reports a lookup that found nothing. Lookups wait for the
+// element, so err is only shown when there is no selector to name (--node).
+func fatalNotFound(selector string, err error) {
+	if selector == "" && err != nil {
+		fail(exitNotFound, "", "element not found: %v", err)
+	}
+	fail(exitNotFound, selector, "element not found: %s", selector)
+}
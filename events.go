@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+var eventTypes = []string{"nav", "console", "request", "dialog", "download"}
+
+// pageEvent is one line of bb events output
+type pageEvent struct {
+	Time     string `json:"time"`
+	Type     string `json:"type"`
+	URL      string `json:"url,omitempty"`
+	Level    string `json:"level,omitempty"` // console: log, warning, error, ...
+	Text     string `json:"text,omitempty"`  // console output or dialog message
+	Method   string `json:"method,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Resource string `json:"resource,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Dialog   string `json:"dialog,omitempty"` // alert, confirm, prompt, beforeunload
+	State    string `json:"state,omitempty"`  // download: started, completed, canceled
+	File     string `json:"file,omitempty"`
+}
+
+func cmdEvents(args []string) {
+	usage := "usage: bb events [--filter nav,console,request,dialog,download] [--duration seconds]"
+	filter := slices.Clone(eventTypes)
+	var duration time.Duration
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--filter":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for --filter")
+			}
+			filter = nil
+			for _, t := range strings.Split(args[i+1], ",") {
+				t = strings.TrimSpace(t)
+				if !slices.Contains(eventTypes, t) {
+					fatalUsage("invalid --filter: %s (expected %s)", t, strings.Join(eventTypes, ", "))
+				}
+				filter = append(filter, t)
+			}
+			i++
+		case "--duration":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for --duration")
+			}
+			v, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil || v <= 0 {
+				fatalUsage("invalid --duration: %s", args[i+1])
+			}
+			duration = time.Duration(v * float64(time.Second))
+			i++
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	want := func(t string) bool { return slices.Contains(filter, t) }
+
+	_, browser, page := withPage()
+	var mu sync.Mutex
+	emit := func(e pageEvent) {
+		e.Time = time.Now().Format(time.RFC3339Nano)
+		data, _ := json.Marshal(e)
+		mu.Lock()
+		fmt.Println(string(data))
+		mu.Unlock()
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	// Runtime replays the console messages logged before bb attached; only
+	// new ones are streamed
+	since := proto.RuntimeTimestamp(time.Now().UnixMilli())
+	requests := map[proto.NetworkRequestID]*proto.NetworkRequest{}
+	p, cancel := page.WithCancel()
+	defer cancel()
+	wait := p.EachEvent(
+		func(e *proto.PageFrameNavigated) {
+			if want("nav") && e.Frame.ParentID == "" {
+				emit(pageEvent{Type: "nav", URL: e.Frame.URL})
+			}
+		},
+		func(e *proto.PageNavigatedWithinDocument) {
+			if want("nav") && e.FrameID == page.FrameID {
+				emit(pageEvent{Type: "nav", URL: e.URL})
+			}
+		},
+		func(e *proto.RuntimeConsoleAPICalled) {
+			if !want("console") || e.Timestamp < since {
+				return
+			}
+			var parts []string
+			for _, arg := range e.Args {
+				parts = append(parts, remoteObjectString(arg))
+			}
+			emit(pageEvent{Type: "console", Level: string(e.Type), Text: strings.Join(parts, " ")})
+		},
+		func(e *proto.RuntimeExceptionThrown) {
+			if !want("console") || e.Timestamp < since {
+				return
+			}
+			text := e.ExceptionDetails.Text
+			if e.ExceptionDetails.Exception != nil {
+				text = remoteObjectString(e.ExceptionDetails.Exception)
+			}
+			emit(pageEvent{Type: "console", Level: "exception", Text: text, URL: e.ExceptionDetails.URL})
+		},
+		func(e *proto.NetworkRequestWillBeSent) {
+			if want("request") {
+				requests[e.RequestID] = e.Request
+			}
+		},
+		func(e *proto.NetworkResponseReceived) {
+			if !want("request") || strings.HasPrefix(e.Response.URL, "data:") {
+				return
+			}
+			ev := pageEvent{Type: "request", URL: e.Response.URL, Status: e.Response.Status, Resource: string(e.Type)}
+			if r := requests[e.RequestID]; r != nil {
+				ev.Method = r.Method
+			}
+			emit(ev)
+		},
+		func(e *proto.NetworkLoadingFailed) {
+			if !want("request") {
+				return
+			}
+			ev := pageEvent{Type: "request", Resource: string(e.Type), Error: e.ErrorText}
+			if r := requests[e.RequestID]; r != nil {
+				ev.URL, ev.Method = r.URL, r.Method
+			}
+			delete(requests, e.RequestID)
+			emit(ev)
+		},
+		func(e *proto.NetworkLoadingFinished) {
+			delete(requests, e.RequestID)
+		},
+		func(e *proto.PageJavascriptDialogOpening) {
+			if want("dialog") {
+				emit(pageEvent{Type: "dialog", Dialog: string(e.Type), Text: e.Message, URL: e.URL})
+			}
+		},
+	)
+	go wait()
+	for _, enable := range []interface{ Call(proto.Client) error }{proto.PageEnable{}, proto.RuntimeEnable{}, proto.NetworkEnable{}} {
+		if err := enable.Call(page); err != nil {
+			fatal("failed to listen for events: %v", err)
+		}
+	}
+
+	if want("download") {
+		// Download events only come from the browser, once they're enabled
+		dir := loadConfig().DownloadDir
+		behavior := proto.BrowserSetDownloadBehavior{Behavior: proto.BrowserSetDownloadBehaviorBehaviorDefault, EventsEnabled: true}
+		if dir != "" {
+			behavior.Behavior, behavior.DownloadPath = proto.BrowserSetDownloadBehaviorBehaviorAllow, dir
+		}
+		if err := behavior.Call(browser); err != nil {
+			fatal("failed to listen for downloads: %v", err)
+		}
+		names := map[string]string{}
+		b, cancel := browser.WithCancel()
+		defer cancel()
+		go b.EachEvent(
+			func(e *proto.BrowserDownloadWillBegin) {
+				if e.FrameID != page.FrameID {
+					return
+				}
+				names[e.GUID] = e.SuggestedFilename
+				emit(pageEvent{Type: "download", State: "started", URL: e.URL, File: e.SuggestedFilename})
+			},
+			func(e *proto.BrowserDownloadProgress) {
+				name, ok := names[e.GUID]
+				if !ok || e.State == proto.BrowserDownloadProgressStateInProgress {
+					return
+				}
+				ev := pageEvent{Type: "download", State: string(e.State), File: name}
+				if dir != "" && e.State == proto.BrowserDownloadProgressStateCompleted {
+					ev.File = filepath.Join(dir, name)
+				}
+				delete(names, e.GUID)
+				emit(ev)
+			},
+		)()
+	}
+
+	info, err := page.Info()
+	if err != nil {
+		fatal("failed to get page info: %v", err)
+	}
+	emit(pageEvent{Type: "ready", URL: info.URL})
+
+	// Stream until interrupted, the duration is up or the page goes away
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timeout = time.After(duration)
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timeout:
+			return
+		case <-time.After(2 * time.Second):
+			if _, err := page.Info(); err != nil {
+				emit(pageEvent{Type: "closed"})
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// blockedJS reports why the loaded page can't be used: an HTTP error status
+// or a bot check / access denied interstitial. It returns "" for usable pages.
+const blockedJS = `() => {
+	const nav = performance.getEntriesByType('navigation')[0];
+	const status = nav && nav.responseStatus;
+	if (status >= 400) return 'HTTP ' + status;
+	const text = (document.body?.innerText || '').toLowerCase().slice(0, 5000);
+	const title = document.title.toLowerCase();
+	const phrases = ['access denied', 'are you a robot', 'verify you are human', 'checking your browser',
+		'unusual traffic', 'request blocked', 'enable javascript and cookies to continue', 'attention required'];
+	if (phrases.some(p => title.includes(p) || (text.length < 3000 && text.includes(p)))) return 'blocked';
+	if (document.querySelector('iframe[src*="captcha"], iframe[src*="challenges.cloudflare.com"], #challenge-form, .g-recaptcha, .h-captcha')) return 'blocked';
+	return '';
+}`
+
+// waybackSnapshot looks up the most recent Wayback Machine snapshot of u and
+// returns its URL (without the archive toolbar) and timestamp
+func waybackSnapshot(u string) (snapshot, timestamp string, err error) {
+	api := "https://archive.org/wayback/available"
+	if v := os.Getenv("BB_WAYBACK_URL"); v != "" {
+		api = v
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(api + "?url=" + url.QueryEscape(u))
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		ArchivedSnapshots struct {
+			Closest struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+				Timestamp string `json:"timestamp"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", "", fmt.Errorf("invalid Wayback Machine response: %v", err)
+	}
+	closest := result.ArchivedSnapshots.Closest
+	if !closest.Available || closest.URL == "" {
+		return "", "", fmt.Errorf("no Wayback Machine snapshot of %s", u)
+	}
+	return waybackRaw.ReplaceAllString(closest.URL, "/web/${1}id_/"), closest.Timestamp, nil
+}
+
+// waybackRaw matches the timestamp of a snapshot URL; the id_ suffix serves
+// the original page without the archive's toolbar and link rewriting
+var waybackRaw = regexp.MustCompile(`/web/(\d+)/`)
+
+// openFallback navigates page to an archived copy of u after the live page
+// failed for the given reason, and records the source for the output
+func openFallback(page *rod.Page, u, reason string, opts *extractOptions) {
+	snapshot, timestamp, err := waybackSnapshot(u)
+	if err != nil {
+		fatal("%s, and the fallback failed: %v", reason, err)
+	}
+	if err := page.Navigate(snapshot); err != nil {
+		fatal("%s, and the Wayback Machine snapshot failed to load: %v", reason, err)
+	}
+	page.MustWaitLoad()
+	if t, err := time.Parse("20060102150405", timestamp); err == nil {
+		timestamp = t.UTC().Format(time.RFC3339)
+	}
+	opts.source = "wayback"
+	opts.originalURL = u
+	opts.archivedAt = timestamp
+	fmt.Fprintf(os.Stderr, "[%s, showing the Wayback Machine snapshot from %s]\n", reason, timestamp)
+}
+
+// pageProblem returns why the loaded page needs a fallback, or ""
+func pageProblem(page *rod.Page) string {
+	res, err := page.Eval(blockedJS)
+	if err == nil && res.Value.Str() != "" {
+		if strings.HasPrefix(res.Value.Str(), "HTTP") {
+			return "page returned " + res.Value.Str()
+		}
+		return "page is blocked by a bot check"
+	}
+	info, err := page.Info()
+	if err != nil {
+		return ""
+	}
+	_, content, _ := readableContent(page, info.URL, info.Title, extractOptions{})
+	if wall := detectWall(page, content); wall != "" {
+		return "page is behind a " + map[string]string{"paywall": "paywall", "login": "login wall"}[wall]
+	}
+	return ""
+}
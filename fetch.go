@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// pageFetchJS runs the request from the page, so it carries the page's cookies
+// and origin. The body comes back base64-encoded to survive binary data.
+const pageFetchJS = `async (url, method, headers, body) => {
+	const init = {method, headers, credentials: 'include', redirect: 'follow'};
+	if (body !== null) init.body = body;
+	let res;
+	try {
+		res = await fetch(url, init);
+	} catch (e) {
+		return {error: String(e.message || e)};
+	}
+	const bytes = new Uint8Array(await res.arrayBuffer());
+	let bin = '';
+	for (let i = 0; i < bytes.length; i += 0x8000) {
+		bin += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000));
+	}
+	const out = {};
+	res.headers.forEach((v, k) => { out[k] = v; });
+	return {url: res.url, status: res.status, statusText: res.statusText, redirected: res.redirected, headers: out, body: btoa(bin)};
+}`
+
+type fetchResult struct {
+	URL        string            `json:"url"`
+	Status     int               `json:"status"`
+	StatusText string            `json:"status_text"`
+	Redirected bool              `json:"redirected,omitempty"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"` // when the body isn't text
+	File       string            `json:"file,omitempty"`
+}
+
+func cmdFetch(args []string, flags globalFlags) {
+	usage := "usage: bb fetch <url> [--method POST] [--body data|@file] [--header 'Name: value'] [--include] [--out file]"
+	method, file := "", ""
+	var body *string
+	headers := map[string]string{}
+	include := false
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--method", "--body", "--header", "--out":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			v := args[i+1]
+			switch args[i] {
+			case "--method":
+				method = strings.ToUpper(v)
+			case "--body":
+				data := readArgValue(v)
+				body = &data
+			case "--header":
+				name, value, ok := strings.Cut(v, ":")
+				if !ok || strings.TrimSpace(name) == "" {
+					fatalUsage("invalid --header %q (expected 'Name: value')", v)
+				}
+				headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			case "--out":
+				file = v
+			}
+			i++
+		case "--include":
+			include = true
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				fatalUsage("%s", usage)
+			}
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("%s", usage)
+	}
+	if method == "" {
+		method = "GET"
+		if body != nil {
+			method = "POST"
+		}
+	}
+	if body != nil && (method == "GET" || method == "HEAD") {
+		fatal("a %s request can't have a body", method)
+	}
+
+	// Relative URLs resolve against the page, as they would in its scripts
+	_, _, page := withPage()
+	var bodyArg interface{}
+	if body != nil {
+		bodyArg = *body
+	}
+	res, err := page.Eval(pageFetchJS, positional[0], method, headers, bodyArg)
+	if err != nil {
+		fatal("fetch failed: %v", err)
+	}
+	if res.Value.Has("error") {
+		// The page only says "Failed to fetch", whether offline, refused
+		// or blocked by CORS
+		fatal("fetch failed: %s (a cross-origin URL needs CORS headers allowing the page's origin)", res.Value.Get("error").Str())
+	}
+	var raw struct {
+		URL        string            `json:"url"`
+		Status     int               `json:"status"`
+		StatusText string            `json:"statusText"`
+		Redirected bool              `json:"redirected"`
+		Headers    map[string]string `json:"headers"`
+		Body       string            `json:"body"`
+	}
+	if err := res.Value.Unmarshal(&raw); err != nil {
+		fatal("fetch failed: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(raw.Body)
+	if err != nil {
+		fatal("fetch failed: %v", err)
+	}
+	result := fetchResult{URL: raw.URL, Status: raw.Status, StatusText: raw.StatusText, Redirected: raw.Redirected, Headers: raw.Headers}
+
+	if file != "" {
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			fatal("failed to write %s: %v", file, err)
+		}
+		recordArtifact("fetch", file)
+		result.File = file
+	} else if utf8.Valid(data) {
+		result.Body = string(data)
+	} else {
+		result.BodyBase64 = raw.Body
+	}
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		if include {
+			fmt.Printf("HTTP %d %s\n", result.Status, result.StatusText)
+			names := make([]string, 0, len(result.Headers))
+			for name := range result.Headers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("%s: %s\n", name, result.Headers[name])
+			}
+			fmt.Println()
+		}
+		switch {
+		case file != "":
+			fmt.Printf("Saved %s (%d bytes, HTTP %d)\n", file, len(data), result.Status)
+		case result.BodyBase64 != "":
+			_, _ = os.Stdout.Write(data)
+		default:
+			fmt.Print(result.Body)
+			if result.Body != "" && !strings.HasSuffix(result.Body, "\n") {
+				fmt.Println()
+			}
+		}
+	}
+	if result.Status >= 400 {
+		failWithOutput(exitFailed, "HTTP %d %s", result.Status, result.StatusText)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-rod/stealth"
+)
+
+// readURLList reads one URL per line, skipping blank lines and # comments
+func readURLList(file string) []string {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fatal("failed to read %s: %v", file, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "://") {
+			line = "https://" + line
+		}
+		urls = append(urls, line)
+	}
+	return urls
+}
+
+func cmdFetchAll(args []string, flags globalFlags) {
+	concurrency := 4
+	format, out := "md", ""
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--concurrency":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --concurrency")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				fatalUsage("invalid --concurrency: %s", args[i])
+			}
+			concurrency = n
+		case "--format":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --format")
+			}
+			if args[i] != "md" && args[i] != "json" {
+				fatalUsage("invalid --format: %s (expected md or json)", args[i])
+			}
+			format = args[i]
+		case "--out":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --out")
+			}
+			out = args[i]
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("usage: bb fetch-all <urls.txt|-> [--concurrency N] [--format md|json] [--out dir]")
+	}
+	urls := readURLList(positional[0])
+	if len(urls) == 0 {
+		fatal("no URLs in %s", positional[0])
+	}
+	if out == "" {
+		out = nextAvailableFile(filepath.Join(outputDir(), "fetch"), "")
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		fatal("failed to create %s: %v", out, err)
+	}
+	concurrency = min(concurrency, len(urls))
+
+	// Each worker has a tab of its own; the active page is left alone
+	_, browser := ensureBrowser()
+	index := make([]crawlEntry, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var printMu sync.Mutex
+	for w := 0; w < concurrency; w++ {
+		base := stealth.MustPage(browser)
+		configurePage(base)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer base.Close()
+			for i := range jobs {
+				entry := &index[i]
+				entry.URL = urls[i]
+				func() {
+					// rod's Must helpers panic; one bad page shouldn't end the batch
+					defer func() {
+						if r := recover(); r != nil {
+							entry.Error = fmt.Sprint(r)
+						}
+					}()
+					if _, err := crawlPage(base.Timeout(defaultTimeout), entry, out, i+1, format); err != nil {
+						entry.Error = err.Error()
+					}
+				}()
+				if !flags.jsonOutput {
+					printMu.Lock()
+					if entry.Error != "" {
+						fmt.Printf("fail  %s: %s\n", entry.URL, entry.Error)
+					} else {
+						fmt.Printf("ok    %s -> %s\n", entry.URL, entry.File)
+					}
+					printMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	indexFile := filepath.Join(out, "index.json")
+	data, _ := json.MarshalIndent(index, "", "  ")
+	if err := os.WriteFile(indexFile, data, 0644); err != nil {
+		fatal("failed to write %s: %v", indexFile, err)
+	}
+	recordArtifact("fetch", indexFile)
+	if flags.jsonOutput {
+		fmt.Println(string(data))
+		return
+	}
+	ok := 0
+	for _, e := range index {
+		if e.Error == "" {
+			ok++
+		}
+	}
+	fmt.Printf("Fetched %d/%d URLs into %s\n", ok, len(urls), out)
+}
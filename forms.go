@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// fillField is one selector → value pair from `bb fill` input
+type fillField struct {
+	Selector string
+	Value    interface{}
+}
+
+// parseFillData decodes a JSON object of selector → value, preserving key
+// order so fields are filled the way they appear in the input
+func parseFillData(data []byte) ([]fillField, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, fmt.Errorf("expected a JSON object of selector: value")
+	}
+	var fields []fillField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		fields = append(fields, fillField{Selector: tok.(string), Value: v})
+	}
+	return fields, nil
+}
+
+// fieldKindJS describes a form control so fill can pick the right strategy
+const fieldKindJS = `function() {
+	const tag = this.tagName.toLowerCase();
+	return {
+		tag,
+		type: (this.type || '').toLowerCase(),
+		name: this.name || '',
+		editable: this.isContentEditable,
+	};
+}`
+
+// setValueJS assigns a value directly and fires input/change, for input types
+// (date, color, range...) whose native pickers can't be typed into
+const setValueJS = `function(v) {
+	const proto = Object.getPrototypeOf(this);
+	const setter = Object.getOwnPropertyDescriptor(proto, 'value')?.set;
+	setter ? setter.call(this, v) : (this.value = v);
+	this.dispatchEvent(new Event('input', {bubbles: true}));
+	this.dispatchEvent(new Event('change', {bubbles: true}));
+}`
+
+// fillElement sets el to value according to its control type
+func fillElement(page *rod.Page, el *rod.Element, selector string, value interface{}) error {
+	res, err := el.Eval(fieldKindJS)
+	if err != nil {
+		return err
+	}
+	var kind struct {
+		Tag      string `json:"tag"`
+		Type     string `json:"type"`
+		Name     string `json:"name"`
+		Editable bool   `json:"editable"`
+	}
+	if err := json.Unmarshal([]byte(res.Value.JSON("", "")), &kind); err != nil {
+		return err
+	}
+
+	switch {
+	case kind.Tag == "select":
+		values := toStrings(value)
+		r, err := page.Eval(selectOptionsJS, selector, values, []string{}, []int{})
+		if err == nil && r.Value.Get("missing").Nil() {
+			return nil
+		}
+		// Fall back to matching option labels
+		r, err = page.Eval(selectOptionsJS, selector, []string{}, values, []int{})
+		if err != nil {
+			return err
+		}
+		if missing := r.Value.Get("missing"); !missing.Nil() {
+			var descs []string
+			for _, m := range missing.Arr() {
+				descs = append(descs, m.Str())
+			}
+			return fmt.Errorf("no option matching %s", strings.Join(descs, ", "))
+		}
+		return nil
+
+	case kind.Type == "checkbox":
+		want, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("checkbox needs true or false, got %v", value)
+		}
+		checked, err := el.Property("checked")
+		if err != nil {
+			return err
+		}
+		if checked.Bool() != want {
+			return el.Click(proto.InputMouseButtonLeft, 1)
+		}
+		return nil
+
+	case kind.Type == "radio":
+		target := el
+		if v, ok := value.(string); ok && kind.Name != "" {
+			target, err = page.Element(fmt.Sprintf(`input[type=radio][name=%q][value=%q]`, kind.Name, v))
+			if err != nil {
+				return fmt.Errorf("no radio %q with value %q", kind.Name, v)
+			}
+		} else if b, ok := value.(bool); ok && !b {
+			return fmt.Errorf("a radio button can't be unchecked")
+		}
+		return target.Click(proto.InputMouseButtonLeft, 1)
+
+	case kind.Type == "file":
+		return el.SetFiles(toStrings(value))
+
+	case kind.Tag == "input" && strings.Contains(" date datetime-local month week time color range ", " "+kind.Type+" "):
+		_, err := el.Eval(setValueJS, fmt.Sprint(value))
+		return err
+
+	case kind.Tag == "input" || kind.Tag == "textarea" || kind.Editable:
+		if err := el.SelectAllText(); err != nil {
+			return err
+		}
+		return el.Input(fmt.Sprint(value))
+	}
+	return fmt.Errorf("unsupported element <%s>", kind.Tag)
+}
+
+// toStrings flattens a JSON scalar or array into strings
+func toStrings(v interface{}) []string {
+	if arr, ok := v.([]interface{}); ok {
+		out := make([]string, 0, len(arr))
+		for _, item := range arr {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+func cmdFill(args []string, flags globalFlags) {
+	var data []byte
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--data":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --data")
+			}
+			data = []byte(args[i])
+		case "--file":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --file")
+			}
+			b, err := os.ReadFile(args[i])
+			if err != nil {
+				fatal("failed to read %s: %v", args[i], err)
+			}
+			data = b
+		default:
+			fatalUsage("unknown flag: %s", args[i])
+		}
+	}
+	if data == nil {
+		fatal(`usage: bb fill --data '{"<selector>": "<value>", ...}' | --file form.json`)
+	}
+	fields, err := parseFillData(data)
+	if err != nil {
+		fatalUsage("invalid fill data: %v", err)
+	}
+
+	_, _, page := withPage()
+	type fieldResult struct {
+		Selector string `json:"selector"`
+		OK       bool   `json:"ok"`
+		Error    string `json:"error,omitempty"`
+	}
+	var results []fieldResult
+	failed := 0
+	for _, f := range fields {
+		r := fieldResult{Selector: f.Selector, OK: true}
+		has, el, err := page.Has(f.Selector)
+		switch {
+		case err != nil:
+			r.Error = err.Error()
+		case !has:
+			r.Error = "element not found"
+		default:
+			if err := fillElement(page, el, f.Selector, f.Value); err != nil {
+				r.Error = err.Error()
+			}
+		}
+		if r.Error != "" {
+			r.OK = false
+			failed++
+		}
+		results = append(results, r)
+	}
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, r := range results {
+			if r.OK {
+				fmt.Printf("ok    %s\n", r.Selector)
+			} else {
+				fmt.Printf("fail  %s: %s\n", r.Selector, r.Error)
+			}
+		}
+		fmt.Printf("Filled %d/%d fields\n", len(results)-failed, len(results))
+	}
+	if failed > 0 {
+		exit(1)
+	}
+}
+
+// formFieldsJS describes the fields of the form matching sel (or the first
+// form on the page) along with a selector `bb fill` can use for each
+const formFieldsJS = `(sel) => {
+	` + cssPathJS + `
+	const form = sel ? document.querySelector(sel) : document.forms[0];
+	if (!form) throw new Error(sel ? 'form not found' : 'no form on page');
+	const elements = form.elements ? Array.from(form.elements) :
+		Array.from(form.querySelectorAll('input, select, textarea, button'));
+	const text = s => (s || '').replace(/\s+/g, ' ').trim();
+	const labelOf = el => {
+		if (el.labels && el.labels.length) return text(el.labels[0].textContent);
+		if (el.getAttribute('aria-label')) return text(el.getAttribute('aria-label'));
+		const by = el.getAttribute('aria-labelledby');
+		if (by) return text(by.split(/\s+/).map(id => document.getElementById(id)?.textContent).join(' '));
+		return text(el.placeholder || el.title);
+	};
+	// Its id or name when that only matches el on the page, otherwise its path
+	const selectorOf = el => {
+		if (el.id && document.querySelectorAll('#' + CSS.escape(el.id)).length === 1) return '#' + CSS.escape(el.id);
+		if (el.name) {
+			let s = el.tagName.toLowerCase() + '[name="' + CSS.escape(el.name) + '"]';
+			if (el.type === 'radio' || el.type === 'checkbox') s += '[value="' + CSS.escape(el.value) + '"]';
+			const matches = document.querySelectorAll(s);
+			if (matches.length === 1 && matches[0] === el) return s;
+		}
+		return cssPath(el);
+	};
+	const fields = [];
+	for (const el of elements) {
+		const tag = el.tagName.toLowerCase();
+		if (tag === 'fieldset' || tag === 'object' || tag === 'output') continue;
+		const type = tag === 'input' ? (el.type || 'text') : (tag === 'select' && el.multiple ? 'select-multiple' : tag);
+		const f = {selector: selectorOf(el), name: el.name || '', type, label: labelOf(el), required: !!el.required};
+		if (el.disabled) f.disabled = true;
+		if (tag === 'select') {
+			f.value = el.multiple ? Array.from(el.selectedOptions).map(o => o.value) : el.value;
+			f.options = Array.from(el.options).map(o => ({value: o.value, label: text(o.text), selected: o.selected}));
+		} else if (type === 'checkbox' || type === 'radio') {
+			f.value = el.value;
+			f.checked = el.checked;
+		} else if (type === 'file') {
+			f.value = Array.from(el.files || []).map(file => file.name);
+		} else {
+			f.value = el.value;
+		}
+		fields.push(f);
+	}
+	return {action: form.action || '', method: (form.method || 'get').toLowerCase(), fields};
+}`
+
+type formOption struct {
+	Value    string `json:"value"`
+	Label    string `json:"label"`
+	Selected bool   `json:"selected"`
+}
+
+type formField struct {
+	Selector string          `json:"selector"`
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Label    string          `json:"label"`
+	Required bool            `json:"required"`
+	Disabled bool            `json:"disabled,omitempty"`
+	Value    json.RawMessage `json:"value"`
+	Checked  *bool           `json:"checked,omitempty"`
+	Options  []formOption    `json:"options,omitempty"`
+}
+
+func cmdForm(args []string, flags globalFlags) {
+	sel := ""
+	if len(args) > 1 {
+		fatalUsage("usage: bb form [selector]")
+	}
+	if len(args) == 1 {
+		sel = args[0]
+	}
+	_, _, page := withPage()
+	result, err := page.Eval(formFieldsJS, sel)
+	if err != nil {
+		fatal("form inspection failed: %v", err)
+	}
+
+	raw := result.Value.JSON("", "  ")
+	if flags.jsonOutput {
+		fmt.Println(raw)
+		return
+	}
+
+	var form struct {
+		Action string      `json:"action"`
+		Method string      `json:"method"`
+		Fields []formField `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(raw), &form); err != nil {
+		fatal("form inspection failed: %v", err)
+	}
+	fmt.Printf("%s %s\n", strings.ToUpper(form.Method), form.Action)
+	for _, f := range form.Fields {
+		line := fmt.Sprintf("  %-24s %-16s", f.Selector, f.Type)
+		if f.Label != "" {
+			line += fmt.Sprintf(" %q", f.Label)
+		}
+		if f.Checked != nil {
+			line += fmt.Sprintf(" checked=%t", *f.Checked)
+		} else {
+			line += " = " + string(f.Value)
+		}
+		if f.Required {
+			line += " (required)"
+		}
+		if f.Disabled {
+			line += " (disabled)"
+		}
+		fmt.Println(line)
+		for _, o := range f.Options {
+			mark := " "
+			if o.Selected {
+				mark = "*"
+			}
+			fmt.Printf("      %s %q (value %q)\n", mark, o.Label, o.Value)
+		}
+	}
+}
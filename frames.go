@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+)
+
+// isDetachedFrame reports whether err means an iframe's document went away
+// mid-call. Chrome moves cross-origin iframes into a new process when they
+// navigate, which ends their session and execution context; rod retries a
+// missing context itself, but not a session that's gone.
+func isDetachedFrame(err error) bool {
+	var objErr *rod.ObjectNotFoundError
+	if errors.Is(err, cdp.ErrSessionNotFound) || errors.Is(err, cdp.ErrCtxDestroyed) ||
+		errors.Is(err, cdp.ErrNotAttachedToActivePage) || errors.As(err, &objErr) {
+		return true
+	}
+	var cdpErr *cdp.Error
+	return errors.As(err, &cdpErr) && (strings.Contains(cdpErr.Message, "No frame with given id") ||
+		strings.Contains(cdpErr.Message, "Frame with the given id was not found"))
+}
+
+// frameRef is what an iframe is found by again after a swap: its name
+// attribute if it has one, otherwise the URL it showed
+type frameRef struct {
+	name string
+	url  string
+}
+
+func refOfFrame(el *rod.Element, frame *rod.Page) frameRef {
+	var ref frameRef
+	if name, err := el.Attribute("name"); err == nil && name != nil {
+		ref.name = *name
+	}
+	if info, err := frame.Info(); err == nil {
+		ref.url = info.URL
+	}
+	return ref
+}
+
+// refindFrame resolves ref among the page's iframes again
+func refindFrame(page *rod.Page, ref frameRef) (*rod.Page, bool) {
+	iframes, err := page.Elements("iframe")
+	if err != nil {
+		return nil, false
+	}
+	for _, el := range iframes {
+		if ref.name != "" {
+			if name, err := el.Attribute("name"); err != nil || name == nil || *name != ref.name {
+				continue
+			}
+		}
+		frame, err := el.Frame()
+		if err != nil {
+			continue
+		}
+		if ref.name == "" {
+			if info, err := frame.Info(); err != nil || info.URL != ref.url {
+				continue
+			}
+		}
+		return frame, true
+	}
+	return nil, false
+}
+
+// inFrame runs fn in the iframe of el, and once more in the same iframe
+// found again if its document was swapped out while fn ran
+func inFrame(page *rod.Page, el *rod.Element, fn func(frame *rod.Page, src string) error) error {
+	frame, err := el.Frame()
+	if err != nil {
+		return err
+	}
+	ref := refOfFrame(el, frame)
+	err = fn(frame, ref.url)
+	if !isDetachedFrame(err) {
+		return err
+	}
+	frame, ok := refindFrame(page, ref)
+	if !ok {
+		return err
+	}
+	src := ref.url
+	if info, err := frame.Info(); err == nil {
+		src = info.URL
+	}
+	return fn(frame, src)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// scrollBoxJS finds what scrolls an element's content: the element itself or
+// its tallest scrollable descendant, else the window. It scrolls that to top
+// (null keeps the position), moves it by step and reports where it is.
+const scrollBoxJS = `function(top, step) {
+	let best = null;
+	for (const el of [this, ...this.querySelectorAll('*')]) {
+		const oy = getComputedStyle(el).overflowY;
+		if ((oy === 'auto' || oy === 'scroll') && el.scrollHeight > el.clientHeight + 1 &&
+			(!best || el.scrollHeight > best.scrollHeight)) best = el;
+	}
+	const box = best || document.scrollingElement;
+	if (top !== null) box.scrollTop = top;
+	if (step) box.scrollTop += step * box.clientHeight;
+	return {top: box.scrollTop, max: box.scrollHeight - box.clientHeight};
+}`
+
+// scrollBox runs scrollBoxJS on el; top is nil to keep the position
+func scrollBox(el *rod.Element, top any, step float64) (float64, float64) {
+	res, err := el.Evaluate(rod.Eval(scrollBoxJS, top, step))
+	if err != nil {
+		fatal("failed to scroll: %v", err)
+	}
+	return res.Value.Get("top").Num(), res.Value.Get("max").Num()
+}
+
+type gridRow struct {
+	Index int      `json:"index,omitempty"` // aria-rowindex, when the grid sets it
+	Level int      `json:"level,omitempty"` // treegrid nesting
+	Cells []string `json:"cells"`
+
+	top int // where the row sits in the scrolled content
+}
+
+type gridResult struct {
+	Role     string    `json:"role"`
+	Columns  []string  `json:"columns"`
+	Rows     []gridRow `json:"rows"`
+	RowCount int       `json:"row_count,omitempty"` // aria-rowcount: all rows, including the header
+}
+
+// gridRowTopsJS gives where each row element of a grid sits in the scrolled
+// content, in document order. That stays the same when a virtualized grid
+// re-creates the row's element.
+const gridRowTopsJS = `function() {
+	const tops = [];
+	for (const row of this.querySelectorAll('[role=row], tr:not([role])')) {
+		let top = row.getBoundingClientRect().top;
+		for (let el = row.parentElement; el; el = el.parentElement) top += el.scrollTop;
+		tops.push(Math.round(top));
+	}
+	return tops;
+}`
+
+// gridRowInfo is what the DOM tells about a row: its aria-rowindex and where
+// it sits
+type gridRowInfo struct {
+	index, top int
+}
+
+// gridRowInfos reads the aria-rowindex and position of every row element in
+// the grid, by the row's node. The grid's DOM is described once, rather than
+// each row on its own; gridRowTopsJS finds the same rows in the same order.
+func gridRowInfos(page *rod.Page, el *rod.Element, grid proto.DOMBackendNodeID) map[proto.DOMBackendNodeID]gridRowInfo {
+	infos := map[proto.DOMBackendNodeID]gridRowInfo{}
+	depth := -1
+	node, err := proto.DOMDescribeNode{BackendNodeID: grid, Depth: &depth}.Call(page)
+	if err != nil {
+		return infos
+	}
+	res, err := el.Evaluate(rod.Eval(gridRowTopsJS))
+	if err != nil {
+		return infos
+	}
+	tops := res.Value.Arr()
+	i := 0
+	var walk func(n *proto.DOMNode)
+	walk = func(n *proto.DOMNode) {
+		for _, c := range n.Children {
+			attrs := map[string]string{}
+			for j := 0; j+1 < len(c.Attributes); j += 2 {
+				attrs[c.Attributes[j]] = c.Attributes[j+1]
+			}
+			role, hasRole := attrs["role"]
+			if role == "row" || (c.NodeName == "TR" && !hasRole) {
+				info := gridRowInfo{}
+				info.index, _ = strconv.Atoi(attrs["aria-rowindex"])
+				if i < len(tops) {
+					info.top = tops[i].Int()
+				}
+				infos[c.BackendNodeID] = info
+				i++
+			}
+			walk(c)
+		}
+	}
+	walk(node.Node)
+	return infos
+}
+
+// domAttrs returns the attributes of a DOM node
+func domAttrs(page *rod.Page, id proto.DOMBackendNodeID) map[string]string {
+	attrs := map[string]string{}
+	node, err := proto.DOMDescribeNode{BackendNodeID: id}.Call(page)
+	if err != nil {
+		return attrs
+	}
+	for i := 0; i+1 < len(node.Node.Attributes); i += 2 {
+		attrs[node.Node.Attributes[i]] = node.Node.Attributes[i+1]
+	}
+	return attrs
+}
+
+// gridRows reads the rows currently rendered under the grid's AX node.
+// Header rows are those made only of column headers.
+func gridRows(page *rod.Page, el *rod.Element, grid proto.DOMBackendNodeID) (header []string, rows []gridRow, err error) {
+	// Only the grid's subtree, ignored wrappers included
+	tree, err := proto.AccessibilityQueryAXTree{BackendNodeID: grid}.Call(page)
+	if err != nil {
+		return nil, nil, err
+	}
+	infos := gridRowInfos(page, el, grid)
+	byID := map[proto.AccessibilityAXNodeID]*proto.AccessibilityAXNode{}
+	var root *proto.AccessibilityAXNode
+	for _, n := range tree.Nodes {
+		byID[n.NodeID] = n
+		if n.BackendDOMNodeID == grid && root == nil {
+			root = n
+		}
+	}
+	if root == nil {
+		return nil, nil, fmt.Errorf("the element has no accessibility node")
+	}
+
+	// Cells are named from their content; ignored wrappers are walked through
+	var cells func(n *proto.AccessibilityAXNode, out *[]*proto.AccessibilityAXNode)
+	cells = func(n *proto.AccessibilityAXNode, out *[]*proto.AccessibilityAXNode) {
+		for _, id := range n.ChildIDs {
+			c, ok := byID[id]
+			if !ok {
+				continue
+			}
+			switch axValueStr(c.Role) {
+			case "gridcell", "cell", "columnheader", "rowheader":
+				*out = append(*out, c)
+			default:
+				cells(c, out)
+			}
+		}
+	}
+	var walk func(n *proto.AccessibilityAXNode)
+	walk = func(n *proto.AccessibilityAXNode) {
+		for _, id := range n.ChildIDs {
+			c, ok := byID[id]
+			if !ok {
+				continue
+			}
+			if axValueStr(c.Role) != "row" {
+				walk(c)
+				continue
+			}
+			var found []*proto.AccessibilityAXNode
+			cells(c, &found)
+			if len(found) == 0 {
+				continue
+			}
+			allHeaders := true
+			row := gridRow{Cells: make([]string, len(found))}
+			for i, cell := range found {
+				row.Cells[i] = strings.TrimSpace(axValueStr(cell.Name))
+				allHeaders = allHeaders && axValueStr(cell.Role) == "columnheader"
+			}
+			if allHeaders {
+				header = append(header, row.Cells...)
+				continue
+			}
+			for _, p := range c.Properties {
+				if p.Name == proto.AccessibilityAXPropertyNameLevel {
+					row.Level = int(p.Value.Value.Int())
+				}
+			}
+			info := infos[c.BackendDOMNodeID]
+			row.Index, row.top = info.index, info.top
+			rows = append(rows, row)
+		}
+	}
+	walk(root)
+	return header, rows, nil
+}
+
+func cmdGrid(args []string, flags globalFlags) {
+	usage := "usage: bb grid [selector] [--max-rows N]"
+	selector, maxRows := "", 0
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--max-rows":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --max-rows")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				fatalUsage("invalid --max-rows: %s", args[i])
+			}
+			maxRows = n
+		case selector == "" && !strings.HasPrefix(args[i], "--"):
+			selector = args[i]
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	if selector == "" {
+		selector = "[role=grid], [role=treegrid]"
+	}
+
+	_, _, page := withPage()
+	el, err := page.Element(selector)
+	if err != nil {
+		fail(exitNotFound, selector, "no grid found: %s", selector)
+	}
+	node, err := proto.DOMDescribeNode{ObjectID: el.Object.ObjectID}.Call(page)
+	if err != nil {
+		fatal("failed to describe the grid: %v", err)
+	}
+	attrs := domAttrs(page, node.Node.BackendNodeID)
+	r := gridResult{Role: attrs["role"], Columns: []string{}, Rows: []gridRow{}}
+	r.RowCount, _ = strconv.Atoi(attrs["aria-rowcount"])
+
+	start, _ := scrollBox(el, nil, 0)
+	defer scrollBox(el, start, 0)
+	scrollBox(el, 0, 0)
+
+	// Virtualized grids only render the rows in view, so scroll through and
+	// collect what each position renders. Rows with an aria-rowindex are
+	// merged, which also joins the halves of rows split by pinned columns.
+	// Others are told apart by where they sit in the content, so identical
+	// rows are all kept.
+	seen := map[int]int{}
+	seenAt := map[string]bool{}
+	for prev := 0.0; ; {
+		time.Sleep(150 * time.Millisecond)
+		header, rows, err := gridRows(page, el, node.Node.BackendNodeID)
+		if err != nil {
+			fatal("failed to read the grid: %v", err)
+		}
+		if len(r.Columns) == 0 && len(header) > 0 {
+			r.Columns = header
+		}
+		for _, row := range rows {
+			if row.Index > 0 {
+				if i, ok := seen[row.Index]; ok {
+					if len(r.Rows[i].Cells) < len(r.Columns) {
+						r.Rows[i].Cells = append(r.Rows[i].Cells, row.Cells...)
+					}
+					continue
+				}
+				seen[row.Index] = len(r.Rows)
+			} else {
+				key := fmt.Sprintf("%d\x00%s", row.top, strings.Join(row.Cells, "\x00"))
+				if seenAt[key] {
+					continue
+				}
+				seenAt[key] = true
+			}
+			r.Rows = append(r.Rows, row)
+		}
+		if maxRows > 0 && len(r.Rows) >= maxRows {
+			r.Rows = r.Rows[:maxRows]
+			break
+		}
+		top, _ := scrollBox(el, nil, 0.8)
+		if top <= prev {
+			break
+		}
+		prev = top
+	}
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(r, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	table := [][]string{}
+	if len(r.Columns) > 0 {
+		table = append(table, r.Columns)
+	}
+	for _, row := range r.Rows {
+		cells := row.Cells
+		if row.Level > 1 {
+			cells = append([]string{strings.Repeat("  ", row.Level-1) + cells[0]}, cells[1:]...)
+		}
+		table = append(table, cells)
+	}
+	widths := map[int]int{}
+	for _, cells := range table {
+		for i, c := range cells {
+			widths[i] = max(widths[i], len([]rune(c)))
+		}
+	}
+	for _, cells := range table {
+		padded := make([]string, len(cells))
+		for i, c := range cells {
+			padded[i] = c + strings.Repeat(" ", widths[i]-len([]rune(c)))
+		}
+		fmt.Println(strings.TrimRight(strings.Join(padded, "  "), " "))
+	}
+	total := ""
+	if r.RowCount > 0 {
+		headers := 0
+		if len(r.Columns) > 0 {
+			headers = 1
+		}
+		total = fmt.Sprintf(" of %d", r.RowCount-headers)
+	}
+	fmt.Printf("(%d rows%s)\n", len(r.Rows), total)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// heapSnapshot is the part of a .heapsnapshot file needed to count objects
+type heapSnapshot struct {
+	Snapshot struct {
+		Meta struct {
+			NodeFields []string          `json:"node_fields"`
+			NodeTypes  []json.RawMessage `json:"node_types"`
+		} `json:"meta"`
+	} `json:"snapshot"`
+	Nodes   []int64  `json:"nodes"`
+	Strings []string `json:"strings"`
+}
+
+// heapClass aggregates the objects of one constructor
+type heapClass struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+// heapClasses groups a snapshot's nodes like the DevTools summary view:
+// objects by constructor name, everything else by node type
+func heapClasses(file string) (map[string]*heapClass, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var snap heapSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%s is not a heap snapshot: %v", file, err)
+	}
+	meta := snap.Snapshot.Meta
+	fieldIndex := func(name string) int { return slices.Index(meta.NodeFields, name) }
+	typeIdx, nameIdx, sizeIdx := fieldIndex("type"), fieldIndex("name"), fieldIndex("self_size")
+	if typeIdx < 0 || nameIdx < 0 || sizeIdx < 0 || len(meta.NodeTypes) == 0 {
+		return nil, fmt.Errorf("%s: unsupported heap snapshot format", file)
+	}
+	var typeNames []string
+	if err := json.Unmarshal(meta.NodeTypes[0], &typeNames); err != nil {
+		return nil, fmt.Errorf("%s: unsupported heap snapshot format", file)
+	}
+
+	classes := map[string]*heapClass{}
+	stride := len(meta.NodeFields)
+	for i := 0; i+stride <= len(snap.Nodes); i += stride {
+		typ := ""
+		if t := int(snap.Nodes[i+typeIdx]); t < len(typeNames) {
+			typ = typeNames[t]
+		}
+		name := "(" + typ + ")"
+		if typ == "object" || typ == "native" || typ == "closure" {
+			if n := int(snap.Nodes[i+nameIdx]); n < len(snap.Strings) {
+				name = snap.Strings[n]
+			}
+		}
+		c := classes[name]
+		if c == nil {
+			c = &heapClass{Name: name}
+			classes[name] = c
+		}
+		c.Count++
+		c.Size += snap.Nodes[i+sizeIdx]
+	}
+	return classes, nil
+}
+
+func cmdHeap(args []string, flags globalFlags) {
+	usage := "usage: bb heap snapshot <file> | bb heap diff <a> <b> [--top N]"
+	if len(args) == 0 {
+		fatalUsage("%s", usage)
+	}
+	switch args[0] {
+	case "snapshot":
+		if len(args) != 2 {
+			fatalUsage("%s", usage)
+		}
+		heapSnapshotCmd(args[1])
+	case "diff":
+		top := 20
+		var positional []string
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--top" {
+				i++
+				if i >= len(args) {
+					fatalUsage("missing value for --top")
+				}
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fatalUsage("invalid --top: %s", args[i])
+				}
+				top = n
+				continue
+			}
+			positional = append(positional, args[i])
+		}
+		if len(positional) != 2 {
+			fatalUsage("%s", usage)
+		}
+		heapDiff(positional[0], positional[1], top, flags)
+	default:
+		fatalUsage("%s", usage)
+	}
+}
+
+func heapSnapshotCmd(file string) {
+	_, _, page := withPage()
+	if err := (proto.HeapProfilerEnable{}).Call(page); err != nil {
+		fatal("failed to enable the heap profiler: %v", err)
+	}
+	// Only what is still reachable should count
+	if err := (proto.HeapProfilerCollectGarbage{}).Call(page); err != nil {
+		fatal("failed to collect garbage: %v", err)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		fatal("failed to write %s: %v", file, err)
+	}
+	defer f.Close()
+	out := &countingWriter{w: f}
+
+	// The snapshot is one JSON object sent in chunks, and the chunks can
+	// still be arriving when the call returns (the progress events end
+	// before they start). Decoding the stream as it comes tells when the
+	// object is complete, reading each chunk once.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	wait := page.Context(ctx).EachEvent(func(e *proto.HeapProfilerAddHeapSnapshotChunk) {
+		_, _ = io.WriteString(pw, e.Chunk)
+	})
+	go wait()
+	done := make(chan error, 1)
+	go func() {
+		done <- json.NewDecoder(io.TeeReader(pr, out)).Decode(&struct{}{})
+	}()
+	if err := (proto.HeapProfilerTakeHeapSnapshot{}).Call(page); err != nil {
+		fatal("failed to take heap snapshot: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			fatal("failed to receive the heap snapshot: %v", err)
+		}
+	case <-time.After(defaultTimeout):
+		fatal("timed out receiving the heap snapshot")
+	}
+	if err := f.Close(); err != nil {
+		fatal("failed to write %s: %v", file, err)
+	}
+	recordArtifact("heap", file)
+	fmt.Printf("Saved %s (%.1f MB)\n", file, float64(out.n)/(1<<20))
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func heapDiff(a, b string, top int, flags globalFlags) {
+	before, err := heapClasses(a)
+	if err != nil {
+		fatal("%v", err)
+	}
+	after, err := heapClasses(b)
+	if err != nil {
+		fatal("%v", err)
+	}
+
+	type classDiff struct {
+		Name       string `json:"name"`
+		CountDelta int    `json:"count_delta"`
+		SizeDelta  int64  `json:"size_delta"`
+		Count      int    `json:"count"`
+		Size       int64  `json:"size"`
+	}
+	var diffs []classDiff
+	var detached, totalCount int
+	var totalSize int64
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	for name := range names {
+		d := classDiff{Name: name}
+		if c := after[name]; c != nil {
+			d.Count, d.Size = c.Count, c.Size
+		}
+		d.CountDelta, d.SizeDelta = d.Count, d.Size
+		if c := before[name]; c != nil {
+			d.CountDelta -= c.Count
+			d.SizeDelta -= c.Size
+		}
+		totalCount += d.CountDelta
+		totalSize += d.SizeDelta
+		// Chrome names DOM nodes that left the document but are still
+		// referenced "Detached <element>"
+		if strings.HasPrefix(name, "Detached ") {
+			detached += d.Count
+		}
+		if d.CountDelta != 0 || d.SizeDelta != 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	slices.SortFunc(diffs, func(x, y classDiff) int {
+		if x.SizeDelta != y.SizeDelta {
+			if x.SizeDelta > y.SizeDelta {
+				return -1
+			}
+			return 1
+		}
+		if x.CountDelta != y.CountDelta {
+			return y.CountDelta - x.CountDelta
+		}
+		return strings.Compare(x.Name, y.Name)
+	})
+	if len(diffs) > top {
+		diffs = diffs[:top]
+	}
+
+	if flags.jsonOutput {
+		if diffs == nil {
+			diffs = []classDiff{}
+		}
+		out, _ := json.MarshalIndent(map[string]interface{}{
+			"count_delta":    totalCount,
+			"size_delta":     totalSize,
+			"detached_nodes": detached,
+			"classes":        diffs,
+		}, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Printf("%+d objects, %+d bytes; %d detached DOM nodes in %s\n", totalCount, totalSize, detached, b)
+	for _, d := range diffs {
+		fmt.Printf("%+8d %+12d  %s\n", d.CountDelta, d.SizeDelta, d.Name)
+	}
+}
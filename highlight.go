@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// highlightJS outlines the element it runs on in a layer of its own. The
+// label is drawn by a pseudo-element, so it stays out of the page's text.
+const highlightJS = `function(color, label) {
+	this.scrollIntoView({block: 'center', inline: 'center'});
+	let layer = document.getElementById('__bb_highlight');
+	if (!layer) {
+		layer = document.createElement('div');
+		layer.id = '__bb_highlight';
+		layer.style.cssText = 'position:absolute;left:0;top:0;width:0;height:0;z-index:2147483647;pointer-events:none';
+		const style = document.createElement('style');
+		style.textContent = '#__bb_highlight > div::before { content: attr(data-label); position: absolute; left: -3px; bottom: 100%; padding: 1px 4px; ' +
+			'font: bold 12px/16px monospace; color: #fff; background: var(--bb-color); white-space: nowrap; }';
+		layer.appendChild(style);
+		document.body.appendChild(layer);
+	}
+	const r = this.getBoundingClientRect();
+	const box = document.createElement('div');
+	box.dataset.label = label;
+	box.style.cssText = '--bb-color:' + color + ';position:absolute;box-sizing:border-box;border:3px solid ' + color + ';' +
+		'background:color-mix(in srgb, ' + color + ' 15%, transparent);' +
+		'left:' + (r.left + scrollX - 3) + 'px;top:' + (r.top + scrollY - 3) + 'px;width:' + (r.width + 6) + 'px;height:' + (r.height + 6) + 'px';
+	layer.appendChild(box);
+}`
+
+const clearHighlightJS = `() => document.getElementById('__bb_highlight')?.remove()`
+
+func cmdHighlight(args []string) {
+	usage := "usage: bb highlight <selector>|--node <id> [--color c] [--label text] [--all] [--screenshot[=file]] | bb highlight --clear"
+	node, args := takeNodeFlag(args)
+	selector, color, label := "", "#e5177b", ""
+	all, clear, shot, file := false, false, false, ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--color" || args[i] == "--label":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			if args[i] == "--color" {
+				color = args[i+1]
+			} else {
+				label = args[i+1]
+			}
+			i++
+		case args[i] == "--all":
+			all = true
+		case args[i] == "--clear":
+			clear = true
+		case args[i] == "--screenshot":
+			shot = true
+		case strings.HasPrefix(args[i], "--screenshot="):
+			shot, file = true, strings.TrimPrefix(args[i], "--screenshot=")
+		case selector == "" && !strings.HasPrefix(args[i], "--"):
+			selector = args[i]
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+
+	_, _, page := withPage()
+	if clear {
+		if selector != "" || node != 0 {
+			fatalUsage("%s", usage)
+		}
+		_, _ = page.Eval(clearHighlightJS)
+		fmt.Println("Cleared highlights")
+		return
+	}
+	if selector == "" && node == 0 {
+		fatalUsage("%s", usage)
+	}
+	nodeOrSelector(node, selector)
+	if label == "" {
+		label = selector
+		if node != 0 {
+			label = fmt.Sprintf("node %d", node)
+		}
+	}
+
+	var els rod.Elements
+	if all && node == 0 {
+		found, err := page.Elements(selector)
+		if err != nil || len(found) == 0 {
+			fatalNotFound(selector, nil)
+		}
+		els = found
+	} else {
+		el, err := findElement(page, selector, node)
+		if err != nil {
+			fatalNoElement(selector, node, err)
+		}
+		els = rod.Elements{el}
+	}
+	for i, el := range els {
+		text := label
+		if len(els) > 1 {
+			text = fmt.Sprintf("%s [%d]", label, i+1)
+		}
+		if _, err := el.Evaluate(rod.Eval(highlightJS, color, text)); err != nil {
+			fatal("failed to highlight: %v", err)
+		}
+	}
+
+	if !shot {
+		fmt.Printf("Highlighted %d element(s); bb highlight --clear removes the outline\n", len(els))
+		return
+	}
+	// The screenshot is the record; the page is left as it was. Several
+	// elements may not fit in the viewport together.
+	data, err := page.Screenshot(len(els) > 1, nil)
+	_, _ = page.Eval(clearHighlightJS)
+	if err != nil {
+		fatal("screenshot failed: %v", err)
+	}
+	if file == "" {
+		file = nextAvailableFile(filepath.Join(outputDir(), "highlight"), ".png")
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		fatal("failed to write screenshot: %v", err)
+	}
+	recordArtifact("screenshot", file)
+	fmt.Println(file)
+}
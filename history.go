@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// maxHistory is how many navigations are kept per page
+const maxHistory = 100
+
+// HistoryEntry is a navigation bb performed. Entries are tied to the page's
+// target id, so closing another page doesn't move them to the wrong page.
+type HistoryEntry struct {
+	Target string `json:"target"`
+	URL    string `json:"url"`
+	Title  string `json:"title"`
+	Time   string `json:"time"`
+}
+
+// recordNavigation appends page's current URL to the session history. Like
+// recordArtifact it is best-effort.
+func recordNavigation(page *rod.Page) {
+	s, err := loadState()
+	if err != nil {
+		return
+	}
+	info, err := page.Info()
+	if err != nil {
+		return
+	}
+	target := string(page.TargetID)
+	s.History = append(s.History, HistoryEntry{
+		Target: target,
+		URL:    info.URL,
+		Title:  info.Title,
+		Time:   time.Now().Format(time.RFC3339),
+	})
+	if entries := pageHistory(s, target); len(entries) > maxHistory {
+		drop := entries[0]
+		for i, e := range s.History {
+			if e == drop {
+				s.History = append(s.History[:i], s.History[i+1:]...)
+				break
+			}
+		}
+	}
+	_ = saveState(s)
+}
+
+// pageHistory returns the navigations of one page, oldest first
+func pageHistory(s *State, target string) []HistoryEntry {
+	var entries []HistoryEntry
+	for _, e := range s.History {
+		if e.Target == target {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// pruneHistory drops the history of pages that no longer exist
+func pruneHistory(s *State, pages rod.Pages) {
+	open := map[string]bool{}
+	for _, p := range pages {
+		open[string(p.TargetID)] = true
+	}
+	kept := s.History[:0]
+	for _, e := range s.History {
+		if open[e.Target] {
+			kept = append(kept, e)
+		}
+	}
+	s.History = kept
+}
+
+func cmdHistory(args []string, flags globalFlags) {
+	usage := "usage: bb history [--page N|id] | bb history goto <n> [--page N|id]"
+	pageRef := ""
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--page":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --page")
+			}
+			pageRef = args[i]
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	s, browser := ensureBrowser()
+	pages, err := browser.Pages()
+	if err != nil {
+		fatal("failed to list pages: %v", err)
+	}
+	pageIdx := activePageIndex(s, pages)
+	if pageRef != "" {
+		if pageIdx, err = resolvePage(pageRef, pages); err != nil {
+			fatal("%v", err)
+		}
+	}
+	if pageIdx < 0 || pageIdx >= len(pages) {
+		fatal("page index %d out of range (0-%d)", pageIdx, len(pages)-1)
+	}
+	entries := pageHistory(s, string(pages[pageIdx].TargetID))
+
+	if len(positional) == 0 {
+		if flags.jsonOutput {
+			type item struct {
+				N     int    `json:"n"`
+				URL   string `json:"url"`
+				Title string `json:"title"`
+				Time  string `json:"time"`
+			}
+			items := []item{}
+			for i, e := range entries {
+				items = append(items, item{i + 1, e.URL, e.Title, e.Time})
+			}
+			out, _ := json.MarshalIndent(items, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("No history for this page")
+			return
+		}
+		for i, e := range entries {
+			fmt.Printf("%3d  %s  %s - %s\n", i+1, e.Time, e.Title, e.URL)
+		}
+		return
+	}
+
+	if positional[0] != "goto" || len(positional) != 2 {
+		fatalUsage("%s", usage)
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(positional[1], "#"))
+	if err != nil {
+		fatalUsage("invalid history entry: %s", positional[1])
+	}
+	if n < 1 || n > len(entries) {
+		fail(exitNotFound, "", "no history entry %d (see bb history)", n)
+	}
+	page := activatePage(pages[pageIdx])
+	prepareNavigation(page, entries[n-1].URL, false)
+	if err := page.Navigate(entries[n-1].URL); err != nil {
+		fatal("navigation failed: %v", err)
+	}
+	page.MustWaitLoad()
+	recordNavigation(page)
+	info, _ := page.Info()
+	if info != nil {
+		fmt.Println(info.URL)
+	}
+}
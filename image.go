@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// imageOptions controls post-processing of screenshots before they are written
+type imageOptions struct {
+	maxDimension int    // longest side in pixels, 0 = keep
+	optimize     bool   // spend more CPU on smaller output
+	format       string // png (default) or jpeg
+	quality      int    // jpeg quality 1-100, 0 = default
+}
+
+// ext returns the file extension for auto-named output
+func (o imageOptions) ext() string {
+	if o.format == "jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// inferFormat picks the output format from the file name unless --format was given
+func (o *imageOptions) inferFormat(file string) {
+	if o.format != "" {
+		return
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jpg", ".jpeg":
+		o.format = "jpeg"
+	}
+}
+
+// parseImageFlag consumes one image post-processing flag at args[i]. It
+// returns the index of the last consumed argument and false if args[i] is not
+// an image flag.
+func parseImageFlag(args []string, i int, opts *imageOptions) (int, bool) {
+	switch args[i] {
+	case "--max-dimension":
+		i++
+		if i >= len(args) {
+			fatalUsage("missing value for --max-dimension")
+		}
+		v, err := strconv.Atoi(args[i])
+		if err != nil || v <= 0 {
+			fatalUsage("invalid --max-dimension: %s", args[i])
+		}
+		opts.maxDimension = v
+		return i, true
+	case "--optimize":
+		opts.optimize = true
+		return i, true
+	case "--format":
+		i++
+		if i >= len(args) {
+			fatalUsage("missing value for --format")
+		}
+		switch strings.ToLower(args[i]) {
+		case "png":
+			opts.format = "png"
+		case "jpeg", "jpg":
+			opts.format = "jpeg"
+		default:
+			fatalUsage("invalid --format: %s (expected png or jpeg)", args[i])
+		}
+		return i, true
+	case "--quality":
+		i++
+		if i >= len(args) {
+			fatalUsage("missing value for --quality")
+		}
+		v, err := strconv.Atoi(args[i])
+		if err != nil || v < 1 || v > 100 {
+			fatalUsage("invalid --quality: %s (expected 1-100)", args[i])
+		}
+		opts.quality = v
+		return i, true
+	}
+	return i, false
+}
+
+// processImage applies opts to PNG data. Without options the data is returned untouched.
+func processImage(data []byte, opts imageOptions) ([]byte, error) {
+	if opts.maxDimension == 0 && !opts.optimize && opts.format != "jpeg" {
+		return data, nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out, err := encodeImage(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Re-encoding an already small image can make it larger
+	if opts.maxDimension == 0 && opts.format != "jpeg" && len(out) >= len(data) {
+		return data, nil
+	}
+	return out, nil
+}
+
+// encodeImage downscales img according to opts and encodes it in the requested format
+func encodeImage(img image.Image, opts imageOptions) ([]byte, error) {
+	if opts.maxDimension > 0 {
+		img = downscale(img, opts.maxDimension)
+	}
+
+	var buf bytes.Buffer
+	if opts.format == "jpeg" {
+		if img.Bounds().Dy() > 65535 {
+			return nil, fmt.Errorf("image is %dpx tall, too tall for JPEG (max 65535)", img.Bounds().Dy())
+		}
+		quality := opts.quality
+		if quality == 0 {
+			quality = 80
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	enc := png.Encoder{CompressionLevel: png.DefaultCompression}
+	if opts.optimize {
+		enc.CompressionLevel = png.BestCompression
+	}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseClip parses "x,y,w,h" in CSS pixels relative to the document
+func parseClip(v string) (*proto.PageViewport, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("expected x,y,w,h, got %q", v)
+	}
+	var n [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected x,y,w,h, got %q", v)
+		}
+		n[i] = f
+	}
+	if n[2] <= 0 || n[3] <= 0 {
+		return nil, fmt.Errorf("clip width and height must be positive")
+	}
+	return &proto.PageViewport{X: n[0], Y: n[1], Width: n[2], Height: n[3], Scale: 1}, nil
+}
+
+// downscale shrinks img so its longest side is at most maxDim, averaging
+// every source pixel that falls into a destination pixel (box filter). This
+// keeps text legible, unlike nearest-neighbour sampling. Smaller images are
+// returned as is.
+func downscale(img image.Image, maxDim int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw <= maxDim && sh <= maxDim {
+		return img
+	}
+	dw, dh := maxDim, sh*maxDim/sw
+	if sh > sw {
+		dw, dh = sw*maxDim/sh, maxDim
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	src, ok := img.(*image.NRGBA)
+	if !ok || b.Min != (image.Point{}) {
+		src = image.NewNRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, max((dy+1)*sh/dh, dy*sh/dh+1)
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, max((dx+1)*sw/dw, dx*sw/dw+1)
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[x*4+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			i := dy*dst.Stride + dx*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// aroundTextJS finds the smallest visible element containing text, widens it
+// to its enclosing block and returns that block's box in document coordinates
+const aroundTextJS = `(text, padding) => {
+	const norm = s => (s || '').replace(/\s+/g, ' ').trim().toLowerCase();
+	const needle = norm(text);
+	let best = null, bestLen = Infinity;
+	for (const el of document.body.querySelectorAll('*')) {
+		if (['SCRIPT', 'STYLE', 'NOSCRIPT', 'TEMPLATE'].includes(el.tagName)) continue;
+		if (!norm(el.textContent).includes(needle)) continue;
+		const t = norm(el.innerText);
+		if (t.includes(needle) && t.length < bestLen) {
+			best = el;
+			bestLen = t.length;
+		}
+	}
+	if (!best) throw new Error('text not found: ' + text);
+	let el = best;
+	while (el.parentElement && el !== document.body &&
+		/^inline|^contents$/.test(getComputedStyle(el).display)) {
+		el = el.parentElement;
+	}
+	const r = el.getBoundingClientRect();
+	const x = Math.max(0, r.left + window.scrollX - padding);
+	const y = Math.max(0, r.top + window.scrollY - padding);
+	return {
+		x, y,
+		width: r.right + window.scrollX + padding - x,
+		height: r.bottom + window.scrollY + padding - y,
+	};
+}`
+
+// clipAroundText returns the screenshot clip for the block containing text
+func clipAroundText(page *rod.Page, text string, padding float64) (*proto.PageViewport, error) {
+	res, err := page.Eval(aroundTextJS, text, padding)
+	if err != nil {
+		return nil, err
+	}
+	v := res.Value
+	return &proto.PageViewport{
+		X:      v.Get("x").Num(),
+		Y:      v.Get("y").Num(),
+		Width:  v.Get("width").Num(),
+		Height: v.Get("height").Num(),
+		Scale:  1,
+	}, nil
+}
+
+// hideFixedJS hides fixed and sticky elements so headers and cookie bars
+// appear only in the first tile of a stitched screenshot
+const hideFixedJS = `() => {
+	for (const el of document.querySelectorAll('body *')) {
+		const pos = getComputedStyle(el).position;
+		if (pos === 'fixed' || pos === 'sticky') {
+			el.dataset.bbVisibility = el.style.visibility;
+			el.style.visibility = 'hidden';
+		}
+	}
+}`
+
+const restoreFixedJS = `() => {
+	for (const el of document.querySelectorAll('[data-bb-visibility]')) {
+		el.style.visibility = el.dataset.bbVisibility;
+		delete el.dataset.bbVisibility;
+	}
+}`
+
+// captureTiles scrolls through the page one viewport at a time and captures
+// each viewport separately. Unlike a single full-page capture this works for
+// pages taller than Chrome's texture limit and keeps memory use in Chrome flat.
+func captureTiles(page *rod.Page) ([]image.Image, error) {
+	metrics, err := proto.PageGetLayoutMetrics{}.Call(page)
+	if err != nil {
+		return nil, err
+	}
+	if metrics.CSSContentSize == nil || metrics.CSSVisualViewport == nil {
+		return nil, fmt.Errorf("failed to get page size")
+	}
+	vw := metrics.CSSVisualViewport.ClientWidth
+	vh := metrics.CSSVisualViewport.ClientHeight
+	total := metrics.CSSContentSize.Height
+
+	scrollY, _ := page.Eval(`() => window.scrollY`)
+	defer func() {
+		_, _ = page.Eval(restoreFixedJS)
+		if scrollY != nil {
+			_, _ = page.Eval(`y => window.scrollTo(0, y)`, scrollY.Value.Num())
+		}
+	}()
+
+	var tiles []image.Image
+	for y := 0.0; y < total; y += vh {
+		if _, err := page.Eval(`y => window.scrollTo(0, y)`, y); err != nil {
+			return nil, err
+		}
+		if y > 0 && len(tiles) == 1 {
+			_, _ = page.Eval(hideFixedJS)
+		}
+		// Give lazy-loaded content a moment to render
+		_ = page.Timeout(2*time.Second).WaitDOMStable(200*time.Millisecond, 0)
+
+		shot, err := proto.PageCaptureScreenshot{Clip: &proto.PageViewport{
+			X: 0, Y: y, Width: vw, Height: min(vh, total-y), Scale: 1,
+		}}.Call(page)
+		if err != nil {
+			return nil, err
+		}
+		tile, err := png.Decode(bytes.NewReader(shot.Data))
+		if err != nil {
+			return nil, err
+		}
+		tiles = append(tiles, tile)
+	}
+	return tiles, nil
+}
+
+// stitchTiles stacks tiles vertically into one image
+func stitchTiles(tiles []image.Image) image.Image {
+	w, h := 0, 0
+	for _, t := range tiles {
+		w = max(w, t.Bounds().Dx())
+		h += t.Bounds().Dy()
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	y := 0
+	for _, t := range tiles {
+		b := t.Bounds()
+		draw.Draw(dst, image.Rect(0, y, b.Dx(), y+b.Dy()), t, b.Min, draw.Src)
+		y += b.Dy()
+	}
+	return dst
+}
+
+// diffTolerance is the per-channel difference (0-255) still treated as equal,
+// so anti-aliasing and JPEG noise don't count as changes
+const diffTolerance = 8
+
+// diffImages compares a and b pixel by pixel over the union of their bounds.
+// The returned image shows a faded a with changed pixels in red.
+func diffImages(a, b image.Image) (*image.NRGBA, int, int) {
+	ab, bb := a.Bounds(), b.Bounds()
+	w, h := max(ab.Dx(), bb.Dx()), max(ab.Dy(), bb.Dy())
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	changed := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			inA := x < ab.Dx() && y < ab.Dy()
+			inB := x < bb.Dx() && y < bb.Dy()
+			var ca, cb color.NRGBA
+			if inA {
+				ca = color.NRGBAModel.Convert(a.At(ab.Min.X+x, ab.Min.Y+y)).(color.NRGBA)
+			}
+			if inB {
+				cb = color.NRGBAModel.Convert(b.At(bb.Min.X+x, bb.Min.Y+y)).(color.NRGBA)
+			}
+			if inA && inB && sameColor(ca, cb) {
+				// Faded grey keeps the layout recognisable behind the changes
+				g := uint8((int(ca.R)*299+int(ca.G)*587+int(ca.B)*114)/1000/4 + 191)
+				out.SetNRGBA(x, y, color.NRGBA{g, g, g, 255})
+				continue
+			}
+			changed++
+			out.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	return out, changed, w * h
+}
+
+func sameColor(a, b color.NRGBA) bool {
+	d := func(x, y uint8) bool { return max(x, y)-min(x, y) <= diffTolerance }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
+
+func readImage(file string) image.Image {
+	f, err := os.Open(file)
+	if err != nil {
+		fatal("failed to open %s: %v", file, err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		fatal("failed to decode %s: %v", file, err)
+	}
+	return img
+}
+
+func cmdImgDiff(args []string, flags globalFlags) {
+	out := ""
+	threshold := 0.0
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--out":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --out")
+			}
+			out = args[i]
+		case "--threshold":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --threshold")
+			}
+			v, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || v < 0 || v > 1 {
+				fatalUsage("invalid threshold: %s (expected a fraction between 0 and 1)", args[i])
+			}
+			threshold = v
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 {
+		fatalUsage("usage: bb imgdiff <a.png> <b.png> [--out diff.png] [--threshold 0.01]")
+	}
+
+	a, b := readImage(positional[0]), readImage(positional[1])
+	diff, changed, total := diffImages(a, b)
+	ratio := float64(changed) / float64(max(total, 1))
+	differ := ratio > threshold
+
+	if out != "" {
+		var opts imageOptions
+		opts.inferFormat(out)
+		data, err := encodeImage(diff, opts)
+		if err != nil {
+			fatal("failed to encode diff: %v", err)
+		}
+		if err := os.WriteFile(out, data, 0644); err != nil {
+			fatal("failed to write diff: %v", err)
+		}
+		recordArtifact("imgdiff", out)
+	}
+
+	if flags.jsonOutput {
+		res, _ := json.Marshal(map[string]interface{}{
+			"changed_pixels": changed,
+			"total_pixels":   total,
+			"ratio":          ratio,
+			"differ":         differ,
+			"size_changed":   a.Bounds().Size() != b.Bounds().Size(),
+			"diff":           out,
+		})
+		fmt.Println(string(res))
+	} else {
+		fmt.Printf("%d of %d pixels differ (%.2f%%)\n", changed, total, ratio*100)
+		if a.Bounds().Size() != b.Bounds().Size() {
+			fmt.Printf("size changed: %dx%d -> %dx%d\n", a.Bounds().Dx(), a.Bounds().Dy(), b.Bounds().Dx(), b.Bounds().Dy())
+		}
+		if out != "" {
+			fmt.Printf("Saved %s\n", out)
+		}
+	}
+	if differ {
+		exit(exitFalse)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// imagesJS lists <img> elements (with the <picture> source the browser
+// picked), and elements with CSS background images. Lazy images that haven't
+// loaded yet report their data-src style URL.
+const imagesJS = `() => {
+	` + cssPathJS + `
+	const abs = u => { try { return new URL(u, document.baseURI).href; } catch (e) { return u; } };
+	const lazyAttrs = ['data-src', 'data-lazy-src', 'data-original', 'data-srcset', 'data-lazy'];
+	const images = [];
+	for (const img of document.querySelectorAll('img')) {
+		const r = img.getBoundingClientRect();
+		const lazySrc = lazyAttrs.map(a => img.getAttribute(a)).find(Boolean);
+		const loaded = img.complete && img.naturalWidth > 0;
+		const src = img.currentSrc || img.getAttribute('src') || '';
+		images.push({
+			kind: img.parentElement?.tagName === 'PICTURE' ? 'picture' : 'img',
+			url: loaded || !lazySrc ? abs(src) : abs(lazySrc.split(/[\s,]/)[0]),
+			alt: img.getAttribute('alt'),
+			naturalWidth: img.naturalWidth,
+			naturalHeight: img.naturalHeight,
+			width: Math.round(r.width),
+			height: Math.round(r.height),
+			loading: img.loading || 'eager',
+			loaded: loaded,
+			lazy: img.loading === 'lazy' || !!lazySrc,
+			selector: cssPath(img),
+		});
+	}
+	for (const el of document.querySelectorAll('body *')) {
+		const bg = getComputedStyle(el).backgroundImage;
+		if (!bg || bg === 'none') continue;
+		for (const m of bg.matchAll(/url\(\s*(['"]?)(.*?)\1\s*\)/g)) {
+			const r = el.getBoundingClientRect();
+			images.push({
+				kind: 'background', url: abs(m[2]), alt: el.getAttribute('aria-label'),
+				naturalWidth: 0, naturalHeight: 0, width: Math.round(r.width), height: Math.round(r.height),
+				loading: 'eager', loaded: true, lazy: false, selector: cssPath(el),
+			});
+		}
+	}
+	return images;
+}`
+
+// fetchJS downloads a URL inside the page, so cookies and the referrer are
+// the ones the page itself would send
+const fetchJS = `async (url) => {
+	const res = await fetch(url, {credentials: 'include'});
+	if (!res.ok) throw new Error('HTTP ' + res.status);
+	const buf = new Uint8Array(await res.arrayBuffer());
+	let bin = '';
+	for (let i = 0; i < buf.length; i += 0x8000) bin += String.fromCharCode.apply(null, buf.subarray(i, i + 0x8000));
+	return {type: res.headers.get('content-type') || '', data: btoa(bin)};
+}`
+
+type pageImage struct {
+	Kind          string  `json:"kind"`
+	URL           string  `json:"url"`
+	Alt           *string `json:"alt"`
+	NaturalWidth  int     `json:"naturalWidth"`
+	NaturalHeight int     `json:"naturalHeight"`
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	Loading       string  `json:"loading"`
+	Loaded        bool    `json:"loaded"`
+	Lazy          bool    `json:"lazy"`
+	Selector      string  `json:"selector"`
+	File          string  `json:"file,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// imageFileBase picks a file name for a downloaded image from its URL
+func imageFileBase(u string, n int) (base, ext string) {
+	if parsed, err := url.Parse(u); err == nil && parsed.Scheme != "data" {
+		name := path.Base(parsed.Path)
+		if name != "." && name != "/" {
+			ext = path.Ext(name)
+			return strings.TrimSuffix(name, ext), ext
+		}
+	}
+	return fmt.Sprintf("image-%d", n), ""
+}
+
+func cmdImages(args []string, flags globalFlags) {
+	dir := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--download":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --download")
+			}
+			dir = args[i]
+		default:
+			fatalUsage("usage: bb images [--download <dir>]")
+		}
+	}
+
+	_, _, page := withPage()
+	res, err := page.Eval(imagesJS)
+	if err != nil {
+		fatal("failed to list images: %v", err)
+	}
+	var images []pageImage
+	if err := json.Unmarshal([]byte(res.Value.JSON("", "")), &images); err != nil {
+		fatal("failed to list images: %v", err)
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fatal("failed to create %s: %v", dir, err)
+		}
+		seen := map[string]string{}
+		for i := range images {
+			img := &images[i]
+			if img.URL == "" {
+				continue
+			}
+			if file, ok := seen[img.URL]; ok {
+				img.File = file
+				continue
+			}
+			res, err := page.Eval(fetchJS, img.URL)
+			if err != nil {
+				img.Error = err.Error()
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(res.Value.Get("data").Str())
+			if err != nil {
+				img.Error = err.Error()
+				continue
+			}
+			base, ext := imageFileBase(img.URL, i+1)
+			if ext == "" {
+				mediaType, _, _ := mime.ParseMediaType(res.Value.Get("type").Str())
+				if mediaType == "image/jpeg" {
+					ext = ".jpg"
+				} else if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+					ext = exts[0]
+				}
+			}
+			file := nextAvailableFile(filepath.Join(dir, base), ext)
+			if err := os.WriteFile(file, data, 0644); err != nil {
+				fatal("failed to write %s: %v", file, err)
+			}
+			recordArtifact("image", file)
+			img.File = file
+			seen[img.URL] = file
+		}
+	}
+
+	if flags.jsonOutput {
+		if images == nil {
+			images = []pageImage{}
+		}
+		out, _ := json.MarshalIndent(images, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	for _, img := range images {
+		size := fmt.Sprintf("%dx%d", img.NaturalWidth, img.NaturalHeight)
+		if img.Kind == "background" {
+			size = fmt.Sprintf("%dx%d box", img.Width, img.Height)
+		}
+		status := ""
+		if img.Lazy && !img.Loaded {
+			status = " (lazy, not loaded)"
+		} else if img.Lazy {
+			status = " (lazy)"
+		}
+		alt := "no alt"
+		if img.Alt != nil {
+			alt = fmt.Sprintf("alt=%q", *img.Alt)
+		}
+		fmt.Printf("%-10s %-11s %s %s%s\n", img.Kind, size, img.URL, alt, status)
+		if img.File != "" {
+			fmt.Printf("           saved %s\n", img.File)
+		} else if img.Error != "" {
+			fmt.Printf("           download failed: %s\n", img.Error)
+		}
+	}
+	fmt.Printf("%d images\n", len(images))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// jankStartJS records Long Tasks and animation frames on the page until
+// jankStopJS collects them. A frame counts as dropped when it arrives more
+// than 1.5 frame intervals (at 60 Hz) after the previous one.
+const jankStartJS = `() => {
+	const j = window.__bbJank = {start: performance.now(), tasks: [], frames: 0, dropped: 0, worst: 0};
+	try {
+		j.obs = new PerformanceObserver(list => {
+			for (const e of list.getEntries()) {
+				const a = e.attribution && e.attribution[0];
+				j.tasks.push({start: e.startTime, duration: e.duration,
+					source: (a && (a.containerSrc || a.containerName || a.containerId)) || e.name});
+			}
+		});
+		j.obs.observe({type: 'longtask'});
+	} catch (e) {
+		j.unsupported = true;
+	}
+	const interval = 1000 / 60;
+	let last = performance.now();
+	const tick = now => {
+		if (window.__bbJank !== j || j.stopped) return;
+		const d = now - last;
+		last = now;
+		j.frames++;
+		if (d > interval * 1.5) j.dropped += Math.round(d / interval) - 1;
+		j.worst = Math.max(j.worst, d);
+		requestAnimationFrame(tick);
+	};
+	requestAnimationFrame(tick);
+}`
+
+// jankStopJS ends the recording; null means the page navigated meanwhile
+const jankStopJS = `() => {
+	const j = window.__bbJank;
+	if (!j) return null;
+	j.stopped = true;
+	if (j.obs) {
+		for (const e of j.obs.takeRecords()) j.tasks.push({start: e.startTime, duration: e.duration, source: e.name});
+		j.obs.disconnect();
+	}
+	delete window.__bbJank;
+	return {elapsed: performance.now() - j.start, tasks: j.tasks, frames: j.frames, dropped: j.dropped,
+		worst: j.worst, unsupported: !!j.unsupported};
+}`
+
+type longTask struct {
+	Start    float64 `json:"start_ms"`
+	Duration float64 `json:"duration_ms"`
+	Source   string  `json:"source"`
+}
+
+type jankReport struct {
+	ElapsedMS      float64    `json:"elapsed_ms"`
+	LongTasks      int        `json:"long_tasks"`
+	LongTaskMS     float64    `json:"long_task_ms"`
+	BlockingTimeMS float64    `json:"blocking_time_ms"` // long task time beyond 50ms each
+	LongestTaskMS  float64    `json:"longest_task_ms"`
+	Frames         int        `json:"frames"`
+	DroppedFrames  int        `json:"dropped_frames"`
+	WorstFrameMS   float64    `json:"worst_frame_ms"`
+	Tasks          []longTask `json:"tasks"`
+	ExitCode       *int       `json:"exit_code,omitempty"` // of the --during command
+}
+
+func cmdJank(args []string, flags globalFlags) {
+	usage := "usage: bb jank [--duration seconds] | bb jank --during -- <command> [args...]"
+	duration := 5 * time.Second
+	var during []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--duration":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --duration")
+			}
+			secs, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || secs <= 0 {
+				fatalUsage("invalid --duration: %s", args[i])
+			}
+			duration = time.Duration(secs * float64(time.Second))
+		case "--during":
+			during = args[i+1:]
+			if len(during) > 0 && during[0] == "--" {
+				during = during[1:]
+			}
+			if len(during) == 0 {
+				fatalUsage("%s", usage)
+			}
+			i = len(args)
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+
+	_, _, page := withPage()
+	if _, err := page.Eval(jankStartJS); err != nil {
+		fatal("failed to start recording: %v", err)
+	}
+
+	var exitCode *int
+	if during != nil {
+		bin, err := os.Executable()
+		if err != nil {
+			fatal("failed to find the bb binary: %v", err)
+		}
+		// The command runs on this page even if it switches the active one
+		cmd := exec.Command(bin, during...)
+		cmd.Env = append(os.Environ(), "BB_PAGE="+string(currentPage.TargetID))
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if flags.jsonOutput {
+			cmd.Stdout = os.Stderr
+		}
+		code := 0
+		if err := cmd.Run(); err != nil {
+			code = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				code = exitErr.ExitCode()
+			}
+		}
+		exitCode = &code
+	} else {
+		time.Sleep(duration)
+	}
+
+	// The page's timeout started before the recording
+	res, err := currentPage.Timeout(defaultTimeout).Eval(jankStopJS)
+	if err != nil {
+		fatal("failed to collect the recording: %v", err)
+	}
+	if res.Value.Nil() {
+		fatal("the page navigated during the recording; record on the page the interaction ends on")
+	}
+	var raw struct {
+		Elapsed     float64    `json:"elapsed"`
+		Tasks       []longTask `json:"tasks"`
+		Frames      int        `json:"frames"`
+		Dropped     int        `json:"dropped"`
+		Worst       float64    `json:"worst"`
+		Unsupported bool       `json:"unsupported"`
+	}
+	if err := res.Value.Unmarshal(&raw); err != nil {
+		fatal("failed to read the recording: %v", err)
+	}
+	if raw.Unsupported {
+		fmt.Fprintln(os.Stderr, "warning: this browser doesn't report Long Tasks; only frames were recorded")
+	}
+
+	r := jankReport{
+		ElapsedMS:     raw.Elapsed,
+		LongTasks:     len(raw.Tasks),
+		Frames:        raw.Frames,
+		DroppedFrames: raw.Dropped,
+		WorstFrameMS:  raw.Worst,
+		Tasks:         raw.Tasks,
+		ExitCode:      exitCode,
+	}
+	if r.Tasks == nil {
+		r.Tasks = []longTask{}
+	}
+	slices.SortFunc(r.Tasks, func(a, b longTask) int {
+		switch {
+		case a.Duration > b.Duration:
+			return -1
+		case a.Duration < b.Duration:
+			return 1
+		}
+		return 0
+	})
+	for _, t := range r.Tasks {
+		r.LongTaskMS += t.Duration
+		r.BlockingTimeMS += max(0, t.Duration-50)
+		r.LongestTaskMS = max(r.LongestTaskMS, t.Duration)
+	}
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(r, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("Recorded %.0fms: %d long tasks (%.0fms, %.0fms blocking, longest %.0fms), %d frames, %d dropped (worst %.0fms)\n",
+			r.ElapsedMS, r.LongTasks, r.LongTaskMS, r.BlockingTimeMS, r.LongestTaskMS, r.Frames, r.DroppedFrames, r.WorstFrameMS)
+		for i, t := range r.Tasks {
+			if i == 10 {
+				fmt.Printf("  ... %d more\n", len(r.Tasks)-10)
+				break
+			}
+			fmt.Printf("  %6.0fms at %7.0fms  %s\n", t.Duration, t.Start, t.Source)
+		}
+	}
+	if exitCode != nil && *exitCode != 0 {
+		exit(*exitCode)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalEntry is one bb invocation in the session journal
+type journalEntry struct {
+	Time       string   `json:"time"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	ExitCode   int      `json:"exit_code"`
+	Error      string   `json:"error,omitempty"`
+	URL        string   `json:"url,omitempty"` // of the active page when the command ended
+	DurationMS int64    `json:"duration_ms"`
+}
+
+func journalPath() string {
+	return filepath.Join(stateDir(), "journal.jsonl")
+}
+
+// failMsg is the error the invocation ends with, for the journal
+var failMsg string
+
+// recordJournal appends the invocation to the journal. Like recordArtifact
+// it is best-effort.
+func recordJournal(code int) {
+	if len(invocation) == 0 {
+		return
+	}
+	cmd := invocation[0]
+	switch {
+	case cmd == "journal", cmd == "help", strings.HasPrefix(cmd, "-"), strings.HasPrefix(cmd, "__"):
+		return
+	case len(invocation) > 1 && strings.HasPrefix(invocation[1], "__"):
+		return
+	}
+	e := journalEntry{
+		Time:       started.Format(time.RFC3339),
+		Command:    cmd,
+		Args:       append([]string{}, invocation[1:]...),
+		ExitCode:   code,
+		Error:      failMsg,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if currentPage != nil {
+		if info, err := currentPage.Timeout(2 * time.Second).Info(); err == nil {
+			e.URL = info.URL
+		}
+	}
+	data, _ := json.Marshal(e)
+	// The args can hold what was typed, so lines are encrypted like the
+	// rest of the session
+	line, err := sealLine(data)
+	if err != nil {
+		return
+	}
+	_ = os.MkdirAll(stateDir(), 0755)
+	f, err := os.OpenFile(journalPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(line, '\n'))
+}
+
+// readJournal reads the entries of a journal file, oldest first
+func readJournal(file string) ([]journalEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var entries []journalEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		line, err := openLine(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+func (e journalEntry) commandLine() string {
+	return strings.TrimSpace(e.Command + " " + quoteArgs(e.Args))
+}
+
+func cmdJournal(args []string, flags globalFlags) {
+	usage := "usage: bb journal [--tail N] | bb journal --replay <journal.jsonl> | bb journal --clear"
+	tail, replay, clear := 20, "", false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--tail", "--replay":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			if args[i] == "--replay" {
+				replay = args[i+1]
+			} else {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 0 {
+					fatalUsage("invalid --tail: %s", args[i+1])
+				}
+				tail = n
+			}
+			i++
+		case "--clear":
+			clear = true
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+
+	if clear {
+		if err := os.Remove(journalPath()); err != nil && !os.IsNotExist(err) {
+			fatal("failed to remove %s: %v", journalPath(), err)
+		}
+		fmt.Println("Journal cleared")
+		return
+	}
+	if replay != "" {
+		replayJournal(replay)
+		return
+	}
+
+	entries, err := readJournal(journalPath())
+	if err != nil && !os.IsNotExist(err) {
+		fatal("failed to read the journal: %v", err)
+	}
+	if tail > 0 && len(entries) > tail {
+		entries = entries[len(entries)-tail:]
+	}
+	if flags.jsonOutput {
+		if entries == nil {
+			entries = []journalEntry{}
+		}
+		out, _ := json.MarshalIndent(entries, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("The journal is empty")
+		return
+	}
+	for _, e := range entries {
+		status := "ok  "
+		if e.ExitCode != 0 {
+			status = fmt.Sprintf("E%-3d", e.ExitCode)
+		}
+		fmt.Printf("%s  %s %6dms  %s\n", e.Time, status, e.DurationMS, e.commandLine())
+		if e.URL != "" {
+			fmt.Printf("%31s%s\n", "", e.URL)
+		}
+		if e.Error != "" {
+			fmt.Printf("%31serror: %s\n", "", e.Error)
+		}
+	}
+}
+
+// replayJournal re-runs the commands of a journal in order. It stops at the
+// first one that ends differently from when it was recorded.
+func replayJournal(file string) {
+	entries, err := readJournal(file)
+	if err != nil {
+		fatal("failed to read %s: %v", file, err)
+	}
+	if len(entries) == 0 {
+		fatal("no commands in %s", file)
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		fatal("failed to find the bb binary: %v", err)
+	}
+	for i, e := range entries {
+		cmd := exec.Command(bin, append([]string{e.Command}, e.Args...)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		t0 := time.Now()
+		code := 0
+		if err := cmd.Run(); err != nil {
+			code = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				code = exitErr.ExitCode()
+			}
+		}
+		status := "ok  "
+		if code != 0 {
+			status = "fail"
+		}
+		fmt.Printf("%s [%d/%d] %-40s %6dms\n", status, i+1, len(entries), e.commandLine(), time.Since(t0).Milliseconds())
+		if code != e.ExitCode {
+			fmt.Fprintf(os.Stderr, "stopped: exit code %d, recorded %d\n", code, e.ExitCode)
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				fmt.Fprintln(os.Stderr, msg)
+			}
+			exit(1)
+		}
+	}
+}
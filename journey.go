@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// navigationTimingJS reads the Navigation Timing entry of the current
+// document. timeOrigin tells one document from the next.
+const navigationTimingJS = `() => {
+	const nav = performance.getEntriesByType('navigation')[0];
+	const out = {origin: performance.timeOrigin, url: location.href};
+	if (nav) {
+		out.nav = {
+			ttfb_ms: Math.round(nav.responseStart),
+			dom_content_loaded_ms: Math.round(nav.domContentLoadedEventEnd),
+			load_ms: Math.round(nav.loadEventEnd),
+			transfer_bytes: nav.transferSize,
+		};
+	}
+	return out;
+}`
+
+// navigationTiming is the page-side timing of a navigation a step caused,
+// relative to its start
+type navigationTiming struct {
+	TTFB             int `json:"ttfb_ms"`
+	DOMContentLoaded int `json:"dom_content_loaded_ms"`
+	Load             int `json:"load_ms"`
+	TransferBytes    int `json:"transfer_bytes"`
+}
+
+type journeyStep struct {
+	N          int               `json:"n"`
+	Line       int               `json:"line"`
+	Command    string            `json:"command"`
+	DurationMS int64             `json:"duration_ms"`
+	ExitCode   int               `json:"exit_code"`
+	URL        string            `json:"url,omitempty"`
+	Navigation *navigationTiming `json:"navigation,omitempty"`
+	Screenshot string            `json:"screenshot,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+type journeyReport struct {
+	Script  string        `json:"script"`
+	Started string        `json:"started"`
+	TotalMS int64         `json:"total_ms"`
+	OK      bool          `json:"ok"`
+	Steps   []journeyStep `json:"steps"`
+}
+
+// splitCommandLine splits a script line into arguments like a shell would:
+// whitespace separates, quotes group, and a backslash escapes the next rune
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// journeyLine is one command of a journey script
+type journeyLine struct {
+	line int
+	args []string
+}
+
+// readJourney parses a script of bb commands, one per line. The leading "bb"
+// is optional; blank lines and # comments are skipped.
+func readJourney(file string) []journeyLine {
+	f, err := os.Open(file)
+	if err != nil {
+		fatal("failed to read %s: %v", file, err)
+	}
+	defer f.Close()
+	var steps []journeyLine
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		args, err := splitCommandLine(text)
+		if err != nil {
+			fatal("%s:%d: %v", file, n, err)
+		}
+		if args[0] == "bb" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "journey", "serve", "remote":
+			fatal("%s:%d: bb %s can't run inside a journey", file, n, args[0])
+		}
+		steps = append(steps, journeyLine{n, args})
+	}
+	if err := scanner.Err(); err != nil {
+		fatal("failed to read %s: %v", file, err)
+	}
+	return steps
+}
+
+// journeyPage connects to the session's active page, if there is one; a step
+// may well have stopped the browser
+func journeyPage() *rod.Page {
+	s, err := loadState()
+	if err != nil {
+		return nil
+	}
+	browser := rod.New().ControlURL(s.DebugURL)
+	if err := browser.Connect(); err != nil {
+		return nil
+	}
+	pages, err := browser.Pages()
+	if err != nil || len(pages) == 0 {
+		return nil
+	}
+	idx := activePageIndex(s, pages)
+	if idx < 0 || idx >= len(pages) {
+		return nil
+	}
+	currentPage = pages[idx]
+	return pages[idx].Timeout(defaultTimeout)
+}
+
+func cmdJourney(args []string, flags globalFlags) {
+	report, shots := "", ""
+	noShots := false
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--report", "--screenshots":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for %s", flag)
+			}
+			if flag == "--report" {
+				report = args[i]
+			} else {
+				shots = args[i]
+			}
+		case "--no-screenshots":
+			noShots = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("usage: bb journey <script.bb> [--report timing.json] [--screenshots dir|--no-screenshots]")
+	}
+	lines := readJourney(positional[0])
+	if len(lines) == 0 {
+		fatal("no commands in %s", positional[0])
+	}
+	if report == "" {
+		report = nextAvailableFile(filepath.Join(outputDir(), "journey"), ".json")
+	}
+	if shots == "" && !noShots {
+		shots = strings.TrimSuffix(report, filepath.Ext(report)) + "-screenshots"
+	}
+	if shots != "" {
+		if err := os.MkdirAll(shots, 0755); err != nil {
+			fatal("failed to create %s: %v", shots, err)
+		}
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		fatal("failed to find the bb binary: %v", err)
+	}
+
+	result := journeyReport{Script: positional[0], Started: time.Now().Format(time.RFC3339), OK: true, Steps: []journeyStep{}}
+	start := time.Now()
+	lastOrigin := 0.0
+	for i, l := range lines {
+		step := journeyStep{N: i + 1, Line: l.line, Command: strings.Join(l.args, " ")}
+
+		// Each step is a bb invocation of its own, exactly as on the command line
+		cmd := exec.Command(bin, l.args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		t0 := time.Now()
+		err := cmd.Run()
+		step.DurationMS = time.Since(t0).Milliseconds()
+		if err != nil {
+			step.ExitCode = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				step.ExitCode = exitErr.ExitCode()
+			}
+			step.Error = strings.TrimSpace(stderr.String())
+			if step.Error == "" {
+				step.Error = err.Error()
+			}
+		}
+
+		// Read timings and take the screenshot from the page the step left
+		if page := journeyPage(); page != nil {
+			if res, err := page.Eval(navigationTimingJS); err == nil {
+				var t struct {
+					Origin float64           `json:"origin"`
+					URL    string            `json:"url"`
+					Nav    *navigationTiming `json:"nav"`
+				}
+				if res.Value.Unmarshal(&t) == nil {
+					step.URL = t.URL
+					if t.Origin != lastOrigin {
+						step.Navigation = t.Nav
+						lastOrigin = t.Origin
+					}
+				}
+			}
+			if shots != "" {
+				if data, err := page.Screenshot(false, &proto.PageCaptureScreenshot{Format: proto.PageCaptureScreenshotFormatPng}); err == nil {
+					file := filepath.Join(shots, fmt.Sprintf("%02d-%s.png", step.N, l.args[0]))
+					if os.WriteFile(file, data, 0644) == nil {
+						step.Screenshot = file
+					}
+				}
+			}
+		}
+		result.Steps = append(result.Steps, step)
+		if !flags.jsonOutput {
+			status := "ok  "
+			if step.ExitCode != 0 {
+				status = "fail"
+			}
+			fmt.Printf("%s [%d/%d] %-40s %6dms\n", status, step.N, len(lines), step.Command, step.DurationMS)
+		}
+		if step.ExitCode != 0 {
+			result.OK = false
+			break
+		}
+	}
+	result.TotalMS = time.Since(start).Milliseconds()
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	if err := os.WriteFile(report, data, 0644); err != nil {
+		fatal("failed to write %s: %v", report, err)
+	}
+	recordArtifact("journey", report)
+	if flags.jsonOutput {
+		fmt.Println(string(data))
+	} else {
+		fmt.Printf("Journey took %dms, report saved to %s\n", result.TotalMS, report)
+	}
+	if !result.OK {
+		exit(1)
+	}
+}
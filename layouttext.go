@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// textFrag is one line of a text node as laid out, in page coordinates
+type textFrag struct {
+	X, Y, W, H float64
+	Text       string
+}
+
+// layoutBlock is a run of text read as one unit: a region of the page, or a
+// column within one
+type layoutBlock struct {
+	Region int    `json:"region"`
+	Label  string `json:"label"` // e.g. "region 2, column 1/3"
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Text   string `json:"text"`
+}
+
+var spaceRun = regexp.MustCompile(`[ \t]+`)
+
+// layoutFragments reads the text boxes of the main document from a DOM
+// snapshot, skipping invisible text
+func layoutFragments(snap *proto.DOMSnapshotCaptureSnapshotResult) []textFrag {
+	if len(snap.Documents) == 0 {
+		return nil
+	}
+	doc := snap.Documents[0]
+	if doc.TextBoxes == nil || doc.Layout == nil {
+		return nil
+	}
+	str := func(i proto.DOMSnapshotStringIndex) string {
+		if i < 0 || int(i) >= len(snap.Strings) {
+			return ""
+		}
+		return snap.Strings[i]
+	}
+	var frags []textFrag
+	for i, li := range doc.TextBoxes.LayoutIndex {
+		if li < 0 || li >= len(doc.Layout.Text) {
+			continue
+		}
+		if li < len(doc.Layout.Styles) && len(doc.Layout.Styles[li]) > 0 && str(doc.Layout.Styles[li][0]) == "hidden" {
+			continue
+		}
+		b := doc.TextBoxes.Bounds[i]
+		if len(b) < 4 || b[2] <= 0 || b[3] <= 0 {
+			continue
+		}
+		// Offsets count UTF-16 code units
+		units := utf16.Encode([]rune(str(doc.Layout.Text[li])))
+		start, end := doc.TextBoxes.Start[i], doc.TextBoxes.Start[i]+doc.TextBoxes.Length[i]
+		if start < 0 || end > len(units) {
+			continue
+		}
+		text := string(utf16.Decode(units[start:end]))
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		frags = append(frags, textFrag{b[0], b[1], b[2], b[3], text})
+	}
+	return frags
+}
+
+// medianHeight is the typical line height of frags
+func medianHeight(frags []textFrag) float64 {
+	hs := make([]float64, len(frags))
+	for i, f := range frags {
+		hs[i] = f.H
+	}
+	slices.Sort(hs)
+	return hs[len(hs)/2]
+}
+
+// splitGaps splits frags where a band at least gap wide along one axis holds
+// no text: horizontal bands when vertical is set, gutters otherwise
+func splitGaps(frags []textFrag, vertical bool, gap float64) [][]textFrag {
+	span := func(f textFrag) (float64, float64) {
+		if vertical {
+			return f.Y, f.Y + f.H
+		}
+		return f.X, f.X + f.W
+	}
+	sorted := slices.Clone(frags)
+	slices.SortFunc(sorted, func(a, b textFrag) int {
+		sa, _ := span(a)
+		sb, _ := span(b)
+		switch {
+		case sa < sb:
+			return -1
+		case sa > sb:
+			return 1
+		}
+		return 0
+	})
+	var groups [][]textFrag
+	var cur []textFrag
+	end := math.Inf(-1)
+	for _, f := range sorted {
+		s, e := span(f)
+		if len(cur) > 0 && s-end >= gap {
+			groups = append(groups, cur)
+			cur = nil
+		}
+		cur = append(cur, f)
+		end = max(end, e)
+	}
+	return append(groups, cur)
+}
+
+// rowsAlign reports whether the parts of a vertical split share their
+// lines, as the cells of a table or grid do, rather than being columns
+// that flow independently
+func rowsAlign(parts [][]textFrag) bool {
+	shared, total := 0, 0
+	for i, part := range parts {
+		for _, f := range part {
+			total++
+			mid := f.Y + f.H/2
+		search:
+			for j, other := range parts {
+				if j == i {
+					continue
+				}
+				for _, o := range other {
+					if mid >= o.Y && mid <= o.Y+o.H {
+						shared++
+						break search
+					}
+				}
+			}
+		}
+	}
+	return shared*2 > total
+}
+
+// labeledFrags is text xyCut found to belong together
+type labeledFrags struct {
+	label string
+	frags []textFrag
+}
+
+// xyCut splits frags recursively at column gutters and the gaps between
+// paragraphs, so a heading above columns doesn't merge them into rows
+func xyCut(frags []textFrag, label string, lh float64) []labeledFrags {
+	if cols := splitGaps(frags, false, max(16, 1.5*lh)); len(cols) > 1 && !rowsAlign(cols) {
+		var out []labeledFrags
+		for i, col := range cols {
+			out = append(out, xyCut(col, fmt.Sprintf("%s, column %d/%d", label, i+1, len(cols)), lh)...)
+		}
+		return out
+	}
+	if rows := splitGaps(frags, true, 0.5*lh); len(rows) > 1 {
+		var out []labeledFrags
+		for _, row := range rows {
+			for _, part := range xyCut(row, label, lh) {
+				// Paragraphs of the same column stay one block
+				if n := len(out); n > 0 && out[n-1].label == part.label {
+					out[n-1].frags = append(out[n-1].frags, part.frags...)
+				} else {
+					out = append(out, part)
+				}
+			}
+		}
+		return out
+	}
+	return []labeledFrags{{label, frags}}
+}
+
+// joinLines reads a block line by line. Text far apart on one line (grid
+// cells) is separated by " | ", and larger vertical gaps start a paragraph.
+func joinLines(frags []textFrag, region int, label string, lh float64) layoutBlock {
+	sorted := slices.Clone(frags)
+	slices.SortFunc(sorted, func(a, b textFrag) int {
+		switch {
+		case a.Y+a.H/2 < b.Y+b.H/2:
+			return -1
+		case a.Y+a.H/2 > b.Y+b.H/2:
+			return 1
+		}
+		return 0
+	})
+	var lines [][]textFrag
+	for _, f := range sorted {
+		if n := len(lines); n > 0 {
+			last := lines[n-1][0]
+			if mid := f.Y + f.H/2; mid >= last.Y && mid <= last.Y+last.H {
+				lines[n-1] = append(lines[n-1], f)
+				continue
+			}
+		}
+		lines = append(lines, []textFrag{f})
+	}
+
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	var b strings.Builder
+	prevBottom := 0.0
+	for _, line := range lines {
+		slices.SortFunc(line, func(a, b textFrag) int {
+			switch {
+			case a.X < b.X:
+				return -1
+			case a.X > b.X:
+				return 1
+			}
+			return 0
+		})
+		top := line[0].Y
+		if b.Len() > 0 {
+			b.WriteString("\n")
+			if top-prevBottom > 0.8*lh {
+				b.WriteString("\n")
+			}
+		}
+		var text strings.Builder
+		right := math.Inf(-1)
+		for i, f := range line {
+			if i > 0 {
+				switch gap := f.X - right; {
+				case gap > 2*lh:
+					text.WriteString(" | ")
+				case gap > 0.2*f.H:
+					text.WriteString(" ")
+				}
+			}
+			text.WriteString(f.Text)
+			right = max(right, f.X+f.W)
+			minX, minY = min(minX, f.X), min(minY, f.Y)
+			maxX, maxY = max(maxX, f.X+f.W), max(maxY, f.Y+f.H)
+		}
+		prevBottom = math.Inf(-1)
+		for _, f := range line {
+			prevBottom = max(prevBottom, f.Y+f.H)
+		}
+		b.WriteString(strings.TrimSpace(spaceRun.ReplaceAllString(strings.ReplaceAll(text.String(), "\n", " "), " ")))
+	}
+	return layoutBlock{
+		Region: region,
+		Label:  label,
+		X:      int(minX),
+		Y:      int(minY),
+		Width:  int(maxX - minX),
+		Height: int(maxY - minY),
+		Text:   b.String(),
+	}
+}
+
+// layoutText orders the page's text visually: regions are separated by wide
+// horizontal bands of whitespace, then cut into columns
+func layoutText(frags []textFrag) []layoutBlock {
+	if len(frags) == 0 {
+		return nil
+	}
+	lh := medianHeight(frags)
+	var blocks []layoutBlock
+	for i, region := range splitGaps(frags, true, 2.5*lh) {
+		for _, part := range xyCut(region, fmt.Sprintf("region %d", i+1), lh) {
+			blocks = append(blocks, joinLines(part.frags, i+1, part.label, lh))
+		}
+	}
+	return blocks
+}
+
+func cmdLayoutText(args []string, flags globalFlags) {
+	usage := "usage: bb layout-text [--selector sel]"
+	selector := ""
+	if len(args) == 2 && args[0] == "--selector" {
+		selector = args[1]
+	} else if len(args) != 0 {
+		fatalUsage("%s", usage)
+	}
+
+	_, _, page := withPage()
+	snap, err := proto.DOMSnapshotCaptureSnapshot{ComputedStyles: []string{"visibility"}}.Call(page)
+	if err != nil {
+		fatal("failed to capture the layout: %v", err)
+	}
+	frags := layoutFragments(snap)
+	if selector != "" {
+		res, err := page.Eval(`sel => {
+			const el = document.querySelector(sel);
+			if (!el) return null;
+			const r = el.getBoundingClientRect();
+			return [r.left + scrollX, r.top + scrollY, r.right + scrollX, r.bottom + scrollY];
+		}`, selector)
+		if err != nil || res.Value.Nil() {
+			fatalNotFound(selector, nil)
+		}
+		box := res.Value.Arr()
+		left, top, right, bottom := box[0].Num(), box[1].Num(), box[2].Num(), box[3].Num()
+		frags = slices.DeleteFunc(frags, func(f textFrag) bool {
+			cx, cy := f.X+f.W/2, f.Y+f.H/2
+			return cx < left || cx > right || cy < top || cy > bottom
+		})
+	}
+	blocks := layoutText(frags)
+
+	if flags.jsonOutput {
+		if blocks == nil {
+			blocks = []layoutBlock{}
+		}
+		out, _ := json.MarshalIndent(blocks, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	for i, b := range blocks {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("=== %s ===\n%s\n", b.Label, b.Text)
+	}
+}
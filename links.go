@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// linkedText renders n like readability's TextContent, except that links keep
+// their target as Markdown: [text](url)
+func linkedText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "noscript", "template":
+				return
+			case "a":
+				if href := linkTarget(n); href != "" {
+					var inner strings.Builder
+					for c := n.FirstChild; c != nil; c = c.NextSibling {
+						inner.WriteString(linkedText(c))
+					}
+					if text := strings.Join(strings.Fields(inner.String()), " "); text != "" {
+						b.WriteString("[" + text + "](" + href + ")")
+						return
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// linkTarget returns the href of a link worth keeping: not a same-page
+// anchor or a javascript: handler
+func linkTarget(n *html.Node) string {
+	for _, a := range n.Attr {
+		if a.Key == "href" {
+			href := strings.TrimSpace(a.Val)
+			if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+				return ""
+			}
+			return href
+		}
+	}
+	return ""
+}
+
+// linkedInnerTextJS is innerText with links written as [text](url). The
+// rewritten copy is rendered off-screen so innerText keeps the line breaks.
+const linkedInnerTextJS = `function() {
+	const copy = this.cloneNode(true);
+	for (const a of copy.querySelectorAll('a[href]')) {
+		const href = a.getAttribute('href').trim();
+		const text = a.textContent.replace(/\s+/g, ' ').trim();
+		if (!text || href.startsWith('#') || /^javascript:/i.test(href)) continue;
+		a.replaceWith('[' + text + '](' + new URL(href, document.baseURI).href + ')');
+	}
+	const holder = document.createElement('div');
+	holder.style.cssText = 'position:absolute;left:-100000px;top:0;width:' + (this.clientWidth || innerWidth) + 'px';
+	holder.appendChild(copy);
+	document.body.appendChild(holder);
+	const text = copy.innerText;
+	holder.remove();
+	return text;
+}`
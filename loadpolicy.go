@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// resourceClasses maps the names load-policy accepts to CDP resource types
+var resourceClasses = map[string]proto.NetworkResourceType{
+	"images":      proto.NetworkResourceTypeImage,
+	"fonts":       proto.NetworkResourceTypeFont,
+	"media":       proto.NetworkResourceTypeMedia,
+	"stylesheets": proto.NetworkResourceTypeStylesheet,
+	"scripts":     proto.NetworkResourceTypeScript,
+}
+
+// blockResourcesFlag is the --block-resources value, overriding the config's
+// load-policy for one command ("none" blocks nothing)
+var blockResourcesFlag string
+
+// parseResourceClasses parses a comma-separated list of resource classes
+func parseResourceClasses(v string) ([]string, error) {
+	var classes []string
+	for _, f := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+		f = strings.ToLower(f)
+		if f == "none" {
+			continue
+		}
+		if _, ok := resourceClasses[f]; !ok {
+			return nil, fmt.Errorf("unknown resource type %q (expected images, fonts, media, stylesheets or scripts)", f)
+		}
+		if !slices.Contains(classes, f) {
+			classes = append(classes, f)
+		}
+	}
+	return classes, nil
+}
+
+// loadPolicySetter returns a setter for `bb config load-policy --block <types>`
+func loadPolicySetter(assign func(c *Config, v []string)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		if len(args) > 0 && args[0] == "--block" {
+			args = args[1:]
+		}
+		classes, err := parseResourceClasses(strings.Join(args, ","))
+		if err != nil {
+			return err
+		}
+		assign(c, classes)
+		return nil
+	}
+}
+
+// blockedClasses returns the resource classes this invocation blocks
+func blockedClasses() []string {
+	if blockResourcesFlag != "" {
+		classes, _ := parseResourceClasses(blockResourcesFlag)
+		return classes
+	}
+	return loadConfig().LoadPolicy
+}
+
+// loadPolicyPages are the pages whose requests are already being filtered
+var loadPolicyPages = map[proto.TargetTargetID]bool{}
+
+// applyLoadPolicy fails requests of the blocked resource types on p and
+// answers the ones bb mock set up. It also gives the client certificate
+// proxy its password when the proxy asks; Chrome keeps it for the proxy's
+// later requests. Only those requests are intercepted, so others don't pay
+// for it. Like the other overrides it lasts while this invocation is
+// attached.
+func applyLoadPolicy(p *rod.Page) {
+	classes := blockedClasses()
+	mocks := sessionMocks()
+	patterns, proxyPassword := certProxyPatterns()
+	if (len(classes) == 0 && len(mocks) == 0 && len(patterns) == 0) || loadPolicyPages[p.TargetID] {
+		return
+	}
+	for _, c := range classes {
+		patterns = append(patterns, &proto.FetchRequestPattern{
+			URLPattern:   "*",
+			ResourceType: resourceClasses[c],
+			RequestStage: proto.FetchRequestStageRequest,
+		})
+	}
+	for _, m := range mocks {
+		patterns = append(patterns, &proto.FetchRequestPattern{URLPattern: m.urlPattern(), RequestStage: proto.FetchRequestStageRequest})
+	}
+	blocked := map[proto.NetworkResourceType]bool{}
+	for _, c := range classes {
+		blocked[resourceClasses[c]] = true
+	}
+	// Listen before enabling, or the first paused request could be missed.
+	// A request can match both; the mock wins.
+	wait := p.EachEvent(func(e *proto.FetchRequestPaused) {
+		if m := matchMock(mocks, e.Request.Method, e.Request.URL); m != nil {
+			fulfillMock(p, e, m)
+		} else if blocked[e.ResourceType] {
+			_ = proto.FetchFailRequest{RequestID: e.RequestID, ErrorReason: proto.NetworkErrorReasonBlockedByClient}.Call(p)
+		} else {
+			_ = proto.FetchContinueRequest{RequestID: e.RequestID}.Call(p)
+		}
+	}, func(e *proto.FetchAuthRequired) {
+		res := &proto.FetchAuthChallengeResponse{Response: proto.FetchAuthChallengeResponseResponseDefault}
+		if e.AuthChallenge.Source == proto.FetchAuthChallengeSourceProxy && e.AuthChallenge.Realm == certProxyRealm {
+			res = &proto.FetchAuthChallengeResponse{
+				Response: proto.FetchAuthChallengeResponseResponseProvideCredentials,
+				Username: "bb",
+				Password: proxyPassword,
+			}
+		}
+		_ = proto.FetchContinueWithAuth{RequestID: e.RequestID, AuthChallengeResponse: res}.Call(p)
+	})
+	go wait()
+	if err := (proto.FetchEnable{Patterns: patterns, HandleAuthRequests: proxyPassword != ""}).Call(p); err != nil {
+		fatal("failed to intercept requests: %v", err)
+	}
+	loadPolicyPages[p.TargetID] = true
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -18,6 +19,7 @@ import (
 	readability "github.com/go-shiori/go-readability"
 
 	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/input"
 	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/go-rod/stealth"
@@ -32,6 +34,19 @@ type State struct {
 	ChromePID  int    `json:"chrome_pid"`
 	ActivePage int    `json:"active_page"`
 	DataDir    string `json:"data_dir"`
+
+	// ActiveTarget is the target id of the active page. Indexes shift when
+	// tabs open and close; the id doesn't.
+	ActiveTarget string `json:"active_target,omitempty"`
+
+	Clock     *ClockOverride  `json:"clock,omitempty"`
+	Audio     *AudioCapture   `json:"audio,omitempty"`
+	Artifacts []Artifact      `json:"artifacts,omitempty"`
+	History   []HistoryEntry  `json:"history,omitempty"`
+	Marks     map[string]Mark `json:"marks,omitempty"`
+	Trace     *TraceRecording `json:"trace,omitempty"`
+	WS        *WSRecording    `json:"ws,omitempty"`
+	Mocks     []Mock          `json:"mocks,omitempty"`
 }
 
 func stateDir() string {
@@ -44,7 +59,7 @@ func statePath() string {
 }
 
 func loadState() (*State, error) {
-	data, err := os.ReadFile(statePath())
+	data, err := readSecretFile(statePath())
 	if err != nil {
 		return nil, err
 	}
@@ -63,18 +78,13 @@ func saveState(s *State) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(statePath(), data, 0644)
+	return writeSecretFile(statePath(), data)
 }
 
 func removeState() {
 	_ = os.Remove(statePath())
 }
 
-func fatal(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
-	os.Exit(1)
-}
-
 // Default timeout for element queries
 var defaultTimeout = 30 * time.Second
 
@@ -89,15 +99,25 @@ func init() {
 
 // ensureBrowser auto-starts Chrome if not running, returns state + connected browser
 func ensureBrowser() (*State, *rod.Browser) {
+	beginPhase("connect")
+	defer endPhase()
 	s, err := loadState()
 	if err == nil {
 		// Try connecting to existing browser
 		browser := rod.New().ControlURL(s.DebugURL)
 		if err := browser.Connect(); err == nil {
+			if len(chromeArgs) > 0 {
+				fmt.Fprintln(os.Stderr, "warning: the browser is already running; --chrome-arg applies to bb restart")
+			}
 			return s, browser
 		}
 		// Stale state, clean up
 		removeState()
+	} else if errors.Is(err, errNoPassphrase) {
+		fatal("%s: %v", statePath(), err)
+	}
+	if profileLocked() {
+		fatal("the Chrome profile is locked; run bb unlock")
 	}
 
 	// Start new browser
@@ -116,9 +136,22 @@ func ensureBrowser() (*State, *rod.Browser) {
 	if bin := os.Getenv("BB_CHROME_BIN"); bin != "" {
 		l = l.Bin(bin)
 	}
+	cfg := loadConfig()
+	l = applyLaunchConfig(l, cfg)
+	l = applyChromeArgs(l, chromeArgs)
+	var attachProxy func(pid int)
+	if len(cfg.ClientCerts) > 0 {
+		l, attachProxy = startCertProxy(l)
+	}
 
-	debugURL := l.MustLaunch()
+	debugURL, err := l.Launch()
+	if err != nil {
+		fail(exitUnreachable, "", "failed to launch Chrome: %v", err)
+	}
 	pid := l.PID()
+	if attachProxy != nil {
+		attachProxy(pid)
+	}
 
 	s = &State{
 		DebugURL:   debugURL,
@@ -132,7 +165,7 @@ func ensureBrowser() (*State, *rod.Browser) {
 
 	browser := rod.New().ControlURL(s.DebugURL)
 	if err := browser.Connect(); err != nil {
-		fatal("failed to connect to new browser: %v", err)
+		fail(exitUnreachable, "", "failed to connect to new browser: %v", err)
 	}
 
 	return s, browser
@@ -148,16 +181,129 @@ func withPage() (*State, *rod.Browser, *rod.Page) {
 	if len(pages) == 0 {
 		fatal("no pages open")
 	}
-	idx := s.ActivePage
+	idx := activePageIndex(s, pages)
 	if idx < 0 || idx >= len(pages) {
 		idx = 0
 	}
-	return s, browser, pages[idx].Timeout(defaultTimeout)
+	return s, browser, activatePage(pages[idx])
+}
+
+// pageTarget is the page given with --target
+var pageTarget string
+
+// chromeArgs are the --chrome-arg flags for a browser this invocation starts
+var chromeArgs []string
+
+// activePageIndex returns the page commands operate on: the --target page,
+// the page bb serve pinned with BB_PAGE (both an index or a target id), or
+// the active page
+func activePageIndex(s *State, pages rod.Pages) int {
+	ref := pageTarget
+	if ref == "" {
+		ref = os.Getenv("BB_PAGE")
+	}
+	if ref != "" {
+		idx, err := resolvePage(ref, pages)
+		if err != nil {
+			fatal("%v", err)
+		}
+		return idx
+	}
+	if s.ActiveTarget != "" {
+		for i, p := range pages {
+			if string(p.TargetID) == s.ActiveTarget {
+				return i
+			}
+		}
+	}
+	return s.ActivePage
+}
+
+// resolvePage finds a page by index or by its target id. A unique prefix of
+// the id is enough, as printed by bb pages; a number as long as that is
+// taken as one, since short ids can be all digits.
+func resolvePage(ref string, pages rod.Pages) (int, error) {
+	if idx, err := strconv.Atoi(ref); err == nil && len(ref) < shortIDLen {
+		if idx < 0 || idx >= len(pages) {
+			return 0, fmt.Errorf("page index %d out of range (0-%d)", idx, len(pages)-1)
+		}
+		return idx, nil
+	}
+	found := -1
+	for i, p := range pages {
+		id := string(p.TargetID)
+		if strings.EqualFold(id, ref) {
+			return i, nil
+		}
+		if len(ref) >= len(id) || !strings.EqualFold(id[:len(ref)], ref) {
+			continue
+		}
+		if found >= 0 {
+			return 0, fmt.Errorf("page id %s is ambiguous", ref)
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("no page with id %s (see bb pages)", ref)
+	}
+	return found, nil
+}
+
+// setActivePage makes page the active one
+func setActivePage(s *State, idx int, page *rod.Page) {
+	s.ActivePage = idx
+	s.ActiveTarget = string(page.TargetID)
+}
+
+// shortIDLen is how much of a target id bb prints
+const shortIDLen = 8
+
+// shortID abbreviates a target id for display
+func shortID(p *rod.Page) string {
+	id := string(p.TargetID)
+	if len(id) > shortIDLen {
+		return id[:shortIDLen]
+	}
+	return id
+}
+
+// activatePage records p as the page the command operates on, applies
+// per-page settings from the config, and returns it with the default timeout
+func activatePage(p *rod.Page) *rod.Page {
+	currentPage = p
+	return configurePage(p)
+}
+
+// configurePage applies the per-page settings to a tab the command works in
+// besides its page, such as a worker tab, and returns it with the default
+// timeout
+func configurePage(p *rod.Page) *rod.Page {
+	page := p.Timeout(defaultTimeout)
+	applyLoadPolicy(p)
+	applyPageConfig(page)
+	applySessionOverrides(page)
+	return page
+}
+
+// applySessionOverrides re-applies page overrides stored in the session state.
+// They live in the CDP session, which ends with each bb invocation.
+func applySessionOverrides(page *rod.Page) {
+	s, err := loadState()
+	if err != nil {
+		return
+	}
+	if s.Clock != nil {
+		applyClock(page, s.Clock)
+	}
+	if s.Audio != nil {
+		applyAudioCapture(page)
+	}
 }
 
 // extractReadableContent extracts readable text from HTML using go-readability
-// with a timeout to avoid hanging on complex pages
-func extractReadableContent(htmlContent string, pageURL string) (title string, content string, err error) {
+// with a timeout to avoid hanging on complex pages. With keepLinks, links are
+// kept as Markdown.
+func extractReadableContent(htmlContent string, pageURL string, keepLinks bool) (title string, content string, err error) {
 	parsedURL, err := url.Parse(pageURL)
 	if err != nil {
 		return "", "", err
@@ -177,7 +323,11 @@ func extractReadableContent(htmlContent string, pageURL string) (title string, c
 			ch <- result{err: err}
 			return
 		}
-		ch <- result{title: article.Title, content: article.TextContent}
+		content := article.TextContent
+		if keepLinks && article.Node != nil {
+			content = linkedText(article.Node)
+		}
+		ch <- result{title: article.Title, content: content}
 	}()
 
 	select {
@@ -191,8 +341,31 @@ func extractReadableContent(htmlContent string, pageURL string) (title string, c
 // --- Global flags ---
 
 type globalFlags struct {
-	jsonOutput bool
-	timeout    float64
+	jsonOutput        bool
+	noJSON            bool // overrides output-format json
+	timeout           float64
+	screenshotOnError string
+	dumpOnError       string
+	priority          string // queue priority when running through BB_REMOTE
+	verbose           bool   // print per-phase timings on stderr
+}
+
+// errorDirArg returns the argument after the --screenshot-on-error or
+// --dump-on-error at args[i] if it names a directory: an existing one, or a
+// path with a slash or starting with ~. The directory is optional, so
+// anything else (a selector, a URL) is left to the command.
+func errorDirArg(args []string, i int) (string, bool) {
+	if i+1 >= len(args) {
+		return "", false
+	}
+	a := args[i+1]
+	if strings.HasPrefix(a, "-") || strings.Contains(a, "://") || strings.HasPrefix(a, "//") {
+		return "", false
+	}
+	if fi, err := os.Stat(a); err == nil && fi.IsDir() {
+		return a, true
+	}
+	return a, strings.Contains(a, "/") || strings.HasPrefix(a, "~")
 }
 
 func parseGlobalFlags(args []string) ([]string, globalFlags) {
@@ -200,37 +373,175 @@ func parseGlobalFlags(args []string) ([]string, globalFlags) {
 	var remaining []string
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
+		case "--":
+			// The rest belongs to a nested command (bb jank --during -- ...)
+			remaining = append(remaining, args[i:]...)
+			i = len(args)
 		case "--json":
 			flags.jsonOutput = true
+		case "--envelope":
+			flags.jsonOutput = true
+			wrapJSON = true
+		case "--no-json":
+			flags.noJSON = true
+		case "--verbose":
+			flags.verbose = true
+		case "--target":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --target")
+			}
+			pageTarget = args[i]
+		case "--auto-consent":
+			autoConsent = true
+		case "--block-resources":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --block-resources")
+			}
+			if _, err := parseResourceClasses(args[i]); err != nil {
+				fatalUsage("--block-resources: %v", err)
+			}
+			blockResourcesFlag = args[i]
+		case "--chrome-arg":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --chrome-arg")
+			}
+			chromeArgs = append(chromeArgs, args[i])
 		case "--timeout":
 			i++
 			if i >= len(args) {
-				fatal("missing value for --timeout")
+				fatalUsage("missing value for --timeout")
 			}
 			v, err := strconv.ParseFloat(args[i], 64)
 			if err != nil {
-				fatal("invalid timeout: %v", err)
+				fatalUsage("invalid timeout: %v", err)
 			}
 			flags.timeout = v
+		case "--priority":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --priority")
+			}
+			if _, ok := priorities[args[i]]; !ok {
+				fatalUsage("invalid --priority: %s (expected high, normal or low)", args[i])
+			}
+			flags.priority = args[i]
+		case "--screenshot-on-error":
+			flags.screenshotOnError = defaultErrorDir()
+			if dir, ok := errorDirArg(args, i); ok {
+				flags.screenshotOnError = dir
+				i++
+			}
+		case "--dump-on-error":
+			flags.dumpOnError = defaultErrorDir()
+			if dir, ok := errorDirArg(args, i); ok {
+				flags.dumpOnError = dir
+				i++
+			}
 		default:
+			if dir, ok := strings.CutPrefix(args[i], "--screenshot-on-error="); ok {
+				flags.screenshotOnError = dir
+				continue
+			}
+			if arg, ok := strings.CutPrefix(args[i], "--chrome-arg="); ok {
+				chromeArgs = append(chromeArgs, arg)
+				continue
+			}
+			if dir, ok := strings.CutPrefix(args[i], "--dump-on-error="); ok {
+				flags.dumpOnError = dir
+				continue
+			}
 			remaining = append(remaining, args[i])
 		}
 	}
+	c := loadConfig()
 	if flags.timeout > 0 {
 		defaultTimeout = time.Duration(flags.timeout * float64(time.Second))
+	} else if c.Timeout > 0 && os.Getenv("BB_TIMEOUT") == "" {
+		defaultTimeout = time.Duration(c.Timeout * float64(time.Second))
+	}
+	if os.Getenv("BB_ENVELOPE") == "1" && !flags.noJSON {
+		flags.jsonOutput = true
+		wrapJSON = true
+	}
+	if c.OutputFormat == "json" && !flags.noJSON {
+		flags.jsonOutput = true
 	}
+	if flags.noJSON {
+		flags.jsonOutput = false
+	}
+	if flags.screenshotOnError == "" {
+		flags.screenshotOnError = os.Getenv("BB_SCREENSHOT_ON_ERROR")
+	}
+	if flags.dumpOnError == "" {
+		flags.dumpOnError = os.Getenv("BB_DUMP_ON_ERROR")
+	}
+	for _, a := range chromeArgs {
+		if !strings.HasPrefix(a, "--") {
+			fatalUsage("invalid --chrome-arg %q (expected --name or --name=value)", a)
+		}
+	}
+	failureCapture.screenshotDir = flags.screenshotOnError
+	failureCapture.dumpDir = flags.dumpOnError
+	jsonErrors = flags.jsonOutput
+	verboseTimings = flags.verbose
 	return remaining, flags
 }
 
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Print(helpText)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	cmd := os.Args[1]
+	invocation = os.Args[1:]
 	args, flags := parseGlobalFlags(os.Args[2:])
 
+	// BB_REMOTE sends the command to a bb remote serve instead
+	if addr := os.Getenv("BB_REMOTE"); addr != "" {
+		switch cmd {
+		case "remote", "serve", "help", "-h", "--help":
+		default:
+			var forward []string
+			for i := 1; i < len(os.Args); i++ {
+				if os.Args[i] == "--priority" {
+					i++
+					continue
+				}
+				forward = append(forward, os.Args[i])
+			}
+			runRemote(addr, forward, flags.priority)
+		}
+	}
+
+	// Must* helpers panic on failure; report them like any other error, so
+	// timeouts get their exit code
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := mustFailure(r)
+			if !ok {
+				panic(r)
+			}
+			fatal("%v", err)
+		}
+	}()
+
+	// Servers, streams and help print as they go; everything else is wrapped
+	if flags.jsonOutput {
+		switch cmd {
+		case "serve", "remote", "events", "help", "-h", "--help", "__cert-proxy":
+		case "ws":
+			if !wsFollowing(args) {
+				startEnvelope(cmd)
+			}
+		default:
+			startEnvelope(cmd)
+		}
+	}
+
 	switch cmd {
 	case "open":
 		cmdOpen(args, flags)
@@ -248,28 +559,82 @@ func main() {
 		cmdText(args)
 	case "html":
 		cmdHTML(args)
+	case "layout-text":
+		cmdLayoutText(args, flags)
+	case "grid":
+		cmdGrid(args, flags)
+	case "virtual-scrape":
+		cmdVirtualScrape(args, flags)
 	case "attr":
 		cmdAttr(args)
 	case "pdf":
 		cmdPDF(args)
+	case "save":
+		cmdSave(args)
 	case "extract":
-		cmdExtract(flags)
+		cmdExtract(args, flags)
+	case "meta":
+		cmdMeta(flags)
+	case "card":
+		cmdCard(args, flags)
+	case "images":
+		cmdImages(args, flags)
+	case "sitemap":
+		cmdSitemap(args, flags)
+	case "crawl":
+		cmdCrawl(args, flags)
+	case "fetch":
+		cmdFetch(args, flags)
+	case "mock":
+		cmdMock(args, flags)
+	case "fetch-all":
+		cmdFetchAll(args, flags)
+	case "canvas":
+		cmdCanvas(args, flags)
+	case "media-el":
+		cmdMediaEl(args, flags)
+	case "audio":
+		cmdAudio(args, flags)
 	case "js":
 		cmdJS(args, flags)
+	case "snapshot":
+		cmdSnapshot(args, flags)
 	case "click":
 		cmdClick(args)
 	case "input":
 		cmdInput(args)
+	case "type":
+		cmdType(args)
 	case "clear":
 		cmdClear(args)
 	case "select":
 		cmdSelect(args)
+	case "combobox":
+		cmdCombobox(args)
+	case "richtext":
+		cmdRichtext(args)
+	case "autocomplete":
+		cmdAutocomplete(args)
+	case "fill":
+		cmdFill(args, flags)
+	case "form":
+		cmdForm(args, flags)
 	case "submit":
 		cmdSubmit(args)
 	case "hover":
 		cmdHover(args)
 	case "focus":
 		cmdFocus(args)
+	case "highlight":
+		cmdHighlight(args)
+	case "click-at":
+		cmdClickAt(args)
+	case "move":
+		cmdMove(args)
+	case "drag":
+		cmdDrag(args)
+	case "dragdrop":
+		cmdDragDrop(args)
 	case "wait":
 		cmdWait(args)
 	case "waitload":
@@ -280,10 +645,18 @@ func main() {
 		cmdWaitIdle()
 	case "sleep":
 		cmdSleep(args)
+	case "retry":
+		cmdRetry(args)
 	case "screenshot":
 		cmdScreenshot(args)
 	case "screenshot-el":
 		cmdScreenshotEl(args)
+	case "responsive":
+		cmdResponsive(args, flags)
+	case "shotmatrix":
+		cmdShotmatrix(args, flags)
+	case "popup":
+		cmdPopup(args)
 	case "pages":
 		cmdPages(flags)
 	case "page":
@@ -294,10 +667,16 @@ func main() {
 		cmdClosePage(args)
 	case "exists":
 		cmdExists(args)
+	case "assert":
+		cmdAssert(args, flags)
 	case "count":
 		cmdCount(args)
 	case "visible":
 		cmdVisible(args)
+	case "probe":
+		cmdProbe(args)
+	case "search":
+		cmdSearch(args, flags)
 	case "ax-tree":
 		cmdAXTree(args, flags)
 	case "ax-find":
@@ -306,17 +685,91 @@ func main() {
 		cmdAXNode(args, flags)
 	case "cdp":
 		cmdCDP(args)
+	case "clock":
+		cmdClock(args)
+	case "imgdiff":
+		cmdImgDiff(args, flags)
+	case "diff":
+		cmdDiff(args, flags)
+	case "artifacts":
+		cmdArtifacts(args, flags)
+	case "lock":
+		cmdLock()
+	case "unlock":
+		cmdUnlock()
+	case "import":
+		cmdImport(args)
+	case "export":
+		cmdExport(args)
+	case "perf":
+		cmdPerf(args, flags)
+	case "audit":
+		cmdAudit(args, flags)
+	case "ax-audit":
+		cmdAxAudit(args, flags)
+	case "__cert-proxy":
+		cmdCertProxy()
+	case "trace":
+		cmdTrace(args)
+	case "jank":
+		cmdJank(args, flags)
+	case "consent":
+		cmdConsent(args, flags)
+	case "declutter":
+		cmdDeclutter(args, flags)
+	case "css":
+		cmdCSS(args)
+	case "prefetch":
+		cmdPrefetch(args, flags)
+	case "console":
+		cmdConsole(args, flags)
+	case "events":
+		cmdEvents(args)
+	case "ws":
+		cmdWS(args, flags)
+	case "heap":
+		cmdHeap(args, flags)
+	case "journey":
+		cmdJourney(args, flags)
+	case "session":
+		cmdSession(args)
+	case "storage":
+		cmdStorage(args, flags)
+	case "mark":
+		cmdMark(args)
+	case "goto":
+		cmdGoto(args)
+	case "marks":
+		cmdMarks(args, flags)
+	case "history":
+		cmdHistory(args, flags)
+	case "journal":
+		cmdJournal(args, flags)
+	case "config":
+		cmdConfig(args, flags)
+	case "serve":
+		cmdServe(args)
+	case "remote":
+		cmdRemote(args)
 	case "status":
 		cmdStatus(flags)
+	case "throttle":
+		cmdThrottle(args)
 	case "stop":
-		cmdStop()
+		cmdStop(args)
+	case "restart":
+		cmdRestart()
 	case "help", "-h", "--help":
 		fmt.Print(helpText)
 	default:
+		if jsonErrors {
+			fail(exitUsage, "", "unknown command: %s", cmd)
+		}
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", cmd)
 		fmt.Print(helpText)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
+	exit(0)
 }
 
 // --- Commands ---
@@ -324,6 +777,10 @@ func main() {
 func cmdOpen(args []string, flags globalFlags) {
 	raw := false
 	waitStable := false
+	noJS := false
+	prefer := ""
+	fallback := ""
+	var opts extractOptions
 	var positional []string
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -331,12 +788,29 @@ func cmdOpen(args []string, flags globalFlags) {
 			raw = true
 		case "--wait":
 			waitStable = true
+		case "--no-js":
+			noJS = true
+		case "--prefer-amp":
+			prefer = "amphtml"
+		case "--prefer-canonical":
+			prefer = "canonical"
+		case "--keep-links":
+			opts.keepLinks = true
+		case "--fallback":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --fallback")
+			}
+			if args[i] != "wayback" {
+				fatalUsage("unknown --fallback %q (supported: wayback)", args[i])
+			}
+			fallback = args[i]
 		default:
 			positional = append(positional, args[i])
 		}
 	}
 	if len(positional) < 1 {
-		fatal("usage: bb open <url>")
+		fatalUsage("usage: bb open <url> [--raw] [--wait] [--no-js] [--keep-links] [--prefer-amp|--prefer-canonical] [--fallback wayback]")
 	}
 	u := positional[0]
 	if !strings.Contains(u, "://") {
@@ -347,27 +821,42 @@ func cmdOpen(args []string, flags globalFlags) {
 	pages, _ := browser.Pages()
 	var page *rod.Page
 	if len(pages) == 0 {
-		page = stealth.MustPage(browser)
-		page = page.Timeout(defaultTimeout)
-		if err := page.Navigate(u); err != nil {
-			fatal("navigation failed: %v", err)
-		}
-		s.ActivePage = 0
+		page = activatePage(stealth.MustPage(browser))
+		setActivePage(s, 0, page)
 		_ = saveState(s)
 	} else {
-		idx := s.ActivePage
+		idx := activePageIndex(s, pages)
 		if idx < 0 || idx >= len(pages) {
 			idx = 0
 		}
-		page = pages[idx].Timeout(defaultTimeout)
-		if err := page.Navigate(u); err != nil {
+		page = activatePage(pages[idx])
+	}
+	beginPhase("navigate")
+	prepareNavigation(page, u, noJS)
+	if err := page.Navigate(u); err != nil {
+		if fallback == "" {
 			fatal("navigation failed: %v", err)
 		}
+		openFallback(page, u, fmt.Sprintf("navigation failed: %v", err), &opts)
+	} else {
+		beginPhase("wait")
+		page.MustWaitLoad()
+		if waitStable {
+			page.MustWaitStable()
+		}
+		reportAutoConsent(page)
+		if prefer != "" {
+			preferVariant(page, prefer, waitStable)
+		}
+		if fallback != "" {
+			if problem := pageProblem(page); problem != "" {
+				openFallback(page, u, problem, &opts)
+			}
+		}
 	}
-	page.MustWaitLoad()
-	if waitStable {
-		page.MustWaitStable()
-	}
+	endPhase()
+
+	recordNavigation(page)
 
 	info, _ := page.Info()
 	currentURL := ""
@@ -379,10 +868,16 @@ func cmdOpen(args []string, flags globalFlags) {
 
 	if raw {
 		if flags.jsonOutput {
-			out, _ := json.MarshalIndent(map[string]string{
+			result := map[string]string{
 				"url":   currentURL,
 				"title": pageTitle,
-			}, "", "  ")
+			}
+			if opts.source != "" {
+				result["source"] = opts.source
+				result["original_url"] = opts.originalURL
+				result["archived_at"] = opts.archivedAt
+			}
+			out, _ := json.MarshalIndent(result, "", "  ")
 			fmt.Println(string(out))
 		} else {
 			fmt.Println(pageTitle)
@@ -390,42 +885,26 @@ func cmdOpen(args []string, flags globalFlags) {
 		return
 	}
 
-	// Extract readable content
-	html := page.MustEval(`() => document.documentElement.outerHTML`).Str()
-	title, content, err := extractReadableContent(html, currentURL)
-	if err != nil || strings.TrimSpace(content) == "" {
-		// Fallback: get body innerText
-		content = page.MustEval(`() => document.body?.innerText ?? ""`).Str()
-	}
-	if title == "" {
-		title = pageTitle
-	}
-
-	// Truncate if very large (50KB limit for agent consumption)
-	const maxBytes = 50 * 1024
-	truncated := false
-	if len(content) > maxBytes {
-		content = content[:maxBytes]
-		truncated = true
-	}
+	printExtraction(page, currentURL, pageTitle, opts, flags)
+}
 
-	if flags.jsonOutput {
-		out, _ := json.MarshalIndent(map[string]interface{}{
-			"url":       currentURL,
-			"title":     title,
-			"content":   content,
-			"truncated": truncated,
-		}, "", "  ")
-		fmt.Println(string(out))
-	} else {
-		fmt.Printf("# %s\n\n%s", title, content)
-		if truncated {
-			fmt.Fprintf(os.Stderr, "\n[content truncated to 50KB]\n")
+func cmdExtract(args []string, flags globalFlags) {
+	var opts extractOptions
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--selector":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --selector")
+			}
+			opts.selector = args[i]
+		case "--keep-links":
+			opts.keepLinks = true
+		default:
+			fatalUsage("usage: bb extract [--selector <sel>] [--keep-links]")
 		}
 	}
-}
 
-func cmdExtract(flags globalFlags) {
 	_, _, page := withPage()
 	info, _ := page.Info()
 	currentURL := ""
@@ -435,16 +914,81 @@ func cmdExtract(flags globalFlags) {
 		pageTitle = info.Title
 	}
 
+	printExtraction(page, currentURL, pageTitle, opts, flags)
+}
+
+// extractOptions controls what open and extract treat as the page content
+type extractOptions struct {
+	selector  string // only extract this subtree
+	keepLinks bool   // write links as [text](url)
+
+	// Set when open fell back to an archived copy
+	source      string
+	originalURL string
+	archivedAt  string
+}
+
+// readableContent returns the page's article text, or its body text when
+// readability finds nothing. With a selector only that subtree is processed.
+func readableContent(page *rod.Page, currentURL, pageTitle string, opts extractOptions) (title, content, method string) {
+	if opts.selector != "" {
+		return scopedContent(page, currentURL, pageTitle, opts)
+	}
 	html := page.MustEval(`() => document.documentElement.outerHTML`).Str()
-	title, content, err := extractReadableContent(html, currentURL)
+	title, content, err := extractReadableContent(html, currentURL, opts.keepLinks)
+	method = extractedReadability
 	if err != nil || strings.TrimSpace(content) == "" {
-		content = page.MustEval(`() => document.body?.innerText ?? ""`).Str()
+		method = extractedInnerText
+		// Fallback: get body innerText
+		if opts.keepLinks {
+			content = page.MustEval(`() => document.body ? (` + linkedInnerTextJS + `).call(document.body) : ""`).Str()
+		} else {
+			content = page.MustEval(`() => document.body?.innerText ?? ""`).Str()
+		}
+	}
+	if title == "" {
+		title = pageTitle
+	}
+	return title, content, method
+}
+
+// scopedContent runs readability on one element. Readability keeps only what
+// looks like an article, so for subtrees such as comment threads, where it
+// drops most of the text, the element's rendered text is used instead.
+func scopedContent(page *rod.Page, currentURL, pageTitle string, opts extractOptions) (title, content, method string) {
+	el, err := page.Element(opts.selector)
+	if err != nil {
+		fatalNotFound(opts.selector, err)
+	}
+	res, err := el.Eval(`function(title, keepLinks) {
+		const doc = document.implementation.createHTMLDocument(title);
+		doc.body.appendChild(doc.importNode(this, true));
+		return {html: doc.documentElement.outerHTML, text: keepLinks ? (`+linkedInnerTextJS+`).call(this) : this.innerText};
+	}`, pageTitle, opts.keepLinks)
+	if err != nil {
+		fatal("failed to read %s: %v", opts.selector, err)
+	}
+	text := res.Value.Get("text").Str()
+	title, content, err = extractReadableContent(res.Value.Get("html").Str(), currentURL, opts.keepLinks)
+	method = extractedReadability
+	if err != nil || len(strings.TrimSpace(content)) < len(strings.TrimSpace(text))/2 {
+		content, method = text, extractedElement
 	}
 	if title == "" {
 		title = pageTitle
 	}
+	return title, content, method
+}
 
-	const maxBytes = 50 * 1024
+// printExtraction prints the readable content of page, as used by open and extract
+func printExtraction(page *rod.Page, currentURL, pageTitle string, opts extractOptions, flags globalFlags) {
+	beginPhase("extract")
+	title, content, method := readableContent(page, currentURL, pageTitle, opts)
+	wall := detectWall(page, content)
+	quality := assessExtraction(page, content, method, wall)
+
+	// Truncate if very large (50KB by default, for agent consumption)
+	maxBytes := extractLimit()
 	truncated := false
 	if len(content) > maxBytes {
 		content = content[:maxBytes]
@@ -452,17 +996,34 @@ func cmdExtract(flags globalFlags) {
 	}
 
 	if flags.jsonOutput {
-		out, _ := json.MarshalIndent(map[string]interface{}{
+		result := map[string]interface{}{
 			"url":       currentURL,
 			"title":     title,
 			"content":   content,
 			"truncated": truncated,
-		}, "", "  ")
+			"quality":   quality,
+		}
+		if wall != "" {
+			result["wall"] = wall
+			result["teaser"] = strings.TrimSpace(content)
+		}
+		if opts.source != "" {
+			result["source"] = opts.source
+			result["original_url"] = opts.originalURL
+			result["archived_at"] = opts.archivedAt
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
 		fmt.Println(string(out))
 	} else {
 		fmt.Printf("# %s\n\n%s", title, content)
 		if truncated {
-			fmt.Fprintf(os.Stderr, "\n[content truncated to 50KB]\n")
+			fmt.Fprintf(os.Stderr, "\n[content truncated to %dKB]\n", maxBytes/1024)
+		}
+		if wall != "" {
+			fmt.Fprintf(os.Stderr, "\n[%s detected: the content above is likely only a teaser]\n", wall)
+		}
+		if quality.Level == "low" {
+			fmt.Fprintf(os.Stderr, "\n[extraction quality low (%.2f): %s; bb html or bb screenshot may show more]\n", quality.Score, strings.Join(quality.Reasons, "; "))
 		}
 	}
 }
@@ -471,6 +1032,7 @@ func cmdBack() {
 	_, _, page := withPage()
 	page.MustNavigateBack()
 	page.MustWaitLoad()
+	recordNavigation(page)
 	info, _ := page.Info()
 	if info != nil {
 		fmt.Println(info.URL)
@@ -481,6 +1043,7 @@ func cmdForward() {
 	_, _, page := withPage()
 	page.MustNavigateForward()
 	page.MustWaitLoad()
+	recordNavigation(page)
 	info, _ := page.Info()
 	if info != nil {
 		fmt.Println(info.URL)
@@ -514,10 +1077,11 @@ func cmdTitle() {
 
 func cmdText(args []string) {
 	_, _, page := withPage()
+	beginPhase("extract")
 	if len(args) > 0 {
 		el, err := page.Element(args[0])
 		if err != nil {
-			fatal("element not found: %v", err)
+			fatalNotFound(args[0], err)
 		}
 		text, err := el.Text()
 		if err != nil {
@@ -532,35 +1096,54 @@ func cmdText(args []string) {
 }
 
 func cmdHTML(args []string) {
+	canonical := false
+	var positional []string
+	for _, a := range args {
+		if a == "--canonical" {
+			canonical = true
+		} else {
+			positional = append(positional, a)
+		}
+	}
+
 	_, _, page := withPage()
-	if len(args) > 0 {
-		el, err := page.Element(args[0])
+	beginPhase("extract")
+	var html string
+	if len(positional) > 0 {
+		el, err := page.Element(positional[0])
 		if err != nil {
-			fatal("element not found: %v", err)
+			fatalNotFound(positional[0], err)
 		}
-		html, err := el.HTML()
+		html, err = el.HTML()
 		if err != nil {
 			fatal("failed to get HTML: %v", err)
 		}
-		fmt.Println(html)
 	} else {
-		html := page.MustEval(`() => document.documentElement.outerHTML`).Str()
-		fmt.Println(html)
+		html = page.MustEval(`() => document.documentElement.outerHTML`).Str()
 	}
+	if canonical {
+		out, err := canonicalHTML(html, len(positional) > 0)
+		if err != nil {
+			fatal("failed to parse HTML: %v", err)
+		}
+		fmt.Print(out)
+		return
+	}
+	fmt.Println(html)
 }
 
 func cmdAttr(args []string) {
 	if len(args) < 2 {
-		fatal("usage: bb attr <selector> <attribute>")
+		fatalUsage("usage: bb attr <selector> <attribute>")
 	}
 	_, _, page := withPage()
 	el, err := page.Element(args[0])
 	if err != nil {
-		fatal("element not found: %v", err)
+		fatalNotFound(args[0], err)
 	}
 	val := el.MustAttribute(args[1])
 	if val == nil {
-		fatal("attribute %q not found", args[1])
+		fail(exitNotFound, args[0], "attribute %q not found", args[1])
 	}
 	fmt.Println(*val)
 }
@@ -569,6 +1152,8 @@ func cmdPDF(args []string) {
 	file := "page.pdf"
 	if len(args) > 0 {
 		file = args[0]
+	} else if dir := outputDir(); dir != "" {
+		file = nextAvailableFile(filepath.Join(dir, "page"), ".pdf")
 	}
 	_, _, page := withPage()
 	req := proto.PagePrintToPDF{}
@@ -590,12 +1175,13 @@ func cmdPDF(args []string) {
 	if err := os.WriteFile(file, buf, 0644); err != nil {
 		fatal("failed to write PDF: %v", err)
 	}
+	recordArtifact("pdf", file)
 	fmt.Printf("Saved %s (%d bytes)\n", file, len(buf))
 }
 
 func cmdJS(args []string, flags globalFlags) {
 	if len(args) < 1 {
-		fatal("usage: bb js <expression>")
+		fatalUsage("usage: bb js <expression>")
 	}
 	expr := strings.Join(args, " ")
 	_, _, page := withPage()
@@ -631,114 +1217,843 @@ func cmdJS(args []string, flags globalFlags) {
 }
 
 func cmdClick(args []string) {
-	if len(args) < 1 {
-		fatal("usage: bb click <selector>")
+	node, args := takeNodeFlag(args)
+	button := proto.InputMouseButtonLeft
+	count := 1
+	followPopup := false
+	var target elementTarget
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--follow-popup":
+			followPopup = true
+		case "--double":
+			count = 2
+		case "--right":
+			button = proto.InputMouseButtonRight
+		case "--middle":
+			button = proto.InputMouseButtonMiddle
+		case "--count":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --count")
+			}
+			v, err := strconv.Atoi(args[i])
+			if err != nil || v < 1 {
+				fatalUsage("invalid count: %s", args[i])
+			}
+			count = v
+		default:
+			if next, ok := parseTargetFlag(args, i, &target); ok {
+				i = next
+				continue
+			}
+			positional = append(positional, args[i])
+		}
 	}
-	_, _, page := withPage()
-	el, err := page.Element(args[0])
+	if len(positional) < 1 && node == 0 {
+		fatalUsage("usage: bb click <selector>|--node <id> [--double] [--right|--middle] [--count N] [--position P] [--offset dx,dy] [--follow-popup]")
+	}
+	selector := ""
+	if len(positional) > 0 {
+		selector = positional[0]
+	}
+	nodeOrSelector(node, selector)
+	_, browser, page := withPage()
+	el, err := findElement(page, selector, node)
 	if err != nil {
-		fatal("element not found: %v", err)
+		fatalNoElement(selector, node, err)
 	}
-	if err := el.Click(proto.InputMouseButtonLeft, 1); err != nil {
+	var waitPopup func() (*rod.Page, error)
+	if followPopup {
+		waitPopup = page.WaitOpen()
+	}
+	if target.set {
+		x, y, err := elementPoint(el, target)
+		if err != nil {
+			fatal("click failed: %v", err)
+		}
+		if err := page.Mouse.MoveTo(proto.Point{X: x, Y: y}); err != nil {
+			fatal("click failed: %v", err)
+		}
+		if err := page.Mouse.Click(button, count); err != nil {
+			fatal("click failed: %v", err)
+		}
+	} else if err := el.Click(button, count); err != nil {
 		fatal("click failed: %v", err)
 	}
+	if waitPopup != nil {
+		popup, err := waitPopup()
+		if err != nil {
+			fatal("click opened no popup: %v", err)
+		}
+		fmt.Println("Clicked")
+		switchToPopup(browser, popup)
+		return
+	}
 	time.Sleep(100 * time.Millisecond)
 	fmt.Println("Clicked")
 }
 
 func cmdInput(args []string) {
-	if len(args) < 2 {
-		fatal("usage: bb input <selector> <text>")
+	node, args := takeNodeFlag(args)
+	selector := ""
+	if node == 0 && len(args) > 0 {
+		selector, args = args[0], args[1:]
+	}
+	if len(args) < 1 {
+		fatalUsage("usage: bb input <selector>|--node <id> <text>")
 	}
 	_, _, page := withPage()
-	el, err := page.Element(args[0])
+	el, err := findElement(page, selector, node)
 	if err != nil {
-		fatal("element not found: %v", err)
+		fatalNoElement(selector, node, err)
 	}
-	text := strings.Join(args[1:], " ")
+	text := strings.Join(args, " ")
 	el.MustSelectAllText().MustInput(text)
 	fmt.Printf("Typed: %s\n", text)
 }
 
-func cmdClear(args []string) {
-	if len(args) < 1 {
-		fatal("usage: bb clear <selector>")
+// keyFor maps a character to rod's keyboard layout. Characters that aren't on
+// the US layout (accents, CJK, emoji) have no key and must be inserted as text.
+func keyFor(r rune) (key input.Key, ok bool) {
+	if r == '\n' {
+		return input.Enter, true
+	}
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	key = input.Key(r)
+	key.Info() // panics for keys outside the layout
+	return key, true
+}
+
+// typeText sends text to the focused element as key events, pausing delay
+// between characters
+func typeText(page *rod.Page, text string, delay time.Duration) error {
+	for _, r := range text {
+		if key, ok := keyFor(r); ok {
+			if err := page.Keyboard.Type(key); err != nil {
+				return err
+			}
+		} else if err := page.InsertText(string(r)); err != nil {
+			return err
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+	return nil
+}
+
+func cmdType(args []string) {
+	var delay time.Duration
+	enter := false
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--delay":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --delay")
+			}
+			ms, err := strconv.Atoi(args[i])
+			if err != nil || ms < 0 {
+				fatalUsage("invalid delay: %s", args[i])
+			}
+			delay = time.Duration(ms) * time.Millisecond
+		case "--enter":
+			enter = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		fatalUsage("usage: bb type [selector] <text> [--delay ms] [--enter]")
+	}
+
+	_, _, page := withPage()
+	text := positional[len(positional)-1]
+	if len(positional) == 2 {
+		el, err := page.Element(positional[0])
+		if err != nil {
+			fatalNotFound(positional[0], err)
+		}
+		if err := el.Focus(); err != nil {
+			fatal("focus failed: %v", err)
+		}
+	}
+
+	if err := typeText(page, text, delay); err != nil {
+		fatal("typing failed: %v", err)
+	}
+	if enter {
+		if err := page.Keyboard.Type(input.Enter); err != nil {
+			fatal("failed to press Enter: %v", err)
+		}
+	}
+	fmt.Printf("Typed: %s\n", text)
+}
+
+func cmdClear(args []string) {
+	if len(args) < 1 {
+		fatalUsage("usage: bb clear <selector>")
+	}
+	_, _, page := withPage()
+	el, err := page.Element(args[0])
+	if err != nil {
+		fatalNotFound(args[0], err)
+	}
+	el.MustSelectAllText().MustInput("")
+	fmt.Println("Cleared")
+}
+
+// selectOptionsJS selects <option>s by value, label and index in one pass.
+// Unmatched criteria are reported back together with the available options.
+const selectOptionsJS = `(sel, values, labels, indexes) => {
+	const el = document.querySelector(sel);
+	if (!el) throw new Error('element not found');
+	if (el.tagName !== 'SELECT') throw new Error('element is not a <select>');
+	const opts = Array.from(el.options);
+	const label = o => o.text.trim();
+	const matched = [], missing = [];
+	const add = (o, desc) => o ? matched.push(o) : missing.push(desc);
+	values.forEach(v => add(opts.find(o => o.value === v), 'value ' + JSON.stringify(v)));
+	labels.forEach(l => add(
+		opts.find(o => label(o) === l) || opts.find(o => label(o).toLowerCase() === l.toLowerCase()),
+		'label ' + JSON.stringify(l)));
+	indexes.forEach(i => add(opts[i], 'index ' + i));
+	const options = opts.map(o => ({value: o.value, label: label(o)}));
+	if (missing.length) return {missing, options};
+	if (matched.length > 1 && !el.multiple) throw new Error('multiple options given but the select is not multiple');
+	opts.forEach(o => { o.selected = matched.includes(o); });
+	el.dispatchEvent(new Event('input', {bubbles: true}));
+	el.dispatchEvent(new Event('change', {bubbles: true}));
+	return {selected: matched.map(o => o.value), options};
+}`
+
+func cmdSelect(args []string) {
+	values := []string{}
+	labels := []string{}
+	indexes := []int{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--label":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --label")
+			}
+			labels = append(labels, args[i])
+		case "--index":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --index")
+			}
+			v, err := strconv.Atoi(args[i])
+			if err != nil || v < 0 {
+				fatalUsage("invalid index: %s", args[i])
+			}
+			indexes = append(indexes, v)
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) < 1 || len(positional)+len(labels)+len(indexes) < 2 {
+		fatalUsage("usage: bb select <selector> <value...> [--label text] [--index N]")
+	}
+	values = append(values, positional[1:]...)
+
+	_, _, page := withPage()
+	result, err := page.Eval(selectOptionsJS, positional[0], values, labels, indexes)
+	if err != nil {
+		fatal("select failed: %v", err)
+	}
+
+	var res struct {
+		Selected []string `json:"selected"`
+		Missing  []string `json:"missing"`
+		Options  []struct {
+			Value string `json:"value"`
+			Label string `json:"label"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(result.Value.JSON("", "")), &res); err != nil {
+		fatal("select failed: %v", err)
+	}
+	if len(res.Missing) > 0 {
+		var avail []string
+		for i, o := range res.Options {
+			avail = append(avail, fmt.Sprintf("  [%d] %q (value %q)", i, o.Label, o.Value))
+		}
+		fail(exitNotFound, "", "no option matching %s\navailable options:\n%s",
+			strings.Join(res.Missing, ", "), strings.Join(avail, "\n"))
+	}
+	fmt.Printf("Selected: %s\n", strings.Join(res.Selected, ", "))
+}
+
+// findListboxJS locates the popup listbox opened by a combobox trigger,
+// preferring aria-controls/aria-owns and falling back to the last visible listbox
+const findListboxJS = `(trigger) => {
+	const visible = e => e && e.getClientRects().length > 0 && getComputedStyle(e).visibility !== 'hidden';
+	const owners = [trigger, ...trigger.querySelectorAll('[aria-controls], [aria-owns]')];
+	for (const owner of owners) {
+		const ids = [owner.getAttribute('aria-controls'), owner.getAttribute('aria-owns')].join(' ').split(/\s+/);
+		for (const id of ids.filter(Boolean)) {
+			const el = document.getElementById(id);
+			if (!el) continue;
+			const lb = el.matches('[role=listbox]') ? el : el.querySelector('[role=listbox]');
+			if (visible(lb)) return lb;
+		}
+	}
+	const all = Array.from(document.querySelectorAll('[role=listbox]')).filter(visible);
+	return all[all.length - 1] || null;
+}`
+
+// findOptionJS matches an option by exact, case-insensitive, then substring text
+const findOptionJS = `(listbox, text) => {
+	const opts = Array.from(listbox.querySelectorAll('[role=option]'));
+	const label = o => o.textContent.trim();
+	const lower = text.toLowerCase();
+	return opts.find(o => label(o) === text)
+		|| opts.find(o => label(o).toLowerCase() === lower)
+		|| opts.find(o => label(o).toLowerCase().includes(lower))
+		|| null;
+}`
+
+func cmdCombobox(args []string) {
+	if len(args) < 2 {
+		fatalUsage("usage: bb combobox <selector> <option-text>")
+	}
+	text := strings.Join(args[1:], " ")
+	_, _, page := withPage()
+	trigger, err := page.Element(args[0])
+	if err != nil {
+		fatalNotFound(args[0], err)
+	}
+	if err := trigger.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		fatal("failed to open combobox: %v", err)
+	}
+
+	listbox, err := page.ElementByJS(rod.Eval(findListboxJS, trigger.Object))
+	if err != nil {
+		fatal("listbox did not appear: %v", err)
+	}
+
+	// Options are often rendered asynchronously after the popup opens
+	wait := min(defaultTimeout, 5*time.Second)
+	option, err := page.Timeout(wait).ElementByJS(rod.Eval(findOptionJS, listbox.Object, text))
+	if err != nil {
+		labels := []string{}
+		if res, err := listbox.Eval(`function() {
+			return Array.from(this.querySelectorAll('[role=option]')).map(o => o.textContent.trim());
+		}`); err == nil {
+			for _, l := range res.Value.Arr() {
+				labels = append(labels, fmt.Sprintf("  %q", l.Str()))
+			}
+		}
+		fail(exitNotFound, "", "no option matching %q\navailable options:\n%s", text, strings.Join(labels, "\n"))
+	}
+	label := option.MustText()
+	if err := option.ScrollIntoView(); err != nil {
+		fatal("failed to scroll to option: %v", err)
+	}
+	if err := option.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		fatal("failed to click option: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("Selected: %s\n", strings.TrimSpace(label))
+}
+
+// suggestionsJS returns the visible suggestions shown for an autocomplete
+// input: matches of optionSel if given, otherwise the options of its listbox
+const suggestionsJS = `(input, optionSel) => {
+	const visible = e => e.getClientRects().length > 0 && getComputedStyle(e).visibility !== 'hidden';
+	if (optionSel) return Array.from(document.querySelectorAll(optionSel)).filter(visible);
+	const listbox = (` + findListboxJS + `)(input);
+	return listbox ? Array.from(listbox.querySelectorAll('[role=option]')).filter(visible) : [];
+}`
+
+func cmdAutocomplete(args []string) {
+	pick := 1
+	optionSel := ""
+	click := false
+	var delay time.Duration
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--pick":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --pick")
+			}
+			v, err := strconv.Atoi(args[i])
+			if err != nil || v < 1 {
+				fatalUsage("invalid pick: %s (expected 1 or more)", args[i])
+			}
+			pick = v
+		case "--option-selector":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --option-selector")
+			}
+			optionSel = args[i]
+		case "--delay":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --delay")
+			}
+			ms, err := strconv.Atoi(args[i])
+			if err != nil || ms < 0 {
+				fatalUsage("invalid delay: %s", args[i])
+			}
+			delay = time.Duration(ms) * time.Millisecond
+		case "--click":
+			click = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 {
+		fatalUsage("usage: bb autocomplete <input-selector> <query> [--pick N] [--option-selector sel] [--delay ms] [--click]")
+	}
+
+	_, _, page := withPage()
+	el, err := page.Element(positional[0])
+	if err != nil {
+		fatalNotFound(positional[0], err)
+	}
+	if err := el.SelectAllText(); err != nil {
+		fatal("failed to clear input: %v", err)
+	}
+	if err := el.Input(""); err != nil {
+		fatal("failed to clear input: %v", err)
+	}
+	if err := typeText(page, positional[1], delay); err != nil {
+		fatal("typing failed: %v", err)
+	}
+
+	// Suggestions usually arrive after a debounce and a network round trip
+	wait := min(defaultTimeout, 5*time.Second)
+	err = page.Timeout(wait).Wait(rod.Eval(`(input, sel, n) => (`+suggestionsJS+`)(input, sel).length >= n`, el.Object, optionSel, pick))
+	options, _ := page.ElementsByJS(rod.Eval(suggestionsJS, el.Object, optionSel))
+	if err != nil || len(options) < pick {
+		var labels []string
+		for _, o := range options {
+			labels = append(labels, fmt.Sprintf("  %q", strings.TrimSpace(o.MustText())))
+		}
+		if len(labels) == 0 {
+			fatal("no suggestions appeared for %q", positional[1])
+		}
+		fatal("only %d suggestions for %q:\n%s", len(options), positional[1], strings.Join(labels, "\n"))
+	}
+	option := options[pick-1]
+	label := strings.TrimSpace(option.MustText())
+
+	if click {
+		if err := option.Click(proto.InputMouseButtonLeft, 1); err != nil {
+			fatal("failed to click suggestion: %v", err)
+		}
+	} else {
+		for i := 0; i < pick; i++ {
+			if err := page.Keyboard.Type(input.ArrowDown); err != nil {
+				fatal("failed to press ArrowDown: %v", err)
+			}
+		}
+		if err := page.Keyboard.Type(input.Enter); err != nil {
+			fatal("failed to press Enter: %v", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("Selected: %s\n", label)
+}
+
+func cmdSubmit(args []string) {
+	if len(args) < 1 {
+		fatalUsage("usage: bb submit <selector>")
+	}
+	_, _, page := withPage()
+	_, err := page.Element(args[0])
+	if err != nil {
+		fatalNotFound(args[0], err)
+	}
+	page.MustEval(fmt.Sprintf(`() => document.querySelector(%q).submit()`, args[0]))
+	fmt.Println("Submitted")
+}
+
+func cmdHover(args []string) {
+	node, args := takeNodeFlag(args)
+	var target elementTarget
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		if next, ok := parseTargetFlag(args, i, &target); ok {
+			i = next
+			continue
+		}
+		positional = append(positional, args[i])
+	}
+	if len(positional) < 1 && node == 0 {
+		fatalUsage("usage: bb hover <selector>|--node <id> [--position P] [--offset dx,dy]")
+	}
+	selector := ""
+	if len(positional) > 0 {
+		selector = positional[0]
+	}
+	nodeOrSelector(node, selector)
+	_, _, page := withPage()
+	el, err := findElement(page, selector, node)
+	if err != nil {
+		fatalNoElement(selector, node, err)
+	}
+	if target.set {
+		x, y, err := elementPoint(el, target)
+		if err != nil {
+			fatal("hover failed: %v", err)
+		}
+		if err := page.Mouse.MoveTo(proto.Point{X: x, Y: y}); err != nil {
+			fatal("hover failed: %v", err)
+		}
+	} else {
+		el.MustHover()
+	}
+	fmt.Println("Hovered")
+}
+
+func cmdFocus(args []string) {
+	node, args := takeNodeFlag(args)
+	if len(args) < 1 && node == 0 {
+		fatalUsage("usage: bb focus <selector>|--node <id>")
+	}
+	selector := ""
+	if len(args) > 0 {
+		selector = args[0]
+	}
+	nodeOrSelector(node, selector)
+	_, _, page := withPage()
+	el, err := findElement(page, selector, node)
+	if err != nil {
+		fatalNoElement(selector, node, err)
+	}
+	el.MustFocus()
+	fmt.Println("Focused")
+}
+
+// parseCoords parses exactly n numeric viewport coordinates from args
+func parseCoords(args []string, n int, usage string) []float64 {
+	if len(args) < n {
+		fatalUsage("usage: %s", usage)
+	}
+	coords := make([]float64, n)
+	for i := 0; i < n; i++ {
+		v, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			fatalUsage("invalid coordinate %q: %v", args[i], err)
+		}
+		coords[i] = v
+	}
+	return coords
+}
+
+// dispatchMouse sends a raw Input.dispatchMouseEvent at viewport coordinates.
+// buttons is the bitmask of buttons held down (1 = left) during the event.
+func dispatchMouse(page *rod.Page, typ proto.InputDispatchMouseEventType, x, y float64, button proto.InputMouseButton, buttons, clickCount int) error {
+	return proto.InputDispatchMouseEvent{
+		Type:       typ,
+		X:          x,
+		Y:          y,
+		Button:     button,
+		Buttons:    &buttons,
+		ClickCount: clickCount,
+	}.Call(page)
+}
+
+// dragPath presses the left button at (x1, y1), moves to (x2, y2) in steps
+// so intermediate mousemove handlers fire, then releases
+func dragPath(page *rod.Page, x1, y1, x2, y2 float64, steps int) error {
+	if err := dispatchMouse(page, proto.InputDispatchMouseEventTypeMouseMoved, x1, y1, proto.InputMouseButtonNone, 0, 0); err != nil {
+		return err
+	}
+	if err := dispatchMouse(page, proto.InputDispatchMouseEventTypeMousePressed, x1, y1, proto.InputMouseButtonLeft, 1, 1); err != nil {
+		return err
+	}
+	for i := 1; i <= steps; i++ {
+		x := x1 + (x2-x1)*float64(i)/float64(steps)
+		y := y1 + (y2-y1)*float64(i)/float64(steps)
+		if err := dispatchMouse(page, proto.InputDispatchMouseEventTypeMouseMoved, x, y, proto.InputMouseButtonLeft, 1, 0); err != nil {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return dispatchMouse(page, proto.InputDispatchMouseEventTypeMouseReleased, x2, y2, proto.InputMouseButtonLeft, 0, 1)
+}
+
+func cmdClickAt(args []string) {
+	c := parseCoords(args, 2, "bb click-at <x> <y>")
+	_, _, page := withPage()
+	if err := dispatchMouse(page, proto.InputDispatchMouseEventTypeMouseMoved, c[0], c[1], proto.InputMouseButtonNone, 0, 0); err != nil {
+		fatal("mouse move failed: %v", err)
+	}
+	if err := dispatchMouse(page, proto.InputDispatchMouseEventTypeMousePressed, c[0], c[1], proto.InputMouseButtonLeft, 1, 1); err != nil {
+		fatal("mouse press failed: %v", err)
+	}
+	if err := dispatchMouse(page, proto.InputDispatchMouseEventTypeMouseReleased, c[0], c[1], proto.InputMouseButtonLeft, 0, 1); err != nil {
+		fatal("mouse release failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("Clicked at %g,%g\n", c[0], c[1])
+}
+
+func cmdMove(args []string) {
+	c := parseCoords(args, 2, "bb move <x> <y>")
+	_, _, page := withPage()
+	if err := dispatchMouse(page, proto.InputDispatchMouseEventTypeMouseMoved, c[0], c[1], proto.InputMouseButtonNone, 0, 0); err != nil {
+		fatal("mouse move failed: %v", err)
+	}
+	fmt.Printf("Moved to %g,%g\n", c[0], c[1])
+}
+
+func cmdDrag(args []string) {
+	c := parseCoords(args, 4, "bb drag <x1> <y1> <x2> <y2>")
+	_, _, page := withPage()
+	if err := dragPath(page, c[0], c[1], c[2], c[3], 10); err != nil {
+		fatal("drag failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("Dragged %g,%g -> %g,%g\n", c[0], c[1], c[2], c[3])
+}
+
+// elementCenter returns the center of el's layout box in viewport coordinates
+func elementCenter(el *rod.Element) (float64, float64, error) {
+	shape, err := el.Shape()
+	if err != nil {
+		return 0, 0, err
+	}
+	box := shape.Box()
+	if box == nil {
+		return 0, 0, fmt.Errorf("element has no layout box")
+	}
+	return box.X + box.Width/2, box.Y + box.Height/2, nil
+}
+
+// takeNodeFlag removes --node <backendNodeId> from args and returns the id
+// (0 without the flag)
+func takeNodeFlag(args []string) (int, []string) {
+	var rest []string
+	node := 0
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--node" {
+			rest = append(rest, args[i])
+			continue
+		}
+		i++
+		if i >= len(args) {
+			fatalUsage("missing value for --node")
+		}
+		v, err := strconv.Atoi(args[i])
+		if err != nil || v < 1 {
+			fatalUsage("invalid backendNodeId: %s", args[i])
+		}
+		node = v
+	}
+	return node, rest
+}
+
+// nodeOrSelector refuses a selector given along with --node
+func nodeOrSelector(node int, selector string) {
+	if node != 0 && selector != "" {
+		fail(exitUsage, selector, "--node %d and selector %s both given; use one of them", node, selector)
+	}
+}
+
+// findElement returns the element with backendNodeId node (as ax-find and
+// ax-tree print it) when set, else the one matching selector
+func findElement(page *rod.Page, selector string, node int) (*rod.Element, error) {
+	if node == 0 {
+		return page.Element(selector)
+	}
+	res, err := proto.DOMResolveNode{BackendNodeID: proto.DOMBackendNodeID(node)}.Call(page)
+	if err != nil {
+		return nil, fmt.Errorf("no node with backendNodeId %d (ids change when the page reloads): %w", node, err)
+	}
+	el, err := page.ElementFromObject(res.Object)
+	if err != nil {
+		return nil, fmt.Errorf("node with backendNodeId %d: %w", node, err)
+	}
+	return el, nil
+}
+
+// fatalNoElement reports a failed findElement, by the node id for --node
+func fatalNoElement(selector string, node int, err error) {
+	if node != 0 {
+		fail(exitNotFound, "", "%v", err)
+	}
+	fatalNotFound(selector, err)
+}
+
+// elementTarget selects a point inside an element for pointer actions
+type elementTarget struct {
+	position string // topleft, topright, center, bottomleft, bottomright
+	dx, dy   float64
+	set      bool
+}
+
+// parseTargetFlag consumes --position or --offset at args[i]. It returns the
+// index of the last consumed argument and false if args[i] is not one of them.
+func parseTargetFlag(args []string, i int, t *elementTarget) (int, bool) {
+	switch args[i] {
+	case "--position":
+		i++
+		if i >= len(args) {
+			fatalUsage("missing value for --position")
+		}
+		switch args[i] {
+		case "topleft", "topright", "center", "bottomleft", "bottomright":
+			t.position = args[i]
+		default:
+			fatalUsage("invalid position %q (expected topleft, topright, center, bottomleft or bottomright)", args[i])
+		}
+		t.set = true
+		return i, true
+	case "--offset":
+		i++
+		if i >= len(args) {
+			fatalUsage("missing value for --offset")
+		}
+		parts := strings.Split(args[i], ",")
+		if len(parts) != 2 {
+			fatalUsage("invalid offset %q (expected dx,dy)", args[i])
+		}
+		coords := parseCoords(parts, 2, "--offset dx,dy")
+		t.dx, t.dy = coords[0], coords[1]
+		t.set = true
+		return i, true
+	}
+	return i, false
+}
+
+// elementPoint scrolls el into view and returns the viewport coordinates of
+// the target point: the anchor given by position (default center) plus the offset
+func elementPoint(el *rod.Element, t elementTarget) (float64, float64, error) {
+	if err := el.ScrollIntoView(); err != nil {
+		return 0, 0, err
 	}
-	_, _, page := withPage()
-	el, err := page.Element(args[0])
+	shape, err := el.Shape()
 	if err != nil {
-		fatal("element not found: %v", err)
-	}
-	el.MustSelectAllText().MustInput("")
-	fmt.Println("Cleared")
+		return 0, 0, err
+	}
+	box := shape.Box()
+	if box == nil {
+		return 0, 0, fmt.Errorf("element has no layout box")
+	}
+	// Corners are inset by a pixel so the point still hits the element
+	x, y := box.X+box.Width/2, box.Y+box.Height/2
+	switch t.position {
+	case "topleft":
+		x, y = box.X+1, box.Y+1
+	case "topright":
+		x, y = box.X+box.Width-1, box.Y+1
+	case "bottomleft":
+		x, y = box.X+1, box.Y+box.Height-1
+	case "bottomright":
+		x, y = box.X+box.Width-1, box.Y+box.Height-1
+	}
+	return x + t.dx, y + t.dy, nil
 }
 
-func cmdSelect(args []string) {
-	if len(args) < 2 {
-		fatal("usage: bb select <selector> <value>")
+// html5DragJS replays the HTML5 drag-and-drop event sequence with a shared
+// DataTransfer, for draggable="true" widgets that ignore pointer events
+const html5DragJS = `function(target) {
+	const dt = new DataTransfer();
+	const fire = (el, type) => {
+		const r = el.getBoundingClientRect();
+		el.dispatchEvent(new DragEvent(type, {
+			bubbles: true, cancelable: true, dataTransfer: dt,
+			clientX: r.left + r.width / 2, clientY: r.top + r.height / 2,
+		}));
+	};
+	fire(this, 'dragstart');
+	fire(target, 'dragenter');
+	fire(target, 'dragover');
+	fire(target, 'drop');
+	fire(this, 'dragend');
+}`
+
+func cmdDragDrop(args []string) {
+	mode := ""
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--mode":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --mode")
+			}
+			mode = args[i]
+			if mode != "pointer" && mode != "html5" {
+				fatalUsage("invalid mode %q (expected pointer or html5)", mode)
+			}
+		default:
+			positional = append(positional, args[i])
+		}
 	}
-	_, _, page := withPage()
-	js := fmt.Sprintf(`() => {
-		const el = document.querySelector(%q);
-		if (!el) throw new Error('element not found');
-		el.value = %q;
-		el.dispatchEvent(new Event('change', {bubbles: true}));
-		return el.value;
-	}`, args[0], args[1])
-	result, err := page.Eval(js)
-	if err != nil {
-		fatal("select failed: %v", err)
+	if len(positional) < 2 {
+		fatalUsage("usage: bb dragdrop <source-selector> <target-selector> [--mode pointer|html5]")
 	}
-	fmt.Printf("Selected: %s\n", result.Value.Str())
-}
 
-func cmdSubmit(args []string) {
-	if len(args) < 1 {
-		fatal("usage: bb submit <selector>")
-	}
 	_, _, page := withPage()
-	_, err := page.Element(args[0])
+	src, err := page.Element(positional[0])
 	if err != nil {
-		fatal("form not found: %v", err)
-	}
-	page.MustEval(fmt.Sprintf(`() => document.querySelector(%q).submit()`, args[0]))
-	fmt.Println("Submitted")
-}
-
-func cmdHover(args []string) {
-	if len(args) < 1 {
-		fatal("usage: bb hover <selector>")
+		fatalNotFound(positional[0], err)
 	}
-	_, _, page := withPage()
-	el, err := page.Element(args[0])
+	dst, err := page.Element(positional[1])
 	if err != nil {
-		fatal("element not found: %v", err)
+		fatalNotFound(positional[1], err)
 	}
-	el.MustHover()
-	fmt.Println("Hovered")
-}
 
-func cmdFocus(args []string) {
-	if len(args) < 1 {
-		fatal("usage: bb focus <selector>")
+	// Native HTML5 drags can't be started by synthetic mouse input in headless
+	// Chrome, so draggable elements get the drag-event sequence instead
+	if mode == "" {
+		mode = "pointer"
+		if draggable, err := src.Property("draggable"); err == nil && draggable.Bool() {
+			mode = "html5"
+		}
 	}
-	_, _, page := withPage()
-	el, err := page.Element(args[0])
-	if err != nil {
-		fatal("element not found: %v", err)
+
+	if mode == "html5" {
+		if _, err := src.Eval(html5DragJS, dst.Object); err != nil {
+			fatal("drag failed: %v", err)
+		}
+	} else {
+		if err := src.ScrollIntoView(); err != nil {
+			fatal("failed to scroll to source: %v", err)
+		}
+		x1, y1, err := elementCenter(src)
+		if err != nil {
+			fatal("failed to locate source: %v", err)
+		}
+		x2, y2, err := elementCenter(dst)
+		if err != nil {
+			fatal("failed to locate target: %v", err)
+		}
+		if err := dragPath(page, x1, y1, x2, y2, 15); err != nil {
+			fatal("drag failed: %v", err)
+		}
 	}
-	el.MustFocus()
-	fmt.Println("Focused")
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("Dropped (%s)\n", mode)
 }
 
 func cmdWait(args []string) {
 	if len(args) < 1 {
-		fatal("usage: bb wait <selector>")
+		fatalUsage("usage: bb wait <selector>")
 	}
 	_, _, page := withPage()
+	beginPhase("wait")
 	el, err := page.Element(args[0])
 	if err != nil {
-		fatal("element not found: %v", err)
+		fail(exitTimeout, args[0], "timed out waiting for %s", args[0])
 	}
 	el.MustWaitVisible()
 	fmt.Println("Element visible")
@@ -746,29 +2061,32 @@ func cmdWait(args []string) {
 
 func cmdWaitLoad() {
 	_, _, page := withPage()
+	beginPhase("wait")
 	page.MustWaitLoad()
 	fmt.Println("Page loaded")
 }
 
 func cmdWaitStable() {
 	_, _, page := withPage()
+	beginPhase("wait")
 	page.MustWaitStable()
 	fmt.Println("DOM stable")
 }
 
 func cmdWaitIdle() {
 	_, _, page := withPage()
+	beginPhase("wait")
 	page.MustWaitIdle()
 	fmt.Println("Network idle")
 }
 
 func cmdSleep(args []string) {
 	if len(args) < 1 {
-		fatal("usage: bb sleep <seconds>")
+		fatalUsage("usage: bb sleep <seconds>")
 	}
 	secs, err := strconv.ParseFloat(args[0], 64)
 	if err != nil {
-		fatal("invalid seconds: %v", err)
+		fatalUsage("invalid seconds: %v", err)
 	}
 	time.Sleep(time.Duration(secs * float64(time.Second)))
 }
@@ -792,40 +2110,92 @@ func cmdScreenshot(args []string) {
 	width := 1280
 	height := 0
 	fullPage := true
+	var imgOpts imageOptions
+	var clip *proto.PageViewport
+	stitch := "" // "", "image" or "tiles"
+	around := ""
+	padding := 20.0
+	annotate := false
 
 	var positional []string
 	for i := 0; i < len(args); i++ {
+		if next, ok := parseImageFlag(args, i, &imgOpts); ok {
+			i = next
+			continue
+		}
 		switch args[i] {
 		case "-w", "--width":
 			i++
 			if i >= len(args) {
-				fatal("missing value for %s", args[i-1])
+				fatalUsage("missing value for %s", args[i-1])
 			}
 			v, err := strconv.Atoi(args[i])
 			if err != nil {
-				fatal("invalid width: %v", err)
+				fatalUsage("invalid width: %v", err)
 			}
 			width = v
 		case "-h", "--height":
 			i++
 			if i >= len(args) {
-				fatal("missing value for %s", args[i-1])
+				fatalUsage("missing value for %s", args[i-1])
 			}
 			v, err := strconv.Atoi(args[i])
 			if err != nil {
-				fatal("invalid height: %v", err)
+				fatalUsage("invalid height: %v", err)
 			}
 			height = v
 			fullPage = false
+		case "--clip":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --clip")
+			}
+			c, err := parseClip(args[i])
+			if err != nil {
+				fatalUsage("invalid --clip: %v", err)
+			}
+			clip = c
+		case "--around":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --around")
+			}
+			around = args[i]
+		case "--padding":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --padding")
+			}
+			v, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || v < 0 {
+				fatalUsage("invalid padding: %s", args[i])
+			}
+			padding = v
+		case "--annotate":
+			annotate = true
+		case "--stitch":
+			stitch = "image"
+		case "--stitch=tiles":
+			stitch = "tiles"
 		default:
 			positional = append(positional, args[i])
 		}
 	}
 
+	if (stitch != "" && (clip != nil || around != "")) || (clip != nil && around != "") {
+		fatalUsage("--stitch, --clip and --around can't be combined")
+	}
 	if len(positional) > 0 {
 		file = positional[0]
+		imgOpts.inferFormat(file)
 	} else {
-		file = nextAvailableFile("screenshot", ".png")
+		file = nextAvailableFile(filepath.Join(outputDir(), "screenshot"), imgOpts.ext())
+	}
+	if stitch == "tiles" && file == "-" {
+		fatalUsage("--stitch=tiles writes several files and can't write to stdout")
+	}
+	if annotate && (file == "-" || stitch != "") {
+		fatalUsage("--annotate writes a JSON sidecar and can't be combined with stdout output or --stitch")
 	}
 
 	_, _, page := withPage()
@@ -843,36 +2213,133 @@ func cmdScreenshot(args []string) {
 		fatal("failed to set viewport: %v", err)
 	}
 
-	data, err := page.Screenshot(fullPage, nil)
+	if stitch != "" {
+		screenshotStitched(page, file, stitch == "tiles", imgOpts)
+		return
+	}
+
+	if around != "" {
+		c, err := clipAroundText(page, around, padding)
+		if err != nil {
+			fatal("%v", err)
+		}
+		clip = c
+	}
+	var req *proto.PageCaptureScreenshot
+	if clip != nil {
+		// The clip is in document coordinates and may lie outside the viewport
+		req = &proto.PageCaptureScreenshot{Clip: clip, CaptureBeyondViewport: true}
+		fullPage = false
+	}
+	var marks []mark
+	if annotate {
+		marks = addMarks(page, fullPage || clip != nil)
+	}
+	data, err := page.Screenshot(fullPage, req)
+	if annotate {
+		removeMarks(page)
+	}
+	if err != nil {
+		fatal("screenshot failed: %v", err)
+	}
+	if data, err = processImage(data, imgOpts); err != nil {
+		fatal("failed to process screenshot: %v", err)
+	}
+	if file == "-" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		fatal("failed to write screenshot: %v", err)
+	}
+	recordArtifact("screenshot", file)
+	fmt.Println(file)
+	if annotate {
+		fmt.Printf("%d elements marked, see %s\n", len(marks), writeMarks(file, marks))
+	}
+}
+
+// screenshotStitched captures the page viewport by viewport and writes either
+// one composite image or one numbered file per tile
+func screenshotStitched(page *rod.Page, file string, separate bool, imgOpts imageOptions) {
+	tiles, err := captureTiles(page)
 	if err != nil {
 		fatal("screenshot failed: %v", err)
 	}
+
+	if separate {
+		ext := filepath.Ext(file)
+		base := strings.TrimSuffix(file, ext)
+		for i, tile := range tiles {
+			data, err := encodeImage(tile, imgOpts)
+			if err != nil {
+				fatal("failed to encode screenshot: %v", err)
+			}
+			name := fmt.Sprintf("%s-%d%s", base, i+1, ext)
+			if err := os.WriteFile(name, data, 0644); err != nil {
+				fatal("failed to write screenshot: %v", err)
+			}
+			recordArtifact("screenshot", name)
+			fmt.Println(name)
+		}
+		return
+	}
+
+	data, err := encodeImage(stitchTiles(tiles), imgOpts)
+	if err != nil {
+		fatal("failed to encode screenshot: %v (try --stitch=tiles)", err)
+	}
+	if file == "-" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
 	if err := os.WriteFile(file, data, 0644); err != nil {
 		fatal("failed to write screenshot: %v", err)
 	}
+	recordArtifact("screenshot", file)
 	fmt.Println(file)
 }
 
 func cmdScreenshotEl(args []string) {
-	if len(args) < 1 {
-		fatal("usage: bb screenshot-el <selector> [file]")
+	var imgOpts imageOptions
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		if next, ok := parseImageFlag(args, i, &imgOpts); ok {
+			i = next
+			continue
+		}
+		positional = append(positional, args[i])
 	}
-	file := "element.png"
-	if len(args) > 1 {
-		file = args[1]
+	if len(positional) < 1 {
+		fatalUsage("usage: bb screenshot-el <selector> [file]")
+	}
+	file := "element" + imgOpts.ext()
+	if len(positional) > 1 {
+		file = positional[1]
+		imgOpts.inferFormat(file)
+	} else if dir := outputDir(); dir != "" {
+		file = nextAvailableFile(filepath.Join(dir, "element"), imgOpts.ext())
 	}
 	_, _, page := withPage()
-	el, err := page.Element(args[0])
+	el, err := page.Element(positional[0])
 	if err != nil {
-		fatal("element not found: %v", err)
+		fatalNotFound(positional[0], err)
 	}
 	data, err := el.Screenshot(proto.PageCaptureScreenshotFormatPng, 0)
 	if err != nil {
 		fatal("screenshot failed: %v", err)
 	}
+	if data, err = processImage(data, imgOpts); err != nil {
+		fatal("failed to process screenshot: %v", err)
+	}
+	if file == "-" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
 	if err := os.WriteFile(file, data, 0644); err != nil {
 		fatal("failed to write screenshot: %v", err)
 	}
+	recordArtifact("screenshot", file)
 	fmt.Printf("Saved %s (%d bytes)\n", file, len(data))
 }
 
@@ -883,9 +2350,11 @@ func cmdPages(flags globalFlags) {
 		fatal("failed to list pages: %v", err)
 	}
 
+	active := activePageIndex(s, pages)
 	if flags.jsonOutput {
 		type pageInfo struct {
 			Index  int    `json:"index"`
+			ID     string `json:"id"`
 			Active bool   `json:"active"`
 			Title  string `json:"title"`
 			URL    string `json:"url"`
@@ -893,7 +2362,7 @@ func cmdPages(flags globalFlags) {
 		var items []pageInfo
 		for i, p := range pages {
 			info, _ := p.Info()
-			pi := pageInfo{Index: i, Active: i == s.ActivePage}
+			pi := pageInfo{Index: i, ID: string(p.TargetID), Active: i == active}
 			if info != nil {
 				pi.Title = info.Title
 				pi.URL = info.URL
@@ -907,35 +2376,32 @@ func cmdPages(flags globalFlags) {
 
 	for i, p := range pages {
 		marker := " "
-		if i == s.ActivePage {
+		if i == active {
 			marker = "*"
 		}
 		info, _ := p.Info()
 		if info != nil {
-			fmt.Printf("%s [%d] %s - %s\n", marker, i, info.Title, info.URL)
+			fmt.Printf("%s [%d] %s %s - %s\n", marker, i, shortID(p), info.Title, info.URL)
 		} else {
-			fmt.Printf("%s [%d] (unknown)\n", marker, i)
+			fmt.Printf("%s [%d] %s (unknown)\n", marker, i, shortID(p))
 		}
 	}
 }
 
 func cmdPage(args []string) {
 	if len(args) < 1 {
-		fatal("usage: bb page <index>")
-	}
-	idx, err := strconv.Atoi(args[0])
-	if err != nil {
-		fatal("invalid index: %v", err)
+		fatalUsage("usage: bb page <index|id>")
 	}
 	s, browser := ensureBrowser()
 	pages, err := browser.Pages()
 	if err != nil {
 		fatal("failed to list pages: %v", err)
 	}
-	if idx < 0 || idx >= len(pages) {
-		fatal("page index %d out of range (0-%d)", idx, len(pages)-1)
+	idx, err := resolvePage(args[0], pages)
+	if err != nil {
+		fatal("%v", err)
 	}
-	s.ActivePage = idx
+	setActivePage(s, idx, pages[idx])
 	if err := saveState(s); err != nil {
 		fatal("failed to save state: %v", err)
 	}
@@ -946,36 +2412,67 @@ func cmdPage(args []string) {
 }
 
 func cmdNewPage(args []string) {
-	s, browser := ensureBrowser()
-
+	background := false
 	u := ""
-	if len(args) > 0 {
-		u = args[0]
-		if !strings.Contains(u, "://") {
-			u = "https://" + u
+	for _, a := range args {
+		switch {
+		case a == "--background":
+			background = true
+		case u == "" && !strings.HasPrefix(a, "--"):
+			u = a
+		default:
+			fatalUsage("usage: bb newpage [url] [--background]")
 		}
 	}
+	if background && u == "" {
+		fatalUsage("bb newpage --background needs a url")
+	}
+	if u != "" && !strings.Contains(u, "://") {
+		u = "https://" + u
+	}
 
-	page := stealth.MustPage(browser)
+	s, browser := ensureBrowser()
+	var page *rod.Page
+	if background {
+		// A worker tab, as far as this invocation goes
+		page = configurePage(stealth.MustPage(browser))
+	} else {
+		page = activatePage(stealth.MustPage(browser))
+	}
 	if u != "" {
+		prepareNavigation(page, u, false)
 		if err := page.Navigate(u); err != nil {
 			fatal("navigation failed: %v", err)
 		}
 		page.MustWaitLoad()
+		reportAutoConsent(page)
 	}
 
 	pages, _ := browser.Pages()
+	idx := 0
 	for i, p := range pages {
 		if p.TargetID == page.TargetID {
+			idx = i
+		} else if background && string(p.TargetID) == s.ActiveTarget {
+			// The active page keeps its id, but its index may have moved
 			s.ActivePage = i
-			break
 		}
 	}
+	if !background {
+		setActivePage(s, idx, page)
+	}
 	_ = saveState(s)
+	if u != "" {
+		recordNavigation(page)
+	}
 
 	info, _ := page.Info()
 	if info != nil {
-		fmt.Printf("Opened [%d] %s\n", s.ActivePage, info.URL)
+		if background {
+			fmt.Printf("Opened [%d] %s %s in the background\n", idx, shortID(page), info.URL)
+		} else {
+			fmt.Printf("Opened [%d] %s\n", s.ActivePage, info.URL)
+		}
 	}
 }
 
@@ -989,31 +2486,38 @@ func cmdClosePage(args []string) {
 		fatal("cannot close the last page")
 	}
 
-	idx := s.ActivePage
+	active := activePageIndex(s, pages)
+	idx := active
 	if len(args) > 0 {
-		idx, err = strconv.Atoi(args[0])
+		idx, err = resolvePage(args[0], pages)
 		if err != nil {
-			fatal("invalid index: %v", err)
+			fatal("%v", err)
 		}
 	}
 	if idx < 0 || idx >= len(pages) {
 		fatal("page index %d out of range", idx)
 	}
 
+	closed := shortID(pages[idx])
 	pages[idx].MustClose()
-	if s.ActivePage >= len(pages)-1 {
-		s.ActivePage = len(pages) - 2
-	}
-	if s.ActivePage < 0 {
-		s.ActivePage = 0
+	remaining := append(pages[:idx:idx], pages[idx+1:]...)
+	pruneHistory(s, remaining)
+	// The active page stays active; closing it activates its neighbour
+	switch {
+	case active > idx:
+		active--
+	case active == idx:
+		active = min(idx, len(remaining)-1)
 	}
+	active = max(0, min(active, len(remaining)-1))
+	setActivePage(s, active, remaining[active])
 	_ = saveState(s)
-	fmt.Printf("Closed page %d\n", idx)
+	fmt.Printf("Closed page %d (%s)\n", idx, closed)
 }
 
 func cmdExists(args []string) {
 	if len(args) < 1 {
-		fatal("usage: bb exists <selector>")
+		fatalUsage("usage: bb exists <selector>")
 	}
 	_, _, page := withPage()
 	has, _, err := page.Has(args[0])
@@ -1022,16 +2526,16 @@ func cmdExists(args []string) {
 	}
 	if has {
 		fmt.Println("true")
-		os.Exit(0)
+		exit(0)
 	} else {
 		fmt.Println("false")
-		os.Exit(1)
+		exit(exitFalse)
 	}
 }
 
 func cmdCount(args []string) {
 	if len(args) < 1 {
-		fatal("usage: bb count <selector>")
+		fatalUsage("usage: bb count <selector>")
 	}
 	_, _, page := withPage()
 	els, err := page.Elements(args[0])
@@ -1043,25 +2547,57 @@ func cmdCount(args []string) {
 
 func cmdVisible(args []string) {
 	if len(args) < 1 {
-		fatal("usage: bb visible <selector>")
+		fatalUsage("usage: bb visible <selector>")
 	}
 	_, _, page := withPage()
 	el, err := page.Element(args[0])
 	if err != nil {
 		fmt.Println("false")
-		os.Exit(1)
+		exit(exitFalse)
 	}
 	visible, err := el.Visible()
 	if err != nil {
 		fmt.Println("false")
-		os.Exit(1)
+		exit(exitFalse)
 	}
 	if visible {
 		fmt.Println("true")
 	} else {
 		fmt.Println("false")
-		os.Exit(1)
+		exit(exitFalse)
+	}
+}
+
+// probeJS checks many selectors in one round trip. An element counts as
+// visible when it has a box and isn't hidden by visibility or display.
+const probeJS = `(selectors) => {
+	const visible = el => {
+		if (el.checkVisibility) return el.checkVisibility({visibilityProperty: true});
+		const r = el.getBoundingClientRect();
+		return r.width > 0 && r.height > 0 && getComputedStyle(el).visibility !== 'hidden';
+	};
+	const result = {};
+	for (const sel of selectors) {
+		try {
+			const els = Array.from(document.querySelectorAll(sel));
+			result[sel] = {exists: els.length > 0, visible: els.some(visible), count: els.length};
+		} catch (e) {
+			result[sel] = {exists: false, visible: false, count: 0, error: 'invalid selector'};
+		}
+	}
+	return result;
+}`
+
+func cmdProbe(args []string) {
+	if len(args) < 1 {
+		fatalUsage("usage: bb probe <selector> [selector...]")
+	}
+	_, _, page := withPage()
+	res, err := page.Eval(probeJS, args)
+	if err != nil {
+		fatal("query failed: %v", err)
 	}
+	fmt.Println(res.Value.JSON("", "  "))
 }
 
 func cmdStatus(flags globalFlags) {
@@ -1084,17 +2620,19 @@ func cmdStatus(flags globalFlags) {
 		return
 	}
 	pages, _ := browser.Pages()
+	active := activePageIndex(s, pages)
 
 	if flags.jsonOutput {
 		type pageInfo struct {
 			Index  int    `json:"index"`
+			ID     string `json:"id"`
 			Active bool   `json:"active"`
 			Title  string `json:"title"`
 			URL    string `json:"url"`
 		}
 		var items []pageInfo
 		for i, p := range pages {
-			pi := pageInfo{Index: i, Active: i == s.ActivePage}
+			pi := pageInfo{Index: i, ID: string(p.TargetID), Active: i == active}
 			if info, _ := p.Info(); info != nil {
 				pi.Title = info.Title
 				pi.URL = info.URL
@@ -1105,14 +2643,14 @@ func cmdStatus(flags globalFlags) {
 			"running":     true,
 			"pid":         s.ChromePID,
 			"pages":       items,
-			"active_page": s.ActivePage,
+			"active_page": active,
 		}, "", "  ")
 		fmt.Println(string(out))
 		return
 	}
 
 	fmt.Printf("Browser running (PID %d)\n", s.ChromePID)
-	fmt.Printf("Pages: %d, Active: %d\n", len(pages), s.ActivePage)
+	fmt.Printf("Pages: %d, Active: %d\n", len(pages), active)
 	if page, err := getActivePage(browser, s); err == nil {
 		if info, _ := page.Info(); info != nil {
 			fmt.Printf("Current: %s - %s\n", info.Title, info.URL)
@@ -1128,7 +2666,7 @@ func getActivePage(browser *rod.Browser, s *State) (*rod.Page, error) {
 	if len(pages) == 0 {
 		return nil, fmt.Errorf("no pages open")
 	}
-	idx := s.ActivePage
+	idx := activePageIndex(s, pages)
 	if idx < 0 || idx >= len(pages) {
 		idx = 0
 	}
@@ -1148,7 +2686,7 @@ func cmdCDP(args []string) {
 	args = filtered
 
 	if len(args) < 1 {
-		fatal("usage: bb cdp [--browser] <method> [params-json]")
+		fatalUsage("usage: bb cdp [--browser] <method> [params-json]")
 	}
 	method := args[0]
 
@@ -1156,7 +2694,7 @@ func cmdCDP(args []string) {
 	if len(args) > 1 {
 		raw := strings.Join(args[1:], " ")
 		if !json.Valid([]byte(raw)) {
-			fatal("invalid JSON params: %s", raw)
+			fatalUsage("invalid JSON params: %s", raw)
 		}
 		params = json.RawMessage(raw)
 	}
@@ -1184,16 +2722,39 @@ func cmdCDP(args []string) {
 	fmt.Println(pretty.String())
 }
 
-func cmdStop() {
+func cmdStop(args []string) {
+	save := ""
+	for _, a := range args {
+		switch {
+		case a == "--save-session":
+			save = savedSessionPath()
+		case strings.HasPrefix(a, "--save-session="):
+			save = strings.TrimPrefix(a, "--save-session=")
+		default:
+			fatalUsage("usage: bb stop [--save-session[=file]]")
+		}
+	}
 	s, err := loadState()
+	if errors.Is(err, errNoPassphrase) {
+		fatal("%s: %v", statePath(), err)
+	}
 	if err != nil {
 		fmt.Println("No active browser session")
 		return
 	}
 	browser := rod.New().ControlURL(s.DebugURL)
 	if err := browser.Connect(); err == nil {
+		// Snapshot the tabs before closing so stopping to free memory can be undone
+		if save != "" {
+			bundle := collectSession(s, browser)
+			writeSession(save, bundle)
+			fmt.Printf("Saved %d pages to %s (bb session restore brings them back)\n", len(bundle.Pages), save)
+		}
 		browser.MustClose()
 	} else if s.ChromePID > 0 {
+		if save != "" {
+			fmt.Fprintln(os.Stderr, "warning: the browser is not responding, no session saved")
+		}
 		if proc, err := os.FindProcess(s.ChromePID); err == nil {
 			_ = proc.Signal(syscall.SIGTERM)
 		}
@@ -1202,38 +2763,185 @@ func cmdStop() {
 	fmt.Println("Browser stopped")
 }
 
+// cmdRestart relaunches Chrome, picking up changed launch settings, and
+// reopens the tabs that were open. Cookies and storage live in the profile;
+// bookmarks, artifacts, history and the clock carry over from the session.
+func cmdRestart() {
+	old, err := loadState()
+	if errors.Is(err, errNoPassphrase) {
+		fatal("%s: %v", statePath(), err)
+	}
+	var urls, targets []string
+	active := 0
+	if err == nil {
+		browser := rod.New().ControlURL(old.DebugURL)
+		if err := browser.Connect(); err == nil {
+			if pages, err := browser.Pages(); err == nil && len(pages) > 0 {
+				active = activePageIndex(old, pages)
+				for _, p := range pages {
+					u := ""
+					if info, err := p.Info(); err == nil {
+						u = info.URL
+					}
+					urls = append(urls, u)
+					targets = append(targets, string(p.TargetID))
+				}
+			}
+			_ = browser.Close()
+		}
+		waitForExit(old.ChromePID, 10*time.Second)
+		removeState()
+	}
+
+	s, browser := ensureBrowser()
+	existing, _ := browser.Pages()
+	renamed := map[string]string{}
+	var activePage *rod.Page
+	for i, u := range urls {
+		var page *rod.Page
+		if i == 0 && len(existing) == 1 {
+			page = activatePage(existing[0])
+		} else {
+			page = activatePage(stealth.MustPage(browser))
+		}
+		renamed[targets[i]] = string(page.TargetID)
+		if i == active {
+			activePage = page
+		}
+		if u == "" || u == "about:blank" {
+			continue
+		}
+		prepareNavigation(page, u, false)
+		if err := page.Navigate(u); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to reopen %s: %v\n", u, err)
+			continue
+		}
+		_ = page.WaitLoad()
+	}
+
+	if old != nil {
+		s.Clock, s.Artifacts, s.Marks = old.Clock, old.Artifacts, old.Marks
+		for _, e := range old.History {
+			if target, ok := renamed[e.Target]; ok {
+				e.Target = target
+				s.History = append(s.History, e)
+			}
+		}
+	}
+	if pages, err := browser.Pages(); err == nil && activePage != nil {
+		for i, p := range pages {
+			if p.TargetID == activePage.TargetID {
+				setActivePage(s, i, p)
+			}
+		}
+	}
+	if err := saveState(s); err != nil {
+		fatal("failed to save state: %v", err)
+	}
+	if len(urls) == 0 {
+		fmt.Println("Browser started")
+		return
+	}
+	fmt.Printf("Browser restarted, reopened %d tabs\n", len(urls))
+}
+
 // --- Accessibility commands ---
 
 func cmdAXTree(args []string, flags globalFlags) {
 	var depth *int
+	selector, interactive := "", false
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--depth":
 			i++
 			if i >= len(args) {
-				fatal("missing value for --depth")
+				fatalUsage("missing value for --depth")
 			}
 			v, err := strconv.Atoi(args[i])
 			if err != nil {
-				fatal("invalid depth: %v", err)
+				fatalUsage("invalid depth: %v", err)
 			}
 			depth = &v
+		case "--selector":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --selector")
+			}
+			selector = args[i]
+		case "--interactive":
+			interactive = true
 		default:
-			fatal("unknown flag: %s", args[i])
+			fatalUsage("unknown flag: %s", args[i])
 		}
 	}
 
 	_, _, page := withPage()
-	result, err := proto.AccessibilityGetFullAXTree{Depth: depth}.Call(page)
+	// A subtree or filter needs the whole tree; depth then counts from its root
+	fetchDepth := depth
+	if selector != "" || interactive {
+		fetchDepth = nil
+	}
+	var result *proto.AccessibilityGetFullAXTreeResult
+	fallback, err := axDomain(func() (err error) {
+		result, err = proto.AccessibilityGetFullAXTree{Depth: fetchDepth}.Call(page)
+		return err
+	})
 	if err != nil {
 		fatal("failed to get accessibility tree: %v", err)
 	}
+	var nodes []*proto.AccessibilityAXNode
+	switch {
+	case selector != "":
+		el, err := page.Element(selector)
+		if err != nil {
+			fatalNotFound(selector, nil)
+		}
+		if fallback {
+			if nodes, err = domAXTree(page, el, depth); err != nil {
+				fatal("%v", err)
+			}
+		} else {
+			node, err := proto.DOMDescribeNode{ObjectID: el.Object.ObjectID}.Call(page)
+			if err != nil {
+				fatal("failed to describe DOM node: %v", err)
+			}
+			nodes = axSubtree(result.Nodes, node.Node.BackendNodeID, depth)
+		}
+		if len(nodes) == 0 {
+			fail(exitNotFound, selector, "no accessibility node for %s", selector)
+		}
+	case fallback:
+		if nodes, err = domAXTree(page, nil, fetchDepth); err != nil {
+			fatal("%v", err)
+		}
+	default:
+		nodes = result.Nodes
+	}
+	if interactive {
+		matched := []*proto.AccessibilityAXNode{}
+		for _, n := range nodes {
+			if axInteractive(n) {
+				matched = append(matched, n)
+			}
+		}
+		if fallback {
+			resolveDOMAXNodes(page, matched)
+		}
+		nodes = matched
+		if flags.jsonOutput {
+			data, _ := json.MarshalIndent(nodes, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			fmt.Print(formatAXNodeList(nodes))
+		}
+		return
+	}
 
 	if flags.jsonOutput {
-		data, _ := json.MarshalIndent(result.Nodes, "", "  ")
+		data, _ := json.MarshalIndent(nodes, "", "  ")
 		fmt.Println(string(data))
 	} else {
-		fmt.Print(formatAXTree(result.Nodes))
+		fmt.Print(formatAXTree(nodes))
 	}
 }
 
@@ -1244,17 +2952,17 @@ func cmdAXFind(args []string, flags globalFlags) {
 		case "--name":
 			i++
 			if i >= len(args) {
-				fatal("missing value for --name")
+				fatalUsage("missing value for --name")
 			}
 			name = args[i]
 		case "--role":
 			i++
 			if i >= len(args) {
-				fatal("missing value for --role")
+				fatalUsage("missing value for --role")
 			}
 			role = args[i]
 		default:
-			fatal("unknown flag: %s", args[i])
+			fatalUsage("unknown flag: %s", args[i])
 		}
 	}
 
@@ -1266,7 +2974,7 @@ func cmdAXFind(args []string, flags globalFlags) {
 
 	if len(nodes) == 0 {
 		fmt.Fprintln(os.Stderr, "No matching nodes")
-		os.Exit(1)
+		exit(exitNotFound)
 	}
 
 	if flags.jsonOutput {
@@ -1279,7 +2987,7 @@ func cmdAXFind(args []string, flags globalFlags) {
 
 func cmdAXNode(args []string, flags globalFlags) {
 	if len(args) < 1 {
-		fatal("usage: bb ax-node <selector>")
+		fatalUsage("usage: bb ax-node <selector>")
 	}
 
 	_, _, page := withPage()
@@ -1304,15 +3012,34 @@ func queryAXNodes(page *rod.Page, name, role string) ([]*proto.AccessibilityAXNo
 	if err != nil {
 		return nil, fmt.Errorf("failed to get document: %w", err)
 	}
-	result, err := proto.AccessibilityQueryAXTree{
-		BackendNodeID:  doc.Root.BackendNodeID,
-		AccessibleName: name,
-		Role:           role,
-	}.Call(page)
+	var result *proto.AccessibilityQueryAXTreeResult
+	fallback, err := axDomain(func() (err error) {
+		result, err = proto.AccessibilityQueryAXTree{
+			BackendNodeID:  doc.Root.BackendNodeID,
+			AccessibleName: name,
+			Role:           role,
+		}.Call(page)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("accessibility query failed: %w", err)
 	}
-	return result.Nodes, nil
+	if !fallback {
+		return result.Nodes, nil
+	}
+	nodes, err := domAXTree(page, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Like the query, this matches the name and role exactly
+	var matched []*proto.AccessibilityAXNode
+	for _, n := range nodes {
+		if !n.Ignored && (name == "" || axValueStr(n.Name) == name) && (role == "" || axValueStr(n.Role) == role) {
+			matched = append(matched, n)
+		}
+	}
+	resolveDOMAXNodes(page, matched)
+	return matched, nil
 }
 
 func getAXNode(page *rod.Page, selector string) (*proto.AccessibilityAXNode, error) {
@@ -1324,13 +3051,29 @@ func getAXNode(page *rod.Page, selector string) (*proto.AccessibilityAXNode, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to describe DOM node: %w", err)
 	}
-	result, err := proto.AccessibilityGetPartialAXTree{
-		BackendNodeID:  node.Node.BackendNodeID,
-		FetchRelatives: false,
-	}.Call(page)
+	var result *proto.AccessibilityGetPartialAXTreeResult
+	fallback, err := axDomain(func() (err error) {
+		result, err = proto.AccessibilityGetPartialAXTree{
+			BackendNodeID:  node.Node.BackendNodeID,
+			FetchRelatives: false,
+		}.Call(page)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get accessibility info: %w", err)
 	}
+	if fallback {
+		zero := 0
+		nodes, err := domAXTree(page, el, &zero)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) == 0 {
+			return nil, fmt.Errorf("no accessibility node found for %q", selector)
+		}
+		nodes[0].BackendDOMNodeID = node.Node.BackendNodeID
+		return nodes[0], nil
+	}
 	for _, n := range result.Nodes {
 		if !n.Ignored {
 			return n, nil
@@ -1356,6 +3099,61 @@ func axValueStr(v *proto.AccessibilityAXValue) string {
 	return raw
 }
 
+// axSubtree returns the nodes under the AX node of a DOM node, that node
+// first, down to depth levels below it when depth is set
+func axSubtree(nodes []*proto.AccessibilityAXNode, backendID proto.DOMBackendNodeID, depth *int) []*proto.AccessibilityAXNode {
+	nodeByID := make(map[proto.AccessibilityAXNodeID]*proto.AccessibilityAXNode)
+	var root *proto.AccessibilityAXNode
+	for _, n := range nodes {
+		nodeByID[n.NodeID] = n
+		if root == nil && n.BackendDOMNodeID == backendID {
+			root = n
+		}
+	}
+	if root == nil {
+		return nil
+	}
+	var out []*proto.AccessibilityAXNode
+	var walk func(n *proto.AccessibilityAXNode, level int)
+	walk = func(n *proto.AccessibilityAXNode, level int) {
+		out = append(out, n)
+		if depth != nil && level >= *depth {
+			return
+		}
+		for _, id := range n.ChildIDs {
+			if c, ok := nodeByID[id]; ok {
+				walk(c, level+1)
+			}
+		}
+	}
+	walk(root, 0)
+	return out
+}
+
+// axInteractiveRoles are roles users act on, whether or not they take focus
+var axInteractiveRoles = map[string]bool{
+	"button": true, "link": true, "checkbox": true, "radio": true, "switch": true,
+	"textbox": true, "searchbox": true, "combobox": true, "listbox": true, "option": true,
+	"slider": true, "spinbutton": true, "menuitem": true, "menuitemcheckbox": true,
+	"menuitemradio": true, "tab": true, "treeitem": true,
+}
+
+// axInteractive reports whether a node can be focused or acted on
+func axInteractive(n *proto.AccessibilityAXNode) bool {
+	if n.Ignored {
+		return false
+	}
+	if axInteractiveRoles[axValueStr(n.Role)] {
+		return true
+	}
+	for _, p := range n.Properties {
+		if p.Name == proto.AccessibilityAXPropertyNameFocusable && axValueStr(p.Value) == "true" {
+			return true
+		}
+	}
+	return false
+}
+
 func formatAXTree(nodes []*proto.AccessibilityAXNode) string {
 	if len(nodes) == 0 {
 		return ""
@@ -1366,9 +3164,10 @@ func formatAXTree(nodes []*proto.AccessibilityAXNode) string {
 		nodeByID[n.NodeID] = n
 	}
 
+	// The root is the node whose parent isn't listed, so subtrees print too
 	var rootID proto.AccessibilityAXNodeID
 	for _, n := range nodes {
-		if n.ParentID == "" {
+		if _, ok := nodeByID[n.ParentID]; !ok {
 			rootID = n.NodeID
 			break
 		}
@@ -1,15 +1,51 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"maps"
+	"math"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+	"github.com/go-rod/rod/lib/launcher"
+	"golang.org/x/net/html"
+	"golang.org/x/net/websocket"
 )
 
 var (
@@ -39,11 +75,19 @@ const page2HTML = `<!DOCTYPE html>
 <a href="/">Back to home</a>
 </body></html>`
 
+const popupHTML = `<!DOCTYPE html>
+<html><head><title>Popup Opener</title></head>
+<body>
+<a id="pop" href="/page2" target="_blank">Open in new tab</a>
+<button id="late" onclick="setTimeout(() => window.open('/form'), 300)">Open later</button>
+</body></html>`
+
 const formHTML = `<!DOCTYPE html>
 <html><head><title>Form Page</title></head>
 <body>
 <h1>Form</h1>
 <form id="myform" action="/submitted" method="get">
+  <label for="name">Your name</label>
   <input id="name" type="text" name="name" value="" placeholder="Name">
   <textarea id="bio" name="bio"></textarea>
   <select id="color" name="color">
@@ -51,10 +95,198 @@ const formHTML = `<!DOCTYPE html>
     <option value="blue">Blue</option>
     <option value="green">Green</option>
   </select>
+  <select id="langs" name="langs" multiple>
+    <option value="de">German</option>
+    <option value="en">English</option>
+    <option value="fr">French</option>
+  </select>
+  <input id="agree" type="checkbox" name="agree">
   <button id="submitbtn" type="submit">Submit</button>
 </form>
 </body></html>`
 
+// twoFormsHTML has fields only a form-scoped path tells apart
+const twoFormsHTML = `<!DOCTYPE html>
+<html><head><title>Two Forms</title></head>
+<body>
+<form id="search"><input name="q"><input type="text"></form>
+<form id="signup">
+  <input name="q">
+  <div><input type="text"></div>
+  <div><input type="text"></div>
+</form>
+</body></html>`
+
+const consentHTML = `<!DOCTYPE html>
+<html><head><title>Consent</title></head>
+<body>
+<p>Article text</p>
+<script>
+setTimeout(function() {
+  var banner = document.createElement('div');
+  banner.id = 'banner';
+  banner.style.cssText = 'position:fixed;bottom:0;left:0;right:0;background:#eee';
+  banner.innerHTML = '<p>Wir verwenden Cookies.</p><button>Einstellungen</button> <button id="yes">Alle akzeptieren</button>';
+  document.body.appendChild(banner);
+  document.getElementById('yes').onclick = function() { window.consented = 'heuristic'; banner.remove(); };
+}, 300);
+</script>
+</body></html>`
+
+const consentRuleHTML = `<!DOCTYPE html>
+<html><head><title>Consent Rule</title></head>
+<body>
+<div id="onetrust-banner-sdk"><button id="onetrust-accept-btn-handler" onclick="window.consented = 'onetrust'; this.parentNode.remove()">OK</button></div>
+<button onclick="window.consented = 'wrong'">Accept</button>
+</body></html>`
+
+const clutterHTML = `<!DOCTYPE html>
+<html><head><title>Clutter</title>
+<style>
+body { overflow: hidden; margin: 0; }
+header { position: sticky; top: 0; height: 50px; background: #ddd; }
+#backdrop { position: fixed; inset: 0; background: rgba(0,0,0,.5); z-index: 100; }
+#modal { position: fixed; top: 20%; left: 20%; width: 60%; height: 40%; background: #fff; z-index: 101; }
+article { filter: blur(4px); }
+</style></head>
+<body>
+<header>Site Header</header>
+<article><p>The story that the overlay hides from view.</p></article>
+<div id="backdrop"></div>
+<div id="modal">Subscribe to keep reading</div>
+</body></html>`
+
+const tallHTML = `<!DOCTYPE html>
+<html><head><title>Tall Page</title></head>
+<body style="margin: 0">
+<div style="height: 5000px">Long read</div>
+</body></html>`
+
+const auditHTML = `<!DOCTYPE html>
+<html lang="en"><head><title>Audit Page</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+<h1>Audit</h1>
+<img id="logo" src="/img/pixel.png" width="20" height="20">
+<label for="q">Search</label> <input id="q"> <input id="unlabelled">
+<script>console.error('boom');</script>
+</body></html>`
+
+// fakeAxeJS stands in for axe-core: it reports images without alt text
+const fakeAxeJS = `var axe = {run: async (context, options) => ({violations: [{
+	id: 'image-alt', impact: 'critical', help: 'Images must have alternate text',
+	helpUrl: 'https://dequeuniversity.com/rules/axe/4.10/image-alt',
+	nodes: [...document.querySelectorAll('img:not([alt])')].map(img => ({target: ['#' + img.id], failureSummary: 'Fix any of the following'})),
+}]})};`
+
+const columnsHTML = `<!DOCTYPE html>
+<html><head><title>Columns</title>
+<style>body { margin: 20px; font: 16px/20px sans-serif; width: 800px; } .cols { display: flex; gap: 60px; } .cols div { width: 370px; }</style>
+</head>
+<body>
+<h1>Front Page</h1>
+<div class="cols">
+<div>Left column first line, which is long enough to wrap onto a second line of text.</div>
+<div>Right column text.</div>
+</div>
+</body></html>`
+
+const gridHTML = `<!DOCTYPE html>
+<html><head><title>Grid</title>
+<style>#body { height: 150px; overflow: auto; position: relative; } [role=row] { display: flex; height: 30px; } [role=row] > div { width: 120px; }</style>
+</head>
+<body>
+<div role="grid" aria-rowcount="101">
+<div role="row" aria-rowindex="1"><div role="columnheader">Name</div><div role="columnheader">Qty</div></div>
+<div id="body"><div id="rows" style="height: 3000px"></div></div>
+</div>
+<script>
+// Only the rows in view exist, as in AG Grid or MUI DataGrid
+const body = document.getElementById('body'), rows = document.getElementById('rows');
+function render() {
+  const first = Math.floor(body.scrollTop / 30);
+  rows.innerHTML = '';
+  for (let i = first; i < Math.min(100, first + 6); i++) {
+    rows.insertAdjacentHTML('beforeend', '<div role="row" aria-rowindex="' + (i + 2) + '" style="position: absolute; top: ' + i * 30 + 'px">' +
+      '<div role="gridcell">Item ' + (i + 1) + '</div><div role="gridcell">' + (i * 3) + '</div></div>');
+  }
+}
+body.addEventListener('scroll', render);
+render();
+</script>
+</body></html>`
+
+const snapshotHTML = `<!DOCTYPE html>
+<html><head><title>Snapshot</title></head>
+<body>
+<a href="/home">Home</a>
+<form id="login">
+<label>Email <input id="email" type="email" value="ann@example.com" required></label>
+<label><input type="checkbox" checked> Remember me</label>
+<button disabled>Sign in</button>
+</form>
+<input type="hidden" name="csrf" value="x">
+<div style="display:none"><button>Hidden</button></div>
+</body></html>`
+
+const virtualListHTML = `<!DOCTYPE html>
+<html><head><title>Feed</title>
+<style>#feed { height: 200px; overflow: auto; position: relative; } .post { position: absolute; height: 40px; }</style>
+</head>
+<body>
+<div id="feed"><div id="inner"></div></div>
+<script>
+// Mounts only the posts in view and loads 60 more at the bottom, up to 120
+const feed = document.getElementById('feed'), inner = document.getElementById('inner');
+let total = 60, loading = false;
+function render() {
+  inner.style.height = total * 40 + 'px';
+  const first = Math.floor(feed.scrollTop / 40);
+  inner.innerHTML = '';
+  for (let i = first; i < Math.min(total, first + 7); i++) {
+    inner.insertAdjacentHTML('beforeend', '<div class="post" data-index="' + i + '" style="top: ' + i * 40 + 'px">Post ' + (i + 1) + '</div>');
+  }
+  if (!loading && total < 120 && feed.scrollTop + feed.clientHeight >= feed.scrollHeight - 1) {
+    loading = true;
+    setTimeout(() => { total += 60; loading = false; render(); }, 300);
+  }
+}
+feed.addEventListener('scroll', render);
+render();
+</script>
+</body></html>`
+
+const audioHTML = `<!DOCTYPE html>
+<html><head><title>Audio</title></head>
+<body>
+<button id="beep">Beep</button>
+<button id="say">Say</button>
+<script>
+document.getElementById('beep').onclick = () => {
+  const ctx = new AudioContext();
+  const osc = ctx.createOscillator();
+  osc.connect(ctx.destination);
+  osc.start();
+  osc.stop(ctx.currentTime + 0.5);
+};
+document.getElementById('say').onclick = () => {
+  const u = new SpeechSynthesisUtterance('Order confirmed');
+  u.onend = () => { document.title = 'spoken'; };
+  speechSynthesis.speak(u);
+};
+</script>
+</body></html>`
+
+const cardPageHTML = `<!DOCTYPE html>
+<html><head><title>Card Page</title>
+<meta property="og:title" content="Card Title">
+<meta property="og:description" content="What the card says">
+<meta property="og:site_name" content="Card Site">
+<meta property="og:image" content="/card.png">
+</head>
+<body><p>Card</p></body></html>`
+
 const delayedHTML = `<!DOCTYPE html>
 <html><head><title>Delayed Page</title></head>
 <body>
@@ -91,6 +323,209 @@ const multiElHTML = `<!DOCTYPE html>
 <button id="btn" aria-label="Click Me" role="button">Click</button>
 </body></html>`
 
+const mouseHTML = `<!DOCTYPE html>
+<html><head><title>Mouse</title></head>
+<body style="margin:0">
+<div id="pad" style="width:400px;height:300px;background:#eee"></div>
+<script>
+window.events = [];
+['mousedown', 'mousemove', 'mouseup', 'click'].forEach(function(type) {
+  document.getElementById('pad').addEventListener(type, function(e) {
+    window.events.push(type + ':' + e.clientX + ',' + e.clientY);
+  });
+});
+['dblclick', 'contextmenu', 'auxclick'].forEach(function(type) {
+  document.getElementById('pad').addEventListener(type, function(e) {
+    e.preventDefault();
+    window.events.push(type + ':' + e.button);
+  });
+});
+</script>
+</body></html>`
+
+const dragHTML = `<!DOCTYPE html>
+<html><head><title>Drag</title></head>
+<body>
+<div id="card" draggable="true" style="width:80px;height:40px;background:#ccf">Card</div>
+<div id="handle" style="width:80px;height:40px;background:#cfc">Handle</div>
+<div id="zone" style="width:200px;height:100px;margin-top:50px;background:#fcc">Zone</div>
+<script>
+window.log = [];
+var zone = document.getElementById('zone');
+zone.addEventListener('dragover', function(e) { e.preventDefault(); });
+zone.addEventListener('drop', function(e) { window.log.push('drop'); });
+document.getElementById('handle').addEventListener('mousedown', function() { window.log.push('down'); });
+zone.addEventListener('mouseup', function() { window.log.push('up-on-zone'); });
+</script>
+</body></html>`
+
+const comboHTML = `<!DOCTYPE html>
+<html><head><title>Combo</title></head>
+<body>
+<button id="country" aria-haspopup="listbox" aria-controls="country-list">Choose</button>
+<ul id="country-list" role="listbox" style="display:none"></ul>
+<script>
+var btn = document.getElementById('country');
+var list = document.getElementById('country-list');
+btn.addEventListener('click', function() {
+  list.style.display = 'block';
+  setTimeout(function() {
+    list.innerHTML = '<li role="option">France</li><li role="option">Germany</li><li role="option">Spain</li>';
+    list.querySelectorAll('li').forEach(function(li) {
+      li.addEventListener('click', function() {
+        btn.textContent = li.textContent;
+        list.style.display = 'none';
+      });
+    });
+  }, 200);
+});
+</script>
+</body></html>`
+
+const autocompleteHTML = `<!DOCTYPE html>
+<html><head><title>Autocomplete</title></head>
+<body>
+<input id="city" role="combobox" aria-controls="city-list" autocomplete="off">
+<ul id="city-list" role="listbox"></ul>
+<script>
+var cities = ['Berlin', 'Bern', 'Bergen', 'Paris'];
+var input = document.getElementById('city');
+var list = document.getElementById('city-list');
+var active = -1;
+input.addEventListener('input', function() {
+  setTimeout(function() {
+    var q = input.value.toLowerCase();
+    list.innerHTML = '';
+    active = -1;
+    cities.filter(function(c) { return q && c.toLowerCase().startsWith(q); }).forEach(function(c) {
+      var li = document.createElement('li');
+      li.setAttribute('role', 'option');
+      li.textContent = c;
+      li.addEventListener('click', function() { input.value = c; list.innerHTML = ''; });
+      list.appendChild(li);
+    });
+  }, 150);
+});
+input.addEventListener('keydown', function(e) {
+  var opts = list.querySelectorAll('li');
+  if (e.key === 'ArrowDown') { active = Math.min(active + 1, opts.length - 1); }
+  if (e.key === 'Enter' && opts[active]) { input.value = opts[active].textContent; list.innerHTML = ''; }
+});
+</script>
+</body></html>`
+
+const editorHTML = `<!DOCTYPE html>
+<html><head><title>Editor</title></head>
+<body>
+<div id="editor"><div class="toolbar">B I U</div><div class="body" contenteditable="true"><p>old</p></div></div>
+</body></html>`
+
+const canvasHTML = `<!DOCTYPE html>
+<html><head><title>Canvas</title></head>
+<body>
+<canvas id="chart" width="100" height="50"></canvas>
+<script>
+var ctx = document.getElementById('chart').getContext('2d');
+ctx.fillStyle = '#ff0000';
+ctx.fillRect(0, 0, 50, 50);
+</script>
+</body></html>`
+
+const mediaHTML = `<!DOCTYPE html>
+<html><head><title>Media</title></head>
+<body>
+<audio id="player" src="/tone.wav" preload="auto"></audio>
+</body></html>`
+
+const paywallHTML = `<!DOCTYPE html>
+<html><head><title>Premium Story</title>
+<script type="application/ld+json">{"@type": "NewsArticle", "headline": "Premium Story", "isAccessibleForFree": "False"}</script>
+</head>
+<body>
+<article><h1>Premium Story</h1><p>The first paragraph of a story that continues behind the wall.</p></article>
+<div class="paywall-prompt">Subscribe to continue reading.</div>
+</body></html>`
+
+const loginWallHTML = `<!DOCTYPE html>
+<html><head><title>Members</title></head>
+<body>
+<p>Sign in to continue.</p>
+<form><input type="email" name="email"><input type="password" name="password"><button>Sign in</button></form>
+</body></html>`
+
+const metaHTML = `<!DOCTYPE html>
+<html lang="en"><head><title>Meta Page</title>
+<meta name="description" content="A page with metadata">
+<meta property="og:title" content="OG Title">
+<meta property="og:image" content="/a.png">
+<meta property="og:image" content="/b.png">
+<meta name="twitter:card" content="summary">
+<link rel="canonical" href="/canonical-article">
+<link rel="alternate" type="application/rss+xml" title="Feed" href="/feed.xml">
+<link rel="alternate" hreflang="de" href="/de/article">
+<script type="application/ld+json">{"@context": "https://schema.org", "@type": "Article", "headline": "LD Headline"}</script>
+</head>
+<body><p>Meta</p></body></html>`
+
+const ampTeaserHTML = `<!DOCTYPE html>
+<html><head><title>Teaser</title><link rel="amphtml" href="/amp-full"><link rel="canonical" href="/amp-teaser"></head>
+<body><p>Short teaser.</p></body></html>`
+
+const ampFullHTML = `<!DOCTYPE html>
+<html><head><title>Full Story</title><link rel="canonical" href="/amp-teaser"></head>
+<body><article><h1>Full Story</h1>
+<p>This is the complete article text that is only present on the AMP version of the page.</p>
+<p>It has several paragraphs so that readability recognizes it as the main content of the page.</p>
+<p>The AMP version of a news article is often easier to extract than the regular page.</p>
+</article></body></html>`
+
+const imagesHTML = `<!DOCTYPE html>
+<html><head><title>Images</title>
+<script>document.cookie = 'session=abc';</script>
+<style>#hero { width: 40px; height: 20px; background-image: url("/img/pixel.png"); }</style>
+</head>
+<body>
+<img id="plain" src="/img/pixel.png" alt="A pixel">
+<picture><source srcset="/img/pixel.png?picture"><img src="/img/missing.png"></picture>
+<img id="lazy" data-src="/img/lazy.png" alt="">
+<div id="hero"></div>
+</body></html>`
+
+const scopedHTML = `<!DOCTYPE html>
+<html><head><title>Scoped</title></head>
+<body>
+<nav>Home | About | Contact</nav>
+<article id="story"><h1>Story</h1>
+<p>The story itself has a few paragraphs of text so that it reads like an article.</p>
+<p>Readability should pick it out when the whole document is processed.</p>
+</article>
+<section id="comments">
+<div class="comment">First!</div>
+<div class="comment">Great read, thanks.</div>
+</section>
+</body></html>`
+
+// silentWAV returns a mono 8 kHz 16-bit PCM WAV file of the given length
+func silentWAV(seconds int) []byte {
+	samples := 8000 * seconds
+	var b bytes.Buffer
+	le := func(v interface{}) { _ = binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("RIFF")
+	le(uint32(36 + samples*2))
+	b.WriteString("WAVEfmt ")
+	le(uint32(16))
+	le(uint16(1))    // PCM
+	le(uint16(1))    // channels
+	le(uint32(8000)) // sample rate
+	le(uint32(16000))
+	le(uint16(2))
+	le(uint16(16))
+	b.WriteString("data")
+	le(uint32(samples * 2))
+	b.Write(make([]byte, samples*2))
+	return b.Bytes()
+}
+
 func TestMain(m *testing.M) {
 	// Set up test HTTP server
 	mux := http.NewServeMux()
@@ -106,10 +541,109 @@ func TestMain(m *testing.M) {
 		w.Header().Set("Content-Type", "text/html")
 		_, _ = fmt.Fprint(w, page2HTML)
 	})
+	mux.HandleFunc("/popup", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, popupHTML)
+	})
 	mux.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
 		_, _ = fmt.Fprint(w, formHTML)
 	})
+	mux.HandleFunc("/consent", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(consentHTML))
+	})
+	mux.HandleFunc("/consent-rule", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(consentRuleHTML))
+	})
+	mux.HandleFunc("/clutter", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(clutterHTML))
+	})
+	mux.HandleFunc("/tall", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(tallHTML))
+	})
+	mux.HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(auditHTML))
+	})
+	mux.HandleFunc("/axe.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte(fakeAxeJS))
+	})
+	mux.HandleFunc("/columns", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(columnsHTML))
+	})
+	mux.HandleFunc("/grid", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(gridHTML))
+	})
+	mux.HandleFunc("/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(snapshotHTML))
+	})
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(virtualListHTML))
+	})
+	mux.HandleFunc("/audio", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(audioHTML))
+	})
+	mux.HandleFunc("/csp", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Security-Policy", "script-src 'self'; style-src 'self'")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Strict</title></head><body><button id="btn">Go</button></body></html>`))
+	})
+	mux.HandleFunc("/wide", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Wide</title></head><body style="margin:0"><div style="width:500px;height:50px">Fixed width</div></body></html>`))
+	})
+	mux.HandleFunc("/card", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, cardPageHTML)
+	})
+	mux.HandleFunc("/card.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_ = png.Encode(w, image.NewNRGBA(image.Rect(0, 0, 400, 210)))
+	})
+	mux.HandleFunc("/long-article", func(w http.ResponseWriter, r *http.Request) {
+		paragraph := "<p>" + strings.Repeat("The committee met again on Tuesday to weigh the proposal, and members asked for more detail about costs. ", 4) + "</p>\n"
+		_, _ = fmt.Fprintf(w, `<!DOCTYPE html><html><head><title>Long Article</title></head><body>
+<nav><a href="/">Home</a> <a href="/page2">News</a></nav>
+<article><h1>Long Article</h1>
+%s</article></body></html>`, strings.Repeat(paragraph, 8))
+	})
+	mux.HandleFunc("/api/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		session := ""
+		if c, err := r.Cookie("session"); err == nil {
+			session = c.Value
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Echo", "1")
+		if code, err := strconv.Atoi(r.URL.Query().Get("status")); err == nil {
+			w.WriteHeader(code)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method, "header": r.Header.Get("X-Test"), "session": session, "body": string(body),
+		})
+	})
+	mux.Handle("/ws-echo", websocket.Handler(func(ws *websocket.Conn) {
+		_, _ = io.Copy(ws, ws)
+	}))
+	mux.HandleFunc("/two-forms", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(twoFormsHTML))
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+		w.Write([]byte("id,total\n1,42\n"))
+	})
 	mux.HandleFunc("/delayed", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
 		_, _ = fmt.Fprint(w, delayedHTML)
@@ -126,6 +660,111 @@ func TestMain(m *testing.M) {
 		w.Header().Set("Content-Type", "text/html")
 		_, _ = fmt.Fprint(w, multiElHTML)
 	})
+	mux.HandleFunc("/mouse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, mouseHTML)
+	})
+	mux.HandleFunc("/drag", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, dragHTML)
+	})
+	mux.HandleFunc("/combo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, comboHTML)
+	})
+	mux.HandleFunc("/autocomplete", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, autocompleteHTML)
+	})
+	mux.HandleFunc("/editor", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, editorHTML)
+	})
+	mux.HandleFunc("/canvas", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, canvasHTML)
+	})
+	mux.HandleFunc("/media", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, mediaHTML)
+	})
+	mux.HandleFunc("/paywall", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, paywallHTML)
+	})
+	mux.HandleFunc("/loginwall", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, loginWallHTML)
+	})
+	mux.HandleFunc("/meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, metaHTML)
+	})
+	mux.HandleFunc("/amp-teaser", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, ampTeaserHTML)
+	})
+	mux.HandleFunc("/amp-full", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, ampFullHTML)
+	})
+	mux.HandleFunc("/images", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, imagesHTML)
+	})
+	mux.HandleFunc("/img/", func(w http.ResponseWriter, r *http.Request) {
+		// Images are only served to the page's session
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+		_ = png.Encode(w, img)
+	})
+	mux.HandleFunc("/scoped", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, scopedHTML)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/wayback/available", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"archived_snapshots": {"closest": {"available": true, "status": "200",
+			"url": "http://%s/web/20240102030405/%s", "timestamp": "20240102030405"}}}`, r.Host, r.URL.Query().Get("url"))
+	})
+	mux.HandleFunc("/web/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, `<html><head><title>Archived</title></head><body><p>The archived copy of the page.</p></body></html>`)
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>http://%[1]s/sitemap-pages.xml</loc></sitemap>
+<sitemap><loc>http://%[1]s/sitemap-posts.xml.gz</loc></sitemap>
+</sitemapindex>`, r.Host)
+	})
+	mux.HandleFunc("/sitemap-pages.xml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>http://%[1]s/</loc><lastmod>2024-01-01</lastmod></url>
+<url><loc>http://%[1]s/about</loc></url>
+</urlset>`, r.Host)
+	})
+	mux.HandleFunc("/sitemap-posts.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		gz := gzip.NewWriter(w)
+		_, _ = fmt.Fprintf(gz, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>http://%[1]s/posts/1</loc><lastmod>2024-02-01</lastmod></url>
+<url><loc>http://%[1]s/posts/2</loc><lastmod>2024-02-02</lastmod></url>
+<url><loc>http://%[1]s/posts/3</loc></url>
+</urlset>`, r.Host)
+		_ = gz.Close()
+	})
+	wav := silentWAV(2)
+	mux.HandleFunc("/tone.wav", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "tone.wav", time.Time{}, bytes.NewReader(wav))
+	})
 	server = httptest.NewServer(mux)
 
 	// Build binary
@@ -257,6 +896,113 @@ func TestOpenAndExtract(t *testing.T) {
 		}
 	})
 
+	t.Run("no wall on a normal page", func(t *testing.T) {
+		out := runBB(t, "open", "--json", server.URL+"/")
+		if strings.Contains(out, `"wall"`) {
+			t.Errorf("expected no wall, got: %s", out)
+		}
+	})
+
+	t.Run("paywall", func(t *testing.T) {
+		out := runBB(t, "open", "--json", server.URL+"/paywall")
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if result["wall"] != "paywall" {
+			t.Errorf("expected wall=paywall, got: %s", out)
+		}
+		if teaser, _ := result["teaser"].(string); !strings.Contains(teaser, "first paragraph") {
+			t.Errorf("expected teaser text, got: %s", out)
+		}
+	})
+
+	t.Run("login wall", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/loginwall")
+		out := runBB(t, "extract", "--json")
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if result["wall"] != "login" {
+			t.Errorf("expected wall=login, got: %s", out)
+		}
+	})
+
+	t.Run("open --prefer-amp", func(t *testing.T) {
+		out := runBB(t, "open", "--prefer-amp", server.URL+"/amp-teaser")
+		if !strings.Contains(out, "complete article text") {
+			t.Errorf("expected AMP content, got: %s", out)
+		}
+		if url := strings.TrimSpace(runBB(t, "url")); url != server.URL+"/amp-full" {
+			t.Errorf("expected to stay on the AMP page, got %s", url)
+		}
+	})
+
+	t.Run("open --prefer-canonical keeps the better page", func(t *testing.T) {
+		out := runBB(t, "open", "--prefer-canonical", server.URL+"/amp-full")
+		if !strings.Contains(out, "complete article text") {
+			t.Errorf("expected original content, got: %s", out)
+		}
+		if url := strings.TrimSpace(runBB(t, "url")); url != server.URL+"/amp-full" {
+			t.Errorf("expected to return to the original page, got %s", url)
+		}
+	})
+
+	t.Run("extract --selector", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/scoped")
+		out := runBB(t, "extract", "--selector", "#comments")
+		if !strings.Contains(out, "First!") || !strings.Contains(out, "Great read") {
+			t.Errorf("expected the comment thread, got: %s", out)
+		}
+		if strings.Contains(out, "story itself") || strings.Contains(out, "About") {
+			t.Errorf("expected only the selected subtree, got: %s", out)
+		}
+
+		out = runBB(t, "extract", "--selector", "#story")
+		if !strings.Contains(out, "story itself") || strings.Contains(out, "Great read") {
+			t.Errorf("expected only the story, got: %s", out)
+		}
+
+		if _, _, code := runBBRaw("extract", "--selector", "#missing"); code == 0 {
+			t.Error("expected error for missing element")
+		}
+	})
+
+	t.Run("open --fallback wayback", func(t *testing.T) {
+		t.Setenv("BB_WAYBACK_URL", server.URL+"/wayback/available")
+		out := runBB(t, "open", "--json", "--fallback", "wayback", server.URL+"/gone")
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if result["source"] != "wayback" || result["original_url"] != server.URL+"/gone" || result["archived_at"] != "2024-01-02T03:04:05Z" {
+			t.Errorf("expected the wayback source to be flagged, got: %s", out)
+		}
+		if content, _ := result["content"].(string); !strings.Contains(content, "archived copy") {
+			t.Errorf("expected archived content, got: %s", out)
+		}
+		if url, _ := result["url"].(string); !strings.Contains(url, "/web/20240102030405id_/") {
+			t.Errorf("expected the raw snapshot URL, got %s", url)
+		}
+
+		out = runBB(t, "open", "--json", "--fallback", "wayback", server.URL+"/")
+		if strings.Contains(out, `"source"`) {
+			t.Errorf("expected no fallback for a working page, got: %s", out)
+		}
+	})
+
+	t.Run("open --keep-links", func(t *testing.T) {
+		out := runBB(t, "open", "--keep-links", server.URL+"/")
+		if !strings.Contains(out, "[Go to page 2]("+server.URL+"/page2)") {
+			t.Errorf("expected a Markdown link, got: %s", out)
+		}
+		out = runBB(t, "extract", "--keep-links", "--selector", "body")
+		if !strings.Contains(out, "[Go to page 2]("+server.URL+"/page2)") {
+			t.Errorf("expected a Markdown link in scoped extraction, got: %s", out)
+		}
+	})
+
 	t.Run("open auto-prepends https", func(t *testing.T) {
 		// This tests the URL normalization — we can't actually test https here
 		// but we can verify open doesn't crash with a full URL
@@ -317,6 +1063,17 @@ func TestTextAndHTML(t *testing.T) {
 		}
 	})
 
+	t.Run("html --canonical", func(t *testing.T) {
+		out := runBB(t, "html", "--canonical")
+		if !strings.Contains(out, "\n  <head>\n    <title>Test Page</title>\n") {
+			t.Errorf("expected indented canonical HTML, got: %s", out)
+		}
+		out = runBB(t, "html", "#link1", "--canonical")
+		if strings.TrimSpace(out) != `<a data-foo="bar" href="/page2" id="link1">Go to page 2</a>` {
+			t.Errorf("expected sorted attributes, got: %s", out)
+		}
+	})
+
 	t.Run("text invalid selector", func(t *testing.T) {
 		_, _, code := runBBRaw("text", "#nonexistent")
 		if code == 0 {
@@ -428,43 +1185,130 @@ func TestInteraction(t *testing.T) {
 		}
 	})
 
-	t.Run("hover", func(t *testing.T) {
-		out := runBB(t, "hover", "#submitbtn")
-		if !strings.Contains(out, "Hovered") {
-			t.Errorf("expected 'Hovered', got: %s", out)
+	t.Run("select by label", func(t *testing.T) {
+		runBB(t, "select", "#color", "--label", "green")
+		val := runBB(t, "js", `document.querySelector('#color').value`)
+		if strings.TrimSpace(val) != "green" {
+			t.Errorf("expected 'green', got: %s", val)
 		}
 	})
 
-	t.Run("focus", func(t *testing.T) {
-		out := runBB(t, "focus", "#name")
-		if !strings.Contains(out, "Focused") {
-			t.Errorf("expected 'Focused', got: %s", out)
+	t.Run("select by index", func(t *testing.T) {
+		runBB(t, "select", "#color", "--index", "0")
+		val := runBB(t, "js", `document.querySelector('#color').value`)
+		if strings.TrimSpace(val) != "red" {
+			t.Errorf("expected 'red', got: %s", val)
 		}
 	})
 
-	t.Run("click", func(t *testing.T) {
-		out := runBB(t, "click", "#submitbtn")
-		if !strings.Contains(out, "Clicked") {
-			t.Errorf("expected 'Clicked', got: %s", out)
+	t.Run("select multiple", func(t *testing.T) {
+		out := runBB(t, "select", "#langs", "de", "--label", "French")
+		if !strings.Contains(out, "de, fr") {
+			t.Errorf("expected 'de, fr' selected, got: %s", out)
 		}
-	})
-
-	t.Run("submit", func(t *testing.T) {
-		runBB(t, "open", "--raw", server.URL+"/form")
-		out := runBB(t, "submit", "#myform")
-		if !strings.Contains(out, "Submitted") {
-			t.Errorf("expected 'Submitted', got: %s", out)
+		val := runBB(t, "js", `Array.from(document.querySelector('#langs').selectedOptions).map(o => o.value).join(',')`)
+		if strings.TrimSpace(val) != "de,fr" {
+			t.Errorf("expected 'de,fr', got: %s", val)
 		}
 	})
 
-	t.Run("click invalid selector", func(t *testing.T) {
-		_, _, code := runBBRaw("click", "#nonexistent")
+	t.Run("select no match lists options", func(t *testing.T) {
+		_, stderr, code := runBBRaw("select", "#color", "purple")
 		if code == 0 {
-			t.Error("expected error for invalid selector")
+			t.Error("expected error for missing option")
+		}
+		if !strings.Contains(stderr, `"Blue"`) {
+			t.Errorf("expected available options in error, got: %s", stderr)
 		}
 	})
 
-	t.Run("input missing args", func(t *testing.T) {
+	t.Run("fill", func(t *testing.T) {
+		out := runBB(t, "fill", "--data", `{"#name": "Bob", "#bio": "Hi", "#color": "Green", "#langs": ["en"], "#agree": true}`)
+		if !strings.Contains(out, "Filled 5/5 fields") {
+			t.Errorf("expected all fields filled, got: %s", out)
+		}
+		val := runBB(t, "js", `[name.value, bio.value, color.value, langs.value, agree.checked].join(',')`)
+		if strings.TrimSpace(val) != "Bob,Hi,green,en,true" {
+			t.Errorf("expected 'Bob,Hi,green,en,true', got: %s", val)
+		}
+	})
+
+	t.Run("fill reports failures", func(t *testing.T) {
+		stdout, _, code := runBBRaw("fill", "--data", `{"#name": "Carol", "#missing": "x"}`)
+		if code == 0 {
+			t.Error("expected error when a field fails")
+		}
+		if !strings.Contains(stdout, "ok    #name") || !strings.Contains(stdout, "fail  #missing") {
+			t.Errorf("expected per-field results, got: %s", stdout)
+		}
+	})
+
+	t.Run("form", func(t *testing.T) {
+		out := runBB(t, "form", "--json")
+		var form struct {
+			Method string      `json:"method"`
+			Fields []formField `json:"fields"`
+		}
+		if err := json.Unmarshal([]byte(out), &form); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, out)
+		}
+		fields := map[string]formField{}
+		for _, f := range form.Fields {
+			fields[f.Selector] = f
+		}
+		if f := fields["#name"]; f.Label != "Your name" || f.Type != "text" {
+			t.Errorf("unexpected #name field: %+v", f)
+		}
+		if f := fields["#color"]; len(f.Options) != 3 || f.Options[2].Label != "Green" {
+			t.Errorf("expected #color options, got: %+v", f)
+		}
+		if f := fields["#agree"]; f.Checked == nil {
+			t.Errorf("expected checked state for #agree, got: %+v", f)
+		}
+
+		text := runBB(t, "form", "#myform")
+		if !strings.Contains(text, `"Your name"`) || !strings.Contains(text, "GET") {
+			t.Errorf("expected field listing, got: %s", text)
+		}
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		out := runBB(t, "hover", "#submitbtn")
+		if !strings.Contains(out, "Hovered") {
+			t.Errorf("expected 'Hovered', got: %s", out)
+		}
+	})
+
+	t.Run("focus", func(t *testing.T) {
+		out := runBB(t, "focus", "#name")
+		if !strings.Contains(out, "Focused") {
+			t.Errorf("expected 'Focused', got: %s", out)
+		}
+	})
+
+	t.Run("click", func(t *testing.T) {
+		out := runBB(t, "click", "#submitbtn")
+		if !strings.Contains(out, "Clicked") {
+			t.Errorf("expected 'Clicked', got: %s", out)
+		}
+	})
+
+	t.Run("submit", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/form")
+		out := runBB(t, "submit", "#myform")
+		if !strings.Contains(out, "Submitted") {
+			t.Errorf("expected 'Submitted', got: %s", out)
+		}
+	})
+
+	t.Run("click invalid selector", func(t *testing.T) {
+		_, _, code := runBBRaw("click", "#nonexistent")
+		if code == 0 {
+			t.Error("expected error for invalid selector")
+		}
+	})
+
+	t.Run("input missing args", func(t *testing.T) {
 		_, _, code := runBBRaw("input", "#name")
 		if code == 0 {
 			t.Error("expected error for missing text arg")
@@ -643,6 +1487,100 @@ func TestScreenshots(t *testing.T) {
 		}
 	})
 
+	t.Run("screenshot max dimension", func(t *testing.T) {
+		file := filepath.Join(dir, "small.png")
+		runBB(t, "screenshot", "-w", "1280", "-h", "720", "--max-dimension", "640", "--optimize", file)
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("screenshot file not found: %v", err)
+		}
+		defer f.Close()
+		cfg, err := png.DecodeConfig(f)
+		if err != nil {
+			t.Fatalf("invalid PNG: %v", err)
+		}
+		if cfg.Width != 640 || cfg.Height != 360 {
+			t.Errorf("expected 640x360, got %dx%d", cfg.Width, cfg.Height)
+		}
+	})
+
+	t.Run("screenshot to stdout as jpeg", func(t *testing.T) {
+		out := runBB(t, "screenshot", "-", "--format", "jpeg", "--quality", "50", "--clip", "0,0,200,100")
+		cfg, format, err := image.DecodeConfig(strings.NewReader(out))
+		if err != nil {
+			t.Fatalf("stdout is not an image: %v", err)
+		}
+		if format != "jpeg" || cfg.Width != 200 || cfg.Height != 100 {
+			t.Errorf("expected 200x100 jpeg, got %dx%d %s", cfg.Width, cfg.Height, format)
+		}
+	})
+
+	t.Run("screenshot stitch", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/big")
+		defer runBB(t, "open", "--raw", server.URL+"/")
+
+		file := filepath.Join(dir, "stitched.png")
+		runBB(t, "screenshot", "-h", "400", "--stitch", file)
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("screenshot file not found: %v", err)
+		}
+		defer f.Close()
+		cfg, err := png.DecodeConfig(f)
+		if err != nil {
+			t.Fatalf("invalid PNG: %v", err)
+		}
+		if cfg.Height <= 400 {
+			t.Errorf("expected stitched image taller than the viewport, got %dpx", cfg.Height)
+		}
+
+		out := runBB(t, "screenshot", "-h", "400", "--stitch=tiles", filepath.Join(dir, "tile.png"))
+		files := strings.Fields(out)
+		if len(files) < 2 || files[0] != filepath.Join(dir, "tile-1.png") {
+			t.Errorf("expected numbered tiles, got: %s", out)
+		}
+	})
+
+	t.Run("screenshot around text", func(t *testing.T) {
+		out := runBB(t, "screenshot", "-", "--around", "test page for BB", "--padding", "10")
+		cfg, err := png.DecodeConfig(strings.NewReader(out))
+		if err != nil {
+			t.Fatalf("stdout is not a PNG: %v", err)
+		}
+		// One paragraph plus padding, not the whole page
+		if cfg.Height < 20 || cfg.Height > 100 {
+			t.Errorf("expected a paragraph-sized image, got %dx%d", cfg.Width, cfg.Height)
+		}
+
+		_, stderr, code := runBBRaw("screenshot", "-", "--around", "no such text anywhere")
+		if code == 0 || !strings.Contains(stderr, "text not found") {
+			t.Errorf("expected 'text not found' error, got exit %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("screenshot annotate", func(t *testing.T) {
+		file := filepath.Join(dir, "marks.png")
+		out := runBB(t, "screenshot", "--annotate", file)
+		if !strings.Contains(out, "elements marked") {
+			t.Errorf("expected marks summary, got: %s", out)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "marks.json"))
+		if err != nil {
+			t.Fatalf("sidecar not written: %v", err)
+		}
+		var marks []mark
+		if err := json.Unmarshal(data, &marks); err != nil {
+			t.Fatalf("invalid sidecar: %v", err)
+		}
+		if len(marks) != 1 || marks[0].Selector != "#link1" || marks[0].Role != "link" || marks[0].Name != "Go to page 2" {
+			t.Errorf("expected one mark for #link1, got: %+v", marks)
+		}
+		// The overlay must not stay on the page
+		if _, _, code := runBBRaw("exists", "#__bb_marks"); code == 0 {
+			t.Error("overlay was not removed")
+		}
+	})
+
 	t.Run("screenshot-el invalid", func(t *testing.T) {
 		_, _, code := runBBRaw("screenshot-el", "#nonexistent", filepath.Join(dir, "nope.png"))
 		if code == 0 {
@@ -731,6 +1669,52 @@ func TestTabs(t *testing.T) {
 		}
 	})
 
+	t.Run("stable ids", func(t *testing.T) {
+		runBB(t, "newpage", server.URL+"/form")
+		var ps []struct {
+			Index  int    `json:"index"`
+			ID     string `json:"id"`
+			Active bool   `json:"active"`
+			URL    string `json:"url"`
+		}
+		if err := json.Unmarshal([]byte(runBB(t, "pages", "--json")), &ps); err != nil {
+			t.Fatal(err)
+		}
+		form := ps[len(ps)-1]
+		if form.ID == "" || !form.Active || form.URL != server.URL+"/form" {
+			t.Fatalf("expected the new page to be active with an id, got %+v", ps)
+		}
+
+		// Closing an earlier tab shifts indexes but not the active page
+		runBB(t, "closepage", ps[0].ID[:8])
+		if out := runBB(t, "url"); strings.TrimSpace(out) != server.URL+"/form" {
+			t.Errorf("expected the active page to stay on /form, got: %s", out)
+		}
+		if out := runBB(t, "url", "--target", ps[1].ID); strings.TrimSpace(out) != ps[1].URL {
+			t.Errorf("expected --target to address page %s, got: %s", ps[1].ID, out)
+		}
+		if out := runBB(t, "page", form.ID); !strings.Contains(out, "Switched") {
+			t.Errorf("expected to switch by id, got: %s", out)
+		}
+		if _, _, code := runBBRaw("url", "--target", "NOSUCHID"); code == 0 {
+			t.Error("expected an error for an unknown id")
+		}
+	})
+
+	t.Run("background", func(t *testing.T) {
+		before := strings.TrimSpace(runBB(t, "url"))
+		out := runBB(t, "newpage", "--background", server.URL+"/page2")
+		if !strings.Contains(out, "in the background") {
+			t.Errorf("expected a background page, got: %s", out)
+		}
+		if out := runBB(t, "url"); strings.TrimSpace(out) != before {
+			t.Errorf("expected the active page to stay on %s, got: %s", before, out)
+		}
+		if out := runBB(t, "pages"); !strings.Contains(out, "Page Two") {
+			t.Errorf("expected the background page loaded, got: %s", out)
+		}
+	})
+
 	t.Run("closepage last page", func(t *testing.T) {
 		// Close until one remains, then try to close it
 		pages := runBB(t, "pages", "--json")
@@ -772,8 +1756,8 @@ func TestQuery(t *testing.T) {
 
 	t.Run("exists false", func(t *testing.T) {
 		out, _, code := runBBRaw("exists", "#nonexistent")
-		if code == 0 {
-			t.Error("expected exit 1 for non-existing element")
+		if code != exitFalse {
+			t.Errorf("expected exit %d for non-existing element, got %d", exitFalse, code)
 		}
 		if !strings.Contains(out, "false") {
 			t.Errorf("expected 'false', got: %s", out)
@@ -807,8 +1791,8 @@ func TestQuery(t *testing.T) {
 	t.Run("visible false hidden element", func(t *testing.T) {
 		runBB(t, "open", "--raw", server.URL+"/")
 		out, _, code := runBBRaw("visible", "#hidden")
-		if code == 0 {
-			t.Error("expected exit 1 for hidden element")
+		if code != exitFalse {
+			t.Errorf("expected exit %d for hidden element, got %d", exitFalse, code)
 		}
 		if !strings.Contains(out, "false") {
 			t.Errorf("expected 'false', got: %s", out)
@@ -817,8 +1801,34 @@ func TestQuery(t *testing.T) {
 
 	t.Run("visible nonexistent", func(t *testing.T) {
 		_, _, code := runBBRaw("visible", "#nonexistent")
-		if code == 0 {
-			t.Error("expected exit 1 for nonexistent element")
+		if code != exitFalse {
+			t.Errorf("expected exit %d for nonexistent element, got %d", exitFalse, code)
+		}
+	})
+
+	t.Run("probe", func(t *testing.T) {
+		runBB(t, "js", `document.body.insertAdjacentHTML('beforeend', '<p id="ghost" style="display:none">x</p>')`)
+		out := runBB(t, "probe", ".item", "#ghost", "#nonexistent", "[[bad")
+		var result map[string]struct {
+			Exists  bool   `json:"exists"`
+			Visible bool   `json:"visible"`
+			Count   int    `json:"count"`
+			Error   string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, out)
+		}
+		if r := result[".item"]; !r.Exists || !r.Visible || r.Count != 3 {
+			t.Errorf("unexpected .item result: %+v", r)
+		}
+		if r := result["#ghost"]; !r.Exists || r.Visible || r.Count != 1 {
+			t.Errorf("unexpected #ghost result: %+v", r)
+		}
+		if r := result["#nonexistent"]; r.Exists || r.Count != 0 {
+			t.Errorf("unexpected #nonexistent result: %+v", r)
+		}
+		if result["[[bad"].Error == "" {
+			t.Error("expected an error for the invalid selector")
 		}
 	})
 }
@@ -855,6 +1865,42 @@ func TestAccessibility(t *testing.T) {
 		}
 	})
 
+	t.Run("ax-tree --selector", func(t *testing.T) {
+		out := runBB(t, "ax-tree", "--selector", "ul")
+		if !strings.HasPrefix(out, "[list]") || !strings.Contains(out, "Three") || strings.Contains(out, "Click Me") {
+			t.Errorf("expected only the list subtree, got: %s", out)
+		}
+	})
+
+	t.Run("ax-tree --interactive", func(t *testing.T) {
+		out := runBB(t, "ax-tree", "--interactive")
+		if !strings.Contains(out, `[button] "Click Me" backendNodeId=`) || strings.Contains(out, "[listitem]") {
+			t.Errorf("expected just the button, got: %s", out)
+		}
+	})
+
+	t.Run("click --node", func(t *testing.T) {
+		var nodes []struct {
+			BackendDOMNodeID int `json:"backendDOMNodeId"`
+		}
+		if err := json.Unmarshal([]byte(runBB(t, "ax-find", "--role", "button", "--json")), &nodes); err != nil || len(nodes) == 0 {
+			t.Fatalf("no button found: %v", err)
+		}
+		id := fmt.Sprint(nodes[0].BackendDOMNodeID)
+		runBB(t, "js", `document.getElementById('btn').onclick = () => document.title = 'clicked'`)
+		runBB(t, "click", "--node", id)
+		if out := runBB(t, "title"); strings.TrimSpace(out) != "clicked" {
+			t.Errorf("expected the click to reach the button, title = %q", out)
+		}
+		runBB(t, "js", "document.title = 'Multi'")
+		if _, stderr, code := runBBRaw("focus", "--node", "999999"); code != exitNotFound || !strings.Contains(stderr, "error: no node with backendNodeId 999999") {
+			t.Errorf("expected an unknown node to fail, got %d: %s", code, stderr)
+		}
+		if _, _, code := runBBRaw("click", "#btn", "--node", id); code != exitUsage {
+			t.Errorf("expected --node with a selector to be refused, got exit %d", code)
+		}
+	})
+
 	t.Run("ax-find --role", func(t *testing.T) {
 		out := runBB(t, "ax-find", "--timeout", "30", "--role", "button")
 		if !strings.Contains(out, "button") {
@@ -907,6 +1953,36 @@ func TestAccessibility(t *testing.T) {
 	})
 }
 
+func TestAccessibilityFallback(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/form")
+	t.Setenv("BB_AX_DOM", "1")
+
+	stdout, stderr, code := runBBRaw("ax-tree")
+	if code != 0 || !strings.Contains(stderr, "derived from the DOM") {
+		t.Fatalf("expected the fallback with a note, got %d: %s", code, stderr)
+	}
+	for _, want := range []string{`[RootWebArea] "Form Page"`, `[heading] "Form" (level=1)`, `[textbox] "Your name" (focusable)`, `[button] "Submit" (focusable)`, `[option] "Blue"`} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %s in the tree:\n%s", want, stdout)
+		}
+	}
+	if out := runBB(t, "ax-tree", "--selector", "form", "--depth", "1"); !strings.HasPrefix(out, "[form]") || strings.Contains(out, "Blue") {
+		t.Errorf("expected the form's first level only, got:\n%s", out)
+	}
+
+	out := runBB(t, "ax-find", "--role", "textbox", "--name", "Your name")
+	if !strings.HasPrefix(out, `[textbox] "Your name" backendNodeId=`) {
+		t.Errorf("expected the labelled field with its backendNodeId, got %q", out)
+	}
+	runBB(t, "click", "--node", strings.Fields(strings.SplitAfter(out, "backendNodeId=")[1])[0])
+	if out := runBB(t, "ax-node", "#name"); !strings.Contains(out, "focused: true") {
+		t.Errorf("expected the node to be clickable and focused, got:\n%s", out)
+	}
+	if out := runBB(t, "ax-node", "#agree"); !strings.Contains(out, "role: checkbox") || !strings.Contains(out, "checked: false") {
+		t.Errorf("unexpected checkbox node:\n%s", out)
+	}
+}
+
 func TestBigPageTruncation(t *testing.T) {
 	out := runBB(t, "open", "--json", server.URL+"/big")
 	var result map[string]interface{}
@@ -1022,3 +2098,3302 @@ func TestTimeout(t *testing.T) {
 		}
 	})
 }
+
+func TestScreenshotOnError(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	dir := t.TempDir()
+
+	_, stderr, code := runBBRaw("text", "--timeout", "1", "--screenshot-on-error="+dir, "#nonexistent")
+	if code == 0 {
+		t.Fatal("expected non-zero exit for invalid selector")
+	}
+	if !strings.Contains(stderr, "error report saved") {
+		t.Errorf("expected report path in stderr, got: %s", stderr)
+	}
+
+	reports, _ := filepath.Glob(filepath.Join(dir, "*-text.json"))
+	if len(reports) != 1 {
+		t.Fatalf("expected one report, got %v", reports)
+	}
+	data, err := os.ReadFile(reports[0])
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !strings.Contains(fmt.Sprint(report["url"]), server.URL) {
+		t.Errorf("expected page URL in report, got: %v", report["url"])
+	}
+	shot, _ := report["screenshot"].(string)
+	if info, err := os.Stat(shot); err != nil || info.Size() == 0 {
+		t.Errorf("expected non-empty screenshot at %q", shot)
+	}
+}
+
+func TestDumpOnError(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	dir := t.TempDir()
+
+	_, _, code := runBBRaw("click", "--timeout", "1", "--dump-on-error="+dir, "#nonexistent")
+	if code == 0 {
+		t.Fatal("expected non-zero exit for invalid selector")
+	}
+
+	html, _ := filepath.Glob(filepath.Join(dir, "*-click.html"))
+	if len(html) != 1 {
+		t.Fatalf("expected one HTML dump, got %v", html)
+	}
+	data, _ := os.ReadFile(html[0])
+	if !strings.Contains(string(data), "<h1>Hello World</h1>") {
+		t.Errorf("expected page DOM in dump, got: %s", data[:min(200, len(data))])
+	}
+	ax, _ := filepath.Glob(filepath.Join(dir, "*-click.ax.txt"))
+	if len(ax) != 1 {
+		t.Fatalf("expected one AX tree dump, got %v", ax)
+	}
+	data, _ = os.ReadFile(ax[0])
+	if !strings.Contains(string(data), "Hello World") {
+		t.Errorf("expected heading in AX dump, got: %s", data[:min(200, len(data))])
+	}
+}
+
+func TestMouseCoordinates(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/mouse")
+
+	t.Run("click-at", func(t *testing.T) {
+		out := runBB(t, "click-at", "50", "60")
+		if !strings.Contains(out, "Clicked at 50,60") {
+			t.Errorf("expected 'Clicked at 50,60', got: %s", out)
+		}
+		events := runBB(t, "js", `window.events.filter(e => e.startsWith('click')).join(' ')`)
+		if !strings.Contains(events, "click:50,60") {
+			t.Errorf("expected click at 50,60, got: %s", events)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		runBB(t, "move", "120", "80")
+		events := runBB(t, "js", `window.events[window.events.length - 1]`)
+		if !strings.Contains(events, "mousemove:120,80") {
+			t.Errorf("expected mousemove at 120,80, got: %s", events)
+		}
+	})
+
+	t.Run("drag", func(t *testing.T) {
+		runBB(t, "js", `window.events = []`)
+		runBB(t, "drag", "10", "10", "200", "150")
+		events := runBB(t, "js", `window.events.join(' ')`)
+		if !strings.Contains(events, "mousedown:10,10") || !strings.Contains(events, "mouseup:200,150") {
+			t.Errorf("expected mousedown/mouseup at drag ends, got: %s", events)
+		}
+	})
+
+	t.Run("click with position and offset", func(t *testing.T) {
+		runBB(t, "js", `window.events = []`)
+		runBB(t, "click", "#pad", "--position", "topleft", "--offset", "20,30")
+		runBB(t, "click", "#pad", "--position", "bottomright", "--offset", "-9,-9")
+		events := runBB(t, "js", `window.events.filter(e => e.startsWith('click')).join(' ')`)
+		if strings.TrimSpace(events) != "click:21,31 click:390,290" {
+			t.Errorf("expected clicks at 21,31 and 390,290, got: %s", events)
+		}
+	})
+
+	t.Run("hover with position", func(t *testing.T) {
+		runBB(t, "hover", "#pad", "--position", "center", "--offset", "5,0")
+		events := runBB(t, "js", `window.events[window.events.length - 1]`)
+		if !strings.Contains(events, "mousemove:205,150") {
+			t.Errorf("expected mousemove at 205,150, got: %s", events)
+		}
+	})
+
+	t.Run("invalid coordinate", func(t *testing.T) {
+		_, _, code := runBBRaw("click-at", "abc", "10")
+		if code == 0 {
+			t.Error("expected error for invalid coordinate")
+		}
+	})
+}
+
+func TestDragDrop(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/drag")
+
+	t.Run("html5 draggable", func(t *testing.T) {
+		out := runBB(t, "dragdrop", "#card", "#zone")
+		if !strings.Contains(out, "html5") {
+			t.Errorf("expected html5 mode for draggable source, got: %s", out)
+		}
+		log := runBB(t, "js", `window.log.join(',')`)
+		if !strings.Contains(log, "drop") {
+			t.Errorf("expected drop event, got: %s", log)
+		}
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		runBB(t, "js", `window.log = []`)
+		out := runBB(t, "dragdrop", "#handle", "#zone")
+		if !strings.Contains(out, "pointer") {
+			t.Errorf("expected pointer mode, got: %s", out)
+		}
+		log := runBB(t, "js", `window.log.join(',')`)
+		if log = strings.TrimSpace(log); log != "down,up-on-zone" {
+			t.Errorf("expected 'down,up-on-zone', got: %q", log)
+		}
+	})
+
+	t.Run("missing target", func(t *testing.T) {
+		_, _, code := runBBRaw("dragdrop", "#card")
+		if code == 0 {
+			t.Error("expected error for missing target")
+		}
+	})
+}
+
+func TestConfig(t *testing.T) {
+	t.Cleanup(func() {
+		runBBRaw("config", "gpu", "")
+		runBBRaw("config", "fonts", "")
+	})
+
+	t.Run("set and get", func(t *testing.T) {
+		out := runBB(t, "config", "gpu", "swiftshader")
+		if !strings.Contains(out, "gpu = swiftshader") {
+			t.Errorf("expected 'gpu = swiftshader', got: %s", out)
+		}
+		out = runBB(t, "config", "gpu")
+		if strings.TrimSpace(out) != "swiftshader" {
+			t.Errorf("expected 'swiftshader', got: %q", out)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		out := runBB(t, "config")
+		if !strings.Contains(out, "headless") || !strings.Contains(out, "swiftshader") {
+			t.Errorf("expected settings listing, got: %s", out)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		runBB(t, "config", "gpu", "")
+		out := runBB(t, "config", "gpu")
+		if strings.TrimSpace(out) != "" {
+			t.Errorf("expected empty value after reset, got: %q", out)
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		_, stderr, code := runBBRaw("config", "headless", "sometimes")
+		if code == 0 {
+			t.Error("expected error for invalid value")
+		}
+		if !strings.Contains(stderr, "expected") {
+			t.Errorf("expected allowed values in error, got: %s", stderr)
+		}
+	})
+
+	t.Run("fonts dir", func(t *testing.T) {
+		dir := t.TempDir()
+		runBB(t, "config", "fonts", dir)
+		out := runBB(t, "config", "fonts")
+		if strings.TrimSpace(out) != dir {
+			t.Errorf("expected %q, got: %q", dir, out)
+		}
+		_, _, code := runBBRaw("config", "fonts", filepath.Join(dir, "missing"))
+		if code == 0 {
+			t.Error("expected error for missing fonts dir")
+		}
+	})
+
+	t.Run("sso allowlist", func(t *testing.T) {
+		t.Cleanup(func() { runBBRaw("config", "sso-allowlist", "") })
+		runBB(t, "config", "sso-allowlist", "*.Corp.example.com, intranet")
+		if out := runBB(t, "config", "sso-allowlist"); strings.TrimSpace(out) != "*.corp.example.com,intranet" {
+			t.Errorf("unexpected allowlist: %q", out)
+		}
+		l := applyLaunchConfig(launcher.New(), &Config{SSOAllowlist: []string{"*.corp.example.com", "intranet"}})
+		if got := l.Get("auth-server-allowlist"); got != "*.corp.example.com,intranet" {
+			t.Errorf("expected the allowlist as a launch flag, got %q", got)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, _, code := runBBRaw("config", "nope")
+		if code == 0 {
+			t.Error("expected error for unknown key")
+		}
+	})
+
+	t.Run("subcommands", func(t *testing.T) {
+		t.Cleanup(func() {
+			runBBRaw("config", "set", "timeout", "")
+			runBBRaw("config", "set", "viewport", "")
+			runBBRaw("config", "set", "output-format", "")
+		})
+		runBB(t, "config", "set", "timeout", "12.5")
+		if out := runBB(t, "config", "get", "timeout"); strings.TrimSpace(out) != "12.5" {
+			t.Errorf("expected timeout 12.5, got: %q", out)
+		}
+		if _, _, code := runBBRaw("config", "set", "viewport", "wide"); code == 0 {
+			t.Error("expected error for an invalid viewport")
+		}
+		runBB(t, "config", "set", "viewport", "1280x800")
+
+		runBB(t, "config", "set", "output-format", "json")
+		out := runBB(t, "config", "list")
+		var values map[string]string
+		if err := json.Unmarshal([]byte(out), &values); err != nil {
+			t.Fatalf("expected output-format json to imply --json, got: %s", out)
+		}
+		if values["viewport"] != "1280x800" || values["timeout"] != "12.5" {
+			t.Errorf("expected the new settings listed, got: %s", out)
+		}
+		if out := runBB(t, "config", "list", "--no-json"); !strings.Contains(out, "(default)") {
+			t.Errorf("expected --no-json to print text, got: %s", out)
+		}
+	})
+}
+
+func TestRestart(t *testing.T) {
+	runBB(t, "config", "chrome-args", `--lang=de --user-agent="bb test"`)
+	if out := runBB(t, "config", "chrome-args"); strings.TrimSpace(out) != `--lang=de "--user-agent=bb test"` {
+		t.Errorf("expected the flags split like a shell, got: %q", out)
+	}
+	runBB(t, "config", "chrome-args", "")
+	if _, _, code := runBBRaw("config", "chrome-args", "lang=de"); code == 0 {
+		t.Error("expected an error for a flag without --")
+	}
+
+	runBB(t, "open", "--raw", server.URL+"/page2")
+	out := runBB(t, "restart", "--chrome-arg", "--user-agent=bb-restart")
+	if !strings.Contains(out, "restarted") {
+		t.Errorf("expected a restart, got: %s", out)
+	}
+	t.Cleanup(func() { runBBRaw("restart") })
+	if out := runBB(t, "url"); strings.TrimSpace(out) != server.URL+"/page2" {
+		t.Errorf("expected the tab reopened, got: %s", out)
+	}
+	if out := runBB(t, "js", "navigator.userAgent"); strings.TrimSpace(out) != "bb-restart" {
+		t.Errorf("expected the new flag applied, got: %s", out)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	runBB(t, "config", "load-policy", "--block", "images,fonts")
+	t.Cleanup(func() { runBBRaw("config", "load-policy", "") })
+	if out := runBB(t, "config", "load-policy"); strings.TrimSpace(out) != "--block images,fonts" {
+		t.Errorf("expected the policy stored, got: %q", out)
+	}
+	if _, _, code := runBBRaw("config", "load-policy", "--block", "videos"); code == 0 {
+		t.Error("expected an error for an unknown resource type")
+	}
+
+	imageWidth := `document.getElementById('plain').naturalWidth`
+	runBB(t, "open", "--raw", server.URL+"/images")
+	if out := runBB(t, "js", imageWidth); strings.TrimSpace(out) != "0" {
+		t.Errorf("expected the image blocked, got width %s", out)
+	}
+	runBB(t, "open", "--raw", "--block-resources", "none", server.URL+"/images?again")
+	if out := runBB(t, "js", imageWidth); strings.TrimSpace(out) == "0" {
+		t.Error("expected --block-resources none to load the image")
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifacts")
+	runBB(t, "config", "output-dir", dir)
+	t.Cleanup(func() { runBBRaw("config", "output-dir", "") })
+
+	runBB(t, "open", "--raw", server.URL+"/form")
+	out := strings.TrimSpace(runBB(t, "screenshot"))
+	want := filepath.Join(dir, time.Now().Format("2006-01-02"), "screenshot.png")
+	if out != want {
+		t.Errorf("expected %s, got: %s", want, out)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("screenshot not written: %v", err)
+	}
+
+	// A second auto-named screenshot must not overwrite the first
+	out = strings.TrimSpace(runBB(t, "screenshot"))
+	if out == want {
+		t.Errorf("expected a new file name, got: %s", out)
+	}
+}
+
+func TestClickVariants(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/mouse")
+
+	cases := []struct {
+		name  string
+		flags []string
+		event string
+	}{
+		{"double", []string{"--double"}, "dblclick:0"},
+		{"right", []string{"--right"}, "contextmenu:2"},
+		{"middle", []string{"--middle"}, "auxclick:1"},
+		{"count", []string{"--count", "2"}, "dblclick:0"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			runBB(t, "js", `window.events = []`)
+			runBB(t, append([]string{"click", "#pad"}, tc.flags...)...)
+			events := runBB(t, "js", `window.events.join(' ')`)
+			if !strings.Contains(events, tc.event) {
+				t.Errorf("expected %s, got: %s", tc.event, events)
+			}
+		})
+	}
+
+	t.Run("invalid count", func(t *testing.T) {
+		_, _, code := runBBRaw("click", "#pad", "--count", "0")
+		if code == 0 {
+			t.Error("expected error for invalid count")
+		}
+	})
+}
+
+func TestType(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/form")
+
+	t.Run("selector with delay", func(t *testing.T) {
+		runBB(t, "js", `(window.keydowns = 0, document.querySelector('#name').addEventListener('keydown', () => window.keydowns++), 0)`)
+		out := runBB(t, "type", "#name", "Bob", "--delay", "10")
+		if !strings.Contains(out, "Typed: Bob") {
+			t.Errorf("expected 'Typed: Bob', got: %s", out)
+		}
+		val := runBB(t, "js", `document.querySelector('#name').value`)
+		if strings.TrimSpace(val) != "Bob" {
+			t.Errorf("expected value 'Bob', got: %q", val)
+		}
+		kd := runBB(t, "js", `window.keydowns`)
+		if strings.TrimSpace(kd) != "3" {
+			t.Errorf("expected 3 keydown events, got: %q", kd)
+		}
+	})
+
+	t.Run("focused element", func(t *testing.T) {
+		runBB(t, "focus", "#bio")
+		runBB(t, "type", "héllo")
+		val := runBB(t, "js", `document.querySelector('#bio').value`)
+		if strings.TrimSpace(val) != "héllo" {
+			t.Errorf("expected 'héllo', got: %q", val)
+		}
+	})
+
+	t.Run("enter submits", func(t *testing.T) {
+		runBB(t, "type", "#name", "x", "--enter")
+		runBB(t, "waitload")
+		title := runBB(t, "title")
+		if !strings.Contains(title, "Submitted") {
+			t.Errorf("expected form submission after Enter, got: %s", title)
+		}
+	})
+
+	t.Run("missing text", func(t *testing.T) {
+		_, _, code := runBBRaw("type")
+		if code == 0 {
+			t.Error("expected error for missing text")
+		}
+	})
+}
+
+func TestKeyFor(t *testing.T) {
+	for _, r := range "aZ1 !\n" {
+		if _, ok := keyFor(r); !ok {
+			t.Errorf("expected key for %q", r)
+		}
+	}
+	for _, r := range "é漢😀" {
+		if _, ok := keyFor(r); ok {
+			t.Errorf("expected no key for %q", r)
+		}
+	}
+}
+
+func TestDisableAnimations(t *testing.T) {
+	runBB(t, "config", "disable-animations", "true")
+	t.Cleanup(func() { runBBRaw("config", "disable-animations", "") })
+
+	runBB(t, "open", "--raw", server.URL+"/")
+	out := runBB(t, "js", `(() => {
+		const el = document.createElement('div');
+		el.style.transition = 'opacity 5s';
+		document.body.appendChild(el);
+		return getComputedStyle(el).transitionDuration;
+	})()`)
+	if strings.TrimSpace(out) != "0s" {
+		t.Errorf("expected transitions disabled, got duration %q", strings.TrimSpace(out))
+	}
+}
+
+func TestBypassCSP(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/csp")
+	if _, _, code := runBBRaw("js", "eval('1 + 1')"); code == 0 {
+		t.Error("expected the page's CSP to block eval")
+	}
+
+	runBB(t, "config", "bypass-csp", "true")
+	t.Cleanup(func() { runBBRaw("config", "bypass-csp", "") })
+	runBB(t, "open", "--raw", server.URL+"/csp")
+	if out := strings.TrimSpace(runBB(t, "js", "eval('1 + 1')")); out != "2" {
+		t.Errorf("expected eval to run with bypass-csp, got %q", out)
+	}
+}
+
+func TestCSS(t *testing.T) {
+	t.Cleanup(func() { runBBRaw("css", "clear") })
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "css", "add", "body { font-size: 31px }")
+	file := filepath.Join(t.TempDir(), "hide.css")
+	if err := os.WriteFile(file, []byte("h1 { display: none }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runBB(t, "css", "add", file)
+	if out := runBB(t, "css", "list"); !strings.Contains(out, "[1] inline") || !strings.Contains(out, "[2] "+file) {
+		t.Errorf("expected both stylesheets listed, got: %s", out)
+	}
+	styles := func() string {
+		return strings.TrimSpace(runBB(t, "js", "getComputedStyle(document.body).fontSize + ' ' + getComputedStyle(document.querySelector('h1')).display"))
+	}
+	if got := styles(); got != "31px none" {
+		t.Errorf("expected the styles applied, got %q", got)
+	}
+	// They come back after navigating
+	runBB(t, "open", "--raw", server.URL+"/")
+	if got := styles(); got != "31px none" {
+		t.Errorf("expected the styles on the next page, got %q", got)
+	}
+
+	runBB(t, "css", "clear")
+	if got := styles(); got == "31px none" {
+		t.Errorf("expected the styles removed, got %q", got)
+	}
+	if _, _, code := runBBRaw("css", "add", "no-such-file.css"); code == 0 {
+		t.Error("expected a missing file to be an error")
+	}
+}
+
+func TestNoJS(t *testing.T) {
+	runBB(t, "open", "--raw", "--no-js", server.URL+"/delayed")
+	time.Sleep(800 * time.Millisecond)
+	if _, _, code := runBBRaw("exists", "#delayed-el"); code == 0 {
+		t.Error("expected the page's script not to run with --no-js")
+	}
+	if out := runBB(t, "js", "document.title"); strings.TrimSpace(out) != "Delayed Page" {
+		t.Errorf("expected bb js to still work, got: %s", out)
+	}
+
+	runBB(t, "config", "nojs-domains", "127.0.0.1")
+	t.Cleanup(func() { runBBRaw("config", "nojs-domains", "") })
+	runBB(t, "open", "--raw", server.URL+"/delayed")
+	time.Sleep(800 * time.Millisecond)
+	if _, _, code := runBBRaw("exists", "#delayed-el"); code == 0 {
+		t.Error("expected scripts disabled on a nojs domain")
+	}
+
+	runBB(t, "config", "nojs-domains", "")
+	runBB(t, "open", "--raw", server.URL+"/delayed")
+	runBB(t, "wait", "#delayed-el")
+}
+
+func TestClock(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+
+	t.Run("set frozen", func(t *testing.T) {
+		out := runBB(t, "clock", "set", "2024-01-01T00:00:00Z")
+		if !strings.Contains(out, "frozen") {
+			t.Errorf("expected frozen clock, got: %s", out)
+		}
+		now := runBB(t, "js", `new Date().toISOString()`)
+		if strings.TrimSpace(now) != "2024-01-01T00:00:00.000Z" {
+			t.Errorf("expected mocked date, got: %s", now)
+		}
+	})
+
+	t.Run("survives navigation", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/page2")
+		year := runBB(t, "js", `new Date().getUTCFullYear()`)
+		if strings.TrimSpace(year) != "2024" {
+			t.Errorf("expected 2024 after navigation, got: %s", year)
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		runBB(t, "clock", "clear")
+		year := runBB(t, "js", `new Date().getUTCFullYear()`)
+		if strings.TrimSpace(year) == "2024" {
+			t.Error("expected real clock after clear")
+		}
+	})
+
+	t.Run("invalid time", func(t *testing.T) {
+		_, _, code := runBBRaw("clock", "set", "yesterday")
+		if code == 0 {
+			t.Error("expected error for invalid time")
+		}
+	})
+}
+
+func TestParseClockTime(t *testing.T) {
+	for _, v := range []string{"2024-01-01T00:00:00Z", "2024-01-01T02:00:00+02:00", "2024-01-01"} {
+		got, err := parseClockTime(v)
+		if err != nil {
+			t.Errorf("parseClockTime(%q): %v", v, err)
+			continue
+		}
+		if got.UTC().Format("2006-01-02T15") != "2024-01-01T00" {
+			t.Errorf("parseClockTime(%q) = %v", v, got)
+		}
+	}
+	if _, err := parseClockTime("soon"); err == nil {
+		t.Error("expected error for invalid time")
+	}
+}
+
+func TestCombobox(t *testing.T) {
+	t.Run("pick option", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/combo")
+		out := runBB(t, "combobox", "#country", "germany")
+		if !strings.Contains(out, "Selected: Germany") {
+			t.Errorf("expected 'Selected: Germany', got: %s", out)
+		}
+		label := runBB(t, "text", "#country")
+		if strings.TrimSpace(label) != "Germany" {
+			t.Errorf("expected trigger to show 'Germany', got: %q", label)
+		}
+	})
+
+	t.Run("no match lists options", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/combo")
+		_, stderr, code := runBBRaw("combobox", "#country", "Atlantis")
+		if code == 0 {
+			t.Error("expected error for missing option")
+		}
+		if !strings.Contains(stderr, `"Spain"`) {
+			t.Errorf("expected available options in error, got: %s", stderr)
+		}
+	})
+}
+
+func TestArtifacts(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/form")
+	file := filepath.Join(t.TempDir(), "shot.png")
+	runBB(t, "screenshot", file)
+
+	out := runBB(t, "artifacts", "list", "--json")
+	var items []Artifact
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	var found *Artifact
+	for i := range items {
+		if items[i].Path == file {
+			found = &items[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("screenshot not in manifest: %s", out)
+	}
+	if found.Kind != "screenshot" || !strings.HasSuffix(found.URL, "/form") || found.Size == 0 {
+		t.Errorf("unexpected metadata: %+v", *found)
+	}
+
+	path := runBB(t, "artifacts", "get", fmt.Sprint(found.ID))
+	if strings.TrimSpace(path) != file {
+		t.Errorf("expected %s, got: %s", file, path)
+	}
+
+	_, _, code := runBBRaw("artifacts", "get", "9999")
+	if code == 0 {
+		t.Error("expected error for unknown artifact id")
+	}
+
+	// A download that finishes while a command runs is recorded too
+	dir := t.TempDir()
+	runBB(t, "config", "set", "download-dir", dir)
+	t.Cleanup(func() { _, _, _ = runBBRaw("config", "set", "download-dir", "") })
+	runBB(t, "js", `new Promise(r => {
+		const a = document.createElement('a');
+		a.href = '/download';
+		document.body.append(a);
+		a.click();
+		setTimeout(r, 1500);
+	})`)
+	items = nil
+	if err := json.Unmarshal([]byte(runBB(t, "artifacts", "list", "--json")), &items); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if last := items[len(items)-1]; last.Kind != "download" || last.Path != filepath.Join(dir, "report.csv") || last.Size == 0 {
+		t.Errorf("expected the download recorded, got %+v", last)
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 100))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 100; y++ {
+			// Alternate black and white columns
+			if x%2 == 0 {
+				src.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			} else {
+				src.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+			}
+		}
+	}
+
+	got := downscale(src, 200)
+	if b := got.Bounds(); b.Dx() != 200 || b.Dy() != 50 {
+		t.Fatalf("expected 200x50, got %dx%d", b.Dx(), b.Dy())
+	}
+	// Each destination pixel averages one white and one black column
+	if c := got.At(10, 10).(color.NRGBA); c.R < 120 || c.R > 135 {
+		t.Errorf("expected mid grey, got %v", c)
+	}
+
+	if downscale(src, 1000) != image.Image(src) {
+		t.Error("images within the limit should be returned unchanged")
+	}
+}
+
+func TestStitchTiles(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	b := image.NewNRGBA(image.Rect(0, 0, 100, 20))
+	b.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+
+	got := stitchTiles([]image.Image{a, b})
+	if bounds := got.Bounds(); bounds.Dx() != 100 || bounds.Dy() != 70 {
+		t.Fatalf("expected 100x70, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+	if c := got.At(0, 50).(color.NRGBA); c.R != 255 {
+		t.Errorf("expected second tile below the first, got %v at (0,50)", c)
+	}
+}
+
+func TestImgDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, red int) string {
+		img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		for i := 0; i < 100; i++ {
+			c := color.NRGBA{255, 255, 255, 255}
+			if i < red {
+				c = color.NRGBA{255, 0, 0, 255}
+			}
+			img.SetNRGBA(i%10, i/10, c)
+		}
+		file := filepath.Join(dir, name)
+		f, err := os.Create(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	a, b, c := write("a.png", 0), write("b.png", 0), write("c.png", 5)
+
+	t.Run("identical", func(t *testing.T) {
+		out := runBB(t, "imgdiff", a, b)
+		if !strings.Contains(out, "0 of 100 pixels differ") {
+			t.Errorf("expected no difference, got: %s", out)
+		}
+	})
+
+	t.Run("different", func(t *testing.T) {
+		diff := filepath.Join(dir, "diff.png")
+		stdout, _, code := runBBRaw("imgdiff", a, c, "--out", diff)
+		if code != exitFalse {
+			t.Errorf("expected exit %d, got %d", exitFalse, code)
+		}
+		if !strings.Contains(stdout, "5 of 100 pixels differ") {
+			t.Errorf("expected 5 changed pixels, got: %s", stdout)
+		}
+		if _, err := os.Stat(diff); err != nil {
+			t.Errorf("diff image not written: %v", err)
+		}
+	})
+
+	t.Run("within threshold", func(t *testing.T) {
+		_, _, code := runBBRaw("imgdiff", a, c, "--threshold", "0.1")
+		if code != 0 {
+			t.Errorf("expected exit 0 within threshold, got %d", code)
+		}
+	})
+}
+
+func TestAutocomplete(t *testing.T) {
+	t.Run("pick with keyboard", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/autocomplete")
+		out := runBB(t, "autocomplete", "#city", "ber", "--pick", "2")
+		if !strings.Contains(out, "Selected: Bern") {
+			t.Errorf("expected 'Selected: Bern', got: %s", out)
+		}
+		val := runBB(t, "js", `document.querySelector('#city').value`)
+		if strings.TrimSpace(val) != "Bern" {
+			t.Errorf("expected input value 'Bern', got: %q", val)
+		}
+	})
+
+	t.Run("pick with click and option selector", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/autocomplete")
+		runBB(t, "autocomplete", "#city", "par", "--option-selector", "#city-list li", "--click")
+		val := runBB(t, "js", `document.querySelector('#city').value`)
+		if strings.TrimSpace(val) != "Paris" {
+			t.Errorf("expected input value 'Paris', got: %q", val)
+		}
+	})
+
+	t.Run("too few suggestions", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/autocomplete")
+		_, stderr, code := runBBRaw("autocomplete", "#city", "ber", "--pick", "9")
+		if code == 0 {
+			t.Error("expected error when --pick exceeds the suggestions")
+		}
+		if !strings.Contains(stderr, `"Bergen"`) {
+			t.Errorf("expected suggestions in error, got: %s", stderr)
+		}
+	})
+}
+
+func TestRichtext(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/editor")
+	md := filepath.Join(t.TempDir(), "post.md")
+	if err := os.WriteFile(md, []byte("# Title\n\nSome **bold** text\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runBB(t, "richtext", "#editor", "--markdown", "@"+md)
+	if !strings.Contains(out, "Inserted markdown") {
+		t.Errorf("expected 'Inserted markdown', got: %s", out)
+	}
+	html := runBB(t, "js", `document.querySelector('#editor .body').innerHTML`)
+	if !strings.Contains(html, "<h1>Title</h1>") || !strings.Contains(html, "<strong>bold</strong>") {
+		t.Errorf("expected formatted content, got: %s", html)
+	}
+	if strings.Contains(html, "old") {
+		t.Errorf("expected previous content to be replaced, got: %s", html)
+	}
+
+	runBB(t, "richtext", "#editor", "--text", "more", "--append")
+	text := runBB(t, "text", "#editor .body")
+	if !strings.Contains(text, "Title") || !strings.Contains(text, "more") {
+		t.Errorf("expected appended text, got: %s", text)
+	}
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	cases := []struct {
+		md, want string
+	}{
+		{"# Hi", "<h1>Hi</h1>\n"},
+		{"one\ntwo", "<p>one two</p>\n"},
+		{"- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"1. a\n2. b", "<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"**b** *i* `x*y*` [l](https://e.x)", `<p><strong>b</strong> <em>i</em> <code>x*y*</code> <a href="https://e.x">l</a></p>` + "\n"},
+		{"```\n<tag>\n```", "<pre><code>&lt;tag&gt;\n</code></pre>\n"},
+		{"> quote", "<blockquote><p>quote</p></blockquote>\n"},
+	}
+	for _, tc := range cases {
+		if got := markdownToHTML(tc.md); got != tc.want {
+			t.Errorf("markdownToHTML(%q) = %q, want %q", tc.md, got, tc.want)
+		}
+	}
+}
+
+func TestCanvas(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/canvas")
+
+	t.Run("export", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "chart.png")
+		runBB(t, "canvas", "#chart", "--out", file)
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("canvas file not found: %v", err)
+		}
+		defer f.Close()
+		cfg, err := png.DecodeConfig(f)
+		if err != nil {
+			t.Fatalf("invalid PNG: %v", err)
+		}
+		if cfg.Width != 100 || cfg.Height != 50 {
+			t.Errorf("expected 100x50, got %dx%d", cfg.Width, cfg.Height)
+		}
+	})
+
+	t.Run("pixels", func(t *testing.T) {
+		out := runBB(t, "canvas", "#chart", "--pixels", "10,10;75,10")
+		if !strings.Contains(out, "10,10 rgba(255, 0, 0, 255)") || !strings.Contains(out, "75,10 rgba(0, 0, 0, 0)") {
+			t.Errorf("unexpected pixel values: %s", out)
+		}
+	})
+
+	t.Run("pixels and out", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "chart.png")
+		var r struct {
+			File   string `json:"file"`
+			Pixels []struct {
+				R int `json:"r"`
+			} `json:"pixels"`
+		}
+		if err := json.Unmarshal([]byte(runBB(t, "canvas", "#chart", "--pixels", "10,10", "--out", file, "--json")), &r); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(file); err != nil || r.File != file || len(r.Pixels) != 1 || r.Pixels[0].R != 255 {
+			t.Errorf("expected the file written and the pixel sampled, got %+v (%v)", r, err)
+		}
+	})
+
+	t.Run("not a canvas", func(t *testing.T) {
+		_, _, code := runBBRaw("canvas", "body", "--pixels", "0,0")
+		if code == 0 {
+			t.Error("expected error for non-canvas element")
+		}
+	})
+}
+
+func TestSave(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/form")
+	runBB(t, "input", "#name", "Dora")
+	dir := t.TempDir()
+
+	t.Run("mhtml", func(t *testing.T) {
+		file := filepath.Join(dir, "page.mhtml")
+		out := runBB(t, "save", file)
+		if !strings.Contains(out, "Saved") {
+			t.Errorf("expected 'Saved', got: %s", out)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("snapshot not written: %v", err)
+		}
+		if !strings.Contains(string(data), "multipart/related") {
+			t.Errorf("expected an MHTML document, got: %.200s", data)
+		}
+	})
+
+	t.Run("single html", func(t *testing.T) {
+		file := filepath.Join(dir, "page.html")
+		runBB(t, "save", file)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("snapshot not written: %v", err)
+		}
+		html := string(data)
+		if !strings.HasPrefix(html, "<!DOCTYPE html>") || !strings.Contains(html, `value="Dora"`) {
+			t.Errorf("expected HTML with current form values, got: %.300s", html)
+		}
+		if strings.Contains(html, "<script") {
+			t.Error("expected scripts to be removed")
+		}
+	})
+}
+
+func TestMediaEl(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/media")
+	// Wait for the metadata so the duration is known
+	for i := 0; i < 50; i++ {
+		if strings.TrimSpace(runBB(t, "js", `document.querySelector('#player').readyState >= 1`)) == "true" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Run("info", func(t *testing.T) {
+		out := runBB(t, "media-el", "#player", "info", "--json")
+		var info struct {
+			Duration float64 `json:"duration"`
+			Paused   bool    `json:"paused"`
+		}
+		if err := json.Unmarshal([]byte(out), &info); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, out)
+		}
+		if info.Duration < 1.9 || info.Duration > 2.1 || !info.Paused {
+			t.Errorf("expected a paused 2s clip, got: %s", out)
+		}
+		if out := runBB(t, "media-el", "#player", "info"); strings.Contains(out, "error:") {
+			t.Errorf("expected no error line for a playable clip, got: %s", out)
+		}
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		out := runBB(t, "media-el", "#player", "seek", "1.5")
+		if !strings.Contains(out, "Seeked (at 1.50s)") {
+			t.Errorf("expected 'Seeked (at 1.50s)', got: %s", out)
+		}
+	})
+
+	t.Run("mute and play", func(t *testing.T) {
+		runBB(t, "media-el", "#player", "mute")
+		runBB(t, "media-el", "#player", "play")
+		paused := runBB(t, "js", `document.querySelector('#player').paused`)
+		if strings.TrimSpace(paused) != "false" {
+			t.Errorf("expected media to play, got paused=%s", paused)
+		}
+		runBB(t, "media-el", "#player", "pause")
+	})
+
+	t.Run("not media", func(t *testing.T) {
+		_, _, code := runBBRaw("media-el", "body", "play")
+		if code == 0 {
+			t.Error("expected error for non-media element")
+		}
+	})
+}
+
+func TestMeta(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/meta")
+
+	out := runBB(t, "meta", "--json")
+	var meta struct {
+		Canonical   string                 `json:"canonical"`
+		Description string                 `json:"description"`
+		OpenGraph   map[string]interface{} `json:"openGraph"`
+		Twitter     map[string]string      `json:"twitter"`
+		JSONLD      []map[string]string    `json:"jsonLD"`
+		Feeds       []struct {
+			Href string `json:"href"`
+		} `json:"feeds"`
+		Alternates []struct {
+			Hreflang string `json:"hreflang"`
+		} `json:"alternates"`
+	}
+	if err := json.Unmarshal([]byte(out), &meta); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if meta.Canonical != server.URL+"/canonical-article" {
+		t.Errorf("expected absolute canonical URL, got %q", meta.Canonical)
+	}
+	if meta.Description != "A page with metadata" || meta.OpenGraph["title"] != "OG Title" || meta.Twitter["card"] != "summary" {
+		t.Errorf("missing meta fields: %s", out)
+	}
+	if images, _ := meta.OpenGraph["image"].([]interface{}); len(images) != 2 {
+		t.Errorf("expected repeated og:image as a list, got %v", meta.OpenGraph["image"])
+	}
+	if len(meta.JSONLD) != 1 || meta.JSONLD[0]["headline"] != "LD Headline" {
+		t.Errorf("expected parsed JSON-LD, got %v", meta.JSONLD)
+	}
+	if len(meta.Feeds) != 1 || len(meta.Alternates) != 1 || meta.Alternates[0].Hreflang != "de" {
+		t.Errorf("expected one feed and one alternate, got: %s", out)
+	}
+
+	text := runBB(t, "meta")
+	if !strings.Contains(text, "og:title: OG Title") || !strings.Contains(text, "json-ld:") {
+		t.Errorf("unexpected text output: %s", text)
+	}
+}
+
+func TestImages(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/images")
+	runBB(t, "wait", "#hero")
+
+	dir := t.TempDir()
+	out := runBB(t, "images", "--json", "--download", dir)
+	var images []struct {
+		Kind         string  `json:"kind"`
+		URL          string  `json:"url"`
+		Alt          *string `json:"alt"`
+		NaturalWidth int     `json:"naturalWidth"`
+		Loaded       bool    `json:"loaded"`
+		Lazy         bool    `json:"lazy"`
+		File         string  `json:"file"`
+	}
+	if err := json.Unmarshal([]byte(out), &images); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	kinds := map[string]int{}
+	for _, img := range images {
+		kinds[img.Kind]++
+	}
+	if kinds["img"] != 2 || kinds["picture"] != 1 || kinds["background"] != 1 {
+		t.Fatalf("unexpected images: %s", out)
+	}
+
+	plain := images[0]
+	if plain.URL != server.URL+"/img/pixel.png" || plain.Alt == nil || *plain.Alt != "A pixel" || plain.NaturalWidth != 3 {
+		t.Errorf("unexpected plain image: %+v", plain)
+	}
+	if !strings.HasSuffix(images[1].URL, "/img/pixel.png?picture") {
+		t.Errorf("expected the picture source, got %s", images[1].URL)
+	}
+	lazy := images[2]
+	if !lazy.Lazy || lazy.Loaded || lazy.URL != server.URL+"/img/lazy.png" {
+		t.Errorf("unexpected lazy image: %+v", lazy)
+	}
+	if plain.File == "" || images[3].File != plain.File {
+		t.Errorf("expected the background to reuse the plain download, got %q and %q", plain.File, images[3].File)
+	}
+	data, err := os.ReadFile(plain.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("downloaded file is not a PNG: %v", err)
+	}
+
+	text := runBB(t, "images")
+	if !strings.Contains(text, `alt="A pixel"`) || !strings.Contains(text, "4 images") {
+		t.Errorf("unexpected text output: %s", text)
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	out := runBB(t, "sitemap", server.URL)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 URLs from the nested sitemaps, got: %s", out)
+	}
+	if lines[0] != server.URL+"/\t2024-01-01" {
+		t.Errorf("expected url and lastmod, got %q", lines[0])
+	}
+
+	out = runBB(t, "sitemap", server.URL, "--filter", "/posts/", "--limit", "2", "--json")
+	var urls []struct {
+		URL     string `json:"url"`
+		Lastmod string `json:"lastmod"`
+	}
+	if err := json.Unmarshal([]byte(out), &urls); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(urls) != 2 || urls[0].URL != server.URL+"/posts/1" || urls[1].Lastmod != "2024-02-02" {
+		t.Errorf("expected the first two posts, got: %s", out)
+	}
+
+	out = runBB(t, "sitemap", server.URL+"/sitemap-pages.xml")
+	if strings.Count(out, "\n") != 2 {
+		t.Errorf("expected only the given sitemap, got: %s", out)
+	}
+}
+
+func TestLinkedText(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div><p>See <a href="https://example.com/a">the <b>docs</b></a>.</p>` +
+		`<a href="#top">Top</a> <a href="javascript:void(0)">Menu</a><script>var x = 1;</script></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := linkedText(doc)
+	want := "See [the docs](https://example.com/a).Top Menu"
+	if got != want {
+		t.Errorf("linkedText = %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalHTML(t *testing.T) {
+	a := `<div class="card css-1x2y3z" id="c" data-reactid="42"><p   style="color:red"  nonce="abc">Hello
+	world</p><br><pre>  keep
+  this</pre><!-- build 123 --></div>`
+	b := `<div data-reactid="7" id="c" class="css-9q8w7e card"><p nonce="xyz" style="color:red">Hello world</p><br><pre>  keep
+  this</pre></div>`
+	ca, err := canonicalHTML(a, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, err := canonicalHTML(b, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca != cb {
+		t.Errorf("expected equal canonical forms:\n%s\n---\n%s", ca, cb)
+	}
+	want := `<div class="card" id="c">
+  <p style="color:red">Hello world</p>
+  <br>
+  <pre>  keep
+  this</pre>
+</div>
+`
+	if ca != want {
+		t.Errorf("canonicalHTML = %q, want %q", ca, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+
+	out := runBB(t, "search", "TEST PAGE", "--json")
+	var hits []struct {
+		Line     int      `json:"line"`
+		Match    string   `json:"match"`
+		Selector string   `json:"selector"`
+		Before   []string `json:"before"`
+	}
+	if err := json.Unmarshal([]byte(out), &hits); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(hits) != 1 || hits[0].Match != "test page" || hits[0].Selector != "#intro" {
+		t.Errorf("expected one hit in #intro, got: %s", out)
+	}
+
+	out = runBB(t, "search", `Paragraph \w+`, "--regex", "--context", "1")
+	if !strings.Contains(out, "Paragraph two.  [body > p:nth-of-type(2)]") || !strings.Contains(out, "This is a test page") {
+		t.Errorf("expected the hit with context, got: %s", out)
+	}
+
+	if _, _, code := runBBRaw("search", "no such text anywhere"); code != 1 {
+		t.Errorf("expected exit 1 without matches, got %d", code)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "open", "--raw", server.URL+"/page2")
+	runBB(t, "back")
+
+	out := runBB(t, "history", "--json")
+	var entries []struct {
+		N     int    `json:"n"`
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	n := len(entries)
+	if n < 3 || entries[n-3].URL != server.URL+"/" || entries[n-2].URL != server.URL+"/page2" || entries[n-1].URL != server.URL+"/" {
+		t.Fatalf("expected open, open, back at the end of the history, got: %s", out)
+	}
+
+	out = runBB(t, "history", "goto", fmt.Sprint(n-1))
+	if strings.TrimSpace(out) != server.URL+"/page2" {
+		t.Errorf("expected goto to return to page2, got: %s", out)
+	}
+	if _, _, code := runBBRaw("history", "goto", "9999"); code == 0 {
+		t.Error("expected an error for a missing entry")
+	}
+}
+
+func TestMarks(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "mark", "results")
+	runBB(t, "open", "--raw", server.URL+"/page2")
+	runBB(t, "mark", "detail", "--scroll")
+
+	out := runBB(t, "marks")
+	if !strings.Contains(out, "results") || !strings.Contains(out, server.URL+"/page2 (scroll 0,0)") {
+		t.Errorf("expected both marks, got: %s", out)
+	}
+
+	out = runBB(t, "goto", "results")
+	if strings.TrimSpace(out) != server.URL+"/" {
+		t.Errorf("expected goto to open the marked URL, got: %s", out)
+	}
+	if _, _, code := runBBRaw("goto", "nowhere"); code == 0 {
+		t.Error("expected an error for an unknown mark")
+	}
+
+	runBB(t, "marks", "rm", "detail")
+	out = runBB(t, "marks", "--json")
+	var marks map[string]struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(out), &marks); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if _, ok := marks["detail"]; ok || marks["results"].URL != server.URL+"/" {
+		t.Errorf("expected only the results mark, got: %s", out)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "storage", "clear")
+	runBB(t, "storage", "set", "token", "abc123")
+	runBB(t, "storage", "set", "flag", "on", "--session")
+
+	if out := runBB(t, "storage", "get", "token"); strings.TrimSpace(out) != "abc123" {
+		t.Errorf("expected the stored token, got: %s", out)
+	}
+	if _, _, code := runBBRaw("storage", "get", "flag"); code != exitNotFound {
+		t.Errorf("expected sessionStorage keys to stay out of localStorage, got exit %d", code)
+	}
+	if out := runBB(t, "js", "sessionStorage.getItem('flag')"); strings.TrimSpace(out) != "on" {
+		t.Errorf("expected the session value, got: %s", out)
+	}
+
+	out := runBB(t, "storage", "dump", "--json")
+	var dump struct {
+		Origin string            `json:"origin"`
+		Items  map[string]string `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(out), &dump); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if dump.Origin != server.URL || len(dump.Items) != 1 || dump.Items["token"] != "abc123" {
+		t.Errorf("unexpected dump: %s", out)
+	}
+
+	runBB(t, "storage", "delete", "token")
+	if _, _, code := runBBRaw("storage", "delete", "token"); code == 0 {
+		t.Error("expected deleting a missing key to fail")
+	}
+}
+
+func TestSessionExportImport(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/page2")
+	runBB(t, "js", "document.cookie = 'sid=abc; path=/'")
+	runBB(t, "storage", "set", "token", "t0k3n")
+	file := filepath.Join(t.TempDir(), "session.json")
+	out := runBB(t, "session", "export", file)
+	if !strings.Contains(out, "storage of 1 origins") {
+		t.Errorf("expected the origin's storage to be exported, got: %s", out)
+	}
+
+	// The bundle survives a fresh browser
+	runBB(t, "stop")
+	runBB(t, "session", "import", file)
+	if out := runBB(t, "url"); strings.TrimSpace(out) != server.URL+"/page2" {
+		t.Errorf("expected the tab to be restored, got: %s", out)
+	}
+	if out := runBB(t, "js", "document.cookie"); !strings.Contains(out, "sid=abc") {
+		t.Errorf("expected the cookie to be restored, got: %s", out)
+	}
+	if out := runBB(t, "storage", "get", "token"); strings.TrimSpace(out) != "t0k3n" {
+		t.Errorf("expected localStorage to be restored, got: %s", out)
+	}
+}
+
+func TestStopSaveSession(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/tall")
+	runBB(t, "js", "window.scrollTo(0, 1200)")
+	runBB(t, "storage", "set", "draft", "kept")
+	out := runBB(t, "stop", "--save-session")
+	if !strings.Contains(out, "Saved 1 pages") || !strings.Contains(out, "Browser stopped") {
+		t.Errorf("expected the session to be saved before stopping, got: %s", out)
+	}
+
+	runBB(t, "session", "restore")
+	if out := runBB(t, "url"); strings.TrimSpace(out) != server.URL+"/tall" {
+		t.Errorf("expected the tab to be restored, got: %s", out)
+	}
+	if out := runBB(t, "js", "window.scrollY"); strings.TrimSpace(out) != "1200" {
+		t.Errorf("expected the scroll position to be restored, got: %s", out)
+	}
+	if out := runBB(t, "storage", "get", "draft"); strings.TrimSpace(out) != "kept" {
+		t.Errorf("expected localStorage to be restored, got: %s", out)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "throttle", "offline")
+	if out := runBB(t, "js", "navigator.onLine"); strings.TrimSpace(out) != "false" {
+		t.Errorf("expected the page to be offline, got: %s", out)
+	}
+	runBB(t, "throttle", "custom", "--down", "800", "--latency", "100")
+	if out := runBB(t, "throttle", "status"); !strings.Contains(out, "down 800 kbps, up unlimited, latency 100 ms") {
+		t.Errorf("unexpected status: %s", out)
+	}
+	runBB(t, "throttle", "off")
+	if out := runBB(t, "js", "navigator.onLine"); strings.TrimSpace(out) != "true" {
+		t.Errorf("expected the page to be online again, got: %s", out)
+	}
+}
+
+func TestPerf(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	var r struct {
+		URL      string   `json:"url"`
+		LoadMS   float64  `json:"load_ms"`
+		FCPMS    *float64 `json:"fcp_ms"`
+		DOMNodes int      `json:"dom_nodes"`
+		JSHeap   int64    `json:"js_heap_used"`
+	}
+	if err := json.Unmarshal([]byte(runBB(t, "perf", "--json")), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.URL != server.URL+"/" || r.LoadMS <= 0 || r.DOMNodes == 0 || r.JSHeap == 0 {
+		t.Errorf("unexpected report: %+v", r)
+	}
+	if r.FCPMS == nil {
+		t.Error("expected a first contentful paint")
+	}
+
+	out := runBB(t, "perf", "--cpu", "4x", "--reload")
+	if !strings.Contains(out, "4x slowdown") {
+		t.Errorf("expected the report to show the CPU throttle, got: %s", out)
+	}
+	if out := runBB(t, "perf", "--cpu", "off"); !strings.Contains(out, "CPU throttling off") {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "trace", "start")
+	if out := runBB(t, "trace", "status"); !strings.Contains(out, "Recording a trace") {
+		t.Errorf("expected a recording, got: %s", out)
+	}
+	runBB(t, "open", "--raw", server.URL+"/page2")
+	file := filepath.Join(t.TempDir(), "trace.json")
+	runBB(t, "trace", "stop", file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []struct {
+			Name string `json:"name"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("trace is not JSON: %v", err)
+	}
+	if len(trace.TraceEvents) == 0 {
+		t.Error("expected trace events")
+	}
+	if out := runBB(t, "trace", "status"); !strings.Contains(out, "No trace recording") {
+		t.Errorf("expected the recording to be over, got: %s", out)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/audit")
+	var r struct {
+		Score      int `json:"score"`
+		Categories map[string]struct {
+			Score  int `json:"score"`
+			Audits []struct {
+				ID      string   `json:"id"`
+				Passed  bool     `json:"passed"`
+				Details []string `json:"details"`
+			} `json:"audits"`
+		} `json:"categories"`
+	}
+	if err := json.Unmarshal([]byte(runBB(t, "audit", "--json")), &r); err != nil {
+		t.Fatal(err)
+	}
+	failed := map[string][]string{}
+	for _, cat := range r.Categories {
+		for _, a := range cat.Audits {
+			if !a.Passed {
+				failed[a.ID] = a.Details
+			}
+		}
+	}
+	for _, id := range []string{"meta-description", "image-alt", "label", "console-errors"} {
+		if _, ok := failed[id]; !ok {
+			t.Errorf("expected %s to fail, failed: %v", id, failed)
+		}
+	}
+	for _, id := range []string{"document-title", "viewport", "html-lang", "mixed-content"} {
+		if _, ok := failed[id]; ok {
+			t.Errorf("expected %s to pass, got: %v", id, failed[id])
+		}
+	}
+	if d := failed["label"]; len(d) != 1 || d[0] != "#unlabelled" {
+		t.Errorf("expected only the unlabelled input, got: %v", d)
+	}
+	if r.Categories["a11y"].Score >= 100 || r.Score == 0 {
+		t.Errorf("unexpected scores: %+v", r)
+	}
+
+	// A category given twice counts once
+	var twice struct {
+		Score      int                        `json:"score"`
+		Categories map[string]json.RawMessage `json:"categories"`
+	}
+	if err := json.Unmarshal([]byte(runBB(t, "audit", "--categories", "a11y,seo,a11y", "--json")), &twice); err != nil {
+		t.Fatal(err)
+	}
+	if want := int(math.Round(float64(r.Categories["a11y"].Score+r.Categories["seo"].Score) / 2)); len(twice.Categories) != 2 || twice.Score != want {
+		t.Errorf("expected a11y and seo once each (score %d), got %d over %d categories", want, twice.Score, len(twice.Categories))
+	}
+
+	runBB(t, "audit", "--categories", "seo", "--min-score", "50")
+	if _, _, code := runBBRaw("audit", "--categories", "a11y", "--min-score", "100"); code != exitFalse {
+		t.Errorf("expected exit 1 below --min-score, got %d", code)
+	}
+}
+
+func TestCheckAxe(t *testing.T) {
+	if err := checkAxe([]byte("var axe = {};")); err == nil || !strings.Contains(err.Error(), "expected "+axeSHA256) {
+		t.Errorf("expected a tampered axe-core to be refused, got %v", err)
+	}
+
+	// The build the digest was pinned for is accepted
+	build := []byte("var axe = {version: '4.10.2'};")
+	sum := sha256.Sum256(build)
+	defer func(pinned string) { axeSHA256 = pinned }(axeSHA256)
+	axeSHA256 = hex.EncodeToString(sum[:])
+	if err := checkAxe(build); err != nil {
+		t.Errorf("expected the pinned build to be accepted, got %v", err)
+	}
+}
+
+func TestAxAudit(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/audit")
+	out := runBB(t, "ax-audit", "--axe", server.URL+"/axe.js")
+	if !strings.Contains(out, "1 violations (1 critical)") || !strings.Contains(out, "CRITICAL") || !strings.Contains(out, "#logo") {
+		t.Errorf("unexpected report: %s", out)
+	}
+
+	var r struct {
+		Counts     map[string]int `json:"counts"`
+		Violations []struct {
+			ID    string `json:"id"`
+			Nodes []struct {
+				Target string `json:"target"`
+			} `json:"nodes"`
+		} `json:"violations"`
+	}
+	if err := json.Unmarshal([]byte(runBB(t, "ax-audit", "--axe", server.URL+"/axe.js", "--json")), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Counts["critical"] != 1 || len(r.Violations) != 1 || r.Violations[0].Nodes[0].Target != "#logo" {
+		t.Errorf("unexpected JSON report: %+v", r)
+	}
+}
+
+func TestLayoutText(t *testing.T) {
+	t.Run("reading order", func(t *testing.T) {
+		frag := func(x, y, w float64, text string) textFrag { return textFrag{x, y, w, 20, text} }
+		frags := []textFrag{
+			frag(0, 0, 500, "Headline"),
+			// Two columns: the left one reads first although its lines interleave
+			frag(0, 40, 200, "Left one"),
+			frag(300, 40, 200, "Right one"),
+			frag(0, 60, 200, "Left two"),
+			frag(300, 80, 200, "Right two"),
+			// A grid row far below: cells on one line
+			frag(0, 200, 50, "Name"),
+			frag(200, 200, 50, "Price"),
+			frag(0, 220, 50, "Tea"),
+			frag(200, 220, 50, "3"),
+		}
+		var got []string
+		for _, b := range layoutText(frags) {
+			got = append(got, b.Label+": "+b.Text)
+		}
+		want := []string{
+			"region 1: Headline",
+			"region 1, column 1/2: Left one\nLeft two",
+			"region 1, column 2/2: Right one\n\nRight two",
+			"region 2: Name | Price\nTea | 3",
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("page", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/columns")
+		out := runBB(t, "layout-text")
+		left := strings.Index(out, "second line")
+		right := strings.Index(out, "Right column")
+		if !strings.Contains(out, "column 1/2") || left < 0 || right < left {
+			t.Errorf("expected the left column before the right one, got: %s", out)
+		}
+	})
+}
+
+func TestGrid(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/grid")
+	out := runBB(t, "grid", "--json")
+	var r gridResult
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if !slices.Equal(r.Columns, []string{"Name", "Qty"}) {
+		t.Errorf("columns = %q", r.Columns)
+	}
+	// 100 rows, though no more than six are ever in the DOM
+	if len(r.Rows) != 100 || r.RowCount != 101 {
+		t.Fatalf("got %d rows (row_count %d), want 100", len(r.Rows), r.RowCount)
+	}
+	if last := r.Rows[99]; last.Index != 101 || !slices.Equal(last.Cells, []string{"Item 100", "297"}) {
+		t.Errorf("last row = %+v", last)
+	}
+
+	out = runBB(t, "grid", "--max-rows", "3")
+	if !strings.Contains(out, "Item 3") || strings.Contains(out, "Item 4") || !strings.Contains(out, "(3 rows of 100)") {
+		t.Errorf("unexpected table: %s", out)
+	}
+
+	// Rows without aria-rowindex are kept even when they read the same
+	runBB(t, "js", `document.body.insertAdjacentHTML('afterbegin', '<table id="plain"><tr><th>Name</th></tr><tr><td>Same</td></tr><tr><td>Same</td></tr><tr><td>Other</td></tr></table>')`)
+	r = gridResult{}
+	if err := json.Unmarshal([]byte(runBB(t, "grid", "#plain", "--json")), &r); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(r.Rows) != 3 || r.Rows[0].Cells[0] != "Same" || r.Rows[1].Cells[0] != "Same" {
+		t.Errorf("expected both identical rows, got %+v", r.Rows)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/snapshot")
+	out := runBB(t, "snapshot")
+	want := []string{
+		"Title: Snapshot",
+		`[1] link "Home" -> a`,
+		`[2] textbox "Email" value="ann@example.com" (required) -> #email`,
+		`[3] checkbox "Remember me" (checked) -> `,
+		`[4] button "Sign in" (disabled) -> #login > button`,
+	}
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("expected %q in:\n%s", w, out)
+		}
+	}
+	if strings.Contains(out, "Hidden") || strings.Contains(out, "[5]") {
+		t.Errorf("expected hidden elements to be left out:\n%s", out)
+	}
+
+	var snap pageSnapshot
+	if err := json.Unmarshal([]byte(runBB(t, "snapshot", "--json")), &snap); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(snap.Elements) != 4 || snap.Elements[1].Selector != "#email" || !strings.HasSuffix(snap.URL, "/snapshot") {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	runBB(t, "focus", "--node", fmt.Sprint(snap.Elements[1].BackendNodeID))
+	if out := runBB(t, "js", "document.activeElement.id"); strings.TrimSpace(out) != "email" {
+		t.Errorf("expected the backendNodeId to reach #email, got %q", out)
+	}
+}
+
+func TestVirtualScrape(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/feed")
+	out := runBB(t, "virtual-scrape", "#feed", "--item", ".post", "--json")
+	var items []virtualItem
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	// All 120, across the load at the bottom, though at most 7 are mounted
+	if len(items) != 120 || items[0].Text != "Post 1" || items[119].Text != "Post 120" {
+		t.Fatalf("got %d items: %+v", len(items), items)
+	}
+
+	runBB(t, "reload")
+	out = runBB(t, "virtual-scrape", "#feed", "--item", ".post", "--until-count", "10")
+	if !strings.Contains(out, "[10] Post 10") || strings.Contains(out, "[11]") {
+		t.Errorf("expected exactly 10 items, got: %s", out)
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "bb-client"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	// An internal app that only lets clients with a certificate in
+	app := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	app.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	app.StartTLS()
+	defer app.Close()
+	roots := filepath.Join(dir, "roots.pem")
+	os.WriteFile(roots, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: app.Certificate().Raw}), 0644)
+
+	t.Cleanup(func() { runBBRaw("config", "client-cert", "") })
+	out := runBB(t, "config", "client-cert", certFile, keyFile, "--origin", app.URL)
+	if !strings.Contains(out, "--origin 127.0.0.1") {
+		t.Errorf("unexpected config: %s", out)
+	}
+	if _, stderr, code := runBBRaw("config", "client-cert", keyFile, certFile); code == 0 || !strings.Contains(stderr, "invalid certificate") {
+		t.Errorf("expected swapped files to be rejected, got %d: %s", code, stderr)
+	}
+
+	// The proxy Chrome is pointed at; it stays up while this process does
+	cmd := exec.Command(bbBin, "__cert-proxy")
+	cmd.Env = append(os.Environ(), "HOME="+tempHome, "SSL_CERT_FILE="+roots)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	fmt.Fprintln(stdin, os.Getpid())
+	var ready struct {
+		Port int    `json:"port"`
+		SPKI string `json:"spki"`
+		PAC  string `json:"pac"`
+	}
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	if err := json.Unmarshal([]byte(line), &ready); err != nil {
+		t.Fatalf("proxy not ready: %q", line)
+	}
+	if !strings.Contains(ready.PAC, `shExpMatch(host, "127.0.0.1")`) {
+		t.Errorf("unexpected PAC script: %s", ready.PAC)
+	}
+
+	authFile := filepath.Join(tempHome, ".bb", "cert-proxy.auth")
+	password, err := os.ReadFile(authFile)
+	if err != nil {
+		t.Fatalf("expected the proxy's password in %s: %v", authFile, err)
+	}
+	if fi, _ := os.Stat(authFile); fi.Mode().Perm() != 0600 {
+		t.Errorf("expected the password file to be private, got %v", fi.Mode().Perm())
+	}
+
+	proxy := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", ready.Port)}
+	anon := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{Proxy: http.ProxyURL(proxy)}}
+	if _, err := anon.Get(app.URL); err == nil || !strings.Contains(err.Error(), "Proxy Authentication Required") {
+		t.Errorf("expected a CONNECT without the password to be refused, got %v", err)
+	}
+	proxy.User = url.UserPassword("bb", strings.TrimSpace(string(password)))
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{
+		Proxy: http.ProxyURL(proxy),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, VerifyConnection: func(cs tls.ConnectionState) error {
+			// What Chrome checks with --ignore-certificate-errors-spki-list
+			sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if base64.StdEncoding.EncodeToString(sum[:]) != ready.SPKI {
+				return fmt.Errorf("the proxy's certificate doesn't match the SPKI hash")
+			}
+			return nil
+		}},
+	}}
+	resp, err := client.Get(app.URL)
+	if err != nil {
+		t.Fatalf("request through the proxy failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body := new(strings.Builder)
+	io.Copy(body, resp.Body)
+	if body.String() != "bb-client" {
+		t.Errorf("expected the app to see the client certificate, got %q", body)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/multi")
+	boxes := func() string {
+		return strings.TrimSpace(runBB(t, "js", "document.querySelectorAll('#__bb_highlight > div').length"))
+	}
+	runBB(t, "highlight", "#btn")
+	if n := boxes(); n != "1" {
+		t.Errorf("expected one outline, got %s", n)
+	}
+	if out := runBB(t, "text"); strings.Contains(out, "#btn") {
+		t.Errorf("expected the label to stay out of the page text, got: %s", out)
+	}
+	runBB(t, "highlight", ".item", "--all", "--color", "blue")
+	if n := boxes(); n != "4" {
+		t.Errorf("expected four outlines, got %s", n)
+	}
+	runBB(t, "highlight", "--clear")
+	if n := boxes(); n != "0" {
+		t.Errorf("expected --clear to remove the outlines, got %s", n)
+	}
+
+	file := filepath.Join(t.TempDir(), "target.png")
+	out := runBB(t, "highlight", "#btn", "--label", "clicked", "--screenshot="+file)
+	if strings.TrimSpace(out) != file {
+		t.Errorf("expected the screenshot path, got: %s", out)
+	}
+	if data, err := os.ReadFile(file); err != nil || !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		t.Errorf("expected a PNG at %s: %v", file, err)
+	}
+	if n := boxes(); n != "0" {
+		t.Errorf("expected the outline removed after the screenshot, got %s", n)
+	}
+}
+
+func TestAssert(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/snapshot")
+
+	for _, check := range [][]string{
+		{"text", "a", "Home"},
+		{"value", "#email", "ann@example.com"},
+		{"attr", "#email", "type", "email"},
+		{"count", "input", "3"},
+		{"count", "label", ">=2"},
+		{"visible", "#email"},
+		{"visible", "--not", "input[type=hidden]"},
+		{"url", "--contains", "/snapshot"},
+		{"title", "--regex", "^Snap"},
+		{"text", "--not", "a", "Away"},
+	} {
+		if out := runBB(t, append([]string{"assert"}, check...)...); !strings.HasPrefix(out, "ok ") {
+			t.Errorf("bb assert %q: %s", check, out)
+		}
+	}
+
+	_, stderr, code := runBBRaw("assert", "value", "#email", "ann@example.org", "--wait", "0")
+	if code != exitFalse || !strings.Contains(stderr, `expected: "ann@example.org"`) || !strings.Contains(stderr, `actual:   "ann@example.com"`) ||
+		!strings.Contains(stderr, "^ differs at character 13") {
+		t.Errorf("expected a diff and exit code %d, got %d: %s", exitFalse, code, stderr)
+	}
+	// The caret sits under the first differing character ("o" of .org/.com)
+	lines := strings.Split(stderr, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, "  actual:") && i+1 < len(lines) {
+			if col := strings.Index(lines[i+1], "^"); col < 0 || l[col:col+3] != "com" {
+				t.Errorf("caret misplaced:\n%s\n%s", l, lines[i+1])
+			}
+		}
+	}
+	if _, stderr, code := runBBRaw("assert", "text", "#nope", "x", "--wait", "0"); code != exitFalse || !strings.Contains(stderr, "no element matches #nope") {
+		t.Errorf("expected a missing element to fail, got %d: %s", code, stderr)
+	}
+
+	// The check waits for the page to catch up
+	runBB(t, "js", "setTimeout(() => document.title = 'Later', 500)")
+	runBB(t, "assert", "title", "Later")
+}
+
+func TestAudio(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/audio")
+	runBB(t, "audio", "capture", "start")
+	if out := runBB(t, "audio", "capture", "status"); !strings.Contains(out, "Capturing audio since") {
+		t.Errorf("expected a running capture, got: %s", out)
+	}
+	runBB(t, "click", "#beep")
+	runBB(t, "click", "#say")
+	runBB(t, "sleep", "1.5")
+	if title := strings.TrimSpace(runBB(t, "js", "document.title")); title != "spoken" {
+		t.Errorf("expected the speech stub to fire end, got title %q", title)
+	}
+
+	file := filepath.Join(t.TempDir(), "out.wav")
+	var r audioResult
+	if err := json.Unmarshal([]byte(runBB(t, "--json", "audio", "capture", "stop", file)), &r); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if r.Silent || r.Duration < 0.4 {
+		t.Errorf("expected the beep to be recorded, got %+v", r)
+	}
+	if len(r.Utterances) != 1 || r.Utterances[0].Text != "Order confirmed" {
+		t.Errorf("expected the utterance to be logged, got %+v", r.Utterances)
+	}
+	if data, err := os.ReadFile(file); err != nil || !bytes.HasPrefix(data, []byte("RIFF")) || len(data) < 44 {
+		t.Errorf("expected a WAV at %s: %v", file, err)
+	}
+	if out := runBB(t, "audio", "capture", "status"); !strings.Contains(out, "No audio capture running") {
+		t.Errorf("expected the capture to end, got: %s", out)
+	}
+	if _, stderr, code := runBBRaw("audio", "capture", "stop"); code == 0 || !strings.Contains(stderr, "no audio capture running") {
+		t.Errorf("expected stop without a capture to fail, got %d: %s", code, stderr)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("gives up", func(t *testing.T) {
+		_, stderr, code := runBBRaw("retry", "--attempts", "2", "--delay", "0", "--", "imgdiff", "/nonexistent/a.png", "/nonexistent/b.png")
+		if code != 1 {
+			t.Errorf("expected the command's exit code, got %d", code)
+		}
+		if !strings.Contains(stderr, "attempt 1/2 failed (exit 1: ") || strings.Contains(stderr, "attempt 2/2 failed") {
+			t.Errorf("expected one retry notice, got: %s", stderr)
+		}
+	})
+
+	t.Run("usage errors", func(t *testing.T) {
+		_, stderr, code := runBBRaw("retry", "--delay", "0", "--", "config", "no-such-key")
+		if code != 2 || strings.Contains(stderr, "attempt 1/3") {
+			t.Errorf("expected a usage error without retries, got %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("until it passes", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/delayed")
+		out := runBB(t, "retry", "--attempts", "10", "--delay", "0.2", "--backoff", "1", "--", "assert", "visible", "#delayed-el", "--wait", "0")
+		if !strings.HasPrefix(out, "ok   visible") {
+			t.Errorf("expected the passing attempt's output only, got: %s", out)
+		}
+	})
+}
+
+func TestExitCodes(t *testing.T) {
+	t.Run("usage", func(t *testing.T) {
+		for _, args := range [][]string{{"no-such-command"}, {"config", "no-such-key"}, {"sleep"}} {
+			if _, _, code := runBBRaw(args...); code != 2 {
+				t.Errorf("bb %s: expected exit code 2, got %d", strings.Join(args, " "), code)
+			}
+		}
+	})
+
+	t.Run("json errors", func(t *testing.T) {
+		_, stderr, _ := runBBRaw("config", "no-such-key", "--json")
+		var e struct {
+			Error cliError `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(stderr), &e); err != nil {
+			t.Fatalf("expected a JSON error, got %q: %v", stderr, err)
+		}
+		if e.Error.Code != "usage" || e.Error.ExitCode != 2 || !strings.Contains(e.Error.Message, "no-such-key") {
+			t.Errorf("unexpected error: %+v", e.Error)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		runBB(t, "open", "--raw", server.URL+"/multi")
+		_, stderr, code := runBBRaw("click", "#missing", "--timeout", "1", "--json")
+		if code != 3 {
+			t.Errorf("expected exit code 3, got %d", code)
+		}
+		var e struct {
+			Error cliError `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(stderr), &e); err != nil || e.Error.Code != "not_found" || e.Error.Selector != "#missing" {
+			t.Errorf("expected a not_found error for #missing, got %q", stderr)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		if _, _, code := runBBRaw("wait", "#missing", "--timeout", "1"); code != 4 {
+			t.Errorf("expected exit code 4, got %d", code)
+		}
+	})
+}
+
+func TestJSONEnvelope(t *testing.T) {
+	var e envelope
+	if err := json.Unmarshal([]byte(runBB(t, "sleep", "0.1", "--json")), &e); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !e.OK || e.Command != "sleep" || e.DurationMS < 100 {
+		t.Errorf("unexpected envelope: %+v", e)
+	}
+
+	runBB(t, "open", "--raw", server.URL+"/multi")
+	if err := json.Unmarshal([]byte(runBB(t, "click", "#btn", "--json")), &e); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !e.OK || e.Command != "click" || e.Output != "Clicked" {
+		t.Errorf("unexpected envelope: %+v", e)
+	}
+	stdout, _, code := runBBRaw("exists", "#missing", "--json")
+	if err := json.Unmarshal([]byte(stdout), &e); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if code != exitFalse || e.OK || e.ExitCode != exitFalse || e.Output != "false" {
+		t.Errorf("expected a false answer, got %d: %+v", code, e)
+	}
+	// Commands with their own JSON print it as they are, unless --envelope
+	// wraps it too
+	if out := runBB(t, "pages", "--json"); !strings.HasPrefix(out, "[") {
+		t.Errorf("expected the pages list unchanged, got: %s", out)
+	}
+	e = envelope{}
+	if err := json.Unmarshal([]byte(runBB(t, "pages", "--envelope")), &e); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !e.OK || e.Command != "pages" || e.Output != "" || !strings.HasPrefix(string(e.Result), "[") {
+		t.Errorf("expected the pages list as the result, got: %+v", e)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	runBB(t, "journal", "--clear")
+	runBB(t, "sleep", "0.05")
+	runBBRaw("config", "no-such-key")
+	runBB(t, "config", "timeout")
+
+	var entries []journalEntry
+	if err := json.Unmarshal([]byte(runBB(t, "journal", "--json")), &entries); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Command != "sleep" || strings.Join(e.Args, " ") != "0.05" || e.ExitCode != 0 || e.DurationMS < 50 {
+		t.Errorf("unexpected first entry: %+v", e)
+	}
+	if e := entries[1]; e.ExitCode != 2 || !strings.Contains(e.Error, "no-such-key") {
+		t.Errorf("expected the failure recorded, got %+v", e)
+	}
+	if out := runBB(t, "journal", "--tail", "1"); !strings.Contains(out, "config timeout") || strings.Contains(out, "sleep") {
+		t.Errorf("expected only the last entry, got: %s", out)
+	}
+
+	// The recorded failure is expected again, so the replay runs through
+	file := filepath.Join(t.TempDir(), "journal.jsonl")
+	data, _ := os.ReadFile(filepath.Join(tempHome, ".bb", "journal.jsonl"))
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := runBB(t, "journal", "--replay", file)
+	if !strings.Contains(out, "[1/3] sleep 0.05") || !strings.Contains(out, "fail [2/3]") || !strings.Contains(out, "[3/3]") {
+		t.Errorf("expected all three steps replayed, got: %s", out)
+	}
+	broken := strings.Replace(string(data), `"exit_code":2`, `"exit_code":0`, 1)
+	if err := os.WriteFile(file, []byte(broken), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if stdout, stderr, code := runBBRaw("journal", "--replay", file); code == 0 || strings.Contains(stdout, "[3/3]") || !strings.Contains(stderr, "recorded 0") {
+		t.Errorf("expected the replay to stop at the changed step, got %d: %s%s", code, stdout, stderr)
+	}
+}
+
+func TestResponsive(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/wide")
+	dir := filepath.Join(t.TempDir(), "shots")
+	var m responsiveManifest
+	if err := json.Unmarshal([]byte(runBB(t, "responsive", "--widths", "320,1024", "--out", dir, "--settle", "0", "--json")), &m); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if m.Title != "Wide" || len(m.Shots) != 2 {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	if m.Shots[0].Overflow != 180 || m.Shots[1].Overflow != 0 {
+		t.Errorf("expected the 320px shot to overflow by 180px only, got %+v", m.Shots)
+	}
+	for _, s := range m.Shots {
+		f, err := os.Open(s.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != s.Width {
+			t.Errorf("expected a %dpx wide PNG at %s, got %d: %v", s.Width, s.File, cfg.Width, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err != nil {
+		t.Errorf("expected the manifest written: %v", err)
+	}
+}
+
+func TestShotmatrix(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "urls.txt")
+	urls := "# pages to review\n" + server.URL + "/wide\n\n" + server.URL + "/\n"
+	if err := os.WriteFile(list, []byte(urls), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "matrix")
+	var m shotmatrixManifest
+	if err := json.Unmarshal([]byte(runBB(t, "shotmatrix", "--urls", list, "--widths", "320,1024", "--out", out, "--settle", "0", "--json")), &m); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(m.Pages) != 2 || m.Pages[0].Title != "Wide" {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	for _, p := range m.Pages {
+		if p.Error != "" || len(p.Shots) != 2 {
+			t.Errorf("expected two shots of %s, got %+v", p.URL, p)
+		}
+	}
+	if m.Pages[0].Shots[0].Overflow != 180 {
+		t.Errorf("expected the 320px shot of /wide to overflow, got %+v", m.Pages[0].Shots)
+	}
+	index, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, _ := filepath.Rel(out, m.Pages[0].Shots[0].File)
+	if !strings.Contains(string(index), `src="`+filepath.ToSlash(rel)+`"`) || !strings.Contains(string(index), "overflows by 180px") {
+		t.Errorf("expected the grid to link %s and flag the overflow:\n%s", rel, index)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\nTWO\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+	want := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ one
+-two
++TWO
+ three
+ four
+ five
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+`
+	if got := unifiedDiff(a, b, "a", "b", 3); got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+	if got := unifiedDiff(a, a, "a", "b", 3); got != "" {
+		t.Errorf("expected no diff for equal input, got:\n%s", got)
+	}
+	if got := unifiedDiff("", "x\n", "a", "b", 3); !strings.Contains(got, "@@ -0,0 +1 @@\n+x\n") {
+		t.Errorf("unexpected diff from empty input:\n%s", got)
+	}
+}
+
+func TestContentDiff(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "diff", "snapshot", "#intro")
+	if out := runBB(t, "diff", "show", "#intro"); !strings.Contains(out, "No changes") {
+		t.Errorf("expected no changes, got %q", out)
+	}
+	runBB(t, "js", `document.querySelector('#intro').textContent = 'Changed text.'`)
+	stdout, _, code := runBBRaw("diff", "show", "#intro", "--update")
+	if code != exitFalse || !strings.Contains(stdout, "-This is a test page for bb.\n+Changed text.") {
+		t.Errorf("expected exit %d with a diff, got %d: %s", exitFalse, code, stdout)
+	}
+	if out := runBB(t, "diff", "show", "#intro"); !strings.Contains(out, "No changes") {
+		t.Errorf("expected --update to replace the snapshot, got %q", out)
+	}
+
+	runBB(t, "diff", "snapshot", "--name", "page", "--html")
+	runBB(t, "js", `document.querySelector('#link1').setAttribute('href', '/moved')`)
+	stdout, _, code = runBBRaw("diff", "show", "--name", "page", "--json")
+	var d contentDiff
+	if err := json.Unmarshal([]byte(stdout), &d); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if code != exitFalse || !d.Changed || d.Before == d.After || !strings.Contains(d.Diff, `href="/moved"`) || !strings.Contains(d.Diff, `href="/page2"`) {
+		t.Errorf("expected the markup change reported, got %d: %+v", code, d)
+	}
+}
+
+func TestCard(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	file := filepath.Join(t.TempDir(), "card.png")
+	var card linkCard
+	if err := json.Unmarshal([]byte(runBB(t, "card", server.URL+"/card", file, "--json")), &card); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if card.Title != "Card Title" || card.Description != "What the card says" || card.Site != "Card Site" || card.Style != "large" {
+		t.Errorf("unexpected card: %+v", card)
+	}
+	if card.Image != server.URL+"/card.png" || card.ImageWidth != 400 || card.ImageHeight != 210 {
+		t.Errorf("expected the absolute image URL and its size, got %+v", card)
+	}
+	if len(card.Warnings) != 1 || !strings.Contains(card.Warnings[0], "400x210") {
+		t.Errorf("expected a warning about the small image, got %q", card.Warnings)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(f)
+	f.Close()
+	if err != nil || cfg.Width < 560 {
+		t.Errorf("expected a card-sized PNG, got %d: %v", cfg.Width, err)
+	}
+
+	out := runBB(t, "card", server.URL+"/meta", filepath.Join(t.TempDir(), "meta.png"))
+	for _, want := range []string{"Title:       OG Title", "Description: A page with metadata", "failed to load", "summary card"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if url := runBB(t, "url"); url != server.URL+"/" {
+		t.Errorf("expected the active page left alone, got %s", url)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	cmd := exec.Command(bbBin, "events", "--filter", "nav,console,request", "--duration", "5")
+	cmd.Env = append(os.Environ(), "HOME="+tempHome, "BB_TIMEOUT=15")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	lines := bufio.NewScanner(stdout)
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"type":"ready"`) {
+		t.Fatalf("expected a ready event first, got %q", lines.Text())
+	}
+
+	runBB(t, "js", `console.warn('watch', 42)`)
+	runBB(t, "open", "--raw", server.URL+"/page2")
+	var events []pageEvent
+	for lines.Scan() {
+		var e pageEvent
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", lines.Text(), err)
+		}
+		events = append(events, e)
+	}
+	has := func(match func(e pageEvent) bool) bool { return slices.ContainsFunc(events, match) }
+	if !has(func(e pageEvent) bool { return e.Type == "console" && e.Level == "warning" && e.Text == "watch 42" }) {
+		t.Errorf("expected the console message, got %+v", events)
+	}
+	if !has(func(e pageEvent) bool { return e.Type == "nav" && e.URL == server.URL+"/page2" }) {
+		t.Errorf("expected the navigation, got %+v", events)
+	}
+	if !has(func(e pageEvent) bool {
+		return e.Type == "request" && e.URL == server.URL+"/page2" && e.Status == 200 && e.Method == "GET"
+	}) {
+		t.Errorf("expected the document request, got %+v", events)
+	}
+	if has(func(e pageEvent) bool { return e.Type == "dialog" || e.Type == "download" }) {
+		t.Errorf("expected only the filtered types, got %+v", events)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "ws", "start")
+	t.Cleanup(func() { _, _, _ = runBBRaw("ws", "stop") })
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-echo"
+	runBB(t, "js", `new Promise(resolve => {
+		const ws = new WebSocket(`+"`"+wsURL+"`"+`);
+		ws.onopen = () => ws.send("hello socket");
+		ws.onmessage = () => { ws.close(); resolve(); };
+	})`)
+	time.Sleep(500 * time.Millisecond)
+
+	var sockets []wsSocket
+	if err := json.Unmarshal([]byte(runBB(t, "ws", "list", "--json")), &sockets); err != nil {
+		t.Fatal(err)
+	}
+	if len(sockets) != 1 || sockets[0].URL != wsURL || sockets[0].Sent != 1 || sockets[0].Received != 1 || sockets[0].Status != 101 {
+		t.Fatalf("expected the echo socket with one frame each way, got %+v", sockets)
+	}
+
+	out := runBB(t, "ws", "messages", "--url", "ws-echo")
+	if !strings.Contains(out, "-> "+wsURL+" hello socket") || !strings.Contains(out, "<- "+wsURL+" hello socket") {
+		t.Errorf("expected both frames, got %q", out)
+	}
+	if out := runBB(t, "ws", "messages", "--url", "nothing-like-this"); out != "" {
+		t.Errorf("expected no frames for another URL, got %q", out)
+	}
+
+	runBB(t, "ws", "stop")
+	if _, _, code := runBBRaw("ws", "stop"); code != exitFailed {
+		t.Errorf("expected stopping twice to fail, got exit %d", code)
+	}
+}
+
+func TestPhaseTimings(t *testing.T) {
+	_, stderr, code := runBBRaw("open", "--raw", server.URL+"/", "--verbose")
+	if code != 0 {
+		t.Fatalf("open failed: %s", stderr)
+	}
+	for _, phase := range []string{"timing: connect ", "navigate ", "wait ", "(total "} {
+		if !strings.Contains(stderr, phase) {
+			t.Errorf("expected %q in the timings, got %q", phase, stderr)
+		}
+	}
+
+	runBB(t, "config", "set", "slow-phases", "wait=0.001")
+	t.Cleanup(func() { _, _, _ = runBBRaw("config", "set", "slow-phases", "") })
+	if out := runBB(t, "config", "get", "slow-phases"); strings.TrimSpace(out) != "wait=0.001" {
+		t.Errorf("expected the threshold back, got %q", out)
+	}
+	if _, _, code := runBBRaw("config", "set", "slow-phases", "render=3"); code != exitUsage {
+		t.Errorf("expected an unknown phase to be refused, got exit %d", code)
+	}
+
+	stdout, stderr, code := runBBRaw("waitload", "--json")
+	if code != 0 {
+		t.Fatalf("waitload failed: %s", stderr)
+	}
+	if !strings.Contains(stderr, "warning: wait took ") {
+		t.Errorf("expected a slow wait warning, got %q", stderr)
+	}
+	var e envelope
+	if err := json.Unmarshal([]byte(stdout), &e); err != nil {
+		t.Fatalf("invalid envelope %q: %v", stdout, err)
+	}
+	if !slices.ContainsFunc(e.Timings, func(p phaseTiming) bool { return p.Phase == "connect" }) ||
+		!slices.ContainsFunc(e.Timings, func(p phaseTiming) bool { return p.Phase == "wait" }) {
+		t.Errorf("expected connect and wait timings, got %+v", e.Timings)
+	}
+	if len(e.Warnings) != 1 || !strings.HasPrefix(e.Warnings[0], "wait took ") {
+		t.Errorf("expected the warning in the envelope, got %q", e.Warnings)
+	}
+
+	// Commands with JSON of their own carry them too
+	for _, args := range [][]string{{"open", server.URL + "/", "--json"}, {"extract", "--json"}} {
+		e = envelope{}
+		if err := json.Unmarshal([]byte(runBB(t, args...)), &e); err != nil {
+			t.Fatalf("invalid envelope: %v", err)
+		}
+		if len(e.Result) == 0 || !slices.ContainsFunc(e.Timings, func(p phaseTiming) bool { return p.Phase == "extract" }) {
+			t.Errorf("expected the %s result with an extract timing, got %+v", args[0], e)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "js", `document.cookie = "session=abc123; path=/"`)
+	body := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(body, []byte(`{"q":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var res fetchResult
+	out := runBB(t, "fetch", "/api/echo", "--method", "put", "--body", "@"+body, "--header", "X-Test: yes", "--json")
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if res.Status != 200 || res.Headers["x-echo"] != "1" || res.URL != server.URL+"/api/echo" {
+		t.Errorf("unexpected response %+v", res)
+	}
+	var echo map[string]string
+	if err := json.Unmarshal([]byte(res.Body), &echo); err != nil {
+		t.Fatalf("invalid body %q: %v", res.Body, err)
+	}
+	want := map[string]string{"method": "PUT", "header": "yes", "session": "abc123", "body": `{"q":1}`}
+	if !maps.Equal(echo, want) {
+		t.Errorf("expected the page's cookie and the request as given, got %v", echo)
+	}
+
+	if out := runBB(t, "fetch", server.URL+"/api/echo"); strings.TrimSpace(out) != `{"body":"","header":"","method":"GET","session":"abc123"}` {
+		t.Errorf("expected the response body, got %q", out)
+	}
+	if out := runBB(t, "fetch", "/api/echo", "--include"); !strings.HasPrefix(out, "HTTP 200 OK\n") || !strings.Contains(out, "x-echo: 1\n") || !strings.Contains(out, `"method":"GET"`) {
+		t.Errorf("expected the status line, headers and body, got %q", out)
+	}
+	stdout, stderr, code := runBBRaw("fetch", "/api/echo?status=404")
+	if code != exitFailed || !strings.Contains(stdout, `"method":"GET"`) || !strings.Contains(stderr, "HTTP 404") {
+		t.Errorf("expected the body and exit 1 for a 404, got %d %q %q", code, stdout, stderr)
+	}
+	stdout, stderr, code = runBBRaw("fetch", "/api/echo?status=404", "--envelope")
+	var e envelope
+	if err := json.Unmarshal([]byte(stdout), &e); err != nil {
+		t.Fatalf("invalid envelope %q: %v", stdout, err)
+	}
+	if err := json.Unmarshal(e.Result, &res); err != nil || code != exitFailed || e.OK || res.Status != 404 || !strings.Contains(stderr, `"message":"HTTP 404`) {
+		t.Errorf("expected the result kept in a failed envelope, got %d %+v %q", code, e, stderr)
+	}
+}
+
+func TestIsDetachedFrame(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{cdp.ErrSessionNotFound, true},
+		{fmt.Errorf("eval: %w", cdp.ErrCtxDestroyed), true},
+		{&cdp.Error{Code: -32000, Message: "No frame with given id found"}, true},
+		{&rod.ObjectNotFoundError{}, true},
+		{cdp.ErrNodeNotFoundAtPos, false},
+		{errors.New("JS error"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isDetachedFrame(tt.err); got != tt.want {
+			t.Errorf("isDetachedFrame(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsMethodNotFound(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&cdp.Error{Code: -32601, Message: "Method not found"}, true},
+		{fmt.Errorf("ax: %w", &cdp.Error{Code: -32000, Message: "'Accessibility.getFullAXTree' wasn't found"}), true},
+		{&cdp.Error{Code: -32000, Message: "Node with given id does not belong to the document"}, false},
+		{cdp.ErrCtxDestroyed, false},
+		{errors.New("'Accessibility.getFullAXTree' wasn't found"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isMethodNotFound(tt.err); got != tt.want {
+			t.Errorf("isMethodNotFound(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestMustFailure(t *testing.T) {
+	tests := []struct {
+		r    interface{}
+		want bool
+	}{
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("wait: %w", context.DeadlineExceeded), true},
+		{&cdp.Error{Code: -32000, Message: "Cannot find context with specified id"}, true},
+		{errors.New("index out of range"), false},
+		{"assignment to entry in nil map", false},
+	}
+	for _, tt := range tests {
+		if _, got := mustFailure(tt.r); got != tt.want {
+			t.Errorf("mustFailure(%v) = %v; want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestMockPattern(t *testing.T) {
+	tests := []struct {
+		pattern, fetch, url string
+		want                bool
+	}{
+		{"/api/user", "*/api/user*", "https://example.com/api/user/1", true},
+		{"/search?q=a", `*/search\?q=a*`, "https://example.com/search?q=a&p=2", true},
+		{"/search?q=a", `*/search\?q=a*`, "https://example.com/searchXq=a", false},
+		{"*/v?/items", `*/v\?/items`, "https://example.com/v1/items", false},
+		{"*/api/*.json", "*/api/*.json", "https://example.com/api/users.json", true},
+	}
+	for _, tt := range tests {
+		m := Mock{Pattern: tt.pattern}
+		if got := m.urlPattern(); got != tt.fetch {
+			t.Errorf("urlPattern(%q) = %q; want %q", tt.pattern, got, tt.fetch)
+		}
+		if got := m.matches("GET", tt.url); got != tt.want {
+			t.Errorf("%q matches %q = %v; want %v", tt.pattern, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestMock(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "mock", "add", "/api/echo", "--status", "503", "--body", `{"down":true}`)
+	t.Cleanup(func() { _, _, _ = runBBRaw("mock", "clear") })
+
+	out := runBB(t, "js", `fetch('/api/echo?x=1').then(async r => r.status + ' ' + r.headers.get('content-type') + ' ' + await r.text())`)
+	if strings.TrimSpace(out) != `503 application/json {"down":true}` {
+		t.Errorf("expected the mocked response, got %q", out)
+	}
+	runBB(t, "mock", "add", "/api/echo", "--method", "POST", "--body", "posted", "--content-type", "text/plain")
+	if out := runBB(t, "js", `fetch('/api/echo', {method: 'POST'}).then(r => r.text())`); strings.TrimSpace(out) != "posted" {
+		t.Errorf("expected the POST mock, got %q", out)
+	}
+	if out := runBB(t, "mock", "list"); !strings.Contains(out, "POST   */api/echo* -> 200 text/plain") || !strings.Contains(out, "*      */api/echo* -> 503") {
+		t.Errorf("expected both mocks listed, got %q", out)
+	}
+
+	runBB(t, "mock", "clear")
+	if out := runBB(t, "js", `fetch('/api/echo').then(r => r.status)`); strings.TrimSpace(out) != "200" {
+		t.Errorf("expected the real response after clearing, got %q", out)
+	}
+	if _, _, code := runBBRaw("mock", "add", "/x", "--status", "42"); code == 0 {
+		t.Error("expected an invalid status to be refused")
+	}
+}
+
+func TestExtractQuality(t *testing.T) {
+	quality := func(u string) extractQuality {
+		t.Helper()
+		var res struct {
+			Quality extractQuality `json:"quality"`
+		}
+		out := runBB(t, "open", u, "--json")
+		if err := json.Unmarshal([]byte(out), &res); err != nil {
+			t.Fatalf("invalid JSON %q: %v", out, err)
+		}
+		return res.Quality
+	}
+
+	if q := quality(server.URL + "/long-article"); q.Method != "readability" || q.Level != "high" || q.Words < 300 || len(q.Reasons) != 0 {
+		t.Errorf("expected an article to rate high, got %+v", q)
+	}
+	q := quality(server.URL + "/")
+	if q.Level != "low" || !slices.ContainsFunc(q.Reasons, func(r string) bool { return strings.HasPrefix(r, "only ") }) {
+		t.Errorf("expected a near-empty page to rate low, got %+v", q)
+	}
+	if _, stderr, _ := runBBRaw("extract"); !strings.Contains(stderr, "[extraction quality low") {
+		t.Errorf("expected a note on stderr, got %q", stderr)
+	}
+}
+
+func TestFormSelectors(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/two-forms")
+	var form struct {
+		Fields []formField `json:"fields"`
+	}
+	out := runBB(t, "form", "#signup", "--json")
+	if err := json.Unmarshal([]byte(out), &form); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	var selectors []string
+	for _, f := range form.Fields {
+		selectors = append(selectors, f.Selector)
+	}
+	want := []string{
+		"#signup > input",
+		"#signup > div:nth-of-type(1) > input",
+		"#signup > div:nth-of-type(2) > input",
+	}
+	if strings.Join(selectors, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected %v, got %v", want, selectors)
+	}
+	for _, sel := range selectors {
+		if out := runBB(t, "count", sel); strings.TrimSpace(out) != "1" {
+			t.Errorf("expected %s to match one element, got: %s", sel, out)
+		}
+	}
+}
+
+func TestResolvePage(t *testing.T) {
+	pages := rod.Pages{
+		&rod.Page{TargetID: "A1B2C3D4E5F60718293A4B5C6D7E8F90"},
+		&rod.Page{TargetID: "12345678AAAAAAAAAAAAAAAAAAAAAAAA"},
+		&rod.Page{TargetID: "12349999BBBBBBBBBBBBBBBBBBBBBBBB"},
+	}
+	tests := []struct {
+		ref  string
+		want int
+		err  bool
+	}{
+		{"1", 1, false},
+		{"3", 0, true},
+		{"a1b2", 0, false},
+		{"12345678", 1, false}, // an all-digit short id, not an index
+		{"1234999", 0, true},   // shorter than an id, so an index
+		{"12349999", 2, false},
+	}
+	for _, tt := range tests {
+		got, err := resolvePage(tt.ref, pages)
+		if (err != nil) != tt.err || (err == nil && got != tt.want) {
+			t.Errorf("resolvePage(%q) = %d, %v; want %d (error %v)", tt.ref, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestWriteFontConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	file, err := writeFontConfig("/home/ann/R&D <fonts>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(file)
+	var conf struct {
+		Dir string `xml:"dir"`
+	}
+	if err := xml.Unmarshal(data, &conf); err != nil || conf.Dir != "/home/ann/R&D <fonts>" {
+		t.Errorf("expected the directory escaped, got %q (%v):\n%s", conf.Dir, err, data)
+	}
+}
+
+func TestErrorDirArg(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{[]string{"--screenshot-on-error", dir, "#btn"}, dir, true},
+		{[]string{"--screenshot-on-error", "./errors"}, "./errors", true},
+		{[]string{"--screenshot-on-error", "~/bb-errors"}, "~/bb-errors", true},
+		{[]string{"--screenshot-on-error", "#btn"}, "", false},
+		{[]string{"--screenshot-on-error", ".item"}, "", false},
+		{[]string{"--screenshot-on-error", "https://example.com/a"}, "", false},
+		{[]string{"--screenshot-on-error", "--json"}, "", false},
+		{[]string{"--screenshot-on-error"}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := errorDirArg(tt.args, 0)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("errorDirArg(%q) = %q, %v; want %q, %v", tt.args, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`open https://example.com`, []string{"open", "https://example.com"}},
+		{`type "#q" 'hello world'`, []string{"type", "#q", "hello world"}},
+		{`js "document.title = \"x\""`, []string{"js", `document.title = "x"`}},
+		{`fill a\ b ''`, []string{"fill", "a b", ""}},
+	}
+	for _, tt := range tests {
+		got, err := splitCommandLine(tt.line)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("splitCommandLine(%q) = %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+	if _, err := splitCommandLine(`click "unterminated`); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+}
+
+func TestImportPlaywright(t *testing.T) {
+	t.Run("script", func(t *testing.T) {
+		src := `import { test } from '@playwright/test';
+test('login', async ({ page }) => {
+  await page.goto('https://example.com/login');
+  await page.fill('#user', "ann o'neil");
+  await page.locator('button[type=submit]').click();
+  await page.waitForSelector('.dashboard', { timeout: 5000 });
+  await page.waitForTimeout(1500);
+  await page.getByRole('link', { name: 'Settings' }).click();
+  await page.click('text=Log out');
+});`
+		lines, unsupported := translatePlaywrightScript(src)
+		want := []string{
+			"open --raw https://example.com/login",
+			`input '#user' "ann o'neil"`,
+			"click button[type=submit]",
+			"wait .dashboard",
+			"sleep 1.5",
+			"# unsupported: await page.getByRole('link', { name: 'Settings' }).click();",
+			"# unsupported: await page.click('text=Log out');",
+		}
+		if !slices.Equal(lines, want) || unsupported != 2 {
+			t.Errorf("got %q (%d unsupported), want %q", lines, unsupported, want)
+		}
+		// The lines read back as the intended arguments
+		args, err := splitCommandLine(lines[1])
+		if err != nil || !slices.Equal(args, []string{"input", "#user", "ann o'neil"}) {
+			t.Errorf("splitCommandLine(%q) = %q, %v", lines[1], args, err)
+		}
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		f, _ := zw.Create("trace.trace")
+		for _, ev := range []string{
+			`{"type":"context-options","browserName":"chromium"}`,
+			`{"type":"before","apiName":"browserContext.newPage","method":"newPage","params":{}}`,
+			`{"type":"before","apiName":"page.goto","method":"goto","params":{"url":"https://example.com/"}}`,
+			`{"type":"before","apiName":"locator.fill","method":"fill","params":{"selector":"#q","value":"shoes"}}`,
+			`{"type":"before","apiName":"locator.click","method":"click","params":{"selector":"internal:role=button[name=\"Go\"i]"}}`,
+		} {
+			fmt.Fprintln(f, ev)
+		}
+		zw.Close()
+		lines, unsupported, err := translatePlaywrightTrace(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			"open --raw https://example.com/",
+			"input '#q' shoes",
+			`# unsupported: locator.click internal:role=button[name="Go"i]`,
+		}
+		if !slices.Equal(lines, want) || unsupported != 1 {
+			t.Errorf("got %q (%d unsupported), want %q", lines, unsupported, want)
+		}
+	})
+}
+
+func TestExportPlaywright(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "login.bb")
+	content := "# log in\nbb open --raw example.com/login\ninput '#user' \"ann o'neil\"\nclick button --double\nsleep 1.5\nvisible .dashboard\ntitle\n"
+	if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	test, unsupported := exportPlaywright("login", readJourney(script))
+	want := `import { test, expect } from '@playwright/test';
+
+test('login', async ({ page }) => {
+  await page.goto('https://example.com/login');
+  await page.fill('#user', 'ann o\'neil');
+  await page.dblclick('button');
+  await page.waitForTimeout(1500);
+  await expect(page.locator('.dashboard')).toBeVisible();
+  // unsupported: bb title
+});
+`
+	if test != want || unsupported != 1 {
+		t.Errorf("got (%d unsupported):\n%s\nwant:\n%s", unsupported, test, want)
+	}
+}
+
+func TestExportJournal(t *testing.T) {
+	runBB(t, "journal", "--clear")
+	runBB(t, "sleep", "0.05")
+	runBBRaw("config", "no-such-key")
+	runBB(t, "sleep", "0.1")
+
+	out := runBB(t, "export", "playwright", "--journal")
+	if !strings.Contains(out, "test('journal'") || !strings.Contains(out, "waitForTimeout(50)") ||
+		!strings.Contains(out, "waitForTimeout(100)") || strings.Contains(out, "no-such-key") {
+		t.Errorf("expected the successful commands exported, got:\n%s", out)
+	}
+	if out := runBB(t, "export", "playwright", "--journal", "--from", "2", "--to", "3"); strings.Contains(out, "waitForTimeout(50)") || !strings.Contains(out, "waitForTimeout(100)") {
+		t.Errorf("expected only entries 2 to 3, got:\n%s", out)
+	}
+	if _, _, code := runBBRaw("export", "playwright", "--journal", "--from", "2", "--to", "2"); code != exitFailed {
+		t.Errorf("expected a range without successful commands to fail, got exit %d", code)
+	}
+	if _, _, code := runBBRaw("export", "playwright", "flow.bb", "--journal"); code != exitUsage {
+		t.Errorf("expected a script and --journal together to be refused, got exit %d", code)
+	}
+}
+
+func TestJourney(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "flow.bb")
+	content := "# open and move on\nbb open --raw " + server.URL + "/\nclick '#link1'\nwaitload\ntitle\n"
+	if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "timing.json")
+	runBB(t, "journey", script, "--report", report)
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r struct {
+		OK    bool `json:"ok"`
+		Steps []struct {
+			Line       int             `json:"line"`
+			URL        string          `json:"url"`
+			Navigation json.RawMessage `json:"navigation"`
+			Screenshot string          `json:"screenshot"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("invalid report: %v\n%s", err, data)
+	}
+	if !r.OK || len(r.Steps) != 4 || r.Steps[0].Line != 2 {
+		t.Fatalf("unexpected report: %s", data)
+	}
+	if r.Steps[0].Navigation == nil || r.Steps[3].Navigation != nil || r.Steps[3].URL != server.URL+"/page2" {
+		t.Errorf("expected navigation timings only where a page loaded, got: %s", data)
+	}
+	if _, err := os.Stat(r.Steps[1].Screenshot); err != nil {
+		t.Errorf("expected a screenshot per step: %v", err)
+	}
+
+	if err := os.WriteFile(script, []byte("open --raw "+server.URL+"/\nexists #nope\ntitle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := runBBRaw("journey", script, "--report", report, "--no-screenshots"); code != 1 {
+		t.Errorf("expected a failing step to fail the journey, got exit %d", code)
+	}
+}
+
+// writeHeapSnapshot writes a minimal .heapsnapshot with one node per name
+func writeHeapSnapshot(t *testing.T, file string, names ...string) {
+	t.Helper()
+	strs := []string{"(root)"}
+	nodes := []int{9, 0, 1, 0, 0, 0, 0} // synthetic root
+	for i, name := range names {
+		strs = append(strs, name)
+		nodes = append(nodes, 3, len(strs)-1, i+2, 32, 0, 0, 0)
+	}
+	snap := map[string]interface{}{
+		"snapshot": map[string]interface{}{
+			"meta": map[string]interface{}{
+				"node_fields": []string{"type", "name", "id", "self_size", "edge_count", "trace_node_id", "detachedness"},
+				"node_types": []interface{}{
+					[]string{"hidden", "array", "string", "object", "code", "closure", "regexp", "number", "native", "synthetic"},
+					"string", "number", "number", "number", "number", "number",
+				},
+			},
+		},
+		"nodes":   nodes,
+		"strings": strs,
+	}
+	data, _ := json.Marshal(snap)
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeapDiff(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.heapsnapshot"), filepath.Join(dir, "b.heapsnapshot")
+	writeHeapSnapshot(t, a, "Widget", "Object")
+	writeHeapSnapshot(t, b, "Widget", "Widget", "Widget", "Object", "Detached HTMLDivElement")
+
+	out := runBB(t, "heap", "diff", a, b, "--json")
+	var res struct {
+		CountDelta    int `json:"count_delta"`
+		DetachedNodes int `json:"detached_nodes"`
+		Classes       []struct {
+			Name       string `json:"name"`
+			CountDelta int    `json:"count_delta"`
+			SizeDelta  int    `json:"size_delta"`
+		} `json:"classes"`
+	}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if res.CountDelta != 3 || res.DetachedNodes != 1 {
+		t.Errorf("expected 3 new objects, 1 detached, got: %s", out)
+	}
+	if len(res.Classes) != 2 || res.Classes[0].Name != "Widget" || res.Classes[0].CountDelta != 2 || res.Classes[0].SizeDelta != 64 {
+		t.Errorf("expected Widget to grow most, got: %s", out)
+	}
+
+	if _, _, code := runBBRaw("heap", "diff", a, filepath.Join(dir, "missing")); code == 0 {
+		t.Error("expected an error for a missing snapshot")
+	}
+}
+
+func TestHeapSnapshot(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.heapsnapshot"), filepath.Join(dir, "b.heapsnapshot")
+	runBB(t, "heap", "snapshot", a)
+	runBB(t, "js", "(window.leak = Array.from({length: 50}, () => { const d = document.createElement('div'); document.body.appendChild(d); d.remove(); return d; })).length")
+	runBB(t, "heap", "snapshot", b)
+
+	out := runBB(t, "heap", "diff", a, b, "--json")
+	var res struct {
+		DetachedNodes int `json:"detached_nodes"`
+	}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if res.DetachedNodes < 50 {
+		t.Errorf("expected the detached divs to show, got: %s", out)
+	}
+}
+
+func TestJank(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	out := runBB(t, "jank", "--json", "--during", "--", "js", "(() => { const end = Date.now() + 200; while (Date.now() < end) {} return 1 })()")
+	var r struct {
+		LongTasks      int     `json:"long_tasks"`
+		BlockingTimeMS float64 `json:"blocking_time_ms"`
+		ExitCode       *int    `json:"exit_code"`
+	}
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if r.LongTasks < 1 || r.BlockingTimeMS < 100 || r.ExitCode == nil || *r.ExitCode != 0 {
+		t.Errorf("expected the busy loop to be a long task, got: %s", out)
+	}
+
+	out = runBB(t, "jank", "--duration", "0.3")
+	if !strings.Contains(out, "Recorded") {
+		t.Errorf("expected a summary, got: %s", out)
+	}
+	if _, _, code := runBBRaw("jank", "--during", "--", "exists", "#nope"); code != exitFalse {
+		t.Errorf("expected the command's exit code, got %d", code)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	runBB(t, "js", "(() => { console.table([{name: 'ann', age: 3}, {name: 'bob', tags: ['x']}], ['name', 'tags']); const o = {a: {b: {c: {d: 1}}}}; o.self = o; console.log('deep', o); return 1 })()")
+
+	out := runBB(t, "console", "--json", "--expand", "2", "--tail", "2")
+	var msgs []struct {
+		Type  string            `json:"type"`
+		Text  string            `json:"text"`
+		Args  []json.RawMessage `json:"args"`
+		Table *struct {
+			Columns []string         `json:"columns"`
+			Rows    []map[string]any `json:"rows"`
+		} `json:"table"`
+	}
+	if err := json.Unmarshal([]byte(out), &msgs); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(msgs) != 2 || msgs[0].Type != "table" || msgs[0].Table == nil {
+		t.Fatalf("expected the table and the log, got: %s", out)
+	}
+	table := msgs[0].Table
+	if !slices.Equal(table.Columns, []string{"(index)", "name", "tags"}) || len(table.Rows) != 2 || table.Rows[1]["name"] != "bob" {
+		t.Errorf("expected the table rebuilt with the given columns, got: %s", out)
+	}
+	if _, ok := table.Rows[0]["age"]; ok {
+		t.Errorf("expected columns outside the filter to be dropped, got: %s", out)
+	}
+	if got := string(msgs[1].Args[1]); got != `{"a":{"b":"Object"},"self":"[Circular]"}` {
+		t.Errorf("expected the object expanded two levels, got: %s", got)
+	}
+
+	out = runBB(t, "console", "--tail", "2")
+	if !strings.Contains(out, "[table]") || !strings.Contains(out, "(index)  name  tags") {
+		t.Errorf("expected a text table, got: %s", out)
+	}
+}
+
+func TestConsent(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/consent-rule")
+	out := runBB(t, "consent", "dismiss")
+	if !strings.Contains(out, "OneTrust") {
+		t.Errorf("expected the OneTrust rule to match, got: %s", out)
+	}
+	if out := runBB(t, "js", "window.consented"); strings.TrimSpace(out) != "onetrust" {
+		t.Errorf("expected the rule's button clicked, got: %s", out)
+	}
+
+	// The banner shows up after the load and is only found by its label
+	runBB(t, "open", "--raw", server.URL+"/consent")
+	out = runBB(t, "consent", "dismiss", "--json")
+	var r struct {
+		Dismissed bool   `json:"dismissed"`
+		Rule      string `json:"rule"`
+		Label     string `json:"label"`
+	}
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if !r.Dismissed || r.Rule != "heuristic" || r.Label != "Alle akzeptieren" {
+		t.Errorf("expected the accept button found by its label, got: %s", out)
+	}
+	if out := runBB(t, "consent", "dismiss", "--wait", "0"); !strings.Contains(out, "No consent banner") {
+		t.Errorf("expected nothing left to dismiss, got: %s", out)
+	}
+
+	_, stderr, code := runBBRaw("open", "--raw", "--auto-consent", server.URL+"/consent")
+	if code != 0 || !strings.Contains(stderr, "dismissed heuristic consent banner") {
+		t.Errorf("expected --auto-consent to dismiss the banner, got: %s", stderr)
+	}
+}
+
+func TestConsentRules(t *testing.T) {
+	out := runBB(t, "consent", "rules")
+	if !strings.Contains(out, "built-in") || !strings.Contains(out, "Cookiebot") {
+		t.Errorf("expected the built-in rules, got: %s", out)
+	}
+	file := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(file, []byte(`{"rules": [{"name": "Custom", "accept": "#ok"}], "phrases": ["fine"]}`), 0644)
+	t.Cleanup(func() { runBBRaw("consent", "update", "--reset") })
+	runBB(t, "consent", "update", file)
+	if out := runBB(t, "consent", "rules"); !strings.Contains(out, "1 rules, 1 phrases") || !strings.Contains(out, "Custom") {
+		t.Errorf("expected the installed rules, got: %s", out)
+	}
+	os.WriteFile(file, []byte(`{"rules": [{"name": "Broken"}]}`), 0644)
+	if _, _, code := runBBRaw("consent", "update", file); code == 0 {
+		t.Error("expected invalid rules to be rejected")
+	}
+}
+
+func TestDeclutter(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/clutter")
+	out := runBB(t, "declutter", "--dry-run", "--json")
+	var items []struct {
+		Action   string `json:"action"`
+		Reason   string `json:"reason"`
+		Selector string `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	got := map[string]string{}
+	for _, it := range items {
+		got[it.Selector] = it.Action
+	}
+	want := map[string]string{"#backdrop": "removed", "#modal": "removed", "body > header": "unstuck", "body > article": "unblurred", "body": "unlocked"}
+	for sel, action := range want {
+		if got[sel] != action {
+			t.Errorf("expected %s to be %s, got: %s", sel, action, out)
+		}
+	}
+	if out := runBB(t, "exists", "#modal"); !strings.Contains(out, "true") {
+		t.Errorf("expected --dry-run to leave the page alone, got: %s", out)
+	}
+
+	runBB(t, "declutter")
+	if _, _, code := runBBRaw("exists", "#modal"); code == 0 {
+		t.Error("expected the modal removed")
+	}
+	if out := runBB(t, "js", "getComputedStyle(document.body).overflow + ' ' + getComputedStyle(document.querySelector('header')).position"); strings.TrimSpace(out) != "visible static" {
+		t.Errorf("expected scrolling unlocked and the header unstuck, got: %s", out)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/")
+	before := runBB(t, "pages", "--json")
+	out := runBB(t, "prefetch", server.URL+"/page2", server.URL+"/form")
+	if !strings.Contains(out, "Prefetched 2/2 URLs") {
+		t.Errorf("expected both URLs loaded, got: %s", out)
+	}
+	if after := runBB(t, "pages", "--json"); after != before {
+		t.Errorf("expected the throwaway tabs closed, got: %s", after)
+	}
+	if out := runBB(t, "url"); strings.TrimSpace(out) != server.URL+"/" {
+		t.Errorf("expected the active page unchanged, got: %s", out)
+	}
+}
+
+func TestPopup(t *testing.T) {
+	runBB(t, "open", "--raw", server.URL+"/popup")
+	out := runBB(t, "click", "#pop", "--follow-popup")
+	if !strings.Contains(out, "Switched to") || !strings.Contains(out, "Page Two") {
+		t.Errorf("expected to follow the popup, got: %s", out)
+	}
+	if out := runBB(t, "url"); strings.TrimSpace(out) != server.URL+"/page2" {
+		t.Errorf("expected the popup to be the active page, got: %s", out)
+	}
+	runBB(t, "closepage")
+
+	// A popup that opens after the click returns
+	runBB(t, "open", "--raw", server.URL+"/popup")
+	runBB(t, "click", "#late")
+	out = runBB(t, "popup", "wait")
+	if !strings.Contains(out, "Form Page") {
+		t.Errorf("expected popup wait to switch to the new tab, got: %s", out)
+	}
+	runBB(t, "closepage")
+}
+
+// startServe runs bb serve (or bb remote serve) on a free port and returns
+// its base URL
+func startServe(t *testing.T, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(bbBin, append(args, "--listen", "127.0.0.1:0")...)
+	cmd.Env = append(os.Environ(), "HOME="+tempHome, "BB_TIMEOUT=15")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("bb serve didn't start: %v", err)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "Serving on "))
+}
+
+func TestServe(t *testing.T) {
+	base := startServe(t, "serve")
+
+	resp, err := http.Post(base+"/run", "application/json", strings.NewReader(`{"args": ["help"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var run struct {
+		Stdout   string `json:"stdout"`
+		ExitCode int    `json:"exit_code"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&run)
+	resp.Body.Close()
+	if run.ExitCode != 0 || !strings.Contains(run.Stdout, "bb - browser automation CLI") {
+		t.Errorf("unexpected /run result: %+v", run)
+	}
+	resp, err = http.Post(base+"/run", "application/json", strings.NewReader(`{"args": ["no-such-command"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for _, body := range []string{`{"args": ["--priority", "high"]}`, `{"args": ["--priority", "low", "serve"]}`} {
+		resp, err = http.Post(base+"/run", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Get(base + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var health map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if health["status"] == nil || health["browser"] == nil {
+		t.Errorf("unexpected /healthz result: %v", health)
+	}
+
+	resp, err = http.Get(base + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metrics bytes.Buffer
+	_, _ = metrics.ReadFrom(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{
+		"# TYPE bb_commands_total counter",
+		`bb_commands_total{command="help"} 1`,
+		`bb_command_errors_total{command="no-such-command"} 1`,
+		"bb_browser_up ",
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("expected %q in metrics:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	dir := t.TempDir()
+	out := runBB(t, "crawl", server.URL+"/", "--depth", "1", "--same-origin", "--out", dir)
+	if !strings.Contains(out, "Crawled 2 pages (0 failed)") {
+		t.Errorf("expected two pages, got: %s", out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index []struct {
+		URL   string `json:"url"`
+		Depth int    `json:"depth"`
+		File  string `json:"file"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("invalid index: %v", err)
+	}
+	if len(index) != 2 || index[1].URL != server.URL+"/page2" || index[1].Depth != 1 {
+		t.Fatalf("unexpected index: %s", data)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, index[1].File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), "You navigated here") {
+		t.Errorf("expected page2 content, got: %s", page)
+	}
+
+	out = runBB(t, "crawl", server.URL+"/", "--depth", "0", "--format", "json", "--out", t.TempDir(), "--json")
+	if !strings.Contains(out, `"depth": 0`) || strings.Contains(out, "/page2") {
+		t.Errorf("expected only the start page, got: %s", out)
+	}
+}
+
+func TestRobotsRules(t *testing.T) {
+	r := &robotsRules{disallow: []string{"/private", "/tmp/"}, allow: []string{"/private/ok"}}
+	for path, want := range map[string]bool{
+		"/":               true,
+		"/private":        false,
+		"/private/secret": false,
+		"/private/ok/a":   true,
+		"/tmp/x":          false,
+		"/tmpfile":        true,
+	} {
+		if got := r.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	q := newScheduler(2)
+	waitQueued := func(n int) {
+		t.Helper()
+		for i := 0; q.waitingCount() != n; i++ {
+			if i > 1000 {
+				t.Fatalf("expected %d queued jobs, have %d", n, q.waitingCount())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Different pages run in parallel
+	a := q.acquire("0", priorityNormal, false)
+	b := q.acquire("1", priorityNormal, false)
+
+	// The same page queues, and high priority goes first
+	started := make(chan string, 3)
+	run := func(name, lane string, priority int, exclusive bool) {
+		job := q.acquire(lane, priority, exclusive)
+		started <- name
+		q.release(job)
+	}
+	go run("low", "0", priorityLow, false)
+	waitQueued(1)
+	go run("high", "0", priorityHigh, false)
+	waitQueued(2)
+	q.release(a)
+	if first, second := <-started, <-started; first != "high" || second != "low" {
+		t.Errorf("expected high before low, got %s then %s", first, second)
+	}
+
+	// An exclusive job waits for running jobs to finish
+	go run("exclusive", "0", priorityNormal, true)
+	waitQueued(1)
+	select {
+	case name := <-started:
+		t.Fatalf("%s started while page 1 was busy", name)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.release(b)
+	if name := <-started; name != "exclusive" {
+		t.Errorf("expected the exclusive job, got %s", name)
+	}
+}
+
+func TestFetchAll(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "urls.txt")
+	content := "# pages\n" + server.URL + "/\n\n" + server.URL + "/page2\n" + server.URL + "/form\n"
+	if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	out := runBB(t, "fetch-all", list, "--concurrency", "2", "--out", dir)
+	if !strings.Contains(out, "Fetched 3/3 URLs") {
+		t.Errorf("expected all URLs fetched, got: %s", out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index []struct {
+		URL  string `json:"url"`
+		File string `json:"file"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("invalid index: %v", err)
+	}
+	if len(index) != 3 || index[1].URL != server.URL+"/page2" {
+		t.Fatalf("expected the index in input order, got: %s", data)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, index[1].File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), "You navigated here") {
+		t.Errorf("expected page2 content, got: %s", page)
+	}
+	if pages := runBB(t, "pages"); strings.Contains(pages, "/form") {
+		t.Errorf("expected worker tabs to be closed, got: %s", pages)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	if _, _, code := runBBRaw("remote", "serve", "--listen", "127.0.0.1:0"); code == 0 {
+		t.Error("expected remote serve to require a token")
+	}
+	base := startServe(t, "remote", "serve", "--token", "secret")
+
+	resp, err := http.Post(base+"/run", "application/json", strings.NewReader(`{"args": ["help"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", resp.StatusCode)
+	}
+
+	// Two different images; imgdiff answers no and writes diff.png remotely
+	dir := t.TempDir()
+	for i, name := range []string{"a.png", "b.png"} {
+		img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		img.Set(0, 0, color.NRGBA{R: uint8(255 * i), A: 255})
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = png.Encode(f, img)
+		f.Close()
+	}
+	client := t.TempDir()
+	cmd := exec.Command(bbBin, "imgdiff", filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png"), "--out", "diff.png")
+	cmd.Dir = client
+	cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "BB_REMOTE="+strings.TrimPrefix(base, "http://"), "BB_REMOTE_TOKEN=secret")
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != exitFalse {
+		t.Fatalf("expected the remote exit code %d, got %v", exitFalse, err)
+	}
+	if !strings.Contains(string(out), "1 of 16 pixels differ") {
+		t.Errorf("expected remote output, got: %s", out)
+	}
+	if _, err := png.DecodeConfig(mustOpen(t, filepath.Join(client, "diff.png"))); err != nil {
+		t.Errorf("expected diff.png to be transferred: %v", err)
+	}
+}
+
+func mustOpen(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestSealData(t *testing.T) {
+	t.Setenv("BB_PASSPHRASE", "correct horse")
+	sealed, err := sealData([]byte(`{"debug_url": "ws://secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(sealed) || bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("expected ciphertext, got: %q", sealed)
+	}
+	plain, err := openData(sealed)
+	if err != nil || string(plain) != `{"debug_url": "ws://secret"}` {
+		t.Errorf("round trip failed: %q, %v", plain, err)
+	}
+	if plain, err := openData([]byte("{}")); err != nil || string(plain) != "{}" {
+		t.Errorf("expected plaintext to pass through, got %q, %v", plain, err)
+	}
+	line, err := sealLine([]byte(`{"data":"token"}`))
+	if err != nil || bytes.ContainsAny(line, "\n{") {
+		t.Fatalf("expected a sealed line, got %q, %v", line, err)
+	}
+	if plain, err := openLine(line); err != nil || string(plain) != `{"data":"token"}` {
+		t.Errorf("line round trip failed: %q, %v", plain, err)
+	}
+
+	clear(derivedKeys)
+	t.Setenv("BB_PASSPHRASE", "wrong")
+	if _, err := openData(sealed); err == nil {
+		t.Error("expected the wrong passphrase to fail")
+	}
+	t.Setenv("BB_PASSPHRASE", "")
+	if _, err := openData(sealed); err != errNoPassphrase {
+		t.Errorf("expected errNoPassphrase, got %v", err)
+	}
+}
+
+func TestEncryptedJournal(t *testing.T) {
+	home := t.TempDir()
+	run := func(pass string, args ...string) (string, int) {
+		cmd := exec.Command(bbBin, args...)
+		cmd.Env = append(os.Environ(), "HOME="+home, "BB_PASSPHRASE="+pass)
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return string(out), exitErr.ExitCode()
+		}
+		return string(out), 0
+	}
+	run("pw", "sleep", "0.01")
+	run("pw", "config", "timeout")
+	file := filepath.Join(home, ".bb", "journal.jsonl")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 || bytes.Contains(data, []byte("sleep")) || bytes.Count(data, []byte("\n")) != 2 {
+		t.Errorf("expected two encrypted lines only the user can read, got %v:\n%s", info.Mode(), data)
+	}
+	if out, code := run("pw", "journal"); code != 0 || !strings.Contains(out, "sleep 0.01") || !strings.Contains(out, "config timeout") {
+		t.Errorf("expected the journal to read back, got %d: %s", code, out)
+	}
+	if _, code := run("", "journal"); code == 0 {
+		t.Error("expected the journal to need BB_PASSPHRASE")
+	}
+}
+
+func TestLockUnlock(t *testing.T) {
+	home := t.TempDir()
+	profile := filepath.Join(home, ".bb", "chrome-data")
+	if err := os.MkdirAll(filepath.Join(profile, "Default"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(profile, "Default", "Cookies"), []byte("session=s3cr3t"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(pass string, args ...string) (string, int) {
+		cmd := exec.Command(bbBin, args...)
+		cmd.Env = append(os.Environ(), "HOME="+home, "BB_PASSPHRASE="+pass)
+		out, err := cmd.CombinedOutput()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return string(out), exitErr.ExitCode()
+		}
+		return string(out), 0
+	}
+
+	if out, code := run("", "lock"); code == 0 {
+		t.Errorf("expected lock to require BB_PASSPHRASE, got: %s", out)
+	}
+	if out, code := run("pw", "lock"); code != 0 {
+		t.Fatalf("lock failed: %s", out)
+	}
+	if _, err := os.Stat(profile); !os.IsNotExist(err) {
+		t.Error("expected the profile directory to be removed")
+	}
+	locked, err := os.ReadFile(filepath.Join(home, ".bb", "chrome-data.locked"))
+	if err != nil || bytes.Contains(locked, []byte("s3cr3t")) {
+		t.Fatalf("expected an encrypted archive, got err %v", err)
+	}
+	if out, code := run("pw", "open", "about:blank"); code == 0 || !strings.Contains(out, "bb unlock") {
+		t.Errorf("expected a locked profile to refuse to launch, got: %s", out)
+	}
+	if out, code := run("nope", "unlock"); code == 0 {
+		t.Errorf("expected the wrong passphrase to fail, got: %s", out)
+	}
+	if out, code := run("pw", "unlock"); code != 0 {
+		t.Fatalf("unlock failed: %s", out)
+	}
+	data, err := os.ReadFile(filepath.Join(profile, "Default", "Cookies"))
+	if err != nil || string(data) != "session=s3cr3t" {
+		t.Errorf("expected the profile to be restored, got %q, %v", data, err)
+	}
+}
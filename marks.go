@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Mark is a named URL saved with bb mark, optionally with a scroll position
+type Mark struct {
+	URL     string   `json:"url"`
+	Title   string   `json:"title"`
+	ScrollX *float64 `json:"scroll_x,omitempty"`
+	ScrollY *float64 `json:"scroll_y,omitempty"`
+	Time    string   `json:"time"`
+}
+
+func cmdMark(args []string) {
+	scroll := false
+	var positional []string
+	for _, a := range args {
+		switch a {
+		case "--scroll":
+			scroll = true
+		default:
+			positional = append(positional, a)
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("usage: bb mark <name> [--scroll]")
+	}
+	name := positional[0]
+
+	s, _, page := withPage()
+	info, err := page.Info()
+	if err != nil {
+		fatal("failed to get page info: %v", err)
+	}
+	m := Mark{URL: info.URL, Title: info.Title, Time: time.Now().Format(time.RFC3339)}
+	if scroll {
+		pos := page.MustEval(`() => [window.scrollX, window.scrollY]`).Arr()
+		x, y := pos[0].Num(), pos[1].Num()
+		m.ScrollX, m.ScrollY = &x, &y
+	}
+
+	if s.Marks == nil {
+		s.Marks = map[string]Mark{}
+	}
+	s.Marks[name] = m
+	if err := saveState(s); err != nil {
+		fatal("failed to save state: %v", err)
+	}
+	fmt.Printf("Marked %s: %s\n", name, m.URL)
+}
+
+func cmdGoto(args []string) {
+	if len(args) != 1 {
+		fatalUsage("usage: bb goto <name>")
+	}
+	s, _, page := withPage()
+	m, ok := s.Marks[args[0]]
+	if !ok {
+		fail(exitNotFound, "", "no mark named %q (see bb marks)", args[0])
+	}
+	prepareNavigation(page, m.URL, false)
+	if err := page.Navigate(m.URL); err != nil {
+		fatal("navigation failed: %v", err)
+	}
+	page.MustWaitLoad()
+	if m.ScrollY != nil {
+		page.MustEval(`(x, y) => window.scrollTo(x, y)`, *m.ScrollX, *m.ScrollY)
+	}
+	recordNavigation(page)
+	info, _ := page.Info()
+	if info != nil {
+		fmt.Println(info.URL)
+	}
+}
+
+func cmdMarks(args []string, flags globalFlags) {
+	s, err := loadState()
+	if err != nil {
+		s = &State{}
+	}
+	if len(args) > 0 {
+		if args[0] != "rm" || len(args) != 2 {
+			fatalUsage("usage: bb marks [rm <name>]")
+		}
+		if _, ok := s.Marks[args[1]]; !ok {
+			fail(exitNotFound, "", "no mark named %q", args[1])
+		}
+		delete(s.Marks, args[1])
+		if err := saveState(s); err != nil {
+			fatal("failed to save state: %v", err)
+		}
+		fmt.Printf("Removed mark %s\n", args[1])
+		return
+	}
+
+	if flags.jsonOutput {
+		marks := s.Marks
+		if marks == nil {
+			marks = map[string]Mark{}
+		}
+		out, _ := json.MarshalIndent(marks, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	if len(s.Marks) == 0 {
+		fmt.Println("No marks in this session")
+		return
+	}
+	names := slices.Sorted(maps.Keys(s.Marks))
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for _, name := range names {
+		m := s.Marks[name]
+		line := fmt.Sprintf("%-*s  %s - %s", width, name, m.Title, m.URL)
+		if m.ScrollY != nil {
+			line += fmt.Sprintf(" (scroll %.0f,%.0f)", *m.ScrollX, *m.ScrollY)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// mediaInfoJS reports the playback state of an <audio> or <video> element
+const mediaInfoJS = `function() {
+	const states = ['HAVE_NOTHING', 'HAVE_METADATA', 'HAVE_CURRENT_DATA', 'HAVE_FUTURE_DATA', 'HAVE_ENOUGH_DATA'];
+	return {
+		tag: this.tagName.toLowerCase(),
+		src: this.currentSrc,
+		duration: isFinite(this.duration) ? this.duration : null,
+		currentTime: this.currentTime,
+		paused: this.paused,
+		ended: this.ended,
+		muted: this.muted,
+		volume: this.volume,
+		playbackRate: this.playbackRate,
+		readyState: this.readyState,
+		readyStateName: states[this.readyState],
+		error: this.error ? this.error.message || 'code ' + this.error.code : null,
+	};
+}`
+
+// mediaActionJS performs a playback action. play() returns a promise that
+// rejects when autoplay is blocked, which is surfaced as an error.
+const mediaActionJS = `async function(action, value) {
+	if (!(this instanceof HTMLMediaElement)) throw new Error('element is not <audio> or <video>');
+	switch (action) {
+	case 'play':
+		await this.play();
+		break;
+	case 'pause':
+		this.pause();
+		break;
+	case 'seek':
+		this.currentTime = value;
+		await new Promise(resolve => {
+			if (!this.seeking) return resolve();
+			this.addEventListener('seeked', resolve, {once: true});
+			setTimeout(resolve, 5000);
+		});
+		break;
+	case 'mute':
+		this.muted = true;
+		break;
+	case 'unmute':
+		this.muted = false;
+		break;
+	case 'rate':
+		this.playbackRate = value;
+		break;
+	}
+	return this.currentTime;
+}`
+
+func cmdMediaEl(args []string, flags globalFlags) {
+	usage := "usage: bb media-el <selector> play|pause|seek <seconds>|mute|unmute|rate <n>|info"
+	if len(args) < 2 {
+		fatalUsage("%s", usage)
+	}
+	sel, action := args[0], args[1]
+	value := 0.0
+	switch action {
+	case "seek", "rate":
+		if len(args) != 3 {
+			fatalUsage("%s", usage)
+		}
+		v, err := strconv.ParseFloat(args[2], 64)
+		if err != nil || v < 0 {
+			fatalUsage("invalid %s value: %s", action, args[2])
+		}
+		value = v
+	case "play", "pause", "mute", "unmute", "info":
+		if len(args) != 2 {
+			fatalUsage("%s", usage)
+		}
+	default:
+		fatalUsage("unknown media action: %s\n%s", action, usage)
+	}
+
+	_, _, page := withPage()
+	el, err := page.Element(sel)
+	if err != nil {
+		fatalNotFound(sel, err)
+	}
+
+	if action == "info" {
+		res, err := el.Eval(`function() {
+			if (!(this instanceof HTMLMediaElement)) throw new Error('element is not <audio> or <video>');
+			return (` + mediaInfoJS + `).call(this);
+		}`)
+		if err != nil {
+			fatal("media info failed: %v", err)
+		}
+		v := res.Value
+		if flags.jsonOutput {
+			fmt.Println(v.JSON("", "  "))
+			return
+		}
+		duration := "unknown"
+		if !v.Get("duration").Nil() {
+			duration = fmt.Sprintf("%.2fs", v.Get("duration").Num())
+		}
+		fmt.Printf("src:          %s\n", v.Get("src").Str())
+		fmt.Printf("duration:     %s\n", duration)
+		fmt.Printf("currentTime:  %.2fs\n", v.Get("currentTime").Num())
+		fmt.Printf("paused:       %t\n", v.Get("paused").Bool())
+		fmt.Printf("ended:        %t\n", v.Get("ended").Bool())
+		fmt.Printf("muted:        %t (volume %.2f)\n", v.Get("muted").Bool(), v.Get("volume").Num())
+		fmt.Printf("playbackRate: %g\n", v.Get("playbackRate").Num())
+		fmt.Printf("readyState:   %d %s\n", v.Get("readyState").Int(), v.Get("readyStateName").Str())
+		if !v.Get("error").Nil() {
+			fmt.Printf("error:        %s\n", v.Get("error").Str())
+		}
+		return
+	}
+
+	res, err := el.Eval(mediaActionJS, action, value)
+	if err != nil {
+		fatal("%s failed: %v", action, err)
+	}
+	fmt.Printf("%s (at %.2fs)\n", map[string]string{
+		"play": "Playing", "pause": "Paused", "seek": "Seeked", "mute": "Muted", "unmute": "Unmuted", "rate": "Rate set",
+	}[action], res.Value.Num())
+}
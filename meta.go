@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// metaJS collects the page's structured metadata. Relative URLs are resolved
+// against the document base; unparseable JSON-LD blocks are kept as strings.
+const metaJS = `() => {
+	const abs = u => { try { return new URL(u, document.baseURI).href; } catch (e) { return u; } };
+	const meta = {}, og = {}, twitter = {};
+	for (const m of document.querySelectorAll('meta[content]')) {
+		const key = m.getAttribute('property') || m.getAttribute('name') || m.getAttribute('itemprop') || m.getAttribute('http-equiv');
+		if (!key) continue;
+		const k = key.toLowerCase(), v = m.getAttribute('content');
+		const target = k.startsWith('og:') ? og : k.startsWith('twitter:') ? twitter : meta;
+		const name = target === meta ? k : k.slice(k.indexOf(':') + 1);
+		// Repeated tags (og:image, article:tag) become arrays
+		if (name in target) target[name] = [].concat(target[name], v);
+		else target[name] = v;
+	}
+	const jsonLD = Array.from(document.querySelectorAll('script[type="application/ld+json"]')).map(s => {
+		try { return JSON.parse(s.textContent); } catch (e) { return s.textContent.trim(); }
+	});
+	const links = rel => Array.from(document.querySelectorAll('link[href]'))
+		.filter(l => (l.getAttribute('rel') || '').toLowerCase().split(/\s+/).includes(rel));
+	const feeds = links('alternate')
+		.filter(l => /(rss|atom|feed)\+xml|application\/feed\+json/i.test(l.type))
+		.map(l => ({href: abs(l.getAttribute('href')), type: l.type, title: l.title}));
+	const alternates = links('alternate')
+		.filter(l => !feeds.some(f => f.href === abs(l.getAttribute('href'))))
+		.map(l => ({href: abs(l.getAttribute('href')), hreflang: l.hreflang, type: l.type, media: l.media}));
+	const first = rel => { const l = links(rel)[0]; return l ? abs(l.getAttribute('href')) : ''; };
+	return {
+		url: location.href,
+		canonical: first('canonical'),
+		amp: first('amphtml'),
+		title: document.title,
+		description: meta.description || '',
+		lang: document.documentElement.lang || '',
+		icon: first('icon') || first('shortcut icon'),
+		openGraph: og,
+		twitter: twitter,
+		jsonLD: jsonLD,
+		feeds: feeds,
+		alternates: alternates,
+		meta: meta,
+	};
+}`
+
+func cmdMeta(flags globalFlags) {
+	_, _, page := withPage()
+	res, err := page.Eval(metaJS)
+	if err != nil {
+		fatal("failed to read metadata: %v", err)
+	}
+	v := res.Value
+	if flags.jsonOutput {
+		fmt.Println(v.JSON("", "  "))
+		return
+	}
+
+	line := func(key, value string) {
+		if value != "" {
+			fmt.Printf("%-14s %s\n", key+":", value)
+		}
+	}
+	line("url", v.Get("url").Str())
+	line("canonical", v.Get("canonical").Str())
+	line("amp", v.Get("amp").Str())
+	line("title", v.Get("title").Str())
+	line("description", v.Get("description").Str())
+	line("lang", v.Get("lang").Str())
+	line("icon", v.Get("icon").Str())
+	for _, group := range []struct{ prefix, key string }{{"og:", "openGraph"}, {"twitter:", "twitter"}} {
+		fields := v.Get(group.key).Map()
+		for _, k := range slices.Sorted(maps.Keys(fields)) {
+			fmt.Printf("%s%s: %s\n", group.prefix, k, metaString(fields[k].Val()))
+		}
+	}
+	for _, f := range v.Get("feeds").Arr() {
+		fmt.Printf("feed:          %s (%s)\n", f.Get("href").Str(), f.Get("type").Str())
+	}
+	for _, a := range v.Get("alternates").Arr() {
+		desc := a.Get("hreflang").Str()
+		if desc == "" {
+			desc = a.Get("type").Str()
+		}
+		fmt.Printf("alternate:     %s %s\n", a.Get("href").Str(), desc)
+	}
+	if blocks := v.Get("jsonLD").Arr(); len(blocks) > 0 {
+		var types []string
+		for _, b := range blocks {
+			for _, node := range append([]interface{}{b.Val()}, graphOf(b.Val())...) {
+				if m, ok := node.(map[string]interface{}); ok && m["@type"] != nil {
+					types = append(types, metaString(m["@type"]))
+				}
+			}
+		}
+		fmt.Printf("json-ld:       %d block(s) %s (use --json for the data)\n", len(blocks), strings.Join(types, ", "))
+	}
+	fields := v.Get("meta").Map()
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		if k != "description" {
+			fmt.Printf("meta %s: %s\n", k, metaString(fields[k].Val()))
+		}
+	}
+}
+
+// graphOf returns the nodes of a JSON-LD @graph, if any
+func graphOf(v interface{}) []interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		if g, ok := m["@graph"].([]interface{}); ok {
+			return g
+		}
+	}
+	return nil
+}
+
+// metaString renders a metadata value that is either a string or a list
+func metaString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []interface{}:
+		parts := make([]string, len(t))
+		for i, p := range t {
+			parts[i] = metaString(p)
+		}
+		return strings.Join(parts, ", ")
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
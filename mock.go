@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Mock is a canned response bb mock add set up. Requests matching Pattern
+// are answered with it instead of reaching the network.
+type Mock struct {
+	Pattern     string `json:"pattern"`
+	Method      string `json:"method,omitempty"` // any method if empty
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// glob is the pattern with * as the only wildcard. A pattern without one
+// matches URLs that contain it.
+func (m Mock) glob() string {
+	if strings.Contains(m.Pattern, "*") {
+		return m.Pattern
+	}
+	return "*" + m.Pattern + "*"
+}
+
+// urlPattern is the Fetch domain's form of the glob, where ? is a wildcard
+// too and has to be escaped like the escape character itself, so that a
+// query string matches literally
+func (m Mock) urlPattern() string {
+	return strings.NewReplacer(`\`, `\\`, `?`, `\?`).Replace(m.glob())
+}
+
+func (m Mock) matches(method, u string) bool {
+	if m.Method != "" && m.Method != method && method != http.MethodOptions {
+		return false
+	}
+	expr := strings.ReplaceAll(regexp.QuoteMeta(m.glob()), `\*`, ".*")
+	ok, _ := regexp.MatchString("^"+expr+"$", u)
+	return ok
+}
+
+// sessionMocks returns the mocks of the running session
+func sessionMocks() []Mock {
+	s, err := loadState()
+	if err != nil {
+		return nil
+	}
+	return s.Mocks
+}
+
+// matchMock returns the mock answering a request, the latest added first
+func matchMock(mocks []Mock, method, u string) *Mock {
+	for i := len(mocks) - 1; i >= 0; i-- {
+		if mocks[i].matches(method, u) {
+			return &mocks[i]
+		}
+	}
+	return nil
+}
+
+// fulfillMock answers a paused request with m. The page sees an ordinary
+// response, with CORS opened up to the page's origin so cross-origin API
+// calls can be mocked too.
+func fulfillMock(p *rod.Page, e *proto.FetchRequestPaused, m *Mock) {
+	header := func(name string) string {
+		for k, v := range e.Request.Headers {
+			if strings.EqualFold(k, name) {
+				return v.Str()
+			}
+		}
+		return ""
+	}
+	headers := []*proto.FetchHeaderEntry{}
+	if origin := header("Origin"); origin != "" {
+		headers = append(headers,
+			&proto.FetchHeaderEntry{Name: "Access-Control-Allow-Origin", Value: origin},
+			&proto.FetchHeaderEntry{Name: "Access-Control-Allow-Credentials", Value: "true"})
+	}
+	if e.Request.Method == http.MethodOptions && m.Method != http.MethodOptions {
+		// A preflight for the mocked request: allow it through
+		headers = append(headers,
+			&proto.FetchHeaderEntry{Name: "Access-Control-Allow-Methods", Value: header("Access-Control-Request-Method")},
+			&proto.FetchHeaderEntry{Name: "Access-Control-Allow-Headers", Value: header("Access-Control-Request-Headers")})
+		_ = proto.FetchFulfillRequest{RequestID: e.RequestID, ResponseCode: http.StatusNoContent, ResponseHeaders: headers}.Call(p)
+		return
+	}
+	if m.ContentType != "" {
+		headers = append(headers, &proto.FetchHeaderEntry{Name: "Content-Type", Value: m.ContentType})
+	}
+	_ = proto.FetchFulfillRequest{
+		RequestID:       e.RequestID,
+		ResponseCode:    m.Status,
+		ResponseHeaders: headers,
+		Body:            m.Body,
+	}.Call(p)
+}
+
+func cmdMock(args []string, flags globalFlags) {
+	usage := "usage: bb mock add <url-pattern> [--status 200] [--body data|@file] [--content-type type] [--method GET] | bb mock list | bb mock clear [url-pattern]"
+	if len(args) == 0 {
+		fatalUsage("%s", usage)
+	}
+	switch args[0] {
+	case "add":
+		m := Mock{Status: http.StatusOK}
+		var positional []string
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--status", "--body", "--content-type", "--method":
+				if i+1 >= len(args) {
+					fatalUsage("missing value for %s", args[i])
+				}
+				v := args[i+1]
+				switch args[i] {
+				case "--status":
+					n, err := strconv.Atoi(v)
+					if err != nil || n < 100 || n > 599 {
+						fatalUsage("invalid --status: %s", v)
+					}
+					m.Status = n
+				case "--body":
+					m.Body = []byte(readArgValue(v))
+				case "--content-type":
+					m.ContentType = v
+				case "--method":
+					m.Method = strings.ToUpper(v)
+				}
+				i++
+			default:
+				if strings.HasPrefix(args[i], "--") {
+					fatalUsage("%s", usage)
+				}
+				positional = append(positional, args[i])
+			}
+		}
+		if len(positional) != 1 || positional[0] == "" {
+			fatalUsage("%s", usage)
+		}
+		m.Pattern = positional[0]
+		if m.ContentType == "" && json.Valid(m.Body) {
+			m.ContentType = "application/json"
+		}
+
+		s, _ := ensureBrowser()
+		// Adding a pattern again replaces its response
+		mocks := s.Mocks[:0]
+		for _, old := range s.Mocks {
+			if old.Pattern != m.Pattern || old.Method != m.Method {
+				mocks = append(mocks, old)
+			}
+		}
+		s.Mocks = append(mocks, m)
+		if err := saveState(s); err != nil {
+			fatal("failed to save state: %v", err)
+		}
+		fmt.Printf("Mocking %s with %d (%d bytes)\n", m.glob(), m.Status, len(m.Body))
+	case "list":
+		if len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		mocks := sessionMocks()
+		if flags.jsonOutput {
+			if mocks == nil {
+				mocks = []Mock{}
+			}
+			out, _ := json.MarshalIndent(mocks, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if len(mocks) == 0 {
+			fmt.Println("No mocks")
+			return
+		}
+		for _, m := range mocks {
+			method := "*"
+			if m.Method != "" {
+				method = m.Method
+			}
+			fmt.Printf("%-6s %s -> %d %s (%d bytes)\n", method, m.glob(), m.Status, m.ContentType, len(m.Body))
+		}
+	case "clear":
+		if len(args) > 2 {
+			fatalUsage("%s", usage)
+		}
+		s, err := loadState()
+		if err != nil || len(s.Mocks) == 0 {
+			fmt.Println("No mocks")
+			return
+		}
+		var kept []Mock
+		for _, m := range s.Mocks {
+			if len(args) == 2 && m.Pattern != args[1] {
+				kept = append(kept, m)
+			}
+		}
+		removed := len(s.Mocks) - len(kept)
+		if removed == 0 {
+			fail(exitNotFound, "", "no mock for %s", args[1])
+		}
+		s.Mocks = kept
+		if err := saveState(s); err != nil {
+			fatal("failed to save state: %v", err)
+		}
+		fmt.Printf("Removed %d mock(s)\n", removed)
+	default:
+		fatalUsage("%s", usage)
+	}
+}
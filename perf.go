@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// perfVitalsJS reads navigation timing and the paint and layout shift entries
+// the browser buffered since the page loaded. Buffered observers deliver
+// their entries asynchronously, hence the short wait.
+const perfVitalsJS = `() => new Promise(resolve => {
+	const out = {fcp: null, lcp: null, cls: 0};
+	const nav = performance.getEntriesByType('navigation')[0];
+	if (nav) {
+		out.ttfb = nav.responseStart;
+		out.dcl = nav.domContentLoadedEventEnd;
+		out.load = nav.loadEventEnd;
+	}
+	const observers = [];
+	const observe = (type, fn) => {
+		try {
+			const o = new PerformanceObserver(list => list.getEntries().forEach(fn));
+			o.observe({type, buffered: true});
+			observers.push(o);
+		} catch (e) {}
+	};
+	observe('paint', e => { if (e.name === 'first-contentful-paint') out.fcp = e.startTime; });
+	observe('largest-contentful-paint', e => { out.lcp = e.startTime; });
+	observe('layout-shift', e => { if (!e.hadRecentInput) out.cls += e.value; });
+	setTimeout(() => {
+		observers.forEach(o => o.disconnect());
+		resolve(out);
+	}, 100);
+})`
+
+type perfReport struct {
+	URL                string   `json:"url"`
+	TTFBMS             float64  `json:"ttfb_ms"`
+	DOMContentLoadedMS float64  `json:"dom_content_loaded_ms"`
+	LoadMS             float64  `json:"load_ms"`
+	FCPMS              *float64 `json:"fcp_ms"` // null if the page painted no content
+	LCPMS              *float64 `json:"lcp_ms"`
+	CLS                float64  `json:"cls"`
+	JSHeapUsed         int64    `json:"js_heap_used"` // bytes
+	JSHeapTotal        int64    `json:"js_heap_total"`
+	DOMNodes           int      `json:"dom_nodes"`
+	CPUThrottle        float64  `json:"cpu_throttle,omitempty"` // slowdown factor
+}
+
+// parseCPURate parses a slowdown factor like 4x; off and 1x lift it
+func parseCPURate(v string) (float64, error) {
+	if v == "off" {
+		return 1, nil
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(v), "x"), 64)
+	if err != nil || rate < 1 {
+		return 0, fmt.Errorf("invalid --cpu: %s (expected a slowdown like 4x, or off)", v)
+	}
+	return rate, nil
+}
+
+func cmdPerf(args []string, flags globalFlags) {
+	usage := "usage: bb perf [--reload] [--cpu Nx|off]"
+	reload := false
+	cpu := 0.0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--reload":
+			reload = true
+		case "--cpu":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --cpu")
+			}
+			rate, err := parseCPURate(args[i])
+			if err != nil {
+				fatalUsage("%v", err)
+			}
+			cpu = rate
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+
+	if cpu > 0 {
+		c := loadConfig()
+		c.CPUThrottle = cpu
+		if cpu == 1 {
+			c.CPUThrottle = 0
+		}
+		if err := saveConfig(c); err != nil {
+			fatal("failed to save config: %v", err)
+		}
+	}
+	// activatePage applies the saved throttling along with the other settings
+	_, _, page := withPage()
+	if cpu > 0 && !reload {
+		if cpu == 1 {
+			fmt.Println("CPU throttling off")
+		} else {
+			fmt.Printf("CPU throttled %gx (bb perf --reload measures under it)\n", cpu)
+		}
+		return
+	}
+
+	if reload {
+		if err := page.Reload(); err != nil {
+			fatal("failed to reload: %v", err)
+		}
+		if err := page.WaitLoad(); err != nil {
+			fatal("failed to wait for the page: %v", err)
+		}
+	}
+	if err := (proto.PerformanceEnable{}).Call(page); err != nil {
+		fatal("failed to enable performance metrics: %v", err)
+	}
+	metrics, err := proto.PerformanceGetMetrics{}.Call(page)
+	if err != nil {
+		fatal("failed to read performance metrics: %v", err)
+	}
+	res, err := page.Eval(perfVitalsJS)
+	if err != nil {
+		fatal("failed to read web vitals: %v", err)
+	}
+	var vitals struct {
+		TTFB float64  `json:"ttfb"`
+		DCL  float64  `json:"dcl"`
+		Load float64  `json:"load"`
+		FCP  *float64 `json:"fcp"`
+		LCP  *float64 `json:"lcp"`
+		CLS  float64  `json:"cls"`
+	}
+	if err := res.Value.Unmarshal(&vitals); err != nil {
+		fatal("failed to read web vitals: %v", err)
+	}
+
+	r := perfReport{
+		URL:                page.MustInfo().URL,
+		TTFBMS:             vitals.TTFB,
+		DOMContentLoadedMS: vitals.DCL,
+		LoadMS:             vitals.Load,
+		FCPMS:              vitals.FCP,
+		LCPMS:              vitals.LCP,
+		CLS:                vitals.CLS,
+		CPUThrottle:        loadConfig().CPUThrottle,
+	}
+	for _, m := range metrics.Metrics {
+		switch m.Name {
+		case "JSHeapUsedSize":
+			r.JSHeapUsed = int64(m.Value)
+		case "JSHeapTotalSize":
+			r.JSHeapTotal = int64(m.Value)
+		case "Nodes":
+			r.DOMNodes = int(m.Value)
+		}
+	}
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(r, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	ms := func(v *float64) string {
+		if v == nil {
+			return "n/a"
+		}
+		return fmt.Sprintf("%.0f ms", *v)
+	}
+	fmt.Printf("%-18s %s\n", "URL", r.URL)
+	fmt.Printf("%-18s %.0f ms\n", "TTFB", r.TTFBMS)
+	fmt.Printf("%-18s %.0f ms\n", "DOMContentLoaded", r.DOMContentLoadedMS)
+	fmt.Printf("%-18s %.0f ms\n", "Load", r.LoadMS)
+	fmt.Printf("%-18s %s\n", "FCP", ms(r.FCPMS))
+	fmt.Printf("%-18s %s\n", "LCP", ms(r.LCPMS))
+	fmt.Printf("%-18s %.3f\n", "CLS", r.CLS)
+	fmt.Printf("%-18s %.1f MB used of %.1f MB\n", "JS heap", float64(r.JSHeapUsed)/(1<<20), float64(r.JSHeapTotal)/(1<<20))
+	fmt.Printf("%-18s %d\n", "DOM nodes", r.DOMNodes)
+	if r.CPUThrottle > 0 {
+		fmt.Printf("%-18s %gx slowdown\n", "CPU throttle", r.CPUThrottle)
+	}
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsStringRe matches a JavaScript string literal; template literals only
+// without substitutions
+const jsStringRe = `'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|` + "`[^`$]*`"
+
+// playwrightCallRe matches the calls bb import translates, on a page or a
+// locator: page.click(sel), page.locator(sel).click(), page.waitForTimeout(ms)
+var playwrightCallRe = regexp.MustCompile(`\.(?:locator\((` + jsStringRe + `)\)\.)?(goto|click|dblclick|fill|type|waitForSelector|waitFor|waitForTimeout|waitForLoadState|waitForNavigation)\(((?:` + jsStringRe + `|[^)'"` + "`" + `])*)\)`)
+
+var playwrightArgRe = regexp.MustCompile(jsStringRe + `|-?\d+(?:\.\d+)?`)
+
+// playwrightSetupRe matches browser and page setup, which bb's persistent
+// session makes unnecessary
+var playwrightSetupRe = regexp.MustCompile(`\.(launch|connect|connectOverCDP|newContext|newPage|close)\(`)
+
+// selectorEngineRe matches a selector engine prefix like text= or role=
+var selectorEngineRe = regexp.MustCompile(`^[a-z_-]+=`)
+
+// jsUnquote decodes a string literal matched by jsStringRe
+func jsUnquote(lit string) string {
+	body := lit[1 : len(lit)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i+1 == len(body) {
+			b.WriteByte(body[i])
+			continue
+		}
+		i++
+		switch body[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		default:
+			b.WriteByte(body[i])
+		}
+	}
+	return b.String()
+}
+
+// cssSelector returns a Playwright selector as CSS, or false for the
+// engines bb has no equivalent of (text=, role=, chained >> selectors...)
+func cssSelector(sel string) (string, bool) {
+	sel = strings.TrimSpace(strings.TrimPrefix(sel, "css="))
+	if sel == "" || strings.Contains(sel, ">>") || strings.Contains(sel, ":has-text(") || strings.Contains(sel, ":text(") {
+		return "", false
+	}
+	if selectorEngineRe.MatchString(sel) || strings.HasPrefix(sel, "//") || strings.HasPrefix(sel, "internal:") {
+		return "", false
+	}
+	return sel, true
+}
+
+// playwrightStep translates one action into a bb command, or returns nil
+// when it is outside the supported subset
+func playwrightStep(method, selector string, params []string, number float64) []string {
+	switch method {
+	case "goto":
+		if len(params) > 0 {
+			return []string{"open", "--raw", params[0]}
+		}
+	case "waitForTimeout":
+		return []string{"sleep", strconv.FormatFloat(number/1000, 'f', -1, 64)}
+	case "waitForLoadState":
+		if len(params) > 0 && params[0] == "networkidle" {
+			return []string{"waitidle"}
+		}
+		return []string{"waitload"}
+	case "waitForNavigation":
+		return []string{"waitload"}
+	}
+	sel, ok := cssSelector(selector)
+	if !ok {
+		return nil
+	}
+	switch method {
+	case "click":
+		return []string{"click", sel}
+	case "dblclick":
+		return []string{"click", sel, "--double"}
+	case "fill":
+		if len(params) > 0 {
+			return []string{"input", sel, params[0]}
+		}
+	case "type":
+		if len(params) > 0 {
+			return []string{"type", sel, params[0]}
+		}
+	case "waitFor", "waitForSelector":
+		return []string{"wait", sel}
+	}
+	return nil
+}
+
+// translatePlaywrightScript translates the supported calls of a Playwright
+// or Puppeteer script, line by line. Other awaited statements become
+// "# unsupported:" comments so nothing is dropped silently.
+func translatePlaywrightScript(src string) (lines []string, unsupported int) {
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "//") {
+			continue
+		}
+		m := playwrightCallRe.FindStringSubmatch(line)
+		if m == nil {
+			if strings.Contains(line, "await ") && !playwrightSetupRe.MatchString(line) {
+				lines = append(lines, "# unsupported: "+line)
+				unsupported++
+			}
+			continue
+		}
+		locator, method := m[1], m[2]
+		var params []string
+		number := 0.0
+		for _, a := range playwrightArgRe.FindAllString(m[3], -1) {
+			if a[0] == '\'' || a[0] == '"' || a[0] == '`' {
+				params = append(params, jsUnquote(a))
+			} else if number == 0 {
+				number, _ = strconv.ParseFloat(a, 64)
+			}
+		}
+		// page.click(sel, ...) names the selector first; locator calls don't
+		selector := ""
+		if locator != "" {
+			selector = jsUnquote(locator)
+		} else if method != "goto" && method != "waitForLoadState" && len(params) > 0 {
+			selector, params = params[0], params[1:]
+		}
+		step := playwrightStep(method, selector, params, number)
+		if step == nil {
+			lines = append(lines, "# unsupported: "+line)
+			unsupported++
+			continue
+		}
+		lines = append(lines, quoteScriptArgs(step))
+	}
+	return lines, unsupported
+}
+
+// translatePlaywrightTrace translates the recorded API calls of a Playwright
+// trace.zip
+func translatePlaywrightTrace(data []byte) (lines []string, unsupported int, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("not a trace archive: %v", err)
+	}
+	found := false
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".trace") {
+			continue
+		}
+		found = true
+		rc, err := f.Open()
+		if err != nil {
+			return nil, 0, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var ev struct {
+				Type     string          `json:"type"`
+				APIName  string          `json:"apiName"`
+				Method   string          `json:"method"`
+				Params   json.RawMessage `json:"params"`
+				Metadata *struct {
+					APIName string          `json:"apiName"`
+					Method  string          `json:"method"`
+					Params  json.RawMessage `json:"params"`
+				} `json:"metadata"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+				continue
+			}
+			// Newer traces log "before" events; older ones "action" events
+			if ev.Type == "action" && ev.Metadata != nil {
+				ev.APIName, ev.Method, ev.Params = ev.Metadata.APIName, ev.Metadata.Method, ev.Metadata.Params
+			} else if ev.Type != "before" {
+				continue
+			}
+			if ev.APIName == "" || playwrightSetupRe.MatchString("."+ev.Method+"(") {
+				continue
+			}
+			var p struct {
+				URL      string  `json:"url"`
+				Selector string  `json:"selector"`
+				Value    string  `json:"value"`
+				Text     string  `json:"text"`
+				State    string  `json:"state"`
+				Timeout  float64 `json:"timeout"`
+			}
+			_ = json.Unmarshal(ev.Params, &p)
+			var params []string
+			switch ev.Method {
+			case "goto":
+				params = []string{p.URL}
+			case "fill":
+				params = []string{p.Value}
+			case "type":
+				params = []string{p.Text}
+			case "waitForLoadState":
+				params = []string{p.State}
+			}
+			step := playwrightStep(ev.Method, p.Selector, params, p.Timeout)
+			if step == nil {
+				desc := ev.APIName
+				if p.Selector != "" {
+					desc += " " + p.Selector
+				}
+				lines = append(lines, "# unsupported: "+desc)
+				unsupported++
+				continue
+			}
+			lines = append(lines, quoteScriptArgs(step))
+		}
+	}
+	if !found {
+		return nil, 0, fmt.Errorf("no .trace file in the archive")
+	}
+	return lines, unsupported, nil
+}
+
+// quoteScriptArgs joins args into a script line that splitCommandLine reads
+// back unchanged
+func quoteScriptArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		switch {
+		case a != "" && !strings.ContainsAny(a, " \t\n\"'\\#"):
+			quoted[i] = a
+		case !strings.ContainsAny(a, "'\n"):
+			quoted[i] = "'" + a + "'"
+		default:
+			quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(a) + `"`
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func cmdImport(args []string) {
+	usage := "usage: bb import playwright <script.ts|trace.zip> [--out flow.bb]"
+	if len(args) < 2 || args[0] != "playwright" {
+		fatalUsage("%s", usage)
+	}
+	src, out := "", ""
+	for i := 1; i < len(args); i++ {
+		switch {
+		case args[i] == "--out" && i+1 < len(args):
+			i++
+			out = args[i]
+		case src == "" && !strings.HasPrefix(args[i], "--"):
+			src = args[i]
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	if src == "" {
+		fatalUsage("%s", usage)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		fatal("failed to read %s: %v", src, err)
+	}
+
+	var lines []string
+	var unsupported int
+	if bytes.HasPrefix(data, []byte("PK")) {
+		lines, unsupported, err = translatePlaywrightTrace(data)
+		if err != nil {
+			fatal("%s: %v", src, err)
+		}
+	} else {
+		lines, unsupported = translatePlaywrightScript(string(data))
+	}
+	if len(lines) == unsupported {
+		fatal("%s: no supported actions (goto, click, fill, waitFor...) found", src)
+	}
+
+	script := "# imported from " + src + " by bb import playwright\n" + strings.Join(lines, "\n") + "\n"
+	if out == "" {
+		fmt.Print(script)
+	} else {
+		if err := os.WriteFile(out, []byte(script), 0644); err != nil {
+			fatal("failed to write %s: %v", out, err)
+		}
+		recordArtifact("flow", out)
+		fmt.Printf("Wrote %s\n", out)
+	}
+	if unsupported > 0 {
+		fmt.Fprintf(os.Stderr, "%d unsupported actions left as # unsupported comments\n", unsupported)
+	}
+}
+
+// jsQuote returns s as a single-quoted JavaScript string literal
+func jsQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`).Replace(s) + "'"
+}
+
+// splitFlags separates a command's --flags from its positional arguments.
+// None of the exported commands' flags take a value, except type's --delay.
+func splitFlags(args []string) (positional []string, flags map[string]bool) {
+	flags = map[string]bool{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--delay":
+			i++
+		case strings.HasPrefix(args[i], "--"):
+			flags[args[i]] = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	return positional, flags
+}
+
+// onlyFlags reports whether every flag is one of allowed
+func onlyFlags(flags map[string]bool, allowed ...string) bool {
+	for f := range flags {
+		if !slices.Contains(allowed, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// playwrightStatements translates one bb command into Playwright test
+// statements, or returns nil for commands it has no equivalent of
+func playwrightStatements(args []string) []string {
+	pos, flags := splitFlags(args[1:])
+	switch {
+	case args[0] == "open" && len(pos) == 1 && onlyFlags(flags, "--raw", "--wait", "--keep-links"):
+		u := pos[0]
+		if !strings.Contains(u, "://") {
+			u = "https://" + u
+		}
+		out := []string{"await page.goto(" + jsQuote(u) + ");"}
+		if flags["--wait"] {
+			out = append(out, "await page.waitForLoadState('networkidle');")
+		}
+		return out
+	case args[0] == "back" && len(pos) == 0:
+		return []string{"await page.goBack();"}
+	case args[0] == "forward" && len(pos) == 0:
+		return []string{"await page.goForward();"}
+	case args[0] == "reload" && len(pos) == 0:
+		return []string{"await page.reload();"}
+	case args[0] == "click" && len(pos) == 1 && onlyFlags(flags, "--double", "--right", "--middle"):
+		method, opts := "click", ""
+		if flags["--double"] {
+			method = "dblclick"
+		}
+		if flags["--right"] {
+			opts = ", { button: 'right' }"
+		} else if flags["--middle"] {
+			opts = ", { button: 'middle' }"
+		}
+		return []string{"await page." + method + "(" + jsQuote(pos[0]) + opts + ");"}
+	case args[0] == "input" && len(pos) >= 2 && len(flags) == 0:
+		return []string{"await page.fill(" + jsQuote(pos[0]) + ", " + jsQuote(strings.Join(pos[1:], " ")) + ");"}
+	case args[0] == "clear" && len(pos) == 1:
+		return []string{"await page.fill(" + jsQuote(pos[0]) + ", '');"}
+	case args[0] == "type" && (len(pos) == 1 || len(pos) == 2) && onlyFlags(flags, "--enter", "--delay"):
+		out := []string{"await page.keyboard.type(" + jsQuote(pos[len(pos)-1]) + ");"}
+		if len(pos) == 2 {
+			out[0] = "await page.locator(" + jsQuote(pos[0]) + ").pressSequentially(" + jsQuote(pos[1]) + ");"
+		}
+		if flags["--enter"] {
+			out = append(out, "await page.keyboard.press('Enter');")
+		}
+		return out
+	case args[0] == "select" && len(pos) >= 2 && len(flags) == 0:
+		values := make([]string, len(pos)-1)
+		for i, v := range pos[1:] {
+			values[i] = jsQuote(v)
+		}
+		return []string{"await page.selectOption(" + jsQuote(pos[0]) + ", [" + strings.Join(values, ", ") + "]);"}
+	case args[0] == "submit" && len(pos) == 1:
+		return []string{"await page.locator(" + jsQuote(pos[0]) + ").evaluate(form => form.requestSubmit());"}
+	case (args[0] == "hover" || args[0] == "focus") && len(pos) == 1 && len(flags) == 0:
+		return []string{"await page." + args[0] + "(" + jsQuote(pos[0]) + ");"}
+	case args[0] == "wait" && len(pos) == 1:
+		return []string{"await page.waitForSelector(" + jsQuote(pos[0]) + ");"}
+	case args[0] == "waitload":
+		return []string{"await page.waitForLoadState('load');"}
+	case args[0] == "waitidle" || args[0] == "waitstable":
+		return []string{"await page.waitForLoadState('networkidle');"}
+	case args[0] == "sleep" && len(pos) == 1:
+		secs, err := strconv.ParseFloat(pos[0], 64)
+		if err != nil {
+			return nil
+		}
+		return []string{"await page.waitForTimeout(" + strconv.FormatFloat(secs*1000, 'f', -1, 64) + ");"}
+	case args[0] == "visible" && len(pos) == 1:
+		return []string{"await expect(page.locator(" + jsQuote(pos[0]) + ")).toBeVisible();"}
+	case args[0] == "exists" && len(pos) == 1:
+		return []string{"await expect(page.locator(" + jsQuote(pos[0]) + ").first()).toBeAttached();"}
+	case args[0] == "js" && len(pos) >= 1:
+		return []string{"await page.evaluate(" + jsQuote(strings.Join(pos, " ")) + ");"}
+	case args[0] == "screenshot" && len(pos) <= 1 && len(flags) == 0:
+		if len(pos) == 0 {
+			return []string{"await page.screenshot();"}
+		}
+		return []string{"await page.screenshot({ path: " + jsQuote(pos[0]) + " });"}
+	}
+	return nil
+}
+
+// exportPlaywright writes the steps as a Playwright test; commands without
+// an equivalent become // unsupported: comments
+func exportPlaywright(name string, steps []journeyLine) (test string, unsupported int) {
+	var b strings.Builder
+	b.WriteString("import { test, expect } from '@playwright/test';\n\n")
+	b.WriteString("test(" + jsQuote(name) + ", async ({ page }) => {\n")
+	for _, step := range steps {
+		stmts := playwrightStatements(step.args)
+		if stmts == nil {
+			stmts = []string{"// unsupported: bb " + quoteScriptArgs(step.args)}
+			unsupported++
+		}
+		for _, s := range stmts {
+			b.WriteString("  " + s + "\n")
+		}
+	}
+	b.WriteString("});\n")
+	return b.String(), unsupported
+}
+
+func cmdExport(args []string) {
+	usage := "usage: bb export playwright <script.bb> | --journal [--from N] [--to N] [--out test.spec.ts] [--name title]"
+	if len(args) < 2 || args[0] != "playwright" {
+		fatalUsage("%s", usage)
+	}
+	src, out, name := "", "", ""
+	journal, from, to := false, 1, 0
+	for i := 1; i < len(args); i++ {
+		switch {
+		case (args[i] == "--out" || args[i] == "--name") && i+1 < len(args):
+			if args[i] == "--out" {
+				out = args[i+1]
+			} else {
+				name = args[i+1]
+			}
+			i++
+		case (args[i] == "--from" || args[i] == "--to") && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				fatalUsage("invalid %s: %s", args[i], args[i+1])
+			}
+			if args[i] == "--from" {
+				from = n
+			} else {
+				to = n
+			}
+			i++
+		case args[i] == "--journal":
+			journal = true
+		case src == "" && !strings.HasPrefix(args[i], "--"):
+			src = args[i]
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	if journal == (src != "") || (!journal && (from != 1 || to != 0)) {
+		fatalUsage("%s", usage)
+	}
+	var steps []journeyLine
+	if journal {
+		steps = journalSteps(from, to)
+		if len(steps) == 0 {
+			fatal("no successful commands in the journal between %d and %d", from, to)
+		}
+		if name == "" {
+			name = "journal"
+		}
+	} else {
+		steps = readJourney(src)
+		if len(steps) == 0 {
+			fatal("no commands in %s", src)
+		}
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	}
+
+	test, unsupported := exportPlaywright(name, steps)
+	if out == "" {
+		fmt.Print(test)
+	} else {
+		if err := os.WriteFile(out, []byte(test), 0644); err != nil {
+			fatal("failed to write %s: %v", out, err)
+		}
+		recordArtifact("playwright", out)
+		fmt.Printf("Wrote %s\n", out)
+	}
+	if unsupported > 0 {
+		fmt.Fprintf(os.Stderr, "%d commands without a Playwright equivalent left as // unsupported comments\n", unsupported)
+	}
+}
+
+// journalSteps turns journal entries from..to (counting from 1 for the
+// oldest; to 0 for the newest) into journey steps. Commands that failed are
+// left out, as are bb export and the ones a journey can't run.
+func journalSteps(from, to int) []journeyLine {
+	entries, err := readJournal(journalPath())
+	if err != nil && !os.IsNotExist(err) {
+		fatal("failed to read the journal: %v", err)
+	}
+	if to == 0 || to > len(entries) {
+		to = len(entries)
+	}
+	var steps []journeyLine
+	for n := from; n <= to; n++ {
+		e := entries[n-1]
+		switch e.Command {
+		case "journey", "serve", "remote", "export":
+			continue
+		}
+		if e.ExitCode == 0 {
+			steps = append(steps, journeyLine{n, append([]string{e.Command}, e.Args...)})
+		}
+	}
+	return steps
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+)
+
+// switchToPopup makes popup the active page once it has loaded
+func switchToPopup(browser *rod.Browser, popup *rod.Page) {
+	page := activatePage(popup)
+	if err := page.WaitLoad(); err != nil {
+		fatal("popup failed to load: %v", err)
+	}
+	pages, err := browser.Pages()
+	if err != nil {
+		fatal("failed to list pages: %v", err)
+	}
+	idx, err := resolvePage(string(popup.TargetID), pages)
+	if err != nil {
+		fatal("popup closed before it could be followed")
+	}
+	s, err := loadState()
+	if err != nil {
+		fatal("failed to load state: %v", err)
+	}
+	setActivePage(s, idx, popup)
+	if err := saveState(s); err != nil {
+		fatal("failed to save state: %v", err)
+	}
+	recordNavigation(page)
+	if info, _ := page.Info(); info != nil {
+		fmt.Printf("Switched to [%d] %s %s - %s\n", idx, shortID(popup), info.Title, info.URL)
+	}
+}
+
+// openedBy returns the most recent page that opener opened, if any
+func openedBy(pages rod.Pages, opener *rod.Page) *rod.Page {
+	var found *rod.Page
+	for _, p := range pages {
+		if info, err := p.Info(); err == nil && info.OpenerID == opener.TargetID {
+			found = p
+		}
+	}
+	return found
+}
+
+func cmdPopup(args []string) {
+	if len(args) != 1 || args[0] != "wait" {
+		fatalUsage("usage: bb popup wait")
+	}
+	_, browser, page := withPage()
+
+	// The popup may already be open (bb click ...; bb popup wait)
+	wait := page.WaitOpen()
+	pages, err := browser.Pages()
+	if err != nil {
+		fatal("failed to list pages: %v", err)
+	}
+	popup := openedBy(pages, page)
+	if popup == nil {
+		if popup, err = wait(); err != nil {
+			fatal("no popup opened: %v", err)
+		}
+	}
+	switchToPopup(browser, popup)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/stealth"
+)
+
+// prefetchResult is one URL bb prefetch loaded
+type prefetchResult struct {
+	URL        string `json:"url"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+func cmdPrefetch(args []string, flags globalFlags) {
+	concurrency := 4
+	var urls []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--concurrency":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --concurrency")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				fatalUsage("invalid --concurrency: %s", args[i])
+			}
+			concurrency = n
+		case "-":
+			urls = append(urls, readURLList("-")...)
+		default:
+			u := args[i]
+			if !strings.Contains(u, "://") {
+				u = "https://" + u
+			}
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		fatalUsage("usage: bb prefetch <url...|-> [--concurrency N]")
+	}
+	concurrency = min(concurrency, len(urls))
+
+	// Throwaway tabs load the pages so the browser's cache and cookie jar are
+	// warm for a later open; the active page is left alone
+	_, browser := ensureBrowser()
+	results := make([]prefetchResult, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var printMu sync.Mutex
+	for w := 0; w < concurrency; w++ {
+		base := stealth.MustPage(browser)
+		configurePage(base)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer base.Close()
+			for i := range jobs {
+				r := &results[i]
+				r.URL = urls[i]
+				start := time.Now()
+				func() {
+					defer func() {
+						if rec := recover(); rec != nil {
+							r.Error = fmt.Sprint(rec)
+						}
+					}()
+					page := base.Timeout(defaultTimeout)
+					prepareNavigation(page, r.URL, false)
+					if err := page.Navigate(r.URL); err != nil {
+						r.Error = err.Error()
+						return
+					}
+					if err := page.WaitLoad(); err != nil {
+						r.Error = err.Error()
+					}
+				}()
+				r.DurationMS = time.Since(start).Milliseconds()
+				if !flags.jsonOutput {
+					printMu.Lock()
+					if r.Error != "" {
+						fmt.Printf("fail  %s: %s\n", r.URL, r.Error)
+					} else {
+						fmt.Printf("ok    %s (%dms)\n", r.URL, r.DurationMS)
+					}
+					printMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	ok := 0
+	for _, r := range results {
+		if r.Error == "" {
+			ok++
+		}
+	}
+	fmt.Printf("Prefetched %d/%d URLs\n", ok, len(urls))
+}
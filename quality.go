@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// How readableContent got the text, from most to least trustworthy
+const (
+	extractedReadability = "readability"  // readability found an article
+	extractedElement     = "element-text" // readability dropped most of the --selector element
+	extractedInnerText   = "innertext"    // readability found nothing; the whole page's text
+)
+
+// extractQuality says how far the extraction can be trusted, so an agent
+// knows when to look at the HTML or a screenshot instead
+type extractQuality struct {
+	Score       float64  `json:"score"` // 0 to 1
+	Level       string   `json:"level"` // high, medium or low
+	Method      string   `json:"method"`
+	Words       int      `json:"words"`
+	TextDensity float64  `json:"text_density"`      // words per paragraph
+	Boilerplate float64  `json:"boilerplate_ratio"` // share of the page's text left out
+	LinkDensity float64  `json:"link_density"`      // share of the page's text in links
+	Reasons     []string `json:"reasons,omitempty"`
+}
+
+// pageTextStatsJS measures the text of the whole page the content came from
+const pageTextStatsJS = `() => {
+	const body = document.body;
+	if (!body) return {text: 0, links: 0};
+	let links = 0;
+	for (const a of body.querySelectorAll('a')) links += (a.innerText || '').length;
+	return {text: (body.innerText || '').length, links};
+}`
+
+// assessExtraction scores content got by method from page. Short text, a
+// fallback to the page's full text, a content wall or an extraction made of
+// fragments each lower the score.
+func assessExtraction(page *rod.Page, content, method, wall string) extractQuality {
+	q := extractQuality{Method: method, Words: len(strings.Fields(content)), Reasons: []string{}}
+	paragraphs := 0
+	for _, block := range strings.Split(content, "\n") {
+		if strings.TrimSpace(block) != "" {
+			paragraphs++
+		}
+	}
+	if paragraphs > 0 {
+		q.TextDensity = round2(float64(q.Words) / float64(paragraphs))
+	}
+	if res, err := page.Eval(pageTextStatsJS); err == nil {
+		text, links := res.Value.Get("text").Int(), res.Value.Get("links").Int()
+		if text > 0 {
+			q.Boilerplate = round2(math.Max(0, 1-float64(len([]rune(content)))/float64(text)))
+			q.LinkDensity = round2(float64(links) / float64(text))
+		}
+	}
+
+	score := map[string]float64{extractedReadability: 1, extractedElement: 0.7, extractedInnerText: 0.5}[method]
+	penalize := func(factor float64, reason string) {
+		score *= factor
+		q.Reasons = append(q.Reasons, reason)
+	}
+	switch method {
+	case extractedInnerText:
+		penalize(1, "readability found no article; this is all of the page's text")
+	case extractedElement:
+		penalize(1, "readability dropped most of the element; this is its plain text")
+	}
+	switch {
+	case q.Words < 50:
+		penalize(0.3, fmt.Sprintf("only %d words", q.Words))
+	case q.Words < 150:
+		penalize(0.7, fmt.Sprintf("only %d words", q.Words))
+	}
+	if paragraphs >= 5 && q.TextDensity < 8 {
+		penalize(0.7, "mostly short lines (menus, lists or labels rather than prose)")
+	}
+	if method == extractedInnerText && q.LinkDensity > 0.5 {
+		penalize(0.6, "most of the page's text is links")
+	}
+	if method == extractedReadability && q.Boilerplate > 0.95 && q.Words < 300 {
+		penalize(0.7, "a small part of the page was kept; the main content may have been missed")
+	}
+	if wall != "" {
+		penalize(0.4, "behind a "+map[string]string{"paywall": "paywall", "login": "login wall"}[wall])
+	}
+	q.Score = round2(score)
+	switch {
+	case q.Score >= 0.7:
+		q.Level = "high"
+	case q.Score >= 0.4:
+		q.Level = "medium"
+	default:
+		q.Level = "low"
+	}
+	return q
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Command priorities for bb serve; interactive commands should use high so a
+// long batch job doesn't hold them up
+const (
+	priorityLow = iota
+	priorityNormal
+	priorityHigh
+)
+
+var priorities = map[string]int{"low": priorityLow, "normal": priorityNormal, "high": priorityHigh}
+
+// exclusiveCommands change which pages exist or session-wide settings, so
+// they run alone rather than in a page's lane
+var exclusiveCommands = map[string]bool{
+	"page": true, "newpage": true, "closepage": true, "stop": true, "restart": true, "config": true, "clock": true, "throttle": true,
+}
+
+// queuedJob waits in the scheduler until it may run
+type queuedJob struct {
+	lane      string // page the command runs on
+	priority  int
+	exclusive bool
+	seq       uint64
+	start     chan struct{}
+}
+
+// scheduler runs at most one command per page at a time and up to max
+// commands across pages. Waiting jobs start by priority, then from the lane
+// that was served least recently, then in arrival order. An exclusive job
+// waits for everything running to finish and holds back the jobs behind it.
+type scheduler struct {
+	mu         sync.Mutex
+	max        int
+	seq        uint64
+	waiting    []*queuedJob
+	running    int
+	busy       map[string]bool
+	exclusive  bool
+	lastServed map[string]uint64
+}
+
+func newScheduler(max int) *scheduler {
+	return &scheduler{max: max, busy: map[string]bool{}, lastServed: map[string]uint64{}}
+}
+
+// acquire blocks until the job may run; release must be called afterwards
+func (q *scheduler) acquire(lane string, priority int, exclusive bool) *queuedJob {
+	q.mu.Lock()
+	q.seq++
+	job := &queuedJob{lane: lane, priority: priority, exclusive: exclusive, seq: q.seq, start: make(chan struct{})}
+	q.waiting = append(q.waiting, job)
+	q.dispatch()
+	q.mu.Unlock()
+	<-job.start
+	return job
+}
+
+func (q *scheduler) release(job *queuedJob) {
+	q.mu.Lock()
+	q.running--
+	if job.exclusive {
+		q.exclusive = false
+	} else {
+		delete(q.busy, job.lane)
+	}
+	q.dispatch()
+	q.mu.Unlock()
+}
+
+// waitingCount returns the number of commands that haven't started yet
+func (q *scheduler) waitingCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+// dispatch starts every job that can run now. Callers hold q.mu.
+func (q *scheduler) dispatch() {
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		a, b := q.waiting[i], q.waiting[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		if la, lb := q.lastServed[a.lane], q.lastServed[b.lane]; la != lb {
+			return la < lb
+		}
+		return a.seq < b.seq
+	})
+	var remaining []*queuedJob
+	blocked := false
+	for _, job := range q.waiting {
+		if blocked || q.exclusive {
+			remaining = append(remaining, job)
+			continue
+		}
+		if job.exclusive {
+			if q.running == 0 {
+				q.exclusive = true
+				q.running++
+				close(job.start)
+			} else {
+				remaining = append(remaining, job)
+			}
+			// Nothing overtakes an exclusive job
+			blocked = true
+			continue
+		}
+		if q.busy[job.lane] || q.running >= q.max {
+			remaining = append(remaining, job)
+			continue
+		}
+		q.busy[job.lane] = true
+		q.running++
+		q.lastServed[job.lane] = job.seq
+		close(job.start)
+	}
+	q.waiting = remaining
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// remoteFile is a file a remote command produced, sent back to the client
+type remoteFile struct {
+	Path string `json:"path"` // relative to the client's working directory
+	Data string `json:"data"` // base64
+}
+
+// collectRemoteFiles gathers what a command wrote to its scratch directory,
+// plus artifacts recorded elsewhere (output-dir, error captures) since the
+// command started
+func collectRemoteFiles(dir string, artifactsBefore int) []remoteFile {
+	var files []remoteFile
+	add := func(path, rel string) {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			files = append(files, remoteFile{Path: filepath.ToSlash(rel), Data: base64.StdEncoding.EncodeToString(data)})
+		}
+	}
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			rel, _ := filepath.Rel(dir, path)
+			add(path, rel)
+		}
+		return nil
+	})
+	if s, err := loadState(); err == nil && len(s.Artifacts) > artifactsBefore {
+		for _, a := range s.Artifacts[artifactsBefore:] {
+			if abs, err := filepath.Abs(a.Path); err == nil && !strings.HasPrefix(abs, dir+string(filepath.Separator)) {
+				add(abs, filepath.Base(abs))
+			}
+		}
+	}
+	return files
+}
+
+// runRemote sends the invocation to the bb remote serve at addr, replays its
+// output and writes the files it produced, then exits with its exit code
+func runRemote(addr string, args []string, priority string) {
+	base := addr
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	body, _ := json.Marshal(runRequest{Args: args, Priority: priority})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(base, "/")+"/run", bytes.NewReader(body))
+	if err != nil {
+		fatalUsage("invalid BB_REMOTE %q: %v", addr, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("BB_REMOTE_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fail(exitUnreachable, "", "remote %s unreachable: %v", addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		fatal("remote %s: %s: %s", addr, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var result runResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fatal("invalid response from remote %s: %v", addr, err)
+	}
+
+	for _, f := range result.Files {
+		// Only write below the working directory
+		rel := filepath.Clean(filepath.FromSlash(f.Path))
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			fmt.Fprintf(os.Stderr, "warning: skipping remote file outside the working directory: %s\n", f.Path)
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(f.Data)
+		if err != nil {
+			fatal("invalid remote file %s: %v", f.Path, err)
+		}
+		if dir := filepath.Dir(rel); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				fatal("failed to create %s: %v", dir, err)
+			}
+		}
+		if err := os.WriteFile(rel, data, 0644); err != nil {
+			fatal("failed to write %s: %v", rel, err)
+		}
+	}
+
+	if result.StdoutBase64 != "" {
+		data, _ := base64.StdEncoding.DecodeString(result.StdoutBase64)
+		_, _ = os.Stdout.Write(data)
+	} else {
+		fmt.Print(result.Stdout)
+	}
+	fmt.Fprint(os.Stderr, result.Stderr)
+	os.Exit(result.ExitCode)
+}
+
+func cmdRemote(args []string) {
+	if len(args) < 1 || args[0] != "serve" {
+		fatalUsage("usage: bb remote serve --token t [--listen host:port] [--concurrency N]")
+	}
+	serveAPI(args[1:], ":8378", true)
+}
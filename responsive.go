@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// responsiveShot is the capture of a page at one viewport width
+type responsiveShot struct {
+	Width    int    `json:"width"`
+	File     string `json:"file"`
+	Height   int    `json:"height"`             // of the page at this width
+	Overflow int    `json:"overflow,omitempty"` // px the page is wider than the viewport
+}
+
+type responsiveManifest struct {
+	URL   string           `json:"url"`
+	Title string           `json:"title"`
+	Time  string           `json:"time"`
+	Shots []responsiveShot `json:"shots"`
+}
+
+// responsiveOptions are the capture settings shared by bb responsive and
+// bb shotmatrix
+type responsiveOptions struct {
+	height int // of the viewport
+	mobile bool
+	settle time.Duration
+	image  imageOptions
+}
+
+// parseWidths parses a comma-separated list of viewport widths
+func parseWidths(v string) ([]int, error) {
+	var widths []int
+	for _, part := range strings.Split(v, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || w < 100 || w > 10000 {
+			return nil, fmt.Errorf("invalid width %q (expected 100-10000)", part)
+		}
+		widths = append(widths, w)
+	}
+	return widths, nil
+}
+
+// parseResponsiveFlag consumes one capture flag at args[i], like
+// parseImageFlag
+func parseResponsiveFlag(args []string, i int, opts *responsiveOptions) (int, bool) {
+	if next, ok := parseImageFlag(args, i, &opts.image); ok {
+		return next, true
+	}
+	switch args[i] {
+	case "--height", "--settle":
+		if i+1 >= len(args) {
+			fatalUsage("missing value for %s", args[i])
+		}
+		v, err := strconv.Atoi(args[i+1])
+		if err != nil || v < 0 || (args[i] == "--height" && v < 100) {
+			fatalUsage("invalid %s: %s", args[i], args[i+1])
+		}
+		if args[i] == "--height" {
+			opts.height = v
+		} else {
+			opts.settle = time.Duration(v) * time.Millisecond
+		}
+		return i + 1, true
+	case "--mobile":
+		opts.mobile = true
+		return i, true
+	}
+	return i, false
+}
+
+// captureWidth resizes the viewport to width, lets the layout settle and
+// saves a full-page screenshot to file
+func captureWidth(page *rod.Page, width int, opts responsiveOptions, file string) (responsiveShot, error) {
+	shot := responsiveShot{Width: width, File: file}
+	err := proto.EmulationSetDeviceMetricsOverride{
+		Width:             width,
+		Height:            opts.height,
+		DeviceScaleFactor: 1,
+		Mobile:            opts.mobile,
+	}.Call(page)
+	if err != nil {
+		return shot, fmt.Errorf("failed to set viewport: %w", err)
+	}
+	// Resize handlers and lazy images react after the media queries
+	time.Sleep(opts.settle)
+	res, err := page.Eval(`() => ({height: document.documentElement.scrollHeight, width: document.documentElement.scrollWidth})`)
+	if err != nil {
+		return shot, fmt.Errorf("failed to measure the page: %w", err)
+	}
+	shot.Height = res.Value.Get("height").Int()
+	shot.Overflow = max(0, res.Value.Get("width").Int()-width)
+	// The shot is as wide as the viewport, as a visitor sees it, even when
+	// the page overflows
+	data, err := page.Screenshot(false, &proto.PageCaptureScreenshot{
+		Clip:                  &proto.PageViewport{Width: float64(width), Height: float64(max(shot.Height, opts.height)), Scale: 1},
+		CaptureBeyondViewport: true,
+	})
+	if err != nil {
+		return shot, fmt.Errorf("screenshot failed: %w", err)
+	}
+	if data, err = processImage(data, opts.image); err != nil {
+		return shot, fmt.Errorf("failed to process screenshot: %w", err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return shot, fmt.Errorf("failed to write screenshot: %w", err)
+	}
+	return shot, nil
+}
+
+func cmdResponsive(args []string, flags globalFlags) {
+	usage := "usage: bb responsive [--widths 320,768,1024,1440] [--out dir] [--height px] [--mobile] [--settle ms]"
+	widths := []int{320, 768, 1024, 1440}
+	opts := responsiveOptions{height: 800, settle: 500 * time.Millisecond}
+	dir := ""
+	for i := 0; i < len(args); i++ {
+		if next, ok := parseResponsiveFlag(args, i, &opts); ok {
+			i = next
+			continue
+		}
+		switch args[i] {
+		case "--widths", "--out":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			if args[i] == "--out" {
+				dir = args[i+1]
+			} else {
+				w, err := parseWidths(args[i+1])
+				if err != nil {
+					fatalUsage("%v", err)
+				}
+				widths = w
+			}
+			i++
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	if dir == "" {
+		dir = nextAvailableFile(filepath.Join(outputDir(), "responsive"), "")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatal("failed to create %s: %v", dir, err)
+	}
+
+	_, _, page := withPage()
+	info, err := page.Info()
+	if err != nil {
+		fatal("failed to get page info: %v", err)
+	}
+	m := responsiveManifest{URL: info.URL, Title: info.Title, Time: time.Now().Format(time.RFC3339), Shots: []responsiveShot{}}
+	for _, w := range widths {
+		shot, err := captureWidth(page, w, opts, filepath.Join(dir, strconv.Itoa(w)+opts.image.ext()))
+		if err != nil {
+			fatal("%d px: %v", w, err)
+		}
+		recordArtifact("screenshot", shot.File)
+		m.Shots = append(m.Shots, shot)
+	}
+	_ = proto.EmulationClearDeviceMetricsOverride{}.Call(page)
+
+	data, _ := json.MarshalIndent(m, "", "  ")
+	manifest := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifest, data, 0644); err != nil {
+		fatal("failed to write %s: %v", manifest, err)
+	}
+	recordArtifact("responsive", manifest)
+	if flags.jsonOutput {
+		fmt.Println(string(data))
+		return
+	}
+	for _, s := range m.Shots {
+		line := fmt.Sprintf("%5dpx  %s  (%dpx tall", s.Width, s.File, s.Height)
+		if s.Overflow > 0 {
+			line += fmt.Sprintf(", %dpx wider than the viewport", s.Overflow)
+		}
+		fmt.Println(line + ")")
+	}
+	fmt.Printf("Manifest saved to %s\n", manifest)
+}
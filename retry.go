@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lastLine returns the last non-empty line of out
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func cmdRetry(args []string) {
+	usage := "usage: bb retry [--attempts N] [--delay seconds] [--backoff factor] -- <command> [args...]"
+	attempts, delay, backoff := 3, 1.0, 2.0
+	var inner []string
+	for i := 0; i < len(args) && inner == nil; i++ {
+		switch args[i] {
+		case "--attempts", "--delay", "--backoff":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			v, err := strconv.ParseFloat(args[i+1], 64)
+			switch {
+			case args[i] == "--attempts" && (err != nil || v < 1 || v != float64(int(v))):
+				fatalUsage("invalid --attempts: %s", args[i+1])
+			case args[i] == "--delay" && (err != nil || v < 0):
+				fatalUsage("invalid --delay: %s", args[i+1])
+			case args[i] == "--backoff" && (err != nil || v < 1):
+				fatalUsage("invalid --backoff: %s (expected 1 or more)", args[i+1])
+			}
+			switch args[i] {
+			case "--attempts":
+				attempts = int(v)
+			case "--delay":
+				delay = v
+			default:
+				backoff = v
+			}
+			i++
+		case "--":
+			inner = args[i+1:]
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				fatalUsage("%s", usage)
+			}
+			inner = args[i:]
+		}
+	}
+	if len(inner) == 0 {
+		fatalUsage("%s", usage)
+	}
+	if inner[0] == "retry" {
+		fatalUsage("bb retry can't wrap itself")
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		fatal("failed to find the bb binary: %v", err)
+	}
+
+	// Each attempt is a fresh bb process, so selectors are looked up again
+	// against the page as it is by then. Only the last attempt's output is
+	// passed through; earlier failures are summarized on stderr.
+	wait := time.Duration(delay * float64(time.Second))
+	for n := 1; ; n++ {
+		cmd := exec.Command(bin, inner...)
+		cmd.Stdin = os.Stdin
+		var stdout, stderr bytes.Buffer
+		if n == attempts {
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		} else {
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		}
+		err := cmd.Run()
+		if err == nil {
+			os.Stdout.Write(stdout.Bytes())
+			os.Stderr.Write(stderr.Bytes())
+			return
+		}
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			fatal("failed to run %s: %v", inner[0], err)
+		}
+		// Bad arguments fail the same way every time
+		if n == attempts || exitErr.ExitCode() == exitUsage {
+			os.Stdout.Write(stdout.Bytes())
+			os.Stderr.Write(stderr.Bytes())
+			exit(exitErr.ExitCode())
+		}
+		reason := fmt.Sprintf("exit %d", exitErr.ExitCode())
+		if line := lastLine(stderr.Bytes()); line != "" {
+			reason += ": " + line
+		}
+		fmt.Fprintf(os.Stderr, "attempt %d/%d failed (%s); retrying in %s\n", n, attempts, reason, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+		wait = time.Duration(float64(wait) * backoff)
+	}
+}
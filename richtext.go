@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// markdownToHTML converts the subset of Markdown that rich text editors can
+// represent: headings, paragraphs, lists, blockquotes, code blocks and inline
+// emphasis, code and links
+func markdownToHTML(md string) string {
+	var out strings.Builder
+	var para []string
+	listTag := ""
+	inCode := false
+
+	flushPara := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + inlineMarkdown(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				out.WriteString("</code></pre>\n")
+			} else {
+				flushPara()
+				closeList()
+				out.WriteString("<pre><code>")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flushPara()
+			closeList()
+		case mdHeading.MatchString(trimmed):
+			flushPara()
+			closeList()
+			m := mdHeading.FindStringSubmatch(trimmed)
+			n := len(m[1])
+			fmt.Fprintf(&out, "<h%d>%s</h%d>\n", n, inlineMarkdown(m[2]), n)
+		case mdBullet.MatchString(trimmed):
+			flushPara()
+			openList("ul")
+			out.WriteString("<li>" + inlineMarkdown(mdBullet.ReplaceAllString(trimmed, "")) + "</li>\n")
+		case mdNumbered.MatchString(trimmed):
+			flushPara()
+			openList("ol")
+			out.WriteString("<li>" + inlineMarkdown(mdNumbered.ReplaceAllString(trimmed, "")) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushPara()
+			closeList()
+			out.WriteString("<blockquote><p>" + inlineMarkdown(strings.TrimSpace(trimmed[1:])) + "</p></blockquote>\n")
+		default:
+			closeList()
+			para = append(para, trimmed)
+		}
+	}
+	if inCode {
+		out.WriteString("</code></pre>\n")
+	}
+	flushPara()
+	closeList()
+	return out.String()
+}
+
+var (
+	mdHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBullet   = regexp.MustCompile(`^[-*+]\s+`)
+	mdNumbered = regexp.MustCompile(`^\d+[.)]\s+`)
+
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold   = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+)
+
+// inlineMarkdown converts inline code, links, bold and italics. Code spans
+// are set aside first so their contents aren't formatted.
+func inlineMarkdown(s string) string {
+	var codes []string
+	s = mdCode.ReplaceAllStringFunc(s, func(m string) string {
+		codes = append(codes, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+	s = html.EscapeString(s)
+	s = mdLink.ReplaceAllString(s, `<a href="$2">$1</a>`)
+	s = mdBold.ReplaceAllString(s, "<strong>$1$2</strong>")
+	s = mdItalic.ReplaceAllString(s, "<em>$1$2</em>")
+	for i, c := range codes {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), c, 1)
+	}
+	return s
+}
+
+// findEditorJS resolves the editable surface for sel: the element itself if
+// it is editable, otherwise a known editor inside it (ProseMirror/Tiptap,
+// Quill, CKEditor, Draft.js, Lexical) or any contenteditable descendant
+const findEditorJS = `(sel) => {
+	const root = document.querySelector(sel);
+	if (!root) throw new Error('element not found: ' + sel);
+	if (root.isContentEditable) return root;
+	const editor = root.querySelector('.ProseMirror, .ql-editor, .ck-editor__editable, .public-DraftEditor-content, [data-lexical-editor], [contenteditable=""], [contenteditable=true]');
+	if (!editor) throw new Error('no rich text editor found in ' + sel);
+	return editor;
+}`
+
+// pasteHTMLJS pastes content like a user would, so the editor's own paste
+// handling converts it into its document model. Editors that don't handle
+// paste get the HTML inserted through execCommand.
+const pasteHTMLJS = `function(htmlText, plain, replace) {
+	this.focus();
+	const sel = window.getSelection();
+	sel.selectAllChildren(this);
+	if (!replace) sel.collapseToEnd();
+	const dt = new DataTransfer();
+	dt.setData('text/html', htmlText);
+	dt.setData('text/plain', plain);
+	const ev = new ClipboardEvent('paste', {clipboardData: dt, bubbles: true, cancelable: true});
+	if (this.dispatchEvent(ev)) {
+		document.execCommand('insertHTML', false, htmlText);
+	}
+}`
+
+// readArgValue returns v, or the contents of the file if v is @path
+func readArgValue(v string) string {
+	if path, ok := strings.CutPrefix(v, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatal("failed to read %s: %v", path, err)
+		}
+		return string(data)
+	}
+	return v
+}
+
+func cmdRichtext(args []string) {
+	var content, format string
+	appendMode := false
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--markdown", "--html", "--text":
+			if format != "" {
+				fatalUsage("only one of --markdown, --html and --text can be given")
+			}
+			format = strings.TrimPrefix(args[i], "--")
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --%s", format)
+			}
+			content = readArgValue(args[i])
+		case "--append":
+			appendMode = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 || format == "" {
+		fatalUsage("usage: bb richtext <selector> --markdown <md|@file> | --html <html|@file> | --text <text|@file> [--append]")
+	}
+
+	var htmlText, plain string
+	switch format {
+	case "markdown":
+		htmlText, plain = markdownToHTML(content), content
+	case "html":
+		htmlText, plain = content, content
+	case "text":
+		htmlText, plain = "<p>"+strings.ReplaceAll(html.EscapeString(content), "\n", "<br>")+"</p>", content
+	}
+
+	_, _, page := withPage()
+	editor, err := page.ElementByJS(rod.Eval(findEditorJS, positional[0]))
+	if err != nil {
+		fatal("%v", err)
+	}
+	if _, err := editor.Eval(pasteHTMLJS, htmlText, plain, !appendMode); err != nil {
+		fatal("failed to insert content: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	text, _ := editor.Text()
+	fmt.Printf("Inserted %s (editor now has %d characters)\n", format, len([]rune(text)))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// singleHTMLJS serializes the current DOM into one self-contained HTML file:
+// stylesheets are inlined, images become data URLs and scripts are dropped so
+// the file shows exactly what was rendered, without re-running the page.
+const singleHTMLJS = `async () => {
+	const abs = u => { try { return new URL(u, document.baseURI).href; } catch (e) { return u; } };
+	const dataURL = async url => {
+		try {
+			const res = await fetch(url, {credentials: 'include'});
+			if (!res.ok) return null;
+			const blob = await res.blob();
+			return await new Promise(resolve => {
+				const r = new FileReader();
+				r.onload = () => resolve(r.result);
+				r.onerror = () => resolve(null);
+				r.readAsDataURL(blob);
+			});
+		} catch (e) {
+			return null;
+		}
+	};
+	// url() references are resolved against the stylesheet, not the page
+	const absCSS = (css, base) => css.replace(/url\(\s*(['"]?)([^'")]+)\1\s*\)/g, (m, q, u) =>
+		u.startsWith('data:') ? m : 'url("' + new URL(u, base).href + '")');
+
+	const css = [];
+	for (const sheet of document.styleSheets) {
+		try {
+			const text = Array.from(sheet.cssRules).map(r => r.cssText).join('\n');
+			css.push({node: sheet.ownerNode, text: absCSS(text, sheet.href || document.baseURI)});
+		} catch (e) {
+			// Cross-origin stylesheet without CORS: fetch it directly
+			let text = '';
+			try { text = await (await fetch(sheet.href)).text(); } catch (e2) {}
+			css.push({node: sheet.ownerNode, text: absCSS(text, sheet.href)});
+		}
+	}
+
+	const doc = document.documentElement.cloneNode(true);
+	const originals = Array.from(document.documentElement.querySelectorAll('*'));
+	const clones = Array.from(doc.querySelectorAll('*'));
+	const cloneOf = node => clones[originals.indexOf(node)];
+
+	for (const {node, text} of css) {
+		const target = node && cloneOf(node);
+		if (!target) continue;
+		const style = document.createElement('style');
+		style.textContent = text;
+		target.replaceWith(style);
+	}
+	for (const [i, el] of originals.entries()) {
+		const c = clones[i];
+		if (el.tagName === 'IMG' && el.currentSrc) {
+			c.setAttribute('src', await dataURL(el.currentSrc) || el.currentSrc);
+			c.removeAttribute('srcset');
+			c.removeAttribute('loading');
+		} else if (el.tagName === 'INPUT' || el.tagName === 'TEXTAREA') {
+			// Keep what the user typed, not the initial value
+			if (el.type === 'checkbox' || el.type === 'radio') {
+				el.checked ? c.setAttribute('checked', '') : c.removeAttribute('checked');
+			} else if (el.tagName === 'TEXTAREA') {
+				c.textContent = el.value;
+			} else if (el.type !== 'file' && el.type !== 'password') {
+				c.setAttribute('value', el.value);
+			}
+		} else if (el.tagName === 'CANVAS') {
+			try {
+				const img = document.createElement('img');
+				img.src = el.toDataURL();
+				img.width = el.width;
+				img.height = el.height;
+				c.replaceWith(img);
+			} catch (e) {}
+		}
+		for (const attr of ['href', 'action', 'poster']) {
+			if (c.hasAttribute(attr)) c.setAttribute(attr, abs(c.getAttribute(attr)));
+		}
+	}
+	doc.querySelectorAll('script, noscript, link[rel=preload], link[rel=modulepreload], source[srcset], #__bb_marks').forEach(el => el.remove());
+	doc.querySelectorAll('[style]').forEach(el => el.setAttribute('style', absCSS(el.getAttribute('style'), document.baseURI)));
+
+	const meta = document.createElement('meta');
+	meta.setAttribute('name', 'bb-source');
+	meta.setAttribute('content', location.href);
+	doc.querySelector('head')?.prepend(meta);
+	return '<!DOCTYPE html>\n' + doc.outerHTML;
+}`
+
+func cmdSave(args []string) {
+	singleHTML := false
+	var positional []string
+	for _, a := range args {
+		switch a {
+		case "--single-html":
+			singleHTML = true
+		default:
+			positional = append(positional, a)
+		}
+	}
+	if len(positional) > 1 {
+		fatalUsage("usage: bb save [file.mhtml] [--single-html]")
+	}
+
+	file := ""
+	if len(positional) == 1 {
+		file = positional[0]
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".html" || ext == ".htm" {
+			singleHTML = true
+		}
+	} else {
+		ext := ".mhtml"
+		if singleHTML {
+			ext = ".html"
+		}
+		file = nextAvailableFile(filepath.Join(outputDir(), "page"), ext)
+	}
+
+	_, _, page := withPage()
+	var data string
+	if singleHTML {
+		res, err := page.Eval(singleHTMLJS)
+		if err != nil {
+			fatal("failed to serialize page: %v", err)
+		}
+		data = res.Value.Str()
+	} else {
+		res, err := proto.PageCaptureSnapshot{Format: proto.PageCaptureSnapshotFormatMhtml}.Call(page)
+		if err != nil {
+			fatal("failed to capture snapshot: %v", err)
+		}
+		data = res.Data
+	}
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		fatal("failed to write %s: %v", file, err)
+	}
+	recordArtifact("snapshot", file)
+	fmt.Printf("Saved %s (%d bytes)\n", file, len(data))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// searchJS finds query in the rendered text line by line and maps every hit
+// back to the element holding it, walking visible text nodes in document
+// order so repeated phrases resolve to successive elements
+const searchJS = `(query, isRegex, context) => {
+	` + cssPathJS + `
+	let re;
+	try {
+		re = new RegExp(isRegex ? query : query.replace(/[.*+?^${}()|[\]\\]/g, '\\$&'), 'gi');
+	} catch (e) {
+		throw new Error('invalid regex: ' + e.message);
+	}
+	const visible = el => !el.checkVisibility || el.checkVisibility({visibilityProperty: true});
+	const nodes = [];
+	const walker = document.createTreeWalker(document.body, NodeFilter.SHOW_TEXT);
+	for (let n = walker.nextNode(); n; n = walker.nextNode()) {
+		if (n.parentElement && visible(n.parentElement) && n.textContent.trim()) nodes.push(n);
+	}
+	const norm = s => s.replace(/\s+/g, ' ').toLowerCase();
+	let cursor = 0;
+	const locate = text => {
+		const words = norm(text).trim();
+		for (const needle of [words, words.split(' ')[0]]) {
+			if (!needle) continue;
+			for (let i = cursor; i < nodes.length; i++) {
+				if (norm(nodes[i].textContent).includes(needle)) {
+					cursor = i;
+					return cssPath(nodes[i].parentElement);
+				}
+			}
+		}
+		return 'body';
+	};
+
+	const lines = document.body.innerText.split('\n');
+	const hits = [];
+	lines.forEach((line, i) => {
+		for (const m of line.matchAll(re)) {
+			if (!m[0]) continue;
+			hits.push({
+				line: i + 1,
+				text: line,
+				match: m[0],
+				column: m.index + 1,
+				selector: locate(m[0]),
+				before: lines.slice(Math.max(0, i - context), i),
+				after: lines.slice(i + 1, i + 1 + context),
+			});
+		}
+	});
+	return hits;
+}`
+
+type searchHit struct {
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Text     string   `json:"text"`
+	Match    string   `json:"match"`
+	Selector string   `json:"selector"`
+	Before   []string `json:"before"`
+	After    []string `json:"after"`
+}
+
+func cmdSearch(args []string, flags globalFlags) {
+	isRegex := false
+	context := 0
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--regex":
+			isRegex = true
+		case "--context":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --context")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				fatalUsage("invalid --context: %s", args[i])
+			}
+			context = n
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("usage: bb search <query> [--regex] [--context N]")
+	}
+
+	_, _, page := withPage()
+	res, err := page.Eval(searchJS, positional[0], isRegex, context)
+	if err != nil {
+		fatal("search failed: %v", err)
+	}
+	var hits []searchHit
+	if err := json.Unmarshal([]byte(res.Value.JSON("", "")), &hits); err != nil {
+		fatal("search failed: %v", err)
+	}
+
+	if flags.jsonOutput {
+		if hits == nil {
+			hits = []searchHit{}
+		}
+		out, _ := json.MarshalIndent(hits, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for i, h := range hits {
+			if i > 0 && context > 0 {
+				fmt.Println("--")
+			}
+			for j, l := range h.Before {
+				fmt.Printf("%d-  %s\n", h.Line-len(h.Before)+j, l)
+			}
+			fmt.Printf("%d:  %s  [%s]\n", h.Line, strings.TrimSpace(h.Text), h.Selector)
+			for j, l := range h.After {
+				fmt.Printf("%d-  %s\n", h.Line+1+j, l)
+			}
+		}
+	}
+	// Like grep, no match is exit code 1
+	if len(hits) == 0 {
+		if !flags.jsonOutput {
+			fmt.Println("No matches")
+		}
+		exit(1)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-rod/rod"
+)
+
+// runRequest is the body of POST /run: the arguments of one bb invocation
+type runRequest struct {
+	Args     []string `json:"args"`
+	Page     *int     `json:"page"`     // page to run on; defaults to the active page
+	Priority string   `json:"priority"` // high, normal (default) or low
+}
+
+type runResponse struct {
+	Stdout       string `json:"stdout"`
+	StdoutBase64 string `json:"stdout_base64,omitempty"` // set instead of stdout for binary output
+	Stderr       string `json:"stderr"`
+	ExitCode     int    `json:"exit_code"`
+	DurationMS   int64  `json:"duration_ms"`
+
+	// Files the command wrote, when serving remote clients
+	Files []remoteFile `json:"files,omitempty"`
+}
+
+// commandStats counts invocations of one command for /metrics
+type commandStats struct {
+	count    int
+	errors   int
+	duration time.Duration
+}
+
+// apiServer runs bb commands over HTTP. Each command runs as a bb subprocess
+// against the same ~/.bb state, so the API has the same command surface and
+// behaviour as the CLI. Commands are queued per page by the scheduler.
+type apiServer struct {
+	bin     string
+	started time.Time
+	token   string // required as a bearer token when set
+	remote  bool   // run commands in scratch directories and return their files
+
+	queue *scheduler
+
+	mu       sync.Mutex
+	inflight int
+	stats    map[string]*commandStats
+}
+
+func (srv *apiServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req runRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Args) == 0 {
+		http.Error(w, `expected {"args": ["command", ...]}`, http.StatusBadRequest)
+		return
+	}
+	// --priority may also be given like a flag
+	var args []string
+	for i := 0; i < len(req.Args); i++ {
+		if req.Args[i] == "--priority" && i+1 < len(req.Args) {
+			req.Priority = req.Args[i+1]
+			i++
+			continue
+		}
+		args = append(args, req.Args[i])
+	}
+	if len(args) == 0 {
+		http.Error(w, `expected {"args": ["command", ...]}`, http.StatusBadRequest)
+		return
+	}
+	if args[0] == "serve" {
+		http.Error(w, "bb serve can't be run through the API", http.StatusBadRequest)
+		return
+	}
+	priority := priorityNormal
+	if req.Priority != "" {
+		p, ok := priorities[req.Priority]
+		if !ok {
+			http.Error(w, "priority must be high, normal or low", http.StatusBadRequest)
+			return
+		}
+		priority = p
+	}
+	// Pin the command to its page, so a later page switch doesn't move it
+	page := "0"
+	if req.Page != nil {
+		page = strconv.Itoa(*req.Page)
+	} else if s, err := loadState(); err == nil {
+		page = strconv.Itoa(s.ActivePage)
+		if s.ActiveTarget != "" {
+			page = s.ActiveTarget
+		}
+	}
+
+	srv.mu.Lock()
+	srv.inflight++
+	srv.mu.Unlock()
+	job := srv.queue.acquire(page, priority, exclusiveCommands[args[0]])
+	start := time.Now()
+	cmd := exec.CommandContext(r.Context(), srv.bin, args...)
+	cmd.Env = append(os.Environ(), "BB_PAGE="+page)
+	var workDir string
+	var artifactsBefore int
+	if srv.remote {
+		// Relative output paths land in a scratch directory that is sent back
+		dir, err := os.MkdirTemp("", "bb-remote-*")
+		if err != nil {
+			srv.queue.release(job)
+			srv.record(args[0], 0, true)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.RemoveAll(dir)
+		workDir, cmd.Dir = dir, dir
+		if s, err := loadState(); err == nil {
+			artifactsBefore = len(s.Artifacts)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	elapsed := time.Since(start)
+	var files []remoteFile
+	if srv.remote {
+		files = collectRemoteFiles(workDir, artifactsBefore)
+	}
+	srv.queue.release(job)
+
+	code := 0
+	if err != nil {
+		code = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			code = exitErr.ExitCode()
+		}
+	}
+	srv.record(args[0], elapsed, code != 0)
+
+	resp := runResponse{
+		Stderr:     stderr.String(),
+		ExitCode:   code,
+		DurationMS: elapsed.Milliseconds(),
+		Files:      files,
+	}
+	if utf8.Valid(stdout.Bytes()) {
+		resp.Stdout = stdout.String()
+	} else {
+		resp.StdoutBase64 = base64.StdEncoding.EncodeToString(stdout.Bytes())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// authorized checks the bearer token, if the server has one
+func (srv *apiServer) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if srv.token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(srv.token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (srv *apiServer) record(command string, elapsed time.Duration, failed bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.inflight--
+	st := srv.stats[command]
+	if st == nil {
+		st = &commandStats{}
+		srv.stats[command] = st
+	}
+	st.count++
+	st.duration += elapsed
+	if failed {
+		st.errors++
+	}
+}
+
+// browserHealth reports whether the session's Chrome responds and how many
+// pages it has open. A session that was never started isn't an error.
+func browserHealth() (status string, pages int) {
+	s, err := loadState()
+	if err != nil {
+		return "not started", 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	browser := rod.New().ControlURL(s.DebugURL).Context(ctx)
+	if err := browser.Connect(); err != nil {
+		return "unresponsive", 0
+	}
+	list, err := browser.Pages()
+	if err != nil {
+		return "unresponsive", 0
+	}
+	return "running", len(list)
+}
+
+func (srv *apiServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	browser, pages := browserHealth()
+	w.Header().Set("Content-Type", "application/json")
+	status := "ok"
+	if browser == "unresponsive" {
+		status = "degraded"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         status,
+		"browser":        browser,
+		"pages":          pages,
+		"uptime_seconds": int(time.Since(srv.started).Seconds()),
+	})
+}
+
+// handleMetrics writes the Prometheus text exposition format
+func (srv *apiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	browser, pages := browserHealth()
+	up := 0
+	if browser == "running" {
+		up = 1
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var b strings.Builder
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	metric("bb_browser_up", "gauge", "Whether the browser responds (1) or not (0).")
+	fmt.Fprintf(&b, "bb_browser_up %d\n", up)
+	metric("bb_open_pages", "gauge", "Number of open pages.")
+	fmt.Fprintf(&b, "bb_open_pages %d\n", pages)
+	metric("bb_uptime_seconds", "gauge", "Seconds since bb serve started.")
+	fmt.Fprintf(&b, "bb_uptime_seconds %.0f\n", time.Since(srv.started).Seconds())
+	metric("bb_commands_in_flight", "gauge", "Commands running or waiting to run.")
+	fmt.Fprintf(&b, "bb_commands_in_flight %d\n", srv.inflight)
+	metric("bb_commands_queued", "gauge", "Commands waiting for their page or a free slot.")
+	fmt.Fprintf(&b, "bb_commands_queued %d\n", srv.queue.waitingCount())
+
+	commands := make([]string, 0, len(srv.stats))
+	for c := range srv.stats {
+		commands = append(commands, c)
+	}
+	sort.Strings(commands)
+	metric("bb_commands_total", "counter", "Commands run, by command.")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "bb_commands_total{command=%q} %d\n", c, srv.stats[c].count)
+	}
+	metric("bb_command_errors_total", "counter", "Commands that exited non-zero, by command.")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "bb_command_errors_total{command=%q} %d\n", c, srv.stats[c].errors)
+	}
+	metric("bb_command_duration_seconds", "summary", "Time spent running commands, by command.")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "bb_command_duration_seconds_sum{command=%q} %.3f\n", c, srv.stats[c].duration.Seconds())
+		fmt.Fprintf(&b, "bb_command_duration_seconds_count{command=%q} %d\n", c, srv.stats[c].count)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func cmdServe(args []string) {
+	serveAPI(args, "127.0.0.1:8377", false)
+}
+
+// serveAPI runs the HTTP API; remote mode is bb remote serve
+func serveAPI(args []string, listen string, remote bool) {
+	usage := "usage: bb serve [--listen host:port] [--concurrency N] [--token t]"
+	if remote {
+		usage = "usage: bb remote serve --token t [--listen host:port] [--concurrency N]"
+	}
+	concurrency := 4
+	token := os.Getenv("BB_REMOTE_TOKEN")
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--token":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --token")
+			}
+			token = args[i]
+		case "--listen":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --listen")
+			}
+			listen = args[i]
+		case "--concurrency":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --concurrency")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				fatalUsage("invalid --concurrency: %s", args[i])
+			}
+			concurrency = n
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	if remote && token == "" {
+		fatalUsage("bb remote serve needs --token (or BB_REMOTE_TOKEN): it accepts connections from other hosts")
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		fatal("failed to find the bb binary: %v", err)
+	}
+	srv := &apiServer{
+		bin:     bin,
+		started: time.Now(),
+		token:   token,
+		remote:  remote,
+		queue:   newScheduler(concurrency),
+		stats:   map[string]*commandStats{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", srv.authorized(srv.handleRun))
+	mux.HandleFunc("/healthz", srv.handleHealth)
+	mux.HandleFunc("/metrics", srv.authorized(srv.handleMetrics))
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		fatal("failed to listen on %s: %v", listen, err)
+	}
+	fmt.Printf("Serving on http://%s\n", ln.Addr())
+	if err := http.Serve(ln, mux); err != nil {
+		fatal("server failed: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/go-rod/stealth"
+)
+
+// sessionBundle is the file written by bb session export
+type sessionBundle struct {
+	Version    int                          `json:"version"`
+	ExportedAt string                       `json:"exported_at"`
+	Cookies    []*proto.NetworkCookie       `json:"cookies"`
+	Storage    map[string]map[string]string `json:"local_storage"` // by origin
+	Pages      []sessionPage                `json:"pages"`
+	ActivePage int                          `json:"active_page"`
+}
+
+// sessionPage is an open tab; sessionStorage belongs to the tab
+type sessionPage struct {
+	URL            string            `json:"url"`
+	SessionStorage map[string]string `json:"session_storage,omitempty"`
+	ScrollX        float64           `json:"scroll_x,omitempty"`
+	ScrollY        float64           `json:"scroll_y,omitempty"`
+}
+
+// savedSessionPath is where bb stop --save-session writes by default and
+// bb session restore reads from
+func savedSessionPath() string {
+	return filepath.Join(stateDir(), "saved-session.json")
+}
+
+// storageDump reads one storage area of the page's origin. Pages without
+// a real origin (about:blank, chrome://) have none.
+func storageDump(page *rod.Page, area string) (origin string, items map[string]string) {
+	res, err := page.Eval(storageJS, area, "dump", "", "")
+	if err != nil {
+		return "", nil
+	}
+	var dump struct {
+		Origin string            `json:"origin"`
+		Items  map[string]string `json:"items"`
+	}
+	if res.Value.Unmarshal(&dump) != nil || dump.Origin == "null" {
+		return "", nil
+	}
+	return dump.Origin, dump.Items
+}
+
+// seedStorageJS fills both storage areas before the page's own scripts run
+const seedStorageJS = `(() => {
+	const seed = %s;
+	if (location.origin !== seed.origin) return;
+	try {
+		for (const [k, v] of Object.entries(seed.local || {})) localStorage.setItem(k, v);
+		for (const [k, v] of Object.entries(seed.session || {})) sessionStorage.setItem(k, v);
+	} catch (e) {}
+})()`
+
+func cmdSession(args []string) {
+	usage := "usage: bb session export|import <file> | bb session restore [file]"
+	switch {
+	case len(args) == 2 && args[0] == "export":
+		exportSession(args[1])
+	case len(args) == 2 && args[0] == "import":
+		importSession(args[1])
+	case len(args) == 1 && args[0] == "restore":
+		restoreSession(savedSessionPath())
+	case len(args) == 2 && args[0] == "restore":
+		restoreSession(args[1])
+	default:
+		fatalUsage("%s", usage)
+	}
+}
+
+func exportSession(file string) {
+	s, browser := ensureBrowser()
+	bundle := collectSession(s, browser)
+	writeSession(file, bundle)
+	recordArtifact("session", file)
+	fmt.Printf("Exported %d cookies, storage of %d origins and %d pages to %s\n", len(bundle.Cookies), len(bundle.Storage), len(bundle.Pages), file)
+}
+
+// restoreSession imports what bb stop --save-session saved
+func restoreSession(file string) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		fatal("no saved session at %s (save one with bb stop --save-session)", file)
+	}
+	importSession(file)
+}
+
+// writeSession writes a bundle; it holds live credentials, so it is
+// encrypted like the state when BB_PASSPHRASE is set
+func writeSession(file string, bundle sessionBundle) {
+	data, _ := json.MarshalIndent(bundle, "", "  ")
+	if err := writeSecretFile(file, data); err != nil {
+		fatal("failed to write %s: %v", file, err)
+	}
+}
+
+// collectSession snapshots cookies, storage, and the URL and scroll position
+// of every tab
+func collectSession(s *State, browser *rod.Browser) sessionBundle {
+	pages, err := browser.Pages()
+	if err != nil {
+		fatal("failed to list pages: %v", err)
+	}
+	cookies, err := browser.GetCookies()
+	if err != nil {
+		fatal("failed to read cookies: %v", err)
+	}
+	bundle := sessionBundle{
+		Version:    1,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Cookies:    cookies,
+		Storage:    map[string]map[string]string{},
+		Pages:      []sessionPage{},
+		ActivePage: activePageIndex(s, pages),
+	}
+	for _, p := range pages {
+		page := p.Timeout(defaultTimeout)
+		info, err := page.Info()
+		if err != nil {
+			continue
+		}
+		sp := sessionPage{URL: info.URL}
+		if origin, items := storageDump(page, "local"); origin != "" && len(items) > 0 {
+			bundle.Storage[origin] = items
+		}
+		if _, items := storageDump(page, "session"); len(items) > 0 {
+			sp.SessionStorage = items
+		}
+		if res, err := page.Eval(`() => [window.scrollX, window.scrollY]`); err == nil {
+			pos := res.Value.Arr()
+			if len(pos) == 2 {
+				sp.ScrollX, sp.ScrollY = pos[0].Num(), pos[1].Num()
+			}
+		}
+		bundle.Pages = append(bundle.Pages, sp)
+	}
+	return bundle
+}
+
+func importSession(file string) {
+	data, err := readSecretFile(file)
+	if err != nil {
+		fatal("failed to read %s: %v", file, err)
+	}
+	var bundle sessionBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		fatal("invalid session file %s: %v", file, err)
+	}
+	if bundle.Version != 1 {
+		fatal("unsupported session file version %d", bundle.Version)
+	}
+
+	_, browser := ensureBrowser()
+	if len(bundle.Cookies) > 0 {
+		if err := browser.SetCookies(proto.CookiesToParams(bundle.Cookies)); err != nil {
+			fatal("failed to set cookies: %v", err)
+		}
+	}
+
+	// A fresh session's blank tab is reused; otherwise tabs are added
+	existing, _ := browser.Pages()
+	var blank *rod.Page
+	if len(existing) == 1 {
+		if info, err := existing[0].Info(); err == nil && (info.URL == "about:blank" || info.URL == "") {
+			blank = existing[0]
+		}
+	}
+	var opened []*rod.Page
+	for _, sp := range bundle.Pages {
+		var page *rod.Page
+		if blank != nil {
+			page, blank = activatePage(blank), nil
+		} else {
+			page = activatePage(stealth.MustPage(browser))
+		}
+		opened = append(opened, page)
+
+		origin := ""
+		if u, err := url.Parse(sp.URL); err == nil && u.Host != "" {
+			origin = u.Scheme + "://" + u.Host
+		}
+		if local, ok := bundle.Storage[origin]; ok || len(sp.SessionStorage) > 0 {
+			seed, _ := json.Marshal(map[string]interface{}{
+				"origin":  origin,
+				"local":   local,
+				"session": sp.SessionStorage,
+			})
+			if _, err := page.EvalOnNewDocument(fmt.Sprintf(seedStorageJS, seed)); err != nil {
+				fatal("failed to seed storage for %s: %v", origin, err)
+			}
+		}
+		if sp.URL == "" || sp.URL == "about:blank" {
+			continue
+		}
+		if err := page.Navigate(sp.URL); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to open %s: %v\n", sp.URL, err)
+			continue
+		}
+		_ = page.WaitLoad()
+		if sp.ScrollX != 0 || sp.ScrollY != 0 {
+			_, _ = page.Eval(`(x, y) => window.scrollTo(x, y)`, sp.ScrollX, sp.ScrollY)
+		}
+		recordNavigation(page)
+	}
+
+	// Point the active page at the imported tab that was active
+	if bundle.ActivePage >= 0 && bundle.ActivePage < len(opened) {
+		pages, _ := browser.Pages()
+		for i, p := range pages {
+			if p.TargetID == opened[bundle.ActivePage].TargetID {
+				if s, err := loadState(); err == nil {
+					setActivePage(s, i, p)
+					_ = saveState(s)
+				}
+				break
+			}
+		}
+	}
+	fmt.Printf("Imported %d cookies, storage of %d origins and %d pages from %s\n", len(bundle.Cookies), len(bundle.Storage), len(opened), file)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/stealth"
+)
+
+// shotmatrixPage is one row of the matrix: a URL captured at every width
+type shotmatrixPage struct {
+	URL   string           `json:"url"`
+	Title string           `json:"title,omitempty"`
+	Dir   string           `json:"dir"`
+	Shots []responsiveShot `json:"shots"`
+	Error string           `json:"error,omitempty"`
+}
+
+type shotmatrixManifest struct {
+	Time   string           `json:"time"`
+	Widths []int            `json:"widths"`
+	Pages  []shotmatrixPage `json:"pages"`
+}
+
+// captureURL loads u in page and captures it at each width into dir
+func captureURL(page *rod.Page, u string, widths []int, opts responsiveOptions, dir string) shotmatrixPage {
+	p := shotmatrixPage{URL: u, Dir: dir, Shots: []responsiveShot{}}
+	defer func() {
+		if rec := recover(); rec != nil {
+			p.Error = fmt.Sprint(rec)
+		}
+	}()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	page = page.Timeout(defaultTimeout)
+	prepareNavigation(page, u, false)
+	if err := page.Navigate(u); err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	if err := page.WaitLoad(); err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	if info, err := page.Info(); err == nil {
+		p.Title = info.Title
+	}
+	for _, w := range widths {
+		shot, err := captureWidth(page, w, opts, filepath.Join(dir, strconv.Itoa(w)+opts.image.ext()))
+		if err != nil {
+			p.Error = fmt.Sprintf("%d px: %v", w, err)
+			return p
+		}
+		p.Shots = append(p.Shots, shot)
+	}
+	return p
+}
+
+// writeShotmatrixIndex writes a grid page with a row per URL and a column
+// per width, for a quick visual review
+func writeShotmatrixIndex(file string, m shotmatrixManifest) error {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>bb shotmatrix</title>\n")
+	b.WriteString("<style>body{font:14px sans-serif;margin:1em}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:6px;vertical-align:top;text-align:left}")
+	b.WriteString("img{max-width:320px;max-height:640px;display:block}.overflow{color:#c00}.error{color:#c00}</style></head><body>\n")
+	fmt.Fprintf(&b, "<h1>%d pages</h1>\n<p>%s</p>\n<table>\n<tr><th>Page</th>", len(m.Pages), html.EscapeString(m.Time))
+	for _, w := range m.Widths {
+		fmt.Fprintf(&b, "<th>%d px</th>", w)
+	}
+	b.WriteString("</tr>\n")
+	base := filepath.Dir(file)
+	for _, p := range m.Pages {
+		fmt.Fprintf(&b, "<tr><td><a href=\"%s\">%s</a>", html.EscapeString(p.URL), html.EscapeString(p.URL))
+		if p.Title != "" {
+			fmt.Fprintf(&b, "<br>%s", html.EscapeString(p.Title))
+		}
+		if p.Error != "" {
+			fmt.Fprintf(&b, "<br><span class=\"error\">%s</span>", html.EscapeString(p.Error))
+		}
+		b.WriteString("</td>")
+		for i := range m.Widths {
+			if i >= len(p.Shots) {
+				b.WriteString("<td></td>")
+				continue
+			}
+			s := p.Shots[i]
+			src := s.File
+			if rel, err := filepath.Rel(base, s.File); err == nil {
+				src = filepath.ToSlash(rel)
+			}
+			fmt.Fprintf(&b, "<td><a href=\"%[1]s\"><img src=\"%[1]s\" loading=\"lazy\"></a>%dpx tall", html.EscapeString(src), s.Height)
+			if s.Overflow > 0 {
+				fmt.Fprintf(&b, " <span class=\"overflow\">overflows by %dpx</span>", s.Overflow)
+			}
+			b.WriteString("</td>")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>\n</body></html>\n")
+	return os.WriteFile(file, []byte(b.String()), 0644)
+}
+
+func cmdShotmatrix(args []string, flags globalFlags) {
+	usage := "usage: bb shotmatrix --urls <urls.txt|-> [--widths 375,1280] [--out dir] [--concurrency N] [--height px] [--mobile] [--settle ms]"
+	widths := []int{375, 1280}
+	opts := responsiveOptions{height: 800, settle: 500 * time.Millisecond}
+	concurrency := 4
+	list, dir := "", ""
+	for i := 0; i < len(args); i++ {
+		if next, ok := parseResponsiveFlag(args, i, &opts); ok {
+			i = next
+			continue
+		}
+		switch args[i] {
+		case "--urls", "--widths", "--out", "--concurrency":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			v := args[i+1]
+			switch args[i] {
+			case "--urls":
+				list = v
+			case "--out":
+				dir = v
+			case "--widths":
+				w, err := parseWidths(v)
+				if err != nil {
+					fatalUsage("%v", err)
+				}
+				widths = w
+			default:
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					fatalUsage("invalid --concurrency: %s", v)
+				}
+				concurrency = n
+			}
+			i++
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	if list == "" {
+		fatalUsage("%s", usage)
+	}
+	urls := readURLList(list)
+	if len(urls) == 0 {
+		fatal("no URLs in %s", list)
+	}
+	concurrency = min(concurrency, len(urls))
+	if dir == "" {
+		dir = nextAvailableFile(filepath.Join(outputDir(), "shotmatrix"), "")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatal("failed to create %s: %v", dir, err)
+	}
+
+	// Each worker tab sets its own viewport, so the active page is left alone
+	_, browser := ensureBrowser()
+	m := shotmatrixManifest{Time: time.Now().Format(time.RFC3339), Widths: widths, Pages: make([]shotmatrixPage, len(urls))}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var printMu sync.Mutex
+	for w := 0; w < concurrency; w++ {
+		page := stealth.MustPage(browser)
+		configurePage(page)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer page.Close()
+			for i := range jobs {
+				p := captureURL(page, urls[i], widths, opts, filepath.Join(dir, crawlFileName(i+1, urls[i])))
+				m.Pages[i] = p
+				if !flags.jsonOutput {
+					printMu.Lock()
+					if p.Error != "" {
+						fmt.Printf("fail  %s: %s\n", p.URL, p.Error)
+					} else {
+						fmt.Printf("ok    %s (%d shots)\n", p.URL, len(p.Shots))
+					}
+					printMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	for _, p := range m.Pages {
+		if p.Error != "" {
+			failed++
+		}
+		for _, s := range p.Shots {
+			recordArtifact("screenshot", s.File)
+		}
+	}
+	data, _ := json.MarshalIndent(m, "", "  ")
+	manifest := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifest, data, 0644); err != nil {
+		fatal("failed to write %s: %v", manifest, err)
+	}
+	index := filepath.Join(dir, "index.html")
+	if err := writeShotmatrixIndex(index, m); err != nil {
+		fatal("failed to write %s: %v", index, err)
+	}
+	recordArtifact("shotmatrix", index)
+	if flags.jsonOutput {
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("Captured %d/%d URLs at %d widths; open %s\n", len(urls)-failed, len(urls), len(widths), index)
+}
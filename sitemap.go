@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sitemapURL is one page listed in a sitemap
+type sitemapURL struct {
+	URL     string `json:"url"`
+	Lastmod string `json:"lastmod,omitempty"`
+}
+
+// sitemapDoc covers both <urlset> and <sitemapindex> documents
+type sitemapDoc struct {
+	URLs []struct {
+		Loc     string `xml:"loc"`
+		Lastmod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapCrawler walks sitemap indexes depth-first until limit URLs are found
+type sitemapCrawler struct {
+	client *http.Client
+	filter *regexp.Regexp
+	limit  int
+	seen   map[string]bool
+	urls   []sitemapURL
+}
+
+func (c *sitemapCrawler) get(u string) (io.ReadCloser, error) {
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: HTTP %d", u, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (c *sitemapCrawler) full() bool {
+	return c.limit > 0 && len(c.urls) >= c.limit
+}
+
+func (c *sitemapCrawler) crawl(u string) error {
+	if c.seen[u] || c.full() {
+		return nil
+	}
+	c.seen[u] = true
+	body, err := c.get(u)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Servers send .xml.gz either as gzip files or with Content-Encoding,
+	// which the client already decodes, so sniff the magic bytes
+	r := bufio.NewReader(body)
+	var src io.Reader = r
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", u, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+	var doc sitemapDoc
+	if err := xml.NewDecoder(src).Decode(&doc); err != nil {
+		return fmt.Errorf("%s: invalid sitemap: %v", u, err)
+	}
+
+	for _, entry := range doc.URLs {
+		if c.full() {
+			return nil
+		}
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" || (c.filter != nil && !c.filter.MatchString(loc)) {
+			continue
+		}
+		c.urls = append(c.urls, sitemapURL{URL: loc, Lastmod: strings.TrimSpace(entry.Lastmod)})
+	}
+	for _, sm := range doc.Sitemaps {
+		if loc := strings.TrimSpace(sm.Loc); loc != "" {
+			if err := c.crawl(loc); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+		}
+	}
+	return nil
+}
+
+// sitemapRoots returns the sitemaps for site: the given URL if it points to a
+// sitemap, otherwise those listed in robots.txt, falling back to /sitemap.xml
+func (c *sitemapCrawler) sitemapRoots(site string) []string {
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	u, err := url.Parse(site)
+	if err != nil || u.Host == "" {
+		fatalUsage("invalid site: %s", site)
+	}
+	if strings.Contains(strings.ToLower(u.Path), ".xml") {
+		return []string{u.String()}
+	}
+	base := u.Scheme + "://" + u.Host
+	var roots []string
+	if body, err := c.get(base + "/robots.txt"); err == nil {
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+				roots = append(roots, strings.TrimSpace(value))
+			}
+		}
+		body.Close()
+	}
+	if len(roots) == 0 {
+		roots = []string{base + "/sitemap.xml"}
+	}
+	return roots
+}
+
+func cmdSitemap(args []string, flags globalFlags) {
+	usage := "usage: bb sitemap <domain|sitemap-url> [--filter regex] [--limit N]"
+	c := &sitemapCrawler{
+		client: &http.Client{Timeout: 30 * time.Second},
+		seen:   map[string]bool{},
+	}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--filter":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --filter")
+			}
+			re, err := regexp.Compile(args[i])
+			if err != nil {
+				fatalUsage("invalid --filter: %v", err)
+			}
+			c.filter = re
+		case "--limit":
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for --limit")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				fatalUsage("invalid --limit: %s", args[i])
+			}
+			c.limit = n
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		fatalUsage("%s", usage)
+	}
+
+	roots := c.sitemapRoots(positional[0])
+	var errs []string
+	for _, root := range roots {
+		if err := c.crawl(root); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) == len(roots) {
+		fatal("failed to fetch sitemap: %s", strings.Join(errs, "; "))
+	}
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", e)
+	}
+
+	if flags.jsonOutput {
+		if c.urls == nil {
+			c.urls = []sitemapURL{}
+		}
+		out, _ := json.MarshalIndent(c.urls, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	for _, u := range c.urls {
+		if u.Lastmod != "" {
+			fmt.Printf("%s\t%s\n", u.URL, u.Lastmod)
+		} else {
+			fmt.Println(u.URL)
+		}
+	}
+}
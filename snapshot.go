@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// snapshotJS lists the page's interactive elements for bb snapshot. The
+// elements are kept for snapshotNodeIDs.
+const snapshotJS = `(fullPage) => {
+	` + interactiveJS + `
+	const found = interactiveElements(fullPage);
+	globalThis.__bbSnapshot = found.map(f => f.el);
+	return found.map(({el, ...f}, i) => ({id: i + 1, ...f}));
+}`
+
+// snapshotElement is one numbered entry of bb snapshot
+type snapshotElement struct {
+	ID            int      `json:"id"`
+	Role          string   `json:"role"`
+	Name          string   `json:"name"`
+	Value         string   `json:"value,omitempty"`
+	States        []string `json:"states,omitempty"`
+	Selector      string   `json:"selector"`
+	Tag           string   `json:"tag"`
+	BackendNodeID int      `json:"backendNodeId,omitempty"` // for --node, as in ax-find; --json only
+	Box           struct {
+		X      int `json:"x"`
+		Y      int `json:"y"`
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"box"`
+}
+
+type pageSnapshot struct {
+	Title    string            `json:"title"`
+	URL      string            `json:"url"`
+	Elements []snapshotElement `json:"elements"`
+}
+
+func cmdSnapshot(args []string, flags globalFlags) {
+	fullPage := true
+	for _, a := range args {
+		switch a {
+		case "--viewport":
+			fullPage = false
+		default:
+			fatalUsage("usage: bb snapshot [--viewport]")
+		}
+	}
+
+	_, _, page := withPage()
+	res, err := page.Eval(snapshotJS, fullPage)
+	if err != nil {
+		fatal("failed to snapshot the page: %v", err)
+	}
+	info, err := page.Info()
+	if err != nil {
+		fatal("failed to get page info: %v", err)
+	}
+	snap := pageSnapshot{Title: info.Title, URL: info.URL, Elements: []snapshotElement{}}
+	if err := res.Value.Unmarshal(&snap.Elements); err != nil {
+		fatal("failed to read the snapshot: %v", err)
+	}
+	if flags.jsonOutput {
+		// The text lines have no room for it, so only JSON pays for the lookup
+		snapshotNodeIDs(page, snap.Elements)
+		out, _ := json.MarshalIndent(snap, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Printf("Title: %s\nURL: %s\n\n", snap.Title, snap.URL)
+	for _, e := range snap.Elements {
+		line := fmt.Sprintf("[%d] %s %q", e.ID, e.Role, e.Name)
+		if e.Value != "" {
+			line += fmt.Sprintf(" value=%q", e.Value)
+		}
+		if len(e.States) > 0 {
+			line += " (" + strings.Join(e.States, ", ") + ")"
+		}
+		fmt.Printf("%s -> %s\n", line, e.Selector)
+	}
+	if len(snap.Elements) == 0 {
+		fmt.Println("No interactive elements")
+	}
+}
+
+// snapshotNodeIDs fills in the backendNodeId of the elements snapshotJS
+// listed last
+func snapshotNodeIDs(page *rod.Page, elements []snapshotElement) {
+	for i := range elements {
+		obj, err := page.Evaluate(rod.Eval(`i => globalThis.__bbSnapshot?.[i]`, i).ByObject())
+		if err != nil || obj.ObjectID == "" {
+			continue
+		}
+		if desc, err := (proto.DOMDescribeNode{ObjectID: obj.ObjectID}).Call(page); err == nil {
+			elements[i].BackendNodeID = int(desc.Node.BackendNodeID)
+		}
+	}
+}
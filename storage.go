@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// storageJS runs one Web Storage operation on the page's origin. Pages that
+// deny storage access (sandboxed frames, opaque origins) throw.
+const storageJS = `(area, op, key, value) => {
+	const s = area === 'session' ? window.sessionStorage : window.localStorage;
+	switch (op) {
+	case 'get':
+		return s.getItem(key);
+	case 'set':
+		s.setItem(key, value);
+		return null;
+	case 'delete':
+		const had = s.getItem(key) !== null;
+		s.removeItem(key);
+		return had;
+	case 'clear':
+		const n = s.length;
+		s.clear();
+		return n;
+	case 'dump':
+		const items = {};
+		for (let i = 0; i < s.length; i++) {
+			const k = s.key(i);
+			items[k] = s.getItem(k);
+		}
+		return {origin: location.origin, items};
+	}
+}`
+
+func cmdStorage(args []string, flags globalFlags) {
+	usage := "usage: bb storage get|set|delete|clear|dump [--session] [key] [value]"
+	area := "local"
+	var positional []string
+	for _, a := range args {
+		switch a {
+		case "--session":
+			area = "session"
+		default:
+			positional = append(positional, a)
+		}
+	}
+	if len(positional) == 0 {
+		fatalUsage("%s", usage)
+	}
+	op, rest := positional[0], positional[1:]
+	want := map[string]int{"get": 1, "set": 2, "delete": 1, "clear": 0, "dump": 0}
+	n, ok := want[op]
+	if !ok || len(rest) != n {
+		fatalUsage("%s", usage)
+	}
+	key, value := "", ""
+	if n > 0 {
+		key = rest[0]
+	}
+	if n > 1 {
+		value = readArgValue(rest[1])
+	}
+
+	_, _, page := withPage()
+	res, err := page.Eval(storageJS, area, op, key, value)
+	if err != nil {
+		fatal("failed to access %sStorage: %v", area, err)
+	}
+
+	switch op {
+	case "get":
+		if res.Value.Nil() {
+			fail(exitNotFound, "", "no %sStorage key %q", area, key)
+		}
+		if flags.jsonOutput {
+			out, _ := json.Marshal(map[string]string{"key": key, "value": res.Value.Str()})
+			fmt.Println(string(out))
+			return
+		}
+		fmt.Println(res.Value.Str())
+	case "set":
+		fmt.Printf("Set %s\n", key)
+	case "delete":
+		if !res.Value.Bool() {
+			fail(exitNotFound, "", "no %sStorage key %q", area, key)
+		}
+		fmt.Printf("Deleted %s\n", key)
+	case "clear":
+		fmt.Printf("Cleared %d keys\n", res.Value.Int())
+	case "dump":
+		var dump struct {
+			Origin string            `json:"origin"`
+			Items  map[string]string `json:"items"`
+		}
+		if err := res.Value.Unmarshal(&dump); err != nil {
+			fatal("failed to read %sStorage: %v", area, err)
+		}
+		if flags.jsonOutput {
+			out, _ := json.MarshalIndent(dump, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if len(dump.Items) == 0 {
+			fmt.Printf("%sStorage of %s is empty\n", area, dump.Origin)
+			return
+		}
+		for _, k := range slices.Sorted(maps.Keys(dump.Items)) {
+			fmt.Printf("%s=%s\n", k, strings.ReplaceAll(dump.Items[k], "\n", `\n`))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Throttle is the emulated network connection saved by bb throttle
+type Throttle struct {
+	Profile string  `json:"profile"`
+	Offline bool    `json:"offline,omitempty"`
+	Down    float64 `json:"down_kbps,omitempty"` // 0 is unlimited
+	Up      float64 `json:"up_kbps,omitempty"`
+	Latency float64 `json:"latency_ms,omitempty"`
+}
+
+// throttleProfiles match the presets of Chrome's DevTools
+var throttleProfiles = map[string]Throttle{
+	"3g":      {Profile: "3g", Down: 1440, Up: 675, Latency: 563},
+	"slow-3g": {Profile: "slow-3g", Down: 400, Up: 400, Latency: 2000},
+	"offline": {Profile: "offline", Offline: true},
+}
+
+func (t *Throttle) String() string {
+	if t.Offline {
+		return "offline"
+	}
+	rate := func(kbps float64) string {
+		if kbps <= 0 {
+			return "unlimited"
+		}
+		return strconv.FormatFloat(kbps, 'f', -1, 64) + " kbps"
+	}
+	return fmt.Sprintf("%s: down %s, up %s, latency %s ms", t.Profile, rate(t.Down), rate(t.Up), strconv.FormatFloat(t.Latency, 'f', -1, 64))
+}
+
+// applyThrottle emulates t on page, or lifts the emulation when t is nil.
+// Like the other overrides it lasts while this invocation is attached.
+func applyThrottle(page *rod.Page, t *Throttle) error {
+	cond := proto.NetworkEmulateNetworkConditions{DownloadThroughput: -1, UploadThroughput: -1}
+	if t != nil {
+		cond.Offline = t.Offline
+		cond.Latency = t.Latency
+		// Throughput is in bytes per second
+		if t.Down > 0 {
+			cond.DownloadThroughput = t.Down * 1000 / 8
+		}
+		if t.Up > 0 {
+			cond.UploadThroughput = t.Up * 1000 / 8
+		}
+	}
+	if err := (proto.NetworkEnable{}).Call(page); err != nil {
+		return err
+	}
+	return cond.Call(page)
+}
+
+func cmdThrottle(args []string) {
+	usage := "usage: bb throttle 3g|slow-3g|offline | bb throttle custom [--down kbps] [--up kbps] [--latency ms] | bb throttle off | bb throttle status"
+	if len(args) == 0 {
+		fatalUsage("%s", usage)
+	}
+	var t *Throttle
+	switch args[0] {
+	case "status":
+		if c := loadConfig(); c.Throttle != nil {
+			fmt.Printf("Network throttled (%s)\n", c.Throttle)
+		} else {
+			fmt.Println("Network not throttled")
+		}
+		return
+	case "off":
+	case "custom":
+		t = &Throttle{Profile: "custom"}
+		for i := 1; i < len(args); i++ {
+			var dst *float64
+			switch args[i] {
+			case "--down":
+				dst = &t.Down
+			case "--up":
+				dst = &t.Up
+			case "--latency":
+				dst = &t.Latency
+			default:
+				fatalUsage("%s", usage)
+			}
+			i++
+			if i >= len(args) {
+				fatalUsage("missing value for %s", args[i-1])
+			}
+			v, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || v < 0 {
+				fatalUsage("invalid %s: %s", args[i-1], args[i])
+			}
+			*dst = v
+		}
+		if t.Down == 0 && t.Up == 0 && t.Latency == 0 {
+			fatalUsage("bb throttle custom needs --down, --up or --latency")
+		}
+	default:
+		p, ok := throttleProfiles[args[0]]
+		if !ok || len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		t = &p
+	}
+
+	c := loadConfig()
+	c.Throttle = t
+	if err := saveConfig(c); err != nil {
+		fatal("failed to save config: %v", err)
+	}
+	if t == nil {
+		fmt.Println("Network throttling off")
+		return
+	}
+	fmt.Printf("Network throttled (%s)\n", t)
+}
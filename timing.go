@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phaseNames are the steps a command's time is reported by
+var phaseNames = []string{"connect", "navigate", "wait", "extract"}
+
+// defaultSlowPhases is how many seconds a phase may take before bb warns
+var defaultSlowPhases = map[string]float64{"connect": 5, "navigate": 10, "wait": 10, "extract": 5}
+
+// slowPhaseHints say which setting helps when a phase is slow
+var slowPhaseHints = map[string]string{
+	"connect":  "starting Chrome is slow the first time; later commands reuse it, and bb status shows whether it runs",
+	"navigate": "the server is slow to answer; raise --timeout, or check bb throttle status",
+	"wait":     "the page keeps loading; bb config set load-policy --block images,fonts,media skips heavy resources",
+	"extract":  "the page is large; bb extract --selector reads only part of it",
+}
+
+type phaseTiming struct {
+	Phase string `json:"phase"`
+	MS    int64  `json:"ms"`
+}
+
+// verboseTimings is set by --verbose
+var verboseTimings bool
+
+// phases records the steps of this invocation. A phase runs until the next
+// one begins or the command exits, so one that times out is still reported.
+var phases struct {
+	sync.Mutex
+	list    []phaseTiming
+	current string
+	since   time.Time
+}
+
+func beginPhase(name string) {
+	phases.Lock()
+	defer phases.Unlock()
+	endPhaseLocked()
+	phases.current, phases.since = name, time.Now()
+}
+
+func endPhase() {
+	phases.Lock()
+	defer phases.Unlock()
+	endPhaseLocked()
+}
+
+func endPhaseLocked() {
+	if phases.current == "" {
+		return
+	}
+	ms := time.Since(phases.since).Milliseconds()
+	if i := slices.IndexFunc(phases.list, func(p phaseTiming) bool { return p.Phase == phases.current }); i >= 0 {
+		phases.list[i].MS += ms
+	} else {
+		phases.list = append(phases.list, phaseTiming{Phase: phases.current, MS: ms})
+	}
+	phases.current = ""
+}
+
+// phaseTimings ends the running phase and returns what was recorded
+func phaseTimings() []phaseTiming {
+	endPhase()
+	phases.Lock()
+	defer phases.Unlock()
+	return slices.Clone(phases.list)
+}
+
+// slowPhaseWarnings lists the phases over their threshold, with a hint
+func slowPhaseWarnings(timings []phaseTiming) []string {
+	limits := loadConfig().SlowPhases
+	var warnings []string
+	for _, p := range timings {
+		limit, ok := limits[p.Phase]
+		if !ok {
+			limit = defaultSlowPhases[p.Phase]
+		}
+		if limit <= 0 || float64(p.MS) < limit*1000 {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s took %s (over %ss); %s", p.Phase, formatMS(p.MS), formatNumber(limit), slowPhaseHints[p.Phase]))
+	}
+	return warnings
+}
+
+// reportTimings prints the timings with --verbose and warns about slow
+// phases, on stderr so the output stays the command's
+func reportTimings(timings []phaseTiming, warnings []string) {
+	if verboseTimings && len(timings) > 0 {
+		var parts []string
+		for _, p := range timings {
+			parts = append(parts, p.Phase+" "+formatMS(p.MS))
+		}
+		fmt.Fprintf(os.Stderr, "timing: %s (total %s)\n", strings.Join(parts, ", "), formatMS(time.Since(started).Milliseconds()))
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+}
+
+func formatMS(ms int64) string {
+	if ms < 1000 {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return strconv.FormatFloat(float64(ms)/1000, 'f', 1, 64) + "s"
+}
+
+// slowPhasesSetter returns a setter that accepts phase=seconds pairs, e.g.
+// "navigate=20,wait=15"; 0 turns a phase's warning off
+func slowPhasesSetter(assign func(c *Config, v map[string]float64)) func(c *Config, args []string) error {
+	return func(c *Config, args []string) error {
+		limits := map[string]float64{}
+		for _, f := range strings.FieldsFunc(strings.Join(args, " "), func(r rune) bool { return r == ',' || r == ' ' }) {
+			name, value, ok := strings.Cut(f, "=")
+			if !ok || !slices.Contains(phaseNames, name) {
+				return fmt.Errorf("invalid threshold %q (expected phase=seconds with phase one of %s)", f, strings.Join(phaseNames, ", "))
+			}
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid seconds in %q", f)
+			}
+			limits[name] = n
+		}
+		if len(limits) == 0 {
+			limits = nil
+		}
+		assign(c, limits)
+		return nil
+	}
+}
+
+func formatSlowPhases(limits map[string]float64) string {
+	var parts []string
+	for name, v := range limits {
+		parts = append(parts, name+"="+strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// traceCategories are the ones the DevTools Performance panel records
+var traceCategories = []string{
+	"devtools.timeline", "disabled-by-default-devtools.timeline", "disabled-by-default-devtools.timeline.frame",
+	"disabled-by-default-devtools.timeline.stack", "toplevel", "v8.execute", "disabled-by-default-v8.cpu_profiler",
+	"blink.console", "blink.user_timing", "latencyInfo", "loading", "disabled-by-default-devtools.screenshot",
+}
+
+// TraceRecording is a trace bb trace start left running. Tracing lasts as
+// long as the CDP connection that started it, so a detached recorder process
+// holds one until bb trace stop signals it.
+type TraceRecording struct {
+	PID     int    `json:"pid"`
+	Started string `json:"started"`
+	Out     string `json:"out,omitempty"` // set by bb trace stop
+}
+
+// traceLogPath collects the recorder's errors
+func traceLogPath() string {
+	return filepath.Join(stateDir(), "trace.log")
+}
+
+// traceLogError returns the error the recorder logged, without its prefix
+func traceLogError() string {
+	msg, _ := os.ReadFile(traceLogPath())
+	return strings.TrimPrefix(strings.TrimSpace(string(msg)), "error: ")
+}
+
+func cmdTrace(args []string) {
+	usage := "usage: bb trace start [--categories a,b] | bb trace stop [file.json] | bb trace status"
+	if len(args) == 0 {
+		fatalUsage("%s", usage)
+	}
+	switch args[0] {
+	case "start":
+		categories := traceCategories
+		if len(args) == 3 && args[1] == "--categories" {
+			categories = strings.Split(args[2], ",")
+		} else if len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		traceStart(categories)
+	case "stop":
+		if len(args) > 2 {
+			fatalUsage("%s", usage)
+		}
+		file := ""
+		if len(args) == 2 {
+			file = args[1]
+		}
+		traceStop(file)
+	case "status":
+		s, err := loadState()
+		if err != nil || s.Trace == nil {
+			fmt.Println("No trace recording")
+			return
+		}
+		fmt.Printf("Recording a trace since %s\n", s.Trace.Started)
+	case "__record":
+		traceRecord(args[1:])
+	default:
+		fatalUsage("%s", usage)
+	}
+}
+
+func traceStart(categories []string) {
+	s, _ := ensureBrowser()
+	if s.Trace != nil && syscall.Kill(s.Trace.PID, 0) == nil {
+		fatal("a trace is already recording; bb trace stop first")
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		fatal("failed to find the bb binary: %v", err)
+	}
+	logFile, err := os.Create(traceLogPath())
+	if err != nil {
+		fatal("failed to create %s: %v", traceLogPath(), err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(bin, "trace", "__record", strings.Join(categories, ","))
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fatal("failed to start the recorder: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		fatal("failed to start the recorder: %v", err)
+	}
+	// The recorder reports once tracing runs, so the next command is traced
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	if strings.TrimSpace(line) != "ready" {
+		_ = cmd.Process.Kill()
+		fatal("failed to start tracing: %s", traceLogError())
+	}
+	_ = cmd.Process.Release()
+
+	s.Trace = &TraceRecording{PID: cmd.Process.Pid, Started: time.Now().Format(time.RFC3339)}
+	if err := saveState(s); err != nil {
+		fatal("failed to save state: %v", err)
+	}
+	fmt.Println("Tracing started; bb trace stop [file.json] saves it")
+}
+
+func traceStop(file string) {
+	s, err := loadState()
+	if errors.Is(err, errNoPassphrase) {
+		fatal("%s: %v", statePath(), err)
+	}
+	if err != nil || s.Trace == nil {
+		fatal("no trace recording; start one with bb trace start")
+	}
+	if file == "" {
+		file = nextAvailableFile(filepath.Join(outputDir(), "trace"), ".json")
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	_ = os.Remove(file)
+
+	// The recorder reads the destination from the state once signalled
+	pid := s.Trace.PID
+	s.Trace.Out = file
+	if err := saveState(s); err != nil {
+		fatal("failed to save state: %v", err)
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err == nil {
+		waitForExit(pid, 60*time.Second)
+	}
+	s.Trace = nil
+	if err := saveState(s); err != nil {
+		fatal("failed to save state: %v", err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		msg := traceLogError()
+		if msg == "" {
+			msg = "the recorder is gone (was the browser stopped?)"
+		}
+		fatal("failed to save the trace: %s", msg)
+	}
+	recordArtifact("trace", file)
+	fmt.Printf("Saved trace to %s (%d KB); open it in chrome://tracing or ui.perfetto.dev\n", file, info.Size()/1024)
+}
+
+// traceRecord runs in the detached recorder: it starts browser-wide tracing,
+// waits for bb trace stop, and writes the trace where the state says
+func traceRecord(args []string) {
+	if len(args) != 1 {
+		fatalUsage("usage: bb trace __record <categories>")
+	}
+	s, err := loadState()
+	if err != nil {
+		fatal("no browser session: %v", err)
+	}
+	browser := rod.New().ControlURL(s.DebugURL)
+	if err := browser.Connect(); err != nil {
+		fatal("failed to connect to the browser: %v", err)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	err = proto.TracingStart{
+		TransferMode: proto.TracingStartTransferModeReturnAsStream,
+		TraceConfig: &proto.TracingTraceConfig{
+			IncludedCategories: strings.Split(args[0], ","),
+			ExcludedCategories: []string{"*"},
+		},
+	}.Call(browser)
+	if err != nil {
+		fatal("%v", err)
+	}
+	fmt.Println("ready")
+
+	// Stop on request, or give up when the browser goes away
+	for alive := true; alive; {
+		select {
+		case <-stop:
+			alive = false
+		case <-time.After(2 * time.Second):
+			if _, err := browser.Pages(); err != nil {
+				fatal("lost the browser: %v", err)
+			}
+		}
+	}
+
+	var done proto.TracingTracingComplete
+	wait := browser.WaitEvent(&done)
+	if err := (proto.TracingEnd{}).Call(browser); err != nil {
+		fatal("failed to end tracing: %v", err)
+	}
+	wait()
+	if s, err = loadState(); err != nil || s.Trace == nil || s.Trace.Out == "" {
+		fatal("no destination for the trace in the state")
+	}
+	f, err := os.Create(s.Trace.Out)
+	if err != nil {
+		fatal("failed to create %s: %v", s.Trace.Out, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, rod.NewStreamReader(browser, done.Stream)); err != nil {
+		_ = os.Remove(s.Trace.Out)
+		fatal("failed to read the trace: %v", err)
+	}
+}
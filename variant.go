@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// variantScore rates how well the loaded page extracts: the length of its
+// readable text, or zero behind a paywall or login wall
+func variantScore(page *rod.Page) int {
+	info, err := page.Info()
+	if err != nil {
+		return 0
+	}
+	_, content, _ := readableContent(page, info.URL, info.Title, extractOptions{})
+	if detectWall(page, content) != "" {
+		return 0
+	}
+	return len([]rune(strings.TrimSpace(content)))
+}
+
+// preferVariant follows the page's rel=amphtml or rel=canonical link and
+// stays on whichever version extracts more text
+func preferVariant(page *rod.Page, rel string, waitStable bool) {
+	res, err := page.Eval(`(rel) => {
+		const l = Array.from(document.querySelectorAll('link[href]'))
+			.find(l => (l.getAttribute('rel') || '').toLowerCase().split(/\s+/).includes(rel));
+		return l ? new URL(l.getAttribute('href'), document.baseURI).href : '';
+	}`, rel)
+	if err != nil || res.Value.Str() == "" {
+		fmt.Fprintf(os.Stderr, "[no rel=%s link, staying on this page]\n", rel)
+		return
+	}
+	target := res.Value.Str()
+	info, err := page.Info()
+	if err != nil {
+		return
+	}
+	original := info.URL
+	if strings.SplitN(target, "#", 2)[0] == strings.SplitN(original, "#", 2)[0] {
+		return
+	}
+
+	before := variantScore(page)
+	if err := page.Navigate(target); err != nil {
+		fmt.Fprintf(os.Stderr, "[failed to open %s variant: %v]\n", rel, err)
+		return
+	}
+	page.MustWaitLoad()
+	if waitStable {
+		page.MustWaitStable()
+	}
+	after := variantScore(page)
+	if after > before {
+		fmt.Fprintf(os.Stderr, "[using %s version: %s]\n", rel, target)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "[%s version extracts less, staying on %s]\n", rel, original)
+	if err := page.Navigate(original); err != nil {
+		fatal("navigation failed: %v", err)
+	}
+	page.MustWaitLoad()
+	if waitStable {
+		page.MustWaitStable()
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// virtualItemsJS reads the items currently mounted in the container. The
+// key identifies an item across re-renders: an index or key attribute the
+// list library sets, else its text.
+const virtualItemsJS = `function(item, html) {
+	const keyAttrs = ['data-index', 'data-item-index', 'aria-rowindex', 'aria-posinset', 'data-key', 'data-id'];
+	return [...this.querySelectorAll(item)].map(el => {
+		const attr = keyAttrs.find(a => el.hasAttribute(a));
+		const text = el.innerText.trim();
+		return {key: attr ? attr + '=' + el.getAttribute(attr) : 'text=' + text, text, html: html ? el.outerHTML : ''};
+	});
+}`
+
+type virtualItem struct {
+	Key  string `json:"key"`
+	Text string `json:"text"`
+	HTML string `json:"html,omitempty"`
+}
+
+func cmdVirtualScrape(args []string, flags globalFlags) {
+	usage := "usage: bb virtual-scrape <container> --item <selector> [--until-count N] [--max-scrolls N] [--html]"
+	container, item := "", ""
+	untilCount, maxScrolls, html := 0, 500, false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--item", "--until-count", "--max-scrolls":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			if args[i] == "--item" {
+				item = args[i+1]
+			} else {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					fatalUsage("invalid %s: %s", args[i], args[i+1])
+				}
+				if args[i] == "--until-count" {
+					untilCount = n
+				} else {
+					maxScrolls = n
+				}
+			}
+			i++
+		case "--html":
+			html = true
+		default:
+			if container != "" || strings.HasPrefix(args[i], "--") {
+				fatalUsage("%s", usage)
+			}
+			container = args[i]
+		}
+	}
+	if container == "" || item == "" {
+		fatalUsage("%s", usage)
+	}
+
+	_, _, page := withPage()
+	el, err := page.Element(container)
+	if err != nil {
+		fatalNotFound(container, nil)
+	}
+
+	// Items unmount as they leave the view, so each position is read as it
+	// renders. At the bottom, infinite lists get a moment to load more.
+	var items []virtualItem
+	seen := map[string]bool{}
+	collect := func() {
+		res, err := el.Evaluate(rod.Eval(virtualItemsJS, item, html))
+		if err != nil {
+			fatal("failed to read the items: %v", err)
+		}
+		var mounted []virtualItem
+		if err := res.Value.Unmarshal(&mounted); err != nil {
+			fatal("failed to read the items: %v", err)
+		}
+		for _, it := range mounted {
+			if !seen[it.Key] {
+				seen[it.Key] = true
+				items = append(items, it)
+			}
+		}
+	}
+	done := func() bool { return untilCount > 0 && len(items) >= untilCount }
+
+	prev, _ := scrollBox(el, nil, 0)
+	collect()
+	for scrolls := 0; !done() && scrolls < maxScrolls; scrolls++ {
+		top, _ := scrollBox(el, nil, 0.8)
+		time.Sleep(150 * time.Millisecond)
+		collect()
+		if top > prev {
+			prev = top
+			continue
+		}
+		grew := false
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline) && !done(); {
+			time.Sleep(250 * time.Millisecond)
+			if _, bottom := scrollBox(el, nil, 0); bottom > top {
+				grew = true
+				break
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+	if untilCount > 0 && len(items) > untilCount {
+		items = items[:untilCount]
+	}
+	if untilCount > 0 && len(items) < untilCount {
+		fmt.Fprintf(os.Stderr, "warning: the list ended after %d of %d items\n", len(items), untilCount)
+	}
+
+	if flags.jsonOutput {
+		if items == nil {
+			items = []virtualItem{}
+		}
+		out, _ := json.MarshalIndent(items, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	for i, it := range items {
+		fmt.Printf("[%d] %s\n", i+1, strings.Join(strings.Fields(it.Text), " "))
+	}
+	fmt.Printf("(%d items)\n", len(items))
+}
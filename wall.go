@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/go-rod/rod"
+)
+
+// detectWallJS looks for the markers of a paywall or login wall: schema.org
+// isAccessibleForFree=false, paywall vendor overlays (Piano, Tinypass,
+// Poool, ...), visible "subscribe/sign in to continue" prompts and login
+// forms standing in for the content. It returns "paywall", "login" or "".
+const detectWallJS = `(contentLength) => {
+	const visible = el => {
+		const r = el.getBoundingClientRect();
+		const st = getComputedStyle(el);
+		return r.width > 0 && r.height > 0 && st.visibility !== 'hidden' && st.display !== 'none';
+	};
+	const walk = (v, fn) => {
+		if (Array.isArray(v)) return v.some(x => walk(x, fn));
+		if (v && typeof v === 'object') return fn(v) || Object.values(v).some(x => walk(x, fn));
+		return false;
+	};
+
+	for (const s of document.querySelectorAll('script[type="application/ld+json"]')) {
+		try {
+			const data = JSON.parse(s.textContent);
+			if (walk(data, o => o.isAccessibleForFree === false || String(o.isAccessibleForFree).toLowerCase() === 'false')) return 'paywall';
+		} catch (e) {}
+	}
+
+	const paywallSelector = '[class*=paywall i], [id*=paywall i], [class*=regwall i], [id*=regwall i], ' +
+		'[class*=subscriber-only i], [class*=premium-wall i], .tp-modal, .tp-container-inner, #piano-offer, [id^=poool], [class*=meter-wall i]';
+	if (Array.from(document.querySelectorAll(paywallSelector)).some(visible)) return 'paywall';
+
+	const text = (document.body?.innerText || '').toLowerCase();
+	const paywallPhrases = ['subscribe to continue', 'subscribe to read', 'subscribers only', 'for subscribers',
+		'already a subscriber', 'to continue reading', 'unlock this article', 'become a member to read',
+		'you have reached your limit', 'free articles remaining', 'start your free trial to'];
+	const loginPhrases = ['sign in to continue', 'log in to continue', 'login to continue', 'sign in to read',
+		'log in to read', 'you must be logged in', 'you need to sign in', 'please log in', 'please sign in',
+		'login required', 'create a free account to'];
+	// A short page is mostly the wall itself; on a long one these phrases are
+	// just as likely to be a footer or sidebar
+	const short = contentLength < 2000;
+	if (short && paywallPhrases.some(p => text.includes(p))) return 'paywall';
+	if (short && loginPhrases.some(p => text.includes(p))) return 'login';
+
+	const password = Array.from(document.querySelectorAll('input[type=password]')).some(visible);
+	if (password && (short || /\/(login|signin|sign-in|auth)\b/i.test(location.pathname))) return 'login';
+	return '';
+}`
+
+// detectWall reports whether page is a paywall or login wall, using the length
+// of the extracted content to tell a wall from a full article that merely
+// mentions subscribing
+func detectWall(page *rod.Page, content string) string {
+	res, err := page.Eval(detectWallJS, len([]rune(content)))
+	if err != nil {
+		return ""
+	}
+	return res.Value.Str()
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// WSRecording is a WebSocket capture bb ws start left running. The Network
+// domain only reports frames while a CDP connection listens, so a detached
+// recorder holds one and appends what it sees to wsLogPath.
+type WSRecording struct {
+	PID      int    `json:"pid"`
+	Started  string `json:"started"`
+	TargetID string `json:"target_id"`
+}
+
+// wsEvent is one line of the capture: a socket opening or closing, or a frame
+type wsEvent struct {
+	Time   string `json:"time"`
+	Type   string `json:"type"` // open, sent, received, error, closed
+	Socket string `json:"socket"`
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status,omitempty"` // of the handshake
+	Opcode int    `json:"opcode,omitempty"` // 1 text, 2 binary (base64 data)
+	Data   string `json:"data,omitempty"`
+}
+
+func wsLogPath() string {
+	return filepath.Join(stateDir(), "ws.jsonl")
+}
+
+func wsErrPath() string {
+	return filepath.Join(stateDir(), "ws.log")
+}
+
+func cmdWS(args []string, flags globalFlags) {
+	usage := "usage: bb ws start | bb ws stop | bb ws list | bb ws messages [--url substr] [--tail N] [--follow]"
+	if len(args) == 0 {
+		fatalUsage("%s", usage)
+	}
+	switch args[0] {
+	case "start":
+		if len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		wsStart()
+	case "stop":
+		if len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		s, err := loadState()
+		if err != nil || s.WS == nil {
+			fatal("not recording WebSockets; start with bb ws start")
+		}
+		if err := syscall.Kill(s.WS.PID, syscall.SIGTERM); err == nil {
+			waitForExit(s.WS.PID, 10*time.Second)
+		}
+		s.WS = nil
+		if err := saveState(s); err != nil {
+			fatal("failed to save state: %v", err)
+		}
+		fmt.Println("Stopped recording WebSockets; bb ws list and bb ws messages still show the capture")
+	case "list":
+		if len(args) != 1 {
+			fatalUsage("%s", usage)
+		}
+		wsList(flags)
+	case "messages":
+		wsMessages(args[1:], usage, flags)
+	case "__record":
+		if len(args) != 2 {
+			fatalUsage("usage: bb ws __record <target>")
+		}
+		wsRecord(proto.TargetTargetID(args[1]))
+	default:
+		fatalUsage("%s", usage)
+	}
+}
+
+// wsRecording returns the running recording, if any
+func wsRecording() *WSRecording {
+	s, err := loadState()
+	if err != nil || s.WS == nil || syscall.Kill(s.WS.PID, 0) != nil {
+		return nil
+	}
+	return s.WS
+}
+
+func wsStart() {
+	if wsRecording() != nil {
+		fatal("already recording WebSockets; bb ws stop first")
+	}
+	s, _, page := withPage()
+	bin, err := os.Executable()
+	if err != nil {
+		fatal("failed to find the bb binary: %v", err)
+	}
+	if err := os.WriteFile(wsLogPath(), nil, 0600); err != nil {
+		fatal("failed to create %s: %v", wsLogPath(), err)
+	}
+	errFile, err := os.Create(wsErrPath())
+	if err != nil {
+		fatal("failed to create %s: %v", wsErrPath(), err)
+	}
+	defer errFile.Close()
+
+	cmd := exec.Command(bin, "ws", "__record", string(page.TargetID))
+	cmd.Stderr = errFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fatal("failed to start the recorder: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		fatal("failed to start the recorder: %v", err)
+	}
+	// Frames are only captured once the recorder listens
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	if strings.TrimSpace(line) != "ready" {
+		_ = cmd.Process.Kill()
+		msg, _ := os.ReadFile(wsErrPath())
+		fatal("failed to start recording: %s", strings.TrimPrefix(strings.TrimSpace(string(msg)), "error: "))
+	}
+	_ = cmd.Process.Release()
+
+	s.WS = &WSRecording{PID: cmd.Process.Pid, Started: time.Now().Format(time.RFC3339), TargetID: string(page.TargetID)}
+	if err := saveState(s); err != nil {
+		fatal("failed to save state: %v", err)
+	}
+	fmt.Println("Recording WebSockets of the active page; sockets opened from now on are captured (reload for ones already open)")
+}
+
+// wsRecord runs in the detached recorder: it appends the page's WebSocket
+// traffic to the log until bb ws stop signals it or the page goes away
+func wsRecord(target proto.TargetTargetID) {
+	s, err := loadState()
+	if err != nil {
+		fatal("no browser session: %v", err)
+	}
+	browser := rod.New().ControlURL(s.DebugURL)
+	if err := browser.Connect(); err != nil {
+		fatal("failed to connect to the browser: %v", err)
+	}
+	page, err := browser.PageFromTarget(target)
+	if err != nil {
+		fatal("failed to attach to the page: %v", err)
+	}
+	log, err := os.OpenFile(wsLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fatal("failed to open %s: %v", wsLogPath(), err)
+	}
+	defer log.Close()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	var mu sync.Mutex
+	write := func(e wsEvent) {
+		e.Time = time.Now().Format(time.RFC3339Nano)
+		data, _ := json.Marshal(e)
+		mu.Lock()
+		defer mu.Unlock()
+		// Frames can carry tokens and messages, so they are encrypted like
+		// the rest of the session
+		line, err := sealLine(data)
+		if err != nil {
+			return
+		}
+		_, _ = log.Write(append(line, '\n'))
+	}
+	frame := func(kind string, id proto.NetworkRequestID, f *proto.NetworkWebSocketFrame) {
+		write(wsEvent{Type: kind, Socket: string(id), Opcode: int(f.Opcode), Data: f.PayloadData})
+	}
+	urls := map[proto.NetworkRequestID]string{}
+	p, cancel := page.WithCancel()
+	defer cancel()
+	wait := p.EachEvent(
+		func(e *proto.NetworkWebSocketCreated) {
+			urls[e.RequestID] = e.URL
+		},
+		func(e *proto.NetworkWebSocketHandshakeResponseReceived) {
+			write(wsEvent{Type: "open", Socket: string(e.RequestID), URL: urls[e.RequestID], Status: e.Response.Status})
+		},
+		func(e *proto.NetworkWebSocketFrameSent) { frame("sent", e.RequestID, e.Response) },
+		func(e *proto.NetworkWebSocketFrameReceived) { frame("received", e.RequestID, e.Response) },
+		func(e *proto.NetworkWebSocketFrameError) {
+			write(wsEvent{Type: "error", Socket: string(e.RequestID), Data: e.ErrorMessage})
+		},
+		func(e *proto.NetworkWebSocketClosed) {
+			write(wsEvent{Type: "closed", Socket: string(e.RequestID)})
+		},
+	)
+	go wait()
+	if err := (proto.NetworkEnable{}).Call(page); err != nil {
+		fatal("failed to listen for WebSockets: %v", err)
+	}
+	fmt.Println("ready")
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(2 * time.Second):
+			if _, err := page.Info(); err != nil {
+				fatal("lost the page: %v", err)
+			}
+		}
+	}
+}
+
+// readWSLog returns the captured events, the offset after the last complete
+// line and whether there is a capture at all
+func readWSLog(offset int64) ([]wsEvent, int64, bool) {
+	f, err := os.Open(wsLogPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, false
+	} else if err != nil {
+		fatal("failed to read %s: %v", wsLogPath(), err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, 0); err != nil {
+		fatal("failed to read %s: %v", wsLogPath(), err)
+	}
+	var events []wsEvent
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// A partial line is read again once the recorder finishes it
+			break
+		}
+		offset += int64(len(line))
+		data, err := openLine(bytes.TrimSpace(line))
+		if err != nil {
+			fatal("failed to read %s: %v", wsLogPath(), err)
+		}
+		var e wsEvent
+		if json.Unmarshal(data, &e) == nil {
+			events = append(events, e)
+		}
+	}
+	return events, offset, true
+}
+
+// wsSocket summarizes one socket for bb ws list
+type wsSocket struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	Status   int    `json:"status,omitempty"`
+	Opened   string `json:"opened"`
+	Closed   string `json:"closed,omitempty"`
+	Sent     int    `json:"sent"`
+	Received int    `json:"received"`
+	Errors   int    `json:"errors,omitempty"`
+}
+
+func wsList(flags globalFlags) {
+	events, _, ok := readWSLog(0)
+	if !ok {
+		fatal("no WebSocket capture; start one with bb ws start")
+	}
+	sockets := []*wsSocket{}
+	byID := map[string]*wsSocket{}
+	for _, e := range events {
+		sock := byID[e.Socket]
+		if sock == nil {
+			sock = &wsSocket{ID: e.Socket, URL: e.URL, Opened: e.Time}
+			byID[e.Socket] = sock
+			sockets = append(sockets, sock)
+		}
+		switch e.Type {
+		case "open":
+			sock.URL, sock.Status = e.URL, e.Status
+		case "sent":
+			sock.Sent++
+		case "received":
+			sock.Received++
+		case "error":
+			sock.Errors++
+		case "closed":
+			sock.Closed = e.Time
+		}
+	}
+	if flags.jsonOutput {
+		out, _ := json.MarshalIndent(sockets, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	if len(sockets) == 0 {
+		fmt.Println("No WebSockets captured")
+		return
+	}
+	for i, sock := range sockets {
+		state := "open"
+		if sock.Closed != "" {
+			state = "closed"
+		}
+		line := fmt.Sprintf("[%d] %s (%s) sent %d, received %d", i+1, sock.URL, state, sock.Sent, sock.Received)
+		if sock.Errors > 0 {
+			line += fmt.Sprintf(", %d errors", sock.Errors)
+		}
+		fmt.Println(line)
+	}
+}
+
+// wsFollowing reports whether args stream messages as they arrive, which
+// prints JSON lines as it goes instead of one envelope
+func wsFollowing(args []string) bool {
+	if len(args) == 0 || args[0] != "messages" {
+		return false
+	}
+	for _, a := range args[1:] {
+		if a == "--follow" {
+			return true
+		}
+	}
+	return false
+}
+
+func wsMessages(args []string, usage string, flags globalFlags) {
+	filter, tail, follow := "", 0, false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--url", "--tail":
+			if i+1 >= len(args) {
+				fatalUsage("missing value for %s", args[i])
+			}
+			if args[i] == "--url" {
+				filter = args[i+1]
+			} else {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					fatalUsage("invalid --tail: %s", args[i+1])
+				}
+				tail = n
+			}
+			i++
+		case "--follow":
+			follow = true
+		default:
+			fatalUsage("%s", usage)
+		}
+	}
+	if follow && wsRecording() == nil {
+		fatal("not recording WebSockets; start with bb ws start")
+	}
+
+	// Frames carry only their socket's id; the URL comes from its open event
+	urls := map[string]string{}
+	pick := func(events []wsEvent) []wsEvent {
+		var frames []wsEvent
+		for _, e := range events {
+			if e.Type == "open" {
+				urls[e.Socket] = e.URL
+				continue
+			}
+			e.URL = urls[e.Socket]
+			if e.Type != "closed" && strings.Contains(e.URL, filter) {
+				frames = append(frames, e)
+			}
+		}
+		return frames
+	}
+	show := func(frames []wsEvent) {
+		for _, e := range frames {
+			if flags.jsonOutput {
+				data, _ := json.Marshal(e)
+				fmt.Println(string(data))
+				continue
+			}
+			arrow := map[string]string{"sent": "->", "received": "<-", "error": "!!"}[e.Type]
+			data := e.Data
+			if e.Opcode == 2 {
+				data = "(binary, base64) " + data
+			}
+			fmt.Printf("%s %s %s %s\n", e.Time, arrow, e.URL, data)
+		}
+	}
+
+	events, offset, ok := readWSLog(0)
+	if !ok {
+		fatal("no WebSocket capture; start one with bb ws start")
+	}
+	frames := pick(events)
+	if tail > 0 && len(frames) > tail {
+		frames = frames[len(frames)-tail:]
+	}
+	if !flags.jsonOutput || follow {
+		show(frames)
+	} else {
+		// Without --follow, --json is one array like other listings
+		if frames == nil {
+			frames = []wsEvent{}
+		}
+		out, _ := json.MarshalIndent(frames, "", "  ")
+		fmt.Println(string(out))
+	}
+	if !follow {
+		return
+	}
+
+	// Follow the log as the recorder appends, until interrupted or the
+	// recording ends
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+		events, offset, _ = readWSLog(offset)
+		show(pick(events))
+		if len(events) == 0 && wsRecording() == nil {
+			return
+		}
+	}
+}